@@ -0,0 +1,565 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/optiflow-os/tracelens-cli/cmd/configconvert"
+	"github.com/optiflow-os/tracelens-cli/cmd/configread"
+	"github.com/optiflow-os/tracelens-cli/cmd/configvalidate"
+	"github.com/optiflow-os/tracelens-cli/cmd/configwrite"
+	"github.com/optiflow-os/tracelens-cli/cmd/doctor"
+	"github.com/optiflow-os/tracelens-cli/cmd/fileexperts"
+	cmdheartbeat "github.com/optiflow-os/tracelens-cli/cmd/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/cmd/offlinecount"
+	"github.com/optiflow-os/tracelens-cli/cmd/offlinedeadletter"
+	"github.com/optiflow-os/tracelens-cli/cmd/offlineexport"
+	"github.com/optiflow-os/tracelens-cli/cmd/offlineimport"
+	"github.com/optiflow-os/tracelens-cli/cmd/offlineprint"
+	"github.com/optiflow-os/tracelens-cli/cmd/offlinesync"
+	"github.com/optiflow-os/tracelens-cli/cmd/shellinit"
+	"github.com/optiflow-os/tracelens-cli/cmd/today"
+	"github.com/optiflow-os/tracelens-cli/cmd/todaygoal"
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// command represents a command, which can be invoked as subcommand or via
+// its top-level flag on the root command.
+type command struct {
+	// Name is the name of the command used in logs.
+	Name string
+	// Flag is the top-level flag selecting the command on the root command.
+	Flag string
+	// Run is the function executing the command.
+	Run cmdFn
+	// WithOfflineSync enables syncing offline activity after a successful run.
+	WithOfflineSync bool
+	// Forward optionally forwards the command to a running daemon. If it
+	// returns false, the command is run in-process.
+	Forward func(ctx context.Context, v *viper.Viper) (bool, int, error)
+}
+
+// nolint:gochecknoglobals
+var (
+	configConvertCommand  = command{Name: "config convert", Run: configconvert.Run}
+	configReadCommand     = command{Name: "config get", Flag: "config-read", Run: configread.Run}
+	configValidateCommand = command{Name: "config validate", Run: configvalidate.Run}
+	configWriteCommand    = command{Name: "config set", Flag: "config-write", Run: configwrite.Run}
+	daemonCommand         = command{Name: "daemon", Run: cmdheartbeat.RunDaemon}
+	doctorCommand         = command{Name: "doctor", Run: doctor.Run}
+	explainCommand        = command{Name: "heartbeat dry-run", Flag: "dry-run", Run: cmdheartbeat.RunExplain}
+	fileExpertsCommand    = command{Name: "file-experts", Flag: "file-experts", Run: fileexperts.Run}
+	heartbeatCommand      = command{
+		Name:            "heartbeat",
+		Flag:            "entity",
+		Run:             cmdheartbeat.Run,
+		WithOfflineSync: true,
+		Forward:         cmdheartbeat.Forward,
+	}
+	offlineCountCommand            = command{Name: "offline count", Flag: "offline-count", Run: offlinecount.Run}
+	offlineDeadLettersListCommand  = command{Name: "offline dead-letters list", Run: offlinedeadletter.RunList}
+	offlineDeadLettersPurgeCommand = command{Name: "offline dead-letters purge", Run: offlinedeadletter.RunPurge}
+	offlineDeadLettersRetryCommand = command{
+		Name:            "offline dead-letters retry",
+		Run:             offlinedeadletter.RunRetry,
+		WithOfflineSync: true,
+	}
+	offlineExportCommand = command{Name: "offline export", Run: offlineexport.Run}
+	offlineImportCommand = command{Name: "offline import", Run: offlineimport.Run}
+	offlinePrintCommand  = command{Name: "offline print", Flag: "print-offline-heartbeats", Run: offlineprint.Run}
+	offlineSyncCommand   = command{
+		Name: "offline sync",
+		Flag: "sync-offline-activity",
+		Run:  offlinesync.RunWithoutRateLimiting,
+	}
+	serveCommand     = command{Name: "serve", Run: cmdheartbeat.RunServe}
+	shellInitCommand = command{Name: "shell-init", Run: shellinit.Run}
+	todayCommand     = command{Name: "today", Flag: "today", Run: today.Run}
+	todayGoalCommand = command{Name: "goal", Flag: "today-goal", Run: todaygoal.Run}
+	versionCommand   = command{Name: "version", Flag: "version", Run: runVersion}
+)
+
+// legacyCommands are the commands selectable via top-level flags on the root
+// command. If more than one of their flags is set, the first one in this list wins.
+// nolint:gochecknoglobals
+var legacyCommands = []command{
+	versionCommand,
+	configReadCommand,
+	configWriteCommand,
+	todayCommand,
+	todayGoalCommand,
+	fileExpertsCommand,
+	explainCommand,
+	heartbeatCommand,
+	offlineSyncCommand,
+	offlineCountCommand,
+	offlinePrintCommand,
+}
+
+// run executes the command function. Heartbeats are forwarded to a running
+// daemon first, before setting up in-process handling.
+func (c command) run(ctx context.Context, v *viper.Viper) error {
+	logger := log.Extract(ctx)
+	logger.Debugf("command: %s", c.Name)
+
+	if c.Forward != nil {
+		var forwarded bool
+
+		err := RunCmd(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(),
+			func(ctx context.Context, v *viper.Viper) (int, error) {
+				var (
+					code int
+					err  error
+				)
+
+				forwarded, code, err = c.Forward(ctx, v)
+
+				return code, err
+			})
+		if forwarded {
+			return err
+		}
+	}
+
+	registerLexers(ctx)
+
+	if c.WithOfflineSync {
+		return RunCmdWithOfflineSync(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(), c.Run)
+	}
+
+	return RunCmd(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(), c.Run)
+}
+
+func newHeartbeatCmd(v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "heartbeat",
+		Short: "Sends a heartbeat for the given entity to the api.",
+		Long: "Sends a heartbeat for the given entity to the api, including extra heartbeats" +
+			" from STDIN if requested. Afterwards, queued offline heartbeats are synced. With --output json," +
+			" prints whether each heartbeat was sent, queued, filtered or rejected and why.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			// shell-init hooks pass the command line on stdin instead of --entity
+			if shellHook, _ := cmd.Flags().GetBool("shell-hook"); !shellHook && !cmd.Flags().Changed("entity") {
+				return errors.New(`required flag(s) "entity" not set`)
+			}
+
+			c := heartbeatCommand
+			if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+				c = explainCommand
+			}
+
+			exit(runCommand(cmd, v, c))
+
+			return nil
+		},
+	}
+
+	setEntityFlags(cmd.Flags())
+	setHeartbeatFlags(cmd.Flags())
+
+	return cmd
+}
+
+func newTodayCmd(v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "today",
+		Short: "Prints dashboard time for today.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_ = v.BindPFlag("today-hide-categories", cmd.Flags().Lookup("hide-categories"))
+
+			exit(runCommand(cmd, v, todayCommand))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().String("hide-categories", "", "Show total code time today without categories. Defaults to false.")
+
+	return cmd
+}
+
+func newGoalCmd(v *viper.Viper) *cobra.Command {
+	return &cobra.Command{
+		Use:   "goal <goal-id>",
+		Short: "Prints time for the given goal id today.",
+		Long: "Prints time for the given goal id today." +
+			" Visit wakatime.com/api/v1/users/current/goals to find your goal id.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v.Set("today-goal", args[0])
+
+			exit(runCommand(cmd, v, todayGoalCommand))
+
+			return nil
+		},
+	}
+}
+
+func newConfigCmd(v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Reads or writes config values.",
+	}
+
+	getCmd := &cobra.Command{
+		Use:   "get <key>",
+		Short: "Prints value for the given config key.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_ = v.BindPFlag("config-section", cmd.Flags().Lookup("section"))
+
+			v.Set("config-read", args[0])
+
+			exit(runCommand(cmd, v, configReadCommand))
+
+			return nil
+		},
+	}
+
+	setCmd := &cobra.Command{
+		Use:   "set <key> <value> [<key> <value>...]",
+		Short: "Writes values to the given config keys.",
+		Args: func(_ *cobra.Command, args []string) error {
+			if len(args) == 0 || len(args)%2 != 0 {
+				return errors.New("expects pairs of key and value")
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_ = v.BindPFlag("config-section", cmd.Flags().Lookup("section"))
+
+			kv := map[string]string{}
+			for i := 0; i < len(args); i += 2 {
+				kv[args[i]] = args[i+1]
+			}
+
+			v.Set("config-write", kv)
+
+			exit(runCommand(cmd, v, configWriteCommand))
+
+			return nil
+		},
+	}
+
+	for _, c := range []*cobra.Command{getCmd, setCmd} {
+		c.Flags().String("section", defaultConfigSection, "Config section of the key. Defaults to [settings].")
+	}
+
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validates the config files.",
+		Long: "Validates the config files and reports unknown sections and keys, values of the wrong type" +
+			" and regex patterns, which don't compile, with their file and line. Set strict_config = true" +
+			" in [settings] to refuse running with an invalid config.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			exit(runCommand(cmd, v, configValidateCommand))
+
+			return nil
+		},
+	}
+
+	convertCmd := &cobra.Command{
+		Use:   "convert",
+		Short: "Converts the config file into another format.",
+		Long: "Converts the config file into ini, toml or yaml format. The converted file is written next to" +
+			" the config file as .wakatime.cfg, .tracelens.toml or .tracelens.yaml, unless --file is given." +
+			" Existing files are never overwritten.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_ = v.BindPFlag("config-convert-format", cmd.Flags().Lookup("format"))
+			_ = v.BindPFlag("config-convert-file", cmd.Flags().Lookup("file"))
+
+			exit(runCommand(cmd, v, configConvertCommand))
+
+			return nil
+		},
+	}
+
+	convertCmd.Flags().String("format", "", "Format to convert the config file into. Can be \"ini\", \"toml\" or \"yaml\".")
+	convertCmd.Flags().String("file", "", "Optional file to write the converted config to.")
+	_ = convertCmd.MarkFlagRequired("format")
+
+	cmd.AddCommand(getCmd, setCmd, validateCmd, convertCmd)
+
+	return cmd
+}
+
+func newOfflineCmd(v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "offline",
+		Short: "Manages heartbeats queued in the offline db.",
+	}
+
+	countCmd := &cobra.Command{
+		Use:   "count",
+		Short: "Prints the number of heartbeats in the offline db.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			exit(runCommand(cmd, v, offlineCountCommand))
+
+			return nil
+		},
+	}
+
+	printCmd := &cobra.Command{
+		Use:   "print",
+		Short: "Prints heartbeats in the offline db.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_ = v.BindPFlag("print-offline-heartbeats", cmd.Flags().Lookup("limit"))
+
+			exit(runCommand(cmd, v, offlinePrintCommand))
+
+			return nil
+		},
+	}
+
+	printCmd.Flags().Int("limit", offline.PrintMaxDefault, "Maximum number of heartbeats to print.")
+
+	syncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Sends heartbeats in the offline db to the api.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_ = v.BindPFlag("sync-offline-activity", cmd.Flags().Lookup("limit"))
+
+			exit(runCommand(cmd, v, offlineSyncCommand))
+
+			return nil
+		},
+	}
+
+	syncCmd.Flags().Int(
+		"limit",
+		offline.SyncMaxDefault,
+		fmt.Sprintf("Maximum number of heartbeats to sync. Defaults to %d. Zero syncs all offline heartbeats.",
+			offline.SyncMaxDefault),
+	)
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Exports heartbeats in the offline db to a ndjson file.",
+		Long: "Exports all heartbeats in the offline db to a new ndjson file, one heartbeat per line," +
+			" including the api key fingerprint and api url needed to sync them later. The file is not" +
+			" encrypted. With --delete, exported heartbeats are removed from the offline db.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_ = v.BindPFlag("offline-export-file", cmd.Flags().Lookup("file"))
+			_ = v.BindPFlag("offline-export-delete", cmd.Flags().Lookup("delete"))
+
+			exit(runCommand(cmd, v, offlineExportCommand))
+
+			return nil
+		},
+	}
+
+	exportCmd.Flags().String("file", "", "Ndjson file to export the heartbeats to. Must not exist yet.")
+	exportCmd.Flags().Bool("delete", false, "Deletes the exported heartbeats from the offline db.")
+	_ = exportCmd.MarkFlagRequired("file")
+
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Imports heartbeats from a ndjson file into the offline db.",
+		Long: "Imports heartbeats exported with offline export into the offline db. Lines are validated" +
+			" like extra heartbeats and invalid lines are skipped. Heartbeats with an api key or api url" +
+			" not found in the config are skipped as invalid. Heartbeats already in the offline db" +
+			" are skipped as duplicates.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_ = v.BindPFlag("offline-import-file", cmd.Flags().Lookup("file"))
+
+			exit(runCommand(cmd, v, offlineImportCommand))
+
+			return nil
+		},
+	}
+
+	importCmd.Flags().String("file", "", "Ndjson file to import the heartbeats from.")
+	_ = importCmd.MarkFlagRequired("file")
+
+	cmd.AddCommand(countCmd, newOfflineDeadLettersCmd(v), exportCmd, importCmd, printCmd, syncCmd)
+
+	return cmd
+}
+
+func newOfflineDeadLettersCmd(v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dead-letters",
+		Short: "Manages heartbeats rejected by the api.",
+		Long: fmt.Sprintf("Heartbeats rejected by the api as invalid are not deleted, but stored as dead letters in"+
+			" the offline db together with the error returned by the api. At most %d dead letters are"+
+			" kept, dropping the oldest ones.", offline.DeadLettersMax),
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Prints dead letters in the offline db as json.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			exit(runCommand(cmd, v, offlineDeadLettersListCommand))
+
+			return nil
+		},
+	}
+
+	retryCmd := &cobra.Command{
+		Use:   "retry",
+		Short: "Moves dead letters back to the offline queue.",
+		Long: "Moves dead letters back to the offline queue, so they are sent to the api again." +
+			" Without --id, all dead letters are retried. With --truncate, entity, project, branch," +
+			" language, cwd, ai tool and dependencies are truncated before retrying.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_ = v.BindPFlag("offline-dead-letters-id", cmd.Flags().Lookup("id"))
+			_ = v.BindPFlag("offline-dead-letters-truncate", cmd.Flags().Lookup("truncate"))
+
+			exit(runCommand(cmd, v, offlineDeadLettersRetryCommand))
+
+			return nil
+		},
+	}
+
+	retryCmd.Flags().StringSlice("id", nil, "Id of a dead letter to retry. Can be used multiple times.")
+	retryCmd.Flags().Int("truncate", 0, "Truncates heartbeat fields to this number of characters before retrying.")
+
+	purgeCmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Deletes dead letters from the offline db.",
+		Long:  "Deletes dead letters from the offline db. Without --id, all dead letters are deleted.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_ = v.BindPFlag("offline-dead-letters-id", cmd.Flags().Lookup("id"))
+
+			exit(runCommand(cmd, v, offlineDeadLettersPurgeCommand))
+
+			return nil
+		},
+	}
+
+	purgeCmd.Flags().StringSlice("id", nil, "Id of a dead letter to delete. Can be used multiple times.")
+
+	cmd.AddCommand(listCmd, purgeCmd, retryCmd)
+
+	return cmd
+}
+
+func newFileExpertsCmd(v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "file-experts",
+		Short: "Prints the top developer within a team for the given entity.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			exit(runCommand(cmd, v, fileExpertsCommand))
+
+			return nil
+		},
+	}
+
+	setEntityFlags(cmd.Flags())
+
+	_ = cmd.MarkFlagRequired("entity")
+
+	return cmd
+}
+
+func newDaemonCmd(v *viper.Viper) *cobra.Command {
+	return &cobra.Command{
+		Use:   "daemon",
+		Short: "Runs a daemon processing heartbeats received over a unix socket.",
+		Long: "Runs a daemon processing heartbeats received over a unix socket, keeping the api connection" +
+			" and offline db warm. While the daemon runs, the heartbeat command forwards heartbeats" +
+			" to it, unless --no-daemon is set or the daemon runs with a different configuration.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			exit(runCommand(cmd, v, daemonCommand))
+
+			return nil
+		},
+	}
+}
+
+func newServeCmd(v *viper.Viper) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serves the heartbeats.bulk and statusbar/today api endpoints on localhost.",
+		Long: "Serves POST /users/current/heartbeats.bulk and GET /users/current/statusbar/today on localhost," +
+			" for tools which can speak http but can't execute the cli. Posted heartbeats are processed" +
+			" like heartbeats sent with the heartbeat command. Requests must authenticate with a configured api key.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_ = v.BindPFlag("serve-listen", cmd.Flags().Lookup("listen"))
+
+			exit(runCommand(cmd, v, serveCommand))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().String(
+		"listen",
+		cmdheartbeat.ServeListenDefault,
+		fmt.Sprintf("Loopback address to listen on. Defaults to %s.", cmdheartbeat.ServeListenDefault),
+	)
+
+	return cmd
+}
+
+func newDoctorCmd(v *viper.Viper) *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Checks the installation and prints a pass/fail line for each check.",
+		Long: "Checks that config files parse, the api key is valid, all configured regex patterns compile," +
+			" the offline db opens, the log file directory is writable and the api answers an authenticated" +
+			" request. Also shows the current backoff state. Supports --output json.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			exit(runCommand(cmd, v, doctorCommand))
+
+			return nil
+		},
+	}
+}
+
+func newShellInitCmd(v *viper.Viper) *cobra.Command {
+	return &cobra.Command{
+		Use:   "shell-init bash|zsh|fish",
+		Short: "Prints shell hooks sending a heartbeat when a command starts and ends.",
+		Long: "Prints hooks for bash, zsh or fish sending an app heartbeat with the shell's working directory" +
+			" as project folder, when a command starts and ends. Load them from your shell's rc file with" +
+			" eval \"$(tracelens-cli shell-init bash)\" or tracelens-cli shell-init fish | source." +
+			" Commands matching [shell_categories] or the default rules for build, test and debug commands" +
+			" get the building, running tests or debugging category. Heartbeats are sent in the background" +
+			" and queued offline when rate limited, so the prompt is never blocked.",
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v.Set("shell-init", args[0])
+
+			exit(runCommand(cmd, v, shellInitCommand))
+
+			return nil
+		},
+	}
+}
+
+func newVersionCmd(v *viper.Viper) *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Prints the wakatime-cli version number.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			exit(runCommand(cmd, v, versionCommand))
+
+			return nil
+		},
+	}
+}
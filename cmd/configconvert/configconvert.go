@@ -0,0 +1,121 @@
+package configconvert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/ini"
+	"github.com/optiflow-os/tracelens-cli/pkg/vipertools"
+
+	"github.com/spf13/viper"
+)
+
+// Params contains config convert parameters.
+type Params struct {
+	Format ini.Format
+	// Filepath is the file to write the converted config to. Empty means
+	// next to the config file, named after the format.
+	Filepath string
+}
+
+// Run converts the config file into another format and prints the written file.
+func Run(ctx context.Context, v *viper.Viper) (int, error) {
+	converted, err := Convert(ctx, v)
+	if err != nil {
+		return exitcode.ErrConfigFileParse, fmt.Errorf(
+			"failed to convert config file: %s",
+			err,
+		)
+	}
+
+	fmt.Println(converted)
+
+	return exitcode.Success, nil
+}
+
+// Convert reads all sections of the config file and writes them into a new
+// config file of the requested format. It never overwrites an existing file.
+// Returns the path of the written file.
+func Convert(ctx context.Context, v *viper.Viper) (string, error) {
+	params, err := LoadParams(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to load command parameters: %w", err)
+	}
+
+	source, err := ini.FilePath(ctx, v)
+	if err != nil {
+		return "", fmt.Errorf("error getting config file path: %s", err)
+	}
+
+	if ini.FormatOf(source) == params.Format {
+		return "", fmt.Errorf("config file %s is already in %s format", source, params.Format)
+	}
+
+	entries, err := ini.ReadEntries(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %s", source, err)
+	}
+
+	sections := map[string]map[string]string{}
+
+	for _, e := range entries {
+		if e.Section == "" {
+			return "", fmt.Errorf("key %q at line %d is outside of a section", e.Key, e.Line)
+		}
+
+		if _, ok := sections[e.Section]; !ok {
+			sections[e.Section] = map[string]string{}
+		}
+
+		sections[e.Section][e.Key] = e.Value
+	}
+
+	b, err := ini.Encode(params.Format, sections)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode config as %s: %s", params.Format, err)
+	}
+
+	target := params.Filepath
+	if target == "" {
+		target = filepath.Join(filepath.Dir(source), ".tracelens"+params.Format.Ext())
+		if params.Format == ini.FormatINI {
+			target = filepath.Join(filepath.Dir(source), ".wakatime.cfg")
+		}
+	}
+
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) // nolint:gosec
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %s", target, err)
+	}
+
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return "", fmt.Errorf("failed to write %s: %s", target, err)
+	}
+
+	return target, nil
+}
+
+// LoadParams loads needed data from the configuration file.
+func LoadParams(v *viper.Viper) (Params, error) {
+	formatStr := strings.TrimSpace(vipertools.GetString(v, "config-convert-format"))
+	if formatStr == "" {
+		return Params{}, errors.New("format cannot be empty")
+	}
+
+	format, err := ini.ParseFormat(formatStr)
+	if err != nil {
+		return Params{}, err
+	}
+
+	return Params{
+		Format:   format,
+		Filepath: strings.TrimSpace(vipertools.GetString(v, "config-convert-file")),
+	}, nil
+}
@@ -0,0 +1,93 @@
+package configconvert_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/cmd/configconvert"
+	"github.com/optiflow-os/tracelens-cli/pkg/ini"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configFilepath := filepath.Join(tmpDir, ".wakatime.cfg")
+
+	err := os.WriteFile(configFilepath, []byte(
+		"[settings]\napi_key = 00000000-0000-4000-8000-000000000000\nexclude =\n  ^/tmp/\n  COMMIT_EDITMSG$\n"+
+			"[projectmap]\n^/some/path/(.+) = {0}\n",
+	), 0600)
+	require.NoError(t, err)
+
+	v := viper.New()
+	v.Set("config", configFilepath)
+	v.Set("config-convert-format", "yaml")
+
+	converted, err := configconvert.Convert(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(tmpDir, ".tracelens.yaml"), converted)
+
+	entries, err := ini.ReadEntries(converted)
+	require.NoError(t, err)
+
+	assert.Equal(t, []ini.Entry{
+		{Section: "projectmap", Key: "^/some/path/(.+)", Value: "{0}", Line: 2, ValueLines: []int{2}},
+		{
+			Section:    "settings",
+			Key:        "api_key",
+			Value:      "00000000-0000-4000-8000-000000000000",
+			Line:       4,
+			ValueLines: []int{4},
+		},
+		{Section: "settings", Key: "exclude", Value: "^/tmp/\nCOMMIT_EDITMSG$", Line: 5, ValueLines: []int{6, 7}},
+	}, entries)
+
+	// existing files are never overwritten
+	_, err = configconvert.Convert(context.Background(), v)
+	require.Error(t, err)
+
+	// and back
+	v.Set("config", converted)
+	v.Set("config-convert-format", "ini")
+	v.Set("config-convert-file", filepath.Join(tmpDir, "converted.cfg"))
+
+	converted, err = configconvert.Convert(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(tmpDir, "converted.cfg"), converted)
+
+	actual, err := os.ReadFile(converted)
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		"[projectmap]\n^/some/path/(.+) = {0}\n\n"+
+			"[settings]\napi_key = 00000000-0000-4000-8000-000000000000\nexclude = \"\"\"^/tmp/\nCOMMIT_EDITMSG$\"\"\"\n",
+		string(actual),
+	)
+}
+
+func TestConvert_SameFormat(t *testing.T) {
+	v := viper.New()
+	v.Set("config", filepath.Join(t.TempDir(), ".tracelens.toml"))
+	v.Set("config-convert-format", "toml")
+
+	_, err := configconvert.Convert(context.Background(), v)
+
+	assert.ErrorContains(t, err, "is already in toml format")
+}
+
+func TestLoadParams_InvalidFormat(t *testing.T) {
+	v := viper.New()
+	v.Set("config-convert-format", "json")
+
+	_, err := configconvert.LoadParams(v)
+
+	assert.EqualError(t, err, `invalid config format "json", expected ini, toml or yaml`)
+}
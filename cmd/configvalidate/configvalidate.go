@@ -0,0 +1,61 @@
+package configvalidate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/cmd/params"
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+
+	"github.com/spf13/viper"
+)
+
+// Run validates the config files and prints all issues found.
+func Run(ctx context.Context, v *viper.Viper) (int, error) {
+	output, valid, err := Validate(ctx, v)
+	if err != nil {
+		return exitcode.ErrConfigFileParse, fmt.Errorf(
+			"failed to validate config: %s",
+			err,
+		)
+	}
+
+	fmt.Println(output)
+
+	if !valid {
+		return exitcode.ErrConfigFileParse, nil
+	}
+
+	return exitcode.Success, nil
+}
+
+// Validate validates the config files and returns one line per issue found
+// or per valid file, and whether all files are valid.
+func Validate(ctx context.Context, v *viper.Viper) (string, bool, error) {
+	files, issues, err := params.ValidateConfigFiles(ctx, v)
+	if err != nil {
+		return "", false, err
+	}
+
+	if len(files) == 0 {
+		return "no config files found", true, nil
+	}
+
+	invalid := map[string]bool{}
+	lines := make([]string, 0, len(files)+len(issues))
+
+	for _, issue := range issues {
+		invalid[issue.Filepath] = true
+
+		lines = append(lines, issue.String())
+	}
+
+	for _, f := range files {
+		if !invalid[f] {
+			lines = append(lines, fmt.Sprintf("%s: ok", f))
+		}
+	}
+
+	return strings.Join(lines, "\n"), len(issues) == 0, nil
+}
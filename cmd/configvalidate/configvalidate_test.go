@@ -0,0 +1,61 @@
+package configvalidate_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/cmd/configvalidate"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configFilepath := filepath.Join(tmpDir, "wakatime.cfg")
+	internalFilepath := filepath.Join(tmpDir, "wakatime-internal.cfg")
+
+	err := os.WriteFile(configFilepath, []byte("[settings]\nhide_file_name = true\ntimeout = 1.5\n"), 0600)
+	require.NoError(t, err)
+
+	err = os.WriteFile(internalFilepath, []byte("[internal]\nbackoff_retries = 3\n"), 0600)
+	require.NoError(t, err)
+
+	v := viper.New()
+	v.Set("config", configFilepath)
+	v.Set("internal-config", internalFilepath)
+
+	output, valid, err := configvalidate.Validate(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.False(t, valid)
+	assert.Equal(t,
+		configFilepath+`:2: unknown key "hide_file_name" in [settings]`+"\n"+
+			configFilepath+`:3: timeout in [settings]: invalid integer value "1.5"`+"\n"+
+			internalFilepath+": ok",
+		output,
+	)
+}
+
+func TestValidate_Valid(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configFilepath := filepath.Join(tmpDir, "wakatime.cfg")
+
+	err := os.WriteFile(configFilepath, []byte("[settings]\nhide_file_names = true\n"), 0600)
+	require.NoError(t, err)
+
+	v := viper.New()
+	v.Set("config", configFilepath)
+	v.Set("internal-config", filepath.Join(tmpDir, "wakatime-internal.cfg"))
+
+	output, valid, err := configvalidate.Validate(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.True(t, valid)
+	assert.Equal(t, configFilepath+": ok", output)
+}
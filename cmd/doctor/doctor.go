@@ -0,0 +1,456 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cmdapi "github.com/optiflow-os/tracelens-cli/cmd/api"
+	"github.com/optiflow-os/tracelens-cli/cmd/logfile"
+	"github.com/optiflow-os/tracelens-cli/cmd/params"
+	"github.com/optiflow-os/tracelens-cli/pkg/backoff"
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/ini"
+	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+	"github.com/optiflow-os/tracelens-cli/pkg/output"
+	"github.com/optiflow-os/tracelens-cli/pkg/regex"
+	"github.com/optiflow-os/tracelens-cli/pkg/vipertools"
+
+	"github.com/spf13/viper"
+	iniv1 "gopkg.in/ini.v1"
+)
+
+// Check is the result of a single diagnostic check.
+type Check struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"`
+}
+
+// Run executes the doctor command.
+func Run(ctx context.Context, v *viper.Viper) (int, error) {
+	var out output.Output
+
+	if outputStr := vipertools.GetString(v, "output"); outputStr != "" {
+		parsed, err := output.Parse(outputStr)
+		if err != nil {
+			return exitcode.ErrGeneric, fmt.Errorf("failed to parse output: %s", err)
+		}
+
+		out = parsed
+	}
+
+	checks := Checks(ctx, v)
+
+	rendered, err := Render(checks, out)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf("failed generating doctor output: %s", err)
+	}
+
+	fmt.Println(rendered)
+
+	var failed int
+
+	for _, c := range checks {
+		if !c.Passed {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return exitcode.ErrGeneric, fmt.Errorf("%d doctor check(s) failed", failed)
+	}
+
+	return exitcode.Success, nil
+}
+
+// Checks runs all diagnostic checks and returns their results.
+func Checks(ctx context.Context, v *viper.Viper) []Check {
+	var checks []Check
+
+	checks = append(checks, checkConfigFiles(ctx, v)...)
+	checks = append(checks, checkAPIKey(ctx, v)...)
+	checks = append(checks, checkPatterns(v)...)
+	checks = append(checks,
+		checkOfflineDB(ctx, v),
+		checkBackoff(v),
+		checkLogFile(ctx, v),
+		checkAPI(ctx, v),
+	)
+
+	return checks
+}
+
+// Render renders the checks as one pass/fail line per check or as json.
+func Render(checks []Check, out output.Output) (string, error) {
+	switch out {
+	case output.JSONOutput, output.RawJSONOutput:
+		passed := true
+
+		for _, c := range checks {
+			passed = passed && c.Passed
+		}
+
+		data, err := json.Marshal(struct {
+			Passed bool    `json:"passed"`
+			Checks []Check `json:"checks"`
+		}{
+			Passed: passed,
+			Checks: checks,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal json: %s", err)
+		}
+
+		return string(data), nil
+	default:
+		lines := make([]string, 0, len(checks))
+
+		for _, c := range checks {
+			status := "pass"
+			if !c.Passed {
+				status = "fail"
+			}
+
+			lines = append(lines, fmt.Sprintf("[%s] %s: %s", status, c.Name, c.Message))
+		}
+
+		return strings.Join(lines, "\n"), nil
+	}
+}
+
+func checkConfigFiles(ctx context.Context, v *viper.Viper) []Check {
+	configFiles := []struct {
+		name       string
+		filePathFn func(context.Context, *viper.Viper) (string, error)
+	}{
+		{name: "config file", filePathFn: ini.FilePath},
+		{name: "import config file", filePathFn: ini.ImportFilePath},
+		{name: "internal config file", filePathFn: ini.InternalFilePath},
+	}
+
+	var checks []Check
+
+	for _, c := range configFiles {
+		configFile, err := c.filePathFn(ctx, v)
+		if err != nil {
+			checks = append(checks, Check{Name: c.name, Message: err.Error()})
+
+			continue
+		}
+
+		// import config file is optional
+		if configFile == "" {
+			continue
+		}
+
+		if _, err := os.Stat(configFile); errors.Is(err, os.ErrNotExist) {
+			checks = append(checks, Check{
+				Name:    c.name,
+				Passed:  true,
+				Message: fmt.Sprintf("%s not present", configFile),
+			})
+
+			continue
+		}
+
+		if ini.FormatOf(configFile) == ini.FormatINI {
+			_, err = iniv1.LoadSources(iniv1.LoadOptions{AllowPythonMultilineValues: true}, configFile)
+		} else {
+			_, err = ini.ReadEntries(configFile)
+		}
+
+		if err != nil {
+			checks = append(checks, Check{
+				Name:    c.name,
+				Message: fmt.Sprintf("failed to parse %s: %s", configFile, strings.TrimSpace(err.Error())),
+			})
+
+			continue
+		}
+
+		checks = append(checks, Check{Name: c.name, Passed: true, Message: configFile})
+	}
+
+	return checks
+}
+
+func checkAPIKey(ctx context.Context, v *viper.Viper) []Check {
+	checks := []Check{{Name: "api key", Passed: true, Message: "valid"}}
+
+	if _, err := params.LoadAPIKey(ctx, v); err != nil {
+		checks[0] = Check{Name: "api key", Message: err.Error()}
+	}
+
+	vaultCmd := vipertools.GetString(v, "settings.api_key_vault_cmd")
+	if vaultCmd == "" {
+		return checks
+	}
+
+	check := Check{Name: "api key vault cmd", Passed: true, Message: "valid"}
+
+	apiKey, err := params.ReadAPIKeyFromCommand(vaultCmd)
+
+	switch {
+	case err != nil:
+		check = Check{Name: check.Name, Message: fmt.Sprintf("failed to run %q: %s", vaultCmd, err)}
+	case !params.IsValidAPIKey(apiKey):
+		check = Check{Name: check.Name, Message: fmt.Sprintf("%q returned an invalid api key", vaultCmd)}
+	}
+
+	return append(checks, check)
+}
+
+func checkPatterns(v *viper.Viper) []Check {
+	var checks []Check
+
+	// map sections use their keys as patterns
+	for _, section := range []string{"projectmap", "project_api_key"} {
+		var invalid []string
+
+		values := vipertools.GetStringMapString(v, section)
+
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			s := values[k]
+
+			if err := compile(k); err != nil {
+				invalid = append(invalid, err.Error())
+			}
+
+			if section == "project_api_key" && !params.IsValidAPIKey(s) {
+				invalid = append(invalid, fmt.Sprintf("invalid api key format for %q", k))
+			}
+		}
+
+		checks = append(checks, patternsCheck(section, invalid))
+	}
+
+	lists := []struct {
+		name   string
+		values []string
+	}{
+		{
+			name: "exclude",
+			values: append(append(v.GetStringSlice("exclude"),
+				v.GetStringSlice("settings.exclude")...),
+				v.GetStringSlice("settings.ignore")...),
+		},
+		{
+			name:   "include",
+			values: append(v.GetStringSlice("include"), v.GetStringSlice("settings.include")...),
+		},
+		{
+			name: "hide_branch_names",
+			values: []string{vipertools.FirstNonEmptyString(v,
+				"hide-branch-names",
+				"settings.hide_branch_names",
+				"settings.hide_branchnames",
+				"settings.hidebranchnames",
+			)},
+		},
+		{
+			name: "hide_dependencies",
+			values: []string{vipertools.FirstNonEmptyString(v,
+				"hide-dependencies",
+				"settings.hide_dependencies",
+			)},
+		},
+		{
+			name: "hide_file_names",
+			values: []string{vipertools.FirstNonEmptyString(v,
+				"hide-file-names",
+				"hide-filenames",
+				"hidefilenames",
+				"settings.hide_file_names",
+				"settings.hide_filenames",
+				"settings.hidefilenames",
+			)},
+		},
+		{
+			name: "hide_project_names",
+			values: []string{vipertools.FirstNonEmptyString(v,
+				"hide-project-names",
+				"settings.hide_project_names",
+				"settings.hide_projectnames",
+				"settings.hideprojectnames",
+			)},
+		},
+	}
+
+	for _, l := range lists {
+		var invalid []string
+
+		for _, value := range l.values {
+			for _, s := range splitPatterns(value) {
+				if err := compile(s); err != nil {
+					invalid = append(invalid, err.Error())
+				}
+			}
+		}
+
+		checks = append(checks, patternsCheck(l.name, invalid))
+	}
+
+	return checks
+}
+
+func patternsCheck(name string, invalid []string) Check {
+	if len(invalid) > 0 {
+		return Check{Name: name + " patterns", Message: strings.Join(invalid, "; ")}
+	}
+
+	return Check{Name: name + " patterns", Passed: true, Message: "valid"}
+}
+
+// splitPatterns splits a bool or regex list param into its regex patterns.
+func splitPatterns(s string) []string {
+	s = strings.ReplaceAll(s, "\r", "\n")
+	s = strings.Trim(s, "\n\t ")
+
+	if s == "" || strings.EqualFold(s, "true") || strings.EqualFold(s, "false") {
+		return nil
+	}
+
+	var patterns []string
+
+	for _, p := range strings.Split(s, "\n") {
+		p = strings.Trim(p, "\n\t ")
+		if p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+
+	return patterns
+}
+
+// compile compiles the pattern case insensitive, like it's done when loading params.
+func compile(s string) error {
+	if !strings.HasPrefix(s, "(?i)") {
+		s = "(?i)" + s
+	}
+
+	_, err := regex.Compile(s)
+
+	return err
+}
+
+func checkOfflineDB(ctx context.Context, v *viper.Viper) Check {
+	queueFilepath, err := offline.QueueFilepath(ctx, v)
+	if err != nil {
+		return Check{Name: "offline db", Message: fmt.Sprintf("failed to load offline queue filepath: %s", err)}
+	}
+
+	count, err := offline.CountHeartbeats(ctx, queueFilepath)
+	if err != nil {
+		return Check{Name: "offline db", Message: fmt.Sprintf("failed to open %s: %s", queueFilepath, err)}
+	}
+
+	return Check{
+		Name:    "offline db",
+		Passed:  true,
+		Message: fmt.Sprintf("%d heartbeat(s) queued in %s", count, queueFilepath),
+	}
+}
+
+func checkBackoff(v *viper.Viper) Check {
+	var retries int
+
+	if s := vipertools.GetString(v, "internal.backoff_retries"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil {
+			return Check{Name: "backoff", Message: fmt.Sprintf("failed to parse backoff_retries: %s", err)}
+		}
+
+		retries = parsed
+	}
+
+	s := vipertools.GetString(v, "internal.backoff_at")
+	if s == "" {
+		return Check{Name: "backoff", Passed: true, Message: fmt.Sprintf("not backing off, %d retries", retries)}
+	}
+
+	at, err := time.Parse(ini.DateFormat, s)
+	if err != nil {
+		return Check{Name: "backoff", Message: fmt.Sprintf("failed to parse backoff_at: %s", err)}
+	}
+
+	until := backoff.Until(retries, at)
+	if until.IsZero() {
+		return Check{
+			Name:    "backoff",
+			Passed:  true,
+			Message: fmt.Sprintf("not backing off, %d retries since %s", retries, s),
+		}
+	}
+
+	return Check{
+		Name:   "backoff",
+		Passed: true,
+		Message: fmt.Sprintf(
+			"backing off until %s, %d retries since %s",
+			until.Format(ini.DateFormat),
+			retries,
+			s,
+		),
+	}
+}
+
+func checkLogFile(ctx context.Context, v *viper.Viper) Check {
+	logParams, err := logfile.LoadParams(ctx, v)
+	if err != nil {
+		return Check{Name: "log file", Message: err.Error()}
+	}
+
+	if logParams.ToStdout {
+		return Check{Name: "log file", Passed: true, Message: "logging to stdout"}
+	}
+
+	dir := filepath.Dir(logParams.File)
+
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return Check{Name: "log file", Message: fmt.Sprintf("log file directory %s not writable: %s", dir, err)}
+	}
+
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+
+	return Check{Name: "log file", Passed: true, Message: logParams.File}
+}
+
+func checkAPI(ctx context.Context, v *viper.Viper) Check {
+	paramAPI, err := params.LoadAPIParams(ctx, v)
+	if err != nil {
+		return Check{Name: "api", Message: fmt.Sprintf("failed to load API parameters: %s", err)}
+	}
+
+	apiClient, err := cmdapi.NewClient(ctx, paramAPI)
+	if err != nil {
+		return Check{Name: "api", Message: fmt.Sprintf("failed to initialize api client: %s", err)}
+	}
+
+	via := ""
+	if paramAPI.ProxyURL != "" {
+		via = " via proxy"
+	}
+
+	if _, err := apiClient.Today(ctx); err != nil {
+		return Check{Name: "api", Message: fmt.Sprintf("request to %s%s failed: %s", paramAPI.URL, via, err)}
+	}
+
+	return Check{Name: "api", Passed: true, Message: fmt.Sprintf("authenticated request to %s%s succeeded", paramAPI.URL, via)}
+}
@@ -0,0 +1,144 @@
+package doctor_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/cmd/doctor"
+	"github.com/optiflow-os/tracelens-cli/pkg/output"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecks(t *testing.T) {
+	testServerURL, router, tearDown := setupTestServer()
+	defer tearDown()
+
+	router.HandleFunc("/users/current/statusbar/today", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, []string{"Basic MDAwMDAwMDAtMDAwMC00MDAwLTgwMDAtMDAwMDAwMDAwMDAw"}, req.Header["Authorization"])
+
+		f, err := os.Open("../today/testdata/api_statusbar_today_response.json")
+		require.NoError(t, err)
+
+		defer f.Close()
+
+		_, err = io.Copy(w, f)
+		require.NoError(t, err)
+	})
+
+	tmpDir := t.TempDir()
+
+	v := viper.New()
+	v.Set("api-url", testServerURL)
+	v.Set("config", filepath.Join(tmpDir, "wakatime.cfg"))
+	v.Set("internal-config", "testdata/wakatime-internal.cfg")
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+	v.Set("log-file", filepath.Join(tmpDir, "wakatime.log"))
+	v.Set("offline-queue-file", filepath.Join(tmpDir, "offline.bdb"))
+	v.Set("internal.backoff_retries", "2")
+	v.Set("internal.backoff_at", "2021-08-30T18:50:42-03:00")
+	v.Set("projectmap.invalid(", "project")
+	v.Set("settings.exclude", []string{"^/tmp/.*\n("})
+	v.Set("settings.hide_file_names", "true")
+
+	checks := doctor.Checks(context.Background(), v)
+
+	assert.Equal(t, []doctor.Check{
+		{Name: "config file", Passed: true, Message: filepath.Join(tmpDir, "wakatime.cfg") + " not present"},
+		{Name: "internal config file", Passed: true, Message: "testdata/wakatime-internal.cfg"},
+		{Name: "api key", Passed: true, Message: "valid"},
+		{
+			Name:    "projectmap patterns",
+			Message: "failed to compile regex \"(?i)invalid(\": error parsing regexp: missing closing ) in `(?i)invalid(`",
+		},
+		{Name: "project_api_key patterns", Passed: true, Message: "valid"},
+		{
+			Name:    "exclude patterns",
+			Message: "failed to compile regex \"(?i)(\": error parsing regexp: missing closing ) in `(?i)(`",
+		},
+		{Name: "include patterns", Passed: true, Message: "valid"},
+		{Name: "hide_branch_names patterns", Passed: true, Message: "valid"},
+		{Name: "hide_dependencies patterns", Passed: true, Message: "valid"},
+		{Name: "hide_file_names patterns", Passed: true, Message: "valid"},
+		{Name: "hide_project_names patterns", Passed: true, Message: "valid"},
+		{Name: "offline db", Passed: true, Message: "0 heartbeat(s) queued in " + filepath.Join(tmpDir, "offline.bdb")},
+		{Name: "backoff", Passed: true, Message: "not backing off, 2 retries since 2021-08-30T18:50:42-03:00"},
+		{Name: "log file", Passed: true, Message: filepath.Join(tmpDir, "wakatime.log")},
+		{Name: "api", Passed: true, Message: "authenticated request to " + testServerURL + " succeeded"},
+	}, checks)
+}
+
+func TestChecks_InvalidAPIKey(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	v := viper.New()
+	v.Set("config", "testdata/wakatime_invalid.cfg")
+	v.Set("internal-config", filepath.Join(tmpDir, "wakatime-internal.cfg"))
+	v.Set("key", "invalid")
+	v.Set("log-file", filepath.Join(tmpDir, "wakatime.log"))
+	v.Set("offline-queue-file", filepath.Join(tmpDir, "offline.bdb"))
+	v.Set("settings.api_key_vault_cmd", "echo invalid")
+
+	checks := doctor.Checks(context.Background(), v)
+
+	failed := map[string]string{}
+
+	for _, c := range checks {
+		if !c.Passed {
+			failed[c.Name] = c.Message
+		}
+	}
+
+	assert.Equal(t, map[string]string{
+		"config file": "failed to parse testdata/wakatime_invalid.cfg:" +
+			" key-value delimiter not found: invalid line",
+		"api key":           "invalid api key format",
+		"api key vault cmd": `"echo invalid" returned an invalid api key`,
+		"api":               "failed to load API parameters: invalid api key format",
+	}, failed)
+}
+
+func TestRender(t *testing.T) {
+	checks := []doctor.Check{
+		{Name: "api key", Passed: true, Message: "valid"},
+		{Name: "api", Message: "request failed"},
+	}
+
+	tests := map[string]struct {
+		Output   output.Output
+		Expected string
+	}{
+		"text": {
+			Output:   output.TextOutput,
+			Expected: "[pass] api key: valid\n[fail] api: request failed",
+		},
+		"json": {
+			Output: output.JSONOutput,
+			Expected: `{"passed":false,"checks":[{"name":"api key","passed":true,"message":"valid"},` +
+				`{"name":"api","passed":false,"message":"request failed"}]}`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rendered, err := doctor.Render(checks, test.Output)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.Expected, rendered)
+		})
+	}
+}
+
+func setupTestServer() (string, *http.ServeMux, func()) {
+	router := http.NewServeMux()
+	srv := httptest.NewServer(router)
+
+	return srv.URL, router, func() { srv.Close() }
+}
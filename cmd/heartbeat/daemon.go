@@ -0,0 +1,390 @@
+package heartbeat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	apicmd "github.com/optiflow-os/tracelens-cli/cmd/api"
+	paramscmd "github.com/optiflow-os/tracelens-cli/cmd/params"
+	"github.com/optiflow-os/tracelens-cli/pkg/apikey"
+	"github.com/optiflow-os/tracelens-cli/pkg/backoff"
+	"github.com/optiflow-os/tracelens-cli/pkg/daemon"
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/ini"
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+	"github.com/optiflow-os/tracelens-cli/pkg/wakaerror"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// daemonDBIdleTimeout is the duration after which the daemon releases the
+	// offline db, so other processes are not blocked from using it.
+	daemonDBIdleTimeout = 2 * time.Second
+	// daemonResponseTimeout is added to the api timeout, when waiting for the
+	// daemon to process heartbeats.
+	daemonResponseTimeout = 10 * time.Second
+)
+
+// RunDaemon executes the daemon command. It keeps a single heartbeat processing
+// pipeline, api client and offline db connection, and processes heartbeats
+// forwarded by other invocations of the cli over a unix socket until interrupted.
+func RunDaemon(ctx context.Context, v *viper.Viper) (int, error) {
+	err := serveDaemon(ctx, v)
+	if err != nil {
+		if errwaka, ok := err.(wakaerror.Error); ok {
+			return errwaka.ExitCode(), fmt.Errorf("running daemon failed: %w", errwaka)
+		}
+
+		return exitcode.ErrGeneric, fmt.Errorf("running daemon failed: %w", err)
+	}
+
+	return exitcode.Success, nil
+}
+
+func serveDaemon(ctx context.Context, v *viper.Viper) error {
+	params, err := loadPipelineParams(ctx, v)
+	if err != nil {
+		return fmt.Errorf("failed to load command parameters: %w", err)
+	}
+
+	logger := log.Extract(ctx)
+	logger.Debugf("params: %s", params)
+
+	socketFilepath, err := daemon.SocketFilepath(ctx, v)
+	if err != nil {
+		logger.Warnf("failed to load daemon socket filepath: %s", err)
+	}
+
+	queueFilepath, err := offline.QueueFilepath(ctx, v)
+	if err != nil {
+		logger.Warnf("failed to load offline queue filepath: %s", err)
+	}
+
+	apiClient, err := apicmd.NewClientWithoutAuth(ctx, params.API)
+	if err != nil {
+		return fmt.Errorf("failed to initialize api client: %w", err)
+	}
+
+	stopKeepingOpen := offline.KeepOpen(queueFilepath, daemonDBIdleTimeout)
+	defer stopKeepingOpen()
+
+	h := newDaemonHandler(v, params, apiClient, queueFilepath)
+
+	l, err := daemon.Listen(ctx, socketFilepath)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Infof("daemon listening on %s", socketFilepath)
+
+	server := daemon.NewServer(fingerprint(ctx, v, params), h.handle)
+
+	return server.Serve(ctx, l)
+}
+
+// loadPipelineParams loads params like LoadParams, but without requiring an entity.
+func loadPipelineParams(ctx context.Context, v *viper.Viper) (paramscmd.Params, error) {
+	apiParams, err := paramscmd.LoadAPIParams(ctx, v)
+	if err != nil {
+		return paramscmd.Params{}, fmt.Errorf("failed to load API parameters: %w", err)
+	}
+
+	heartbeatParams, err := paramscmd.LoadHeartbeatPipelineParams(ctx, v)
+	if err != nil {
+		return paramscmd.Params{}, fmt.Errorf("failed to load heartbeat params: %s", err)
+	}
+
+	return paramscmd.Params{
+		API:       apiParams,
+		Heartbeat: heartbeatParams,
+		Offline:   paramscmd.LoadOfflineParams(ctx, v),
+	}, nil
+}
+
+// daemonHandler processes heartbeats like SendHeartbeats does, but reuses the
+// handles and keeps the rate limit state across requests.
+type daemonHandler struct {
+	v          *viper.Viper
+	offline    paramscmd.Offline
+	lastSentAt time.Time
+	queue      heartbeat.Handle
+	send       heartbeat.Handle
+	sync       heartbeat.Handle
+}
+
+func newDaemonHandler(
+	v *viper.Viper,
+	params paramscmd.Params,
+	sender heartbeat.Sender,
+	queueFilepath string,
+) *daemonHandler {
+	sendOpts := initHandleOptions(params)
+
+	if !params.Offline.Disabled {
+		sendOpts = append(sendOpts, offline.WithQueue(queueFilepath, params.Offline.Retention))
+	}
+
+	sendOpts = append(sendOpts, backoff.WithBackoff(backoff.Config{
+		V:        v,
+		At:       params.API.BackoffAt,
+		Retries:  params.API.BackoffRetries,
+		HasProxy: params.API.ProxyURL != "",
+	}))
+
+	queueOpts := append(initHandleOptions(params), offline.WithQueue(queueFilepath, params.Offline.Retention))
+
+	return &daemonHandler{
+		v:          v,
+		offline:    params.Offline,
+		lastSentAt: params.Offline.LastSentAt,
+		queue:      heartbeat.NewHandle(offline.Noop{}, queueOpts...),
+		send:       heartbeat.NewHandle(sender, sendOpts...),
+		sync: heartbeat.NewHandle(sender,
+			offline.WithSync(queueFilepath, params.Offline.SyncMax, params.Offline.Retention),
+			apikey.WithReplacing(apikey.Config{
+				APIURL:        params.API.URL,
+				DefaultAPIKey: params.API.Key,
+				MapPatterns:   params.API.KeyPatterns,
+			}),
+		),
+	}
+}
+
+func (d *daemonHandler) handle(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+	logger := log.Extract(ctx)
+
+	if RateLimited(RateLimitParams{
+		Disabled:   d.offline.Disabled,
+		LastSentAt: d.lastSentAt,
+		Timeout:    d.offline.RateLimit,
+	}) {
+		logger.Debugf("save %d rate limited heartbeat(s) to offline queue", len(hh))
+
+		_, _ = d.queue(ctx, hh)
+
+		return nil, nil
+	}
+
+	// only send at once the maximum amount of `offline.SendLimit`.
+	if len(hh) > offline.SendLimit {
+		logger.Debugf("save %d extra heartbeat(s) to offline queue", len(hh)-offline.SendLimit)
+
+		if !d.offline.Disabled {
+			_, _ = d.queue(ctx, hh[offline.SendLimit:])
+		}
+
+		hh = hh[:offline.SendLimit]
+	}
+
+	results, err := d.send(ctx, hh)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		if len(result.Errors) > 0 {
+			logger.Warnln(strings.Join(result.Errors, " "))
+		}
+	}
+
+	d.lastSentAt = time.Now()
+
+	// also persist the rate limit for the cli, when handling heartbeats in-process
+	if err := ResetRateLimit(ctx, d.v); err != nil {
+		logger.Errorf("failed to reset rate limit: %s", err)
+	}
+
+	if !d.offline.Disabled {
+		if _, err := d.sync(ctx, nil); err != nil {
+			logger.Warnf("failed to sync offline activity: %s", err)
+		}
+	}
+
+	return results, nil
+}
+
+// Forward forwards the heartbeats to a running daemon. It returns false, if
+// no daemon is running or the daemon's configuration differs, in which case
+// the heartbeats have to be handled in-process.
+func Forward(ctx context.Context, v *viper.Viper) (bool, int, error) {
+	if v.GetBool("no-daemon") {
+		return false, exitcode.Success, nil
+	}
+
+	// the daemon doesn't report the fate of single heartbeats
+	if reporting, _ := loadReporting(v); reporting {
+		return false, exitcode.Success, nil
+	}
+
+	logger := log.Extract(ctx)
+
+	socketFilepath, err := daemon.SocketFilepath(ctx, v)
+	if err != nil {
+		logger.Debugf("failed to load daemon socket filepath: %s", err)
+
+		return false, exitcode.Success, nil
+	}
+
+	if _, err := os.Stat(socketFilepath); err != nil {
+		return false, exitcode.Success, nil
+	}
+
+	params, err := LoadParams(ctx, v)
+	if err != nil {
+		// leave error handling to the in-process heartbeat command
+		return false, exitcode.Success, nil
+	}
+
+	setLogFields(ctx, params)
+
+	heartbeats := buildHeartbeats(ctx, params)
+
+	// the daemon runs in a different working directory
+	for n, h := range heartbeats {
+		if !h.IsRemote() {
+			heartbeats[n] = heartbeat.Format(ctx, h)
+		}
+	}
+
+	results, err := daemon.Send(
+		ctx,
+		socketFilepath,
+		fingerprint(ctx, v, params),
+		heartbeats,
+		params.API.Timeout+daemonResponseTimeout,
+	)
+	if err != nil {
+		if errors.Is(err, daemon.ErrNotRunning) || errors.Is(err, daemon.ErrConfigMismatch) {
+			logger.Debugf("handling heartbeat(s) in-process: %s", err)
+
+			return false, exitcode.Success, nil
+		}
+
+		if errwaka, ok := err.(wakaerror.Error); ok {
+			return true, errwaka.ExitCode(), fmt.Errorf("sending heartbeat(s) to daemon failed: %w", errwaka)
+		}
+
+		return true, exitcode.ErrGeneric, fmt.Errorf("sending heartbeat(s) to daemon failed: %w", err)
+	}
+
+	for _, result := range results {
+		if len(result.Errors) > 0 {
+			logger.Warnln(strings.Join(result.Errors, " "))
+		}
+	}
+
+	logger.Debugln("successfully forwarded heartbeat(s) to daemon")
+
+	return true, exitcode.Success, nil
+}
+
+// fingerprint returns a hash of all params affecting heartbeat processing,
+// except the ones carried by the heartbeats themselves. Settings only read
+// from the config files are covered by hashing the config files, so the daemon
+// is never used with stale settings after a config file changed.
+func fingerprint(ctx context.Context, v *viper.Viper, params paramscmd.Params) string {
+	keyPatterns := make([]string, 0, len(params.API.KeyPatterns))
+	for _, p := range params.API.KeyPatterns {
+		keyPatterns = append(keyPatterns, p.Regex.String()+"="+p.APIKey)
+	}
+
+	s := fmt.Sprintf(
+		"api key: %s, key patterns: %q, api url: %s, hostname: %s, proxy url: %s,"+
+			" disable ssl verify: %t, ssl cert filepath: %s, timeout: %s,"+
+			" filter params: (%s), guess language: %t, map patterns: %s, category rules: %s,"+
+			" domain rules: %s, project from git remote: %t, git submodules disabled: %s,"+
+			" git submodule project map: %s, command arg patterns: %s, send command args: %t,"+
+			" hide branch names: %s, hide dependencies: %s, hide file names: %s,"+
+			" hide project folder: %t, hide project names: %s,"+
+			" offline disabled: %t, rate limit: %s, retention: (%s), sync max: %d, config files: %s",
+		params.API.Key,
+		keyPatterns,
+		params.API.URL,
+		params.API.Hostname,
+		params.API.ProxyURL,
+		params.API.DisableSSLVerify,
+		params.API.SSLCertFilepath,
+		params.API.Timeout,
+		params.Heartbeat.Filter,
+		params.Heartbeat.GuessLanguage,
+		params.Heartbeat.Project.MapPatterns,
+		params.Heartbeat.CategoryRules,
+		params.Heartbeat.Project.DomainRules,
+		params.Heartbeat.Project.ProjectFromGitRemote,
+		params.Heartbeat.Project.SubmodulesDisabled,
+		params.Heartbeat.Project.SubmoduleMapPatterns,
+		params.Heartbeat.Sanitize.CommandArgPatterns,
+		params.Heartbeat.Sanitize.SendCommandArgs,
+		params.Heartbeat.Sanitize.HideBranchNames,
+		params.Heartbeat.Sanitize.HideDependencies,
+		params.Heartbeat.Sanitize.HideFileNames,
+		params.Heartbeat.Sanitize.HideProjectFolder,
+		params.Heartbeat.Sanitize.HideProjectNames,
+		params.Offline.Disabled,
+		params.Offline.RateLimit,
+		params.Offline.Retention,
+		params.Offline.SyncMax,
+		configFilesDigest(ctx, v),
+	)
+
+	sum := sha256.Sum256([]byte(s))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// configFilesDigest returns a hash of the paths, modification times and
+// contents of the config file and the imported config file.
+func configFilesDigest(ctx context.Context, v *viper.Viper) string {
+	logger := log.Extract(ctx)
+
+	var filepaths []string
+
+	for _, load := range []func(context.Context, *viper.Viper) (string, error){ini.FilePath, ini.ImportFilePath} {
+		fp, err := load(ctx, v)
+		if err != nil {
+			logger.Debugf("failed to load config filepath: %s", err)
+			continue
+		}
+
+		if fp != "" {
+			filepaths = append(filepaths, fp)
+		}
+	}
+
+	h := sha256.New()
+
+	for _, fp := range filepaths {
+		_, _ = fmt.Fprintf(h, "%s\n", fp)
+
+		info, err := os.Stat(fp)
+		if err != nil {
+			continue
+		}
+
+		_, _ = fmt.Fprintf(h, "%d\n", info.ModTime().UnixNano())
+
+		data, err := os.ReadFile(fp) // nolint:gosec
+		if err != nil {
+			logger.Debugf("failed to read config file %q: %s", fp, err)
+			continue
+		}
+
+		_, _ = h.Write(data)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,160 @@
+package heartbeat_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cmdheartbeat "github.com/optiflow-os/tracelens-cli/cmd/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/daemon"
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForward_NotRunning(t *testing.T) {
+	resetSingleton(t)
+
+	v := viper.New()
+	v.Set("daemon-socket", filepath.Join(t.TempDir(), "daemon.sock"))
+	v.Set("entity", "testdata/main.go")
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+
+	forwarded, code, err := cmdheartbeat.Forward(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.False(t, forwarded)
+	assert.Equal(t, exitcode.Success, code)
+}
+
+func TestForward_ConfigMismatch(t *testing.T) {
+	resetSingleton(t)
+
+	socketFilepath := filepath.Join(t.TempDir(), "daemon.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l, err := daemon.Listen(ctx, socketFilepath)
+	require.NoError(t, err)
+
+	server := daemon.NewServer("fingerprint", func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		t.Fatal("heartbeats must not be processed")
+
+		return nil, nil
+	})
+
+	go func() {
+		_ = server.Serve(ctx, l)
+	}()
+
+	v := viper.New()
+	v.Set("daemon-socket", socketFilepath)
+	v.Set("entity", "testdata/main.go")
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+
+	forwarded, code, err := cmdheartbeat.Forward(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.False(t, forwarded)
+	assert.Equal(t, exitcode.Success, code)
+}
+
+func TestForward_ConfigFileChanged(t *testing.T) {
+	resetSingleton(t)
+
+	// keep file snapshots of line changes detection apart from other runs
+	t.Setenv("WAKATIME_HOME", t.TempDir())
+
+	testServerURL, router, tearDown := setupTestServer()
+	defer tearDown()
+
+	router.HandleFunc("/users/current/heartbeats.bulk", func(w http.ResponseWriter, _ *http.Request) {
+		f, err := os.Open("testdata/api_heartbeats_response.json")
+		require.NoError(t, err)
+
+		defer f.Close()
+
+		w.WriteHeader(http.StatusCreated)
+		_, err = io.Copy(w, f)
+		require.NoError(t, err)
+	})
+
+	tmpDir := t.TempDir()
+	configFilepath := filepath.Join(tmpDir, "tracelens.cfg")
+	socketFilepath := filepath.Join(tmpDir, "daemon.sock")
+
+	err := os.WriteFile(configFilepath, []byte("[settings]\n"), 0600)
+	require.NoError(t, err)
+
+	newViper := func() *viper.Viper {
+		v := viper.New()
+		v.Set("api-url", testServerURL)
+		v.Set("config", configFilepath)
+		v.Set("daemon-socket", socketFilepath)
+		v.Set("entity", "testdata/main.go")
+		v.Set("internal-config", filepath.Join(tmpDir, "internal.cfg"))
+		v.Set("key", "00000000-0000-4000-8000-000000000000")
+		v.Set("offline-queue-file", filepath.Join(tmpDir, "offline_heartbeats.bdb"))
+
+		return v
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_, _ = cmdheartbeat.RunDaemon(ctx, newViper())
+	}()
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(socketFilepath)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	forwarded, code, err := cmdheartbeat.Forward(context.Background(), newViper())
+	require.NoError(t, err)
+
+	assert.True(t, forwarded)
+	assert.Equal(t, exitcode.Success, code)
+
+	// settings only read from the config file changed
+	err = os.WriteFile(configFilepath, []byte("[categories]\n.*_test.go = code reviewing\n"), 0600)
+	require.NoError(t, err)
+
+	forwarded, code, err = cmdheartbeat.Forward(context.Background(), newViper())
+	require.NoError(t, err)
+
+	assert.False(t, forwarded)
+	assert.Equal(t, exitcode.Success, code)
+}
+
+func TestForward_Disabled(t *testing.T) {
+	resetSingleton(t)
+
+	socketFilepath := filepath.Join(t.TempDir(), "daemon.sock")
+
+	l, err := daemon.Listen(context.Background(), socketFilepath)
+	require.NoError(t, err)
+
+	defer l.Close()
+
+	v := viper.New()
+	v.Set("daemon-socket", socketFilepath)
+	v.Set("entity", "testdata/main.go")
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+	v.Set("no-daemon", true)
+
+	forwarded, code, err := cmdheartbeat.Forward(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.False(t, forwarded)
+	assert.Equal(t, exitcode.Success, code)
+}
@@ -0,0 +1,200 @@
+package heartbeat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/wakaerror"
+
+	"github.com/spf13/viper"
+)
+
+// RunExplain executes the heartbeat command in dry-run mode.
+func RunExplain(ctx context.Context, v *viper.Viper) (int, error) {
+	output, err := Explain(ctx, v)
+	if err != nil {
+		if errwaka, ok := err.(wakaerror.Error); ok {
+			return errwaka.ExitCode(), fmt.Errorf("explaining heartbeat(s) failed: %w", errwaka)
+		}
+
+		return exitcode.ErrGeneric, fmt.Errorf("explaining heartbeat(s) failed: %w", err)
+	}
+
+	fmt.Print(output)
+
+	return exitcode.Success, nil
+}
+
+// Explain runs the heartbeats through the full processing pipeline, but records
+// them instead of sending them to the api. Neither the offline queue, the
+// rate limit, the line changes snapshots nor project files are touched. It returns a per-stage diff of all heartbeat fields
+// followed by the json body, which would have been sent to the api.
+func Explain(ctx context.Context, v *viper.Viper) (string, error) {
+	params, err := LoadParams(ctx, v)
+	if err != nil {
+		return "", fmt.Errorf("failed to load command parameters: %w", err)
+	}
+
+	heartbeats := buildHeartbeats(ctx, params)
+
+	tracer := &heartbeat.Tracer{}
+
+	stages := initStages(params, true)
+	opts := make([]heartbeat.HandleOption, 0, len(stages))
+
+	for _, s := range stages {
+		opts = append(opts, tracer.Trace(s.Name, s.Option))
+	}
+
+	recorder := &heartbeat.Recorder{}
+
+	handle := heartbeat.NewHandle(recorder, opts...)
+	if _, err := handle(ctx, heartbeats); err != nil {
+		return "", err
+	}
+
+	return renderExplain(heartbeats, tracer.Steps, recorder.Heartbeats)
+}
+
+func renderExplain(initial []heartbeat.Heartbeat, steps []heartbeat.TraceStep, sent []heartbeat.Heartbeat) (string, error) {
+	var b strings.Builder
+
+	for id, h := range initial {
+		fmt.Fprintf(&b, "heartbeat #%d: %s\n", id+1, h.Entity)
+
+		for _, step := range steps {
+			before, ok := step.Before[id]
+			if !ok {
+				continue
+			}
+
+			if step.After == nil {
+				fmt.Fprintf(&b, "  %s: aborted\n", step.Stage)
+				continue
+			}
+
+			after, ok := step.After[id]
+			if !ok {
+				fmt.Fprintf(&b, "  %s: removed\n", step.Stage)
+				continue
+			}
+
+			changes := diffHeartbeats(before, after)
+			if len(changes) == 0 {
+				fmt.Fprintf(&b, "  %s: no changes\n", step.Stage)
+				continue
+			}
+
+			fmt.Fprintf(&b, "  %s:\n", step.Stage)
+
+			for _, c := range changes {
+				fmt.Fprintf(&b, "    %s\n", c)
+			}
+		}
+
+		b.WriteString("\n")
+	}
+
+	if len(sent) == 0 {
+		b.WriteString("no heartbeats would have been sent to the api\n")
+
+		return b.String(), nil
+	}
+
+	// the api client sends one request per api key
+	var keys []string
+
+	grouped := map[string][]heartbeat.Heartbeat{}
+
+	for _, h := range sent {
+		if _, ok := grouped[h.APIKey]; !ok {
+			keys = append(keys, h.APIKey)
+		}
+
+		grouped[h.APIKey] = append(grouped[h.APIKey], h)
+	}
+
+	for _, k := range keys {
+		buffer := &bytes.Buffer{}
+
+		encoder := json.NewEncoder(buffer)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(grouped[k]); err != nil {
+			return "", fmt.Errorf("failed to json marshal heartbeats: %s", err)
+		}
+
+		fmt.Fprintf(&b, "would post to heartbeats.bulk with api key %s:\n%s", hideAPIKey(k), buffer.String())
+	}
+
+	return b.String(), nil
+}
+
+// diffHeartbeats returns a description of every field that differs between a and b.
+func diffHeartbeats(a, b heartbeat.Heartbeat) []string {
+	var changes []string
+
+	va := reflect.ValueOf(a)
+	vb := reflect.ValueOf(b)
+	t := va.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		fa, fb := va.Field(i), vb.Field(i)
+
+		if reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+			continue
+		}
+
+		name := t.Field(i).Name
+
+		before, after := formatValue(fa), formatValue(fb)
+		if name == "APIKey" {
+			before, after = hideAPIKey(a.APIKey), hideAPIKey(b.APIKey)
+		}
+
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", name, before, after))
+	}
+
+	return changes
+}
+
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return "<nil>"
+		}
+
+		return formatValue(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return "<nil>"
+		}
+
+		return fmt.Sprintf("%q", v.Interface())
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	default:
+		return fmt.Sprintf("%v", v.Interface())
+	}
+}
+
+// hideAPIKey only shows the last 4 chars of an api key.
+func hideAPIKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+
+	if len(key) > 4 {
+		return "<hidden>" + key[len(key)-4:]
+	}
+
+	return key
+}
@@ -0,0 +1,134 @@
+package heartbeat_test
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cmdheartbeat "github.com/optiflow-os/tracelens-cli/cmd/heartbeat"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	resetSingleton(t)
+
+	v := viper.New()
+	v.Set("category", "debugging")
+	v.Set("entity", "wakatime")
+	v.Set("entity-type", "app")
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+	v.Set("plugin", "plugin")
+	v.Set("time", 1585598059.1)
+
+	output, err := cmdheartbeat.Explain(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Contains(t, output, "heartbeat #1: wakatime\n")
+	assert.Contains(t, output, "  filtering: no changes\n")
+	assert.Contains(t, output, "  apikey:\n    APIKey: \"\" -> <hidden>0000\n")
+	assert.Contains(t, output, "would post to heartbeats.bulk with api key <hidden>0000:\n")
+	assert.Contains(t, output, `"category": "debugging"`)
+	assert.Contains(t, output, `"entity": "wakatime"`)
+	assert.Contains(t, output, `"type": "app"`)
+}
+
+func TestExplain_NoSnapshots(t *testing.T) {
+	resetSingleton(t)
+
+	home := t.TempDir()
+	t.Setenv("WAKATIME_HOME", home)
+
+	root := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(root, ".git"), 0700)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(root, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0600)
+	require.NoError(t, err)
+
+	entity := filepath.Join(root, "main.go")
+
+	err = os.WriteFile(entity, []byte("package main\n"), 0600)
+	require.NoError(t, err)
+
+	v := viper.New()
+	v.Set("entity", entity)
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+	v.Set("time", 1585598059.1)
+
+	output, err := cmdheartbeat.Explain(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Contains(t, output, "LineAdditions: <nil> -> 1\n")
+
+	// explain has no side effects on line changes detection of the next heartbeat
+	var snapshots []string
+
+	err = filepath.WalkDir(home, func(fp string, _ fs.DirEntry, err error) error {
+		if err == nil && fp != home {
+			snapshots = append(snapshots, fp)
+		}
+
+		return err
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, snapshots)
+}
+
+func TestExplain_HideProjectNames(t *testing.T) {
+	resetSingleton(t)
+
+	t.Setenv("WAKATIME_HOME", t.TempDir())
+
+	root := t.TempDir()
+	entity := filepath.Join(root, "main.go")
+
+	err := os.WriteFile(entity, []byte("package main\n"), 0600)
+	require.NoError(t, err)
+
+	v := viper.New()
+	v.Set("entity", entity)
+	v.Set("hide-project-names", "true")
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+	v.Set("project", "secret")
+	v.Set("time", 1585598059.1)
+
+	output, err := cmdheartbeat.Explain(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Contains(t, output, "  project:\n")
+	assert.NotContains(t, output, `"project": "secret"`)
+
+	// explain does not write the obfuscated project name to a project file
+	assert.NoFileExists(t, filepath.Join(root, ".wakatime-project"))
+}
+
+func TestExplain_Filtered(t *testing.T) {
+	resetSingleton(t)
+
+	v := viper.New()
+	v.Set("entity", "/tmp/main.go")
+	v.Set("exclude", "^/tmp/")
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+	v.Set("time", 1585598059.1)
+
+	output, err := cmdheartbeat.Explain(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		"heartbeat #1: /tmp/main.go\n"+
+			"  formatting: no changes\n"+
+			"  entity modifier: no changes\n"+
+			"  repo config: no changes\n"+
+			"  filtering: removed\n"+
+			"\n"+
+			"no heartbeats would have been sent to the api\n",
+		output,
+	)
+}
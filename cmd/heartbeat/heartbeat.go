@@ -13,6 +13,7 @@ import (
 	"github.com/optiflow-os/tracelens-cli/pkg/api"
 	"github.com/optiflow-os/tracelens-cli/pkg/apikey"
 	"github.com/optiflow-os/tracelens-cli/pkg/backoff"
+	"github.com/optiflow-os/tracelens-cli/pkg/category"
 	"github.com/optiflow-os/tracelens-cli/pkg/deps"
 	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
 	"github.com/optiflow-os/tracelens-cli/pkg/filestats"
@@ -23,8 +24,10 @@ import (
 	_ "github.com/optiflow-os/tracelens-cli/pkg/lexer" // force to load all lexers
 	"github.com/optiflow-os/tracelens-cli/pkg/log"
 	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+	"github.com/optiflow-os/tracelens-cli/pkg/output"
 	"github.com/optiflow-os/tracelens-cli/pkg/project"
 	"github.com/optiflow-os/tracelens-cli/pkg/remote"
+	"github.com/optiflow-os/tracelens-cli/pkg/vipertools"
 	"github.com/optiflow-os/tracelens-cli/pkg/wakaerror"
 
 	"github.com/spf13/viper"
@@ -34,12 +37,24 @@ import (
 func Run(ctx context.Context, v *viper.Viper) (int, error) {
 	logger := log.Extract(ctx)
 
+	reporting, err := loadReporting(v)
+	if err != nil {
+		return exitcode.ErrGeneric, err
+	}
+
 	queueFilepath, err := offline.QueueFilepath(ctx, v)
 	if err != nil {
 		logger.Warnf("failed to load offline queue filepath: %s", err)
 	}
 
-	err = SendHeartbeats(ctx, v, queueFilepath)
+	rep, err := sendHeartbeats(ctx, v, queueFilepath, reporting)
+
+	if reporting {
+		defer func() {
+			printReport(ctx, rep)
+		}()
+	}
+
 	if err != nil {
 		var errauth api.ErrAuth
 
@@ -48,6 +63,8 @@ func Run(ctx context.Context, v *viper.Viper) (int, error) {
 		if errors.As(err, &errauth) {
 			if err := offlinecmd.SaveHeartbeats(ctx, v, nil, queueFilepath); err != nil {
 				logger.Errorf("failed to save heartbeats to offline queue: %s", err)
+			} else if reporting && rep == nil {
+				rep = queuedReport(ctx, v, errauth.Error())
 			}
 
 			return errauth.ExitCode(), fmt.Errorf("sending heartbeat(s) failed: %w", errauth)
@@ -72,9 +89,25 @@ func Run(ctx context.Context, v *viper.Viper) (int, error) {
 // heartbeats from the offline queue, if available and offline sync is not
 // explicitly disabled.
 func SendHeartbeats(ctx context.Context, v *viper.Viper, queueFilepath string) error {
+	_, err := sendHeartbeats(ctx, v, queueFilepath, false)
+	return err
+}
+
+// SendHeartbeatsWithReport sends heartbeats like SendHeartbeats and returns a
+// record with the final fate of every input heartbeat, including invalid
+// extra heartbeats. Records are in input order.
+func SendHeartbeatsWithReport(ctx context.Context, v *viper.Viper, queueFilepath string) ([]Record, error) {
+	rep, err := sendHeartbeats(ctx, v, queueFilepath, true)
+
+	return rep.Records(), err
+}
+
+// sendHeartbeats sends the heartbeats and only tracks their fates, if reporting
+// is true. Otherwise the returned report is nil.
+func sendHeartbeats(ctx context.Context, v *viper.Viper, queueFilepath string, reporting bool) (*report, error) {
 	params, err := LoadParams(ctx, v)
 	if err != nil {
-		return fmt.Errorf("failed to load command parameters: %w", err)
+		return nil, fmt.Errorf("failed to load command parameters: %w", err)
 	}
 
 	logger := log.Extract(ctx)
@@ -82,21 +115,28 @@ func SendHeartbeats(ctx context.Context, v *viper.Viper, queueFilepath string) e
 	setLogFields(ctx, params)
 	logger.Debugf("params: %s", params)
 
+	heartbeats := buildHeartbeats(ctx, params)
+
+	var rep *report
+	if reporting {
+		rep = newReport(heartbeats, params.Heartbeat.ExtraHeartbeatErrs)
+	}
+
 	if RateLimited(RateLimitParams{
 		Disabled:   params.Offline.Disabled,
 		LastSentAt: params.Offline.LastSentAt,
 		Timeout:    params.Offline.RateLimit,
 	}) {
 		if err = offlinecmd.SaveHeartbeats(ctx, v, nil, queueFilepath); err == nil {
-			return nil
+			rep.setAll(FateQueued, "rate limited")
+
+			return rep, nil
 		}
 
 		// log offline db error then try to send heartbeats to API so they're not lost
 		logger.Errorf("failed to save rate limited heartbeats: %s", err)
 	}
 
-	heartbeats := buildHeartbeats(ctx, params)
-
 	var chOfflineSave = make(chan bool)
 
 	// only send at once the maximum amount of `offline.SendLimit`.
@@ -105,6 +145,13 @@ func SendHeartbeats(ctx context.Context, v *viper.Viper, queueFilepath string) e
 
 		logger.Debugf("save %d extra heartbeat(s) to offline queue", len(extraHeartbeats))
 
+		rep.set(
+			offline.SendLimit,
+			len(heartbeats),
+			FateQueued,
+			fmt.Sprintf("exceeds limit of %d heartbeats sent at once", offline.SendLimit),
+		)
+
 		go func(done chan<- bool) {
 			if err := offlinecmd.SaveHeartbeats(ctx, v, extraHeartbeats, queueFilepath); err != nil {
 				logger.Errorf("failed to save extra heartbeats to offline queue: %s", err)
@@ -116,10 +163,22 @@ func SendHeartbeats(ctx context.Context, v *viper.Viper, queueFilepath string) e
 		heartbeats = heartbeats[:offline.SendLimit]
 	}
 
-	handleOpts := initHandleOptions(params)
+	tracer := &heartbeat.Tracer{}
+
+	var handleOpts []heartbeat.HandleOption
+
+	if reporting {
+		ctx = heartbeat.TracerToContext(ctx, tracer)
+
+		for _, s := range initStages(params, false) {
+			handleOpts = append(handleOpts, tracer.Trace(s.Name, s.Option))
+		}
+	} else {
+		handleOpts = initHandleOptions(params)
+	}
 
 	if !params.Offline.Disabled {
-		handleOpts = append(handleOpts, offline.WithQueue(queueFilepath))
+		handleOpts = append(handleOpts, offline.WithQueue(queueFilepath, params.Offline.Retention))
 	}
 
 	handleOpts = append(handleOpts, backoff.WithBackoff(backoff.Config{
@@ -132,12 +191,16 @@ func SendHeartbeats(ctx context.Context, v *viper.Viper, queueFilepath string) e
 	apiClient, err := apicmd.NewClientWithoutAuth(ctx, params.API)
 	if err != nil {
 		if !params.Offline.Disabled {
-			if err := offlinecmd.SaveHeartbeats(ctx, v, heartbeats, queueFilepath); err != nil {
-				logger.Errorf("failed to save heartbeats to offline queue: %s", err)
+			if errSave := offlinecmd.SaveHeartbeats(ctx, v, heartbeats, queueFilepath); errSave != nil {
+				logger.Errorf("failed to save heartbeats to offline queue: %s", errSave)
+			} else {
+				rep.set(0, len(heartbeats), FateQueued, err.Error())
 			}
 		}
 
-		return fmt.Errorf("failed to initialize api client: %w", err)
+		rep.set(0, len(heartbeats), FateRejected, err.Error())
+
+		return rep, fmt.Errorf("failed to initialize api client: %w", err)
 	}
 
 	handle := heartbeat.NewHandle(apiClient, handleOpts...)
@@ -148,8 +211,10 @@ func SendHeartbeats(ctx context.Context, v *viper.Viper, queueFilepath string) e
 		<-chOfflineSave
 	}
 
+	rep.trace(0, tracer, results, err, !params.Offline.Disabled)
+
 	if err != nil {
-		return err
+		return rep, err
 	}
 
 	for _, result := range results {
@@ -162,7 +227,51 @@ func SendHeartbeats(ctx context.Context, v *viper.Viper, queueFilepath string) e
 		logger.Errorf("failed to reset rate limit: %s", err)
 	}
 
-	return nil
+	return rep, nil
+}
+
+// loadReporting returns true, if the fate of every heartbeat should be
+// printed as json.
+func loadReporting(v *viper.Viper) (bool, error) {
+	outputStr := vipertools.GetString(v, "output")
+	if outputStr == "" {
+		return false, nil
+	}
+
+	out, err := output.Parse(outputStr)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse output: %s", err)
+	}
+
+	return out == output.JSONOutput || out == output.RawJSONOutput, nil
+}
+
+// queuedReport returns a report with all heartbeats queued, used when the
+// api params couldn't be loaded and heartbeats were saved to the offline queue.
+func queuedReport(ctx context.Context, v *viper.Viper, reason string) *report {
+	heartbeatParams, err := paramscmd.LoadHeartbeatParams(ctx, v)
+	if err != nil {
+		return nil
+	}
+
+	rep := newReport(
+		buildHeartbeats(ctx, paramscmd.Params{Heartbeat: heartbeatParams}),
+		heartbeatParams.ExtraHeartbeatErrs,
+	)
+	rep.setAll(FateQueued, reason)
+
+	return rep
+}
+
+func printReport(ctx context.Context, rep *report) {
+	rendered, err := renderReport(rep.Records())
+	if err != nil {
+		log.Extract(ctx).Errorf("failed to render heartbeat records: %s", err)
+
+		return
+	}
+
+	fmt.Println(rendered)
 }
 
 // LoadParams loads params from viper.Viper instance. Returns ErrAuth
@@ -259,6 +368,12 @@ func buildHeartbeats(ctx context.Context, params paramscmd.Params) []heartbeat.H
 		userAgent,
 	))
 
+	heartbeats[0].AILineChanges = params.Heartbeat.AILineChanges
+	heartbeats[0].AITool = params.Heartbeat.AITool
+	heartbeats[0].CategoryExplicit = params.Heartbeat.CategoryExplicit
+	heartbeats[0].Cwd = params.Heartbeat.Cwd
+	heartbeats[0].HumanLineChanges = params.Heartbeat.HumanLineChanges
+
 	if len(params.Heartbeat.ExtraHeartbeats) > 0 {
 		logger := log.Extract(ctx)
 		logger.Debugf("include %d extra heartbeat(s) from stdin", len(params.Heartbeat.ExtraHeartbeats))
@@ -286,54 +401,111 @@ func buildHeartbeats(ctx context.Context, params paramscmd.Params) []heartbeat.H
 				h.Time,
 				userAgent,
 			))
+
+			heartbeats[len(heartbeats)-1].AILineChanges = h.AILineChanges
+			heartbeats[len(heartbeats)-1].AITool = h.AITool
+			heartbeats[len(heartbeats)-1].CategoryExplicit = h.CategoryExplicit
+			heartbeats[len(heartbeats)-1].Cwd = h.Cwd
+			heartbeats[len(heartbeats)-1].HumanLineChanges = h.HumanLineChanges
+
+			// keep the uuid passed by the plugin, if it sorts by heartbeat time
+			if heartbeat.ValidUUID(h.UUID, h.Time) {
+				heartbeats[len(heartbeats)-1].UUID = h.UUID
+			}
 		}
 	}
 
 	return heartbeats
 }
 
+// stage is a named handle option of the heartbeat processing pipeline.
+type stage struct {
+	Name   string
+	Option heartbeat.HandleOption
+}
+
 func initHandleOptions(params paramscmd.Params) []heartbeat.HandleOption {
-	return []heartbeat.HandleOption{
-		heartbeat.WithFormatting(),
-		heartbeat.WithEntityModifier(),
-		filter.WithFiltering(filter.Config{
-			Exclude:                    params.Heartbeat.Filter.Exclude,
-			Include:                    params.Heartbeat.Filter.Include,
-			IncludeOnlyWithProjectFile: params.Heartbeat.Filter.IncludeOnlyWithProjectFile,
-		}),
-		remote.WithDetection(),
-		apikey.WithReplacing(apikey.Config{
+	stages := initStages(params, false)
+
+	opts := make([]heartbeat.HandleOption, 0, len(stages))
+	for _, s := range stages {
+		opts = append(opts, s.Option)
+	}
+
+	return opts
+}
+
+// initStages returns the stages of the heartbeat processing pipeline. With
+// dryRun, stages don't keep state for the next heartbeats.
+func initStages(params paramscmd.Params, dryRun bool) []stage {
+	// stages depending on settings of repository-local config files
+	repoParams := func(build func(paramscmd.Heartbeat) heartbeat.HandleOption) heartbeat.HandleOption {
+		return paramscmd.WithRepoParams(params.Heartbeat, build)
+	}
+
+	return []stage{
+		{Name: "formatting", Option: heartbeat.WithFormatting()},
+		{Name: "entity modifier", Option: heartbeat.WithEntityModifier()},
+		{Name: "repo config", Option: paramscmd.WithRepoConfig()},
+		{Name: "filtering", Option: repoParams(func(p paramscmd.Heartbeat) heartbeat.HandleOption {
+			return filter.WithFiltering(filter.Config{
+				Exclude:                    p.Filter.Exclude,
+				Include:                    p.Filter.Include,
+				IncludeOnlyWithProjectFile: p.Filter.IncludeOnlyWithProjectFile,
+			})
+		})},
+		{Name: "remote", Option: remote.WithDetection()},
+		{Name: "apikey", Option: apikey.WithReplacing(apikey.Config{
+			APIURL:        params.API.URL,
 			DefaultAPIKey: params.API.Key,
 			MapPatterns:   params.API.KeyPatterns,
-		}),
-		filestats.WithDetection(),
-		language.WithDetection(language.Config{
+		})},
+		{Name: "language", Option: language.WithDetection(language.Config{
 			GuessLanguage: params.Heartbeat.GuessLanguage,
-		}),
-		deps.WithDetection(deps.Config{
-			FilePatterns: params.Heartbeat.Sanitize.HideFileNames,
-		}),
-		project.WithDetection(project.Config{
-			HideProjectNames:     params.Heartbeat.Sanitize.HideProjectNames,
-			MapPatterns:          params.Heartbeat.Project.MapPatterns,
-			ProjectFromGitRemote: params.Heartbeat.Project.ProjectFromGitRemote,
-			Submodule: project.Submodule{
-				DisabledPatterns: params.Heartbeat.Project.SubmodulesDisabled,
-				MapPatterns:      params.Heartbeat.Project.SubmoduleMapPatterns,
-			},
-		}),
-		project.WithFiltering(project.FilterConfig{
-			ExcludeUnknownProject: params.Heartbeat.Filter.ExcludeUnknownProject,
-		}),
-		heartbeat.WithSanitization(heartbeat.SanitizeConfig{
-			BranchPatterns:     params.Heartbeat.Sanitize.HideBranchNames,
-			DependencyPatterns: params.Heartbeat.Sanitize.HideDependencies,
-			FilePatterns:       params.Heartbeat.Sanitize.HideFileNames,
-			HideProjectFolder:  params.Heartbeat.Sanitize.HideProjectFolder,
-			ProjectPatterns:    params.Heartbeat.Sanitize.HideProjectNames,
-		}),
-		remote.WithCleanup(),
-		filter.WithLengthValidator(),
+		})},
+		{Name: "filestats", Option: filestats.WithDetection()},
+		{Name: "line changes", Option: filestats.WithLineChanges(filestats.LineChangesConfig{
+			DryRun: dryRun,
+		})},
+		{Name: "deps", Option: repoParams(func(p paramscmd.Heartbeat) heartbeat.HandleOption {
+			return deps.WithDetection(deps.Config{
+				FilePatterns: p.Sanitize.HideFileNames,
+			})
+		})},
+		{Name: "project", Option: repoParams(func(p paramscmd.Heartbeat) heartbeat.HandleOption {
+			return project.WithDetection(project.Config{
+				DomainRules:          p.Project.DomainRules,
+				DryRun:               dryRun,
+				HideProjectNames:     p.Sanitize.HideProjectNames,
+				MapPatterns:          p.Project.MapPatterns,
+				ProjectFromGitRemote: p.Project.ProjectFromGitRemote,
+				Submodule: project.Submodule{
+					DisabledPatterns: p.Project.SubmodulesDisabled,
+					MapPatterns:      p.Project.SubmoduleMapPatterns,
+				},
+			})
+		})},
+		{Name: "category", Option: category.WithDetection(category.Config{
+			Rules: params.Heartbeat.CategoryRules,
+		})},
+		{Name: "project filtering", Option: repoParams(func(p paramscmd.Heartbeat) heartbeat.HandleOption {
+			return project.WithFiltering(project.FilterConfig{
+				ExcludeUnknownProject: p.Filter.ExcludeUnknownProject,
+			})
+		})},
+		{Name: "sanitization", Option: repoParams(func(p paramscmd.Heartbeat) heartbeat.HandleOption {
+			return heartbeat.WithSanitization(heartbeat.SanitizeConfig{
+				BranchPatterns:     p.Sanitize.HideBranchNames,
+				CommandArgPatterns: p.Sanitize.CommandArgPatterns,
+				DependencyPatterns: p.Sanitize.HideDependencies,
+				FilePatterns:       p.Sanitize.HideFileNames,
+				HideProjectFolder:  p.Sanitize.HideProjectFolder,
+				ProjectPatterns:    p.Sanitize.HideProjectNames,
+				SendCommandArgs:    p.Sanitize.SendCommandArgs,
+			})
+		})},
+		{Name: "remote cleanup", Option: remote.WithCleanup()},
+		{Name: "length validation", Option: filter.WithLengthValidator()},
 	}
 }
 
@@ -19,6 +19,7 @@ import (
 	cmdheartbeat "github.com/optiflow-os/tracelens-cli/cmd/heartbeat"
 	cmdparams "github.com/optiflow-os/tracelens-cli/cmd/params"
 	"github.com/optiflow-os/tracelens-cli/pkg/api"
+	"github.com/optiflow-os/tracelens-cli/pkg/apikey"
 	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
 	"github.com/optiflow-os/tracelens-cli/pkg/ini"
 	"github.com/optiflow-os/tracelens-cli/pkg/log"
@@ -32,12 +33,14 @@ import (
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	bolt "go.etcd.io/bbolt"
 )
 
 func TestSendHeartbeats(t *testing.T) {
 	resetSingleton(t)
 
+	// keep file snapshots of line changes detection apart from other runs
+	t.Setenv("WAKATIME_HOME", t.TempDir())
+
 	testServerURL, router, tearDown := setupTestServer()
 	defer tearDown()
 
@@ -91,7 +94,7 @@ func TestSendHeartbeats(t *testing.T) {
 		)
 
 		assert.True(t, strings.HasSuffix(entity.Entity, "testdata/main.go"))
-		assert.JSONEq(t, expectedBodyStr, string(body))
+		assert.JSONEq(t, expectedBodyStr, withoutIDs(t, body))
 
 		// send response
 		w.WriteHeader(http.StatusCreated)
@@ -272,6 +275,194 @@ func TestSendHeartbeats_WithFiltering_Exclude_All(t *testing.T) {
 	assert.Equal(t, 0, numCalls)
 }
 
+func TestSendHeartbeatsWithReport(t *testing.T) {
+	resetSingleton(t)
+
+	testServerURL, router, tearDown := setupTestServer()
+	defer tearDown()
+
+	var numCalls int
+
+	router.HandleFunc("/users/current/heartbeats.bulk", func(w http.ResponseWriter, req *http.Request) {
+		numCalls++
+
+		var body []struct {
+			Entity string `json:"entity"`
+		}
+
+		err := json.NewDecoder(req.Body).Decode(&body)
+		require.NoError(t, err)
+
+		require.Len(t, body, 2)
+		assert.True(t, strings.HasSuffix(body[0].Entity, "testdata/main.go"))
+		assert.True(t, strings.HasSuffix(body[1].Entity, "testdata/main.py"))
+
+		w.WriteHeader(http.StatusAccepted)
+
+		_, err = w.Write([]byte(`{"responses": [[{"data": {}}, 201], [{"error": "invalid language"}, 400]]}`))
+		require.NoError(t, err)
+	})
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	defer func() {
+		r.Close()
+		w.Close()
+	}()
+
+	origStdin := os.Stdin
+
+	defer func() { os.Stdin = origStdin }()
+
+	os.Stdin = r
+
+	go func() {
+		_, err := w.WriteString(
+			`{"entity": "testdata/main.py", "entity_type": "file", "time": 1585598060}` + "\n" +
+				`{"entity": "testdata/main.go"` + "\n" +
+				`{"entity": "/tmp/excluded/main.go", "entity_type": "file", "time": 1585598061}` + "\n" +
+				`{"entity": "testdata/main.rb"` + "\n",
+		)
+		require.NoError(t, err)
+
+		w.Close()
+	}()
+
+	tmpFile, err := os.CreateTemp(t.TempDir(), "wakatime-config")
+	require.NoError(t, err)
+
+	defer tmpFile.Close()
+
+	tmpFileInternal, err := os.CreateTemp(t.TempDir(), "wakatime-internal-config")
+	require.NoError(t, err)
+
+	defer tmpFileInternal.Close()
+
+	v := viper.New()
+	v.SetDefault("sync-offline-activity", 1000)
+	v.Set("api-url", testServerURL)
+	v.Set("config", tmpFile.Name())
+	v.Set("internal-config", tmpFileInternal.Name())
+	v.Set("entity", "testdata/main.go")
+	v.Set("entity-type", "file")
+	v.Set("exclude", []string{"^/tmp/excluded/"})
+	v.Set("extra-heartbeats", true)
+	v.Set("extra-heartbeats-format", "ndjson")
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+	v.Set("plugin", "plugin/0.0.1")
+	v.Set("project", "wakatime-cli")
+	v.Set("time", 1585598059.1)
+	v.Set("timeout", 5)
+
+	offlineQueueFile, err := os.CreateTemp(t.TempDir(), "")
+	require.NoError(t, err)
+
+	defer offlineQueueFile.Close()
+
+	records, err := cmdheartbeat.SendHeartbeatsWithReport(context.Background(), v, offlineQueueFile.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, numCalls)
+
+	// records are in input order, including the invalid lines
+	require.Len(t, records, 5)
+
+	assert.Equal(t, "testdata/main.go", records[0].Entity)
+	assert.Equal(t, cmdheartbeat.FateSent, records[0].Fate)
+	assert.Equal(t, http.StatusCreated, records[0].Status)
+	require.NotNil(t, records[0].Payload)
+	assert.True(t, strings.HasSuffix(records[0].Payload.Entity, "testdata/main.go"))
+
+	assert.Equal(t, "testdata/main.py", records[1].Entity)
+	assert.Equal(t, cmdheartbeat.FateRejected, records[1].Fate)
+	assert.Equal(t, http.StatusBadRequest, records[1].Status)
+	assert.Equal(t, "invalid language", records[1].Reason)
+	require.NotNil(t, records[1].Payload)
+
+	assert.Equal(t, cmdheartbeat.Record{
+		Fate:   cmdheartbeat.FateRejected,
+		Line:   2,
+		Reason: "failed to json decode: unexpected end of JSON input",
+	}, records[2])
+
+	assert.Equal(t, cmdheartbeat.Record{
+		Entity: "/tmp/excluded/main.go",
+		Fate:   cmdheartbeat.FateFiltered,
+		Reason: `filter by pattern: skipping because matches exclude pattern "(?i)^/tmp/excluded/"`,
+	}, records[3])
+
+	assert.Equal(t, cmdheartbeat.Record{
+		Fate:   cmdheartbeat.FateRejected,
+		Line:   4,
+		Reason: "failed to json decode: unexpected end of JSON input",
+	}, records[4])
+
+	// rejected heartbeats are not queued
+	offlineCount, err := offline.CountHeartbeats(context.Background(), offlineQueueFile.Name())
+	require.NoError(t, err)
+
+	assert.Zero(t, offlineCount)
+}
+
+func TestSendHeartbeatsWithReport_RateLimited(t *testing.T) {
+	resetSingleton(t)
+
+	testServerURL, router, tearDown := setupTestServer()
+	defer tearDown()
+
+	var numCalls int
+
+	router.HandleFunc("/users/current/heartbeats.bulk", func(_ http.ResponseWriter, _ *http.Request) {
+		numCalls++
+	})
+
+	tmpFile, err := os.CreateTemp(t.TempDir(), "wakatime-config")
+	require.NoError(t, err)
+
+	defer tmpFile.Close()
+
+	tmpFileInternal, err := os.CreateTemp(t.TempDir(), "wakatime-internal-config")
+	require.NoError(t, err)
+
+	defer tmpFileInternal.Close()
+
+	offlineQueueFile, err := os.CreateTemp(t.TempDir(), "")
+	require.NoError(t, err)
+
+	defer offlineQueueFile.Close()
+
+	v := viper.New()
+	v.Set("api-url", testServerURL)
+	v.Set("config", tmpFile.Name())
+	v.Set("internal-config", tmpFileInternal.Name())
+	v.Set("entity", "testdata/main.go")
+	v.Set("entity-type", "file")
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+	v.Set("heartbeat-rate-limit-seconds", 500)
+	v.Set("internal.heartbeats_last_sent_at", time.Now().Add(-time.Minute).Format(time.RFC3339))
+	v.Set("offline-queue-file", offlineQueueFile.Name())
+	v.Set("time", 1585598059.1)
+
+	records, err := cmdheartbeat.SendHeartbeatsWithReport(context.Background(), v, offlineQueueFile.Name())
+	require.NoError(t, err)
+
+	assert.Zero(t, numCalls)
+
+	assert.Equal(t, []cmdheartbeat.Record{
+		{
+			Entity: "testdata/main.go",
+			Fate:   cmdheartbeat.FateQueued,
+			Reason: "rate limited",
+		},
+	}, records)
+
+	offlineCount, err := offline.CountHeartbeats(context.Background(), offlineQueueFile.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, offlineCount)
+}
+
 func TestSendHeartbeats_ExtraHeartbeats(t *testing.T) {
 	resetSingleton(t)
 
@@ -344,7 +535,7 @@ func TestSendHeartbeats_ExtraHeartbeats(t *testing.T) {
 			entities[24].Entity, subfolders, userAgent,
 		)
 
-		assert.JSONEq(t, expectedBodyStr, string(body))
+		assert.JSONEq(t, expectedBodyStr, withoutIDs(t, body))
 
 		// send response
 		w.WriteHeader(http.StatusCreated)
@@ -500,27 +691,12 @@ func TestSendHeartbeats_ExtraHeartbeats_Sanitize(t *testing.T) {
 	offlineCount, err := offline.CountHeartbeats(ctx, offlineQueueFile.Name())
 	require.NoError(t, err)
 
-	db, err := bolt.Open(offlineQueueFile.Name(), 0600, nil)
-	require.NoError(t, err)
-
-	defer func() {
-		err = db.Close()
-		require.NoError(t, err)
-	}()
-
-	tx, err := db.Begin(true)
-	require.NoError(t, err)
-
-	q := offline.NewQueue(tx)
-
-	hh, err := q.PopMany(1)
-	require.NoError(t, err)
-
-	err = tx.Commit()
+	hh, err := offline.ReadHeartbeats(ctx, offlineQueueFile.Name(), 1)
 	require.NoError(t, err)
 
 	assert.Equal(t, 1, offlineCount)
-	assert.Len(t, hh, 1)
+	require.Len(t, hh, 1)
+	assert.Regexp(t, uuidv7Regex, hh[0].UUID)
 
 	info, err := goInfo.GetInfo()
 	require.NoError(t, err)
@@ -537,20 +713,24 @@ func TestSendHeartbeats_ExtraHeartbeats_Sanitize(t *testing.T) {
 
 	assert.Equal(t, []heartbeat.Heartbeat{
 		{
-			Branch:           nil,
-			Category:         heartbeat.CodingCategory,
-			CursorPosition:   nil,
-			Dependencies:     nil,
-			Entity:           "HIDDEN.go",
-			EntityType:       heartbeat.FileType,
-			IsWrite:          heartbeat.PointerTo(true),
-			Language:         heartbeat.PointerTo("Go"),
-			LineNumber:       nil,
-			Lines:            nil,
-			Project:          heartbeat.PointerTo("wakatime-cli"),
-			ProjectRootCount: nil,
-			Time:             1585598059,
-			UserAgent:        userAgent,
+			// sanitized entity is queued with the api key and url it was meant for
+			APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000000"),
+			APIURL:            testServerURL,
+			Branch:            nil,
+			Category:          heartbeat.CodingCategory,
+			CursorPosition:    nil,
+			Dependencies:      nil,
+			Entity:            "HIDDEN.go",
+			EntityType:        heartbeat.FileType,
+			IsWrite:           heartbeat.PointerTo(true),
+			Language:          heartbeat.PointerTo("Go"),
+			LineNumber:        nil,
+			Lines:             nil,
+			Project:           heartbeat.PointerTo("wakatime-cli"),
+			ProjectRootCount:  nil,
+			Time:              1585598059,
+			UserAgent:         userAgent,
+			UUID:              hh[0].UUID,
 		}}, hh)
 
 	assert.Eventually(t, func() bool { return numCalls == 1 }, time.Second, 50*time.Millisecond)
@@ -644,7 +824,7 @@ func TestSendHeartbeats_ExtraHeartbeatsIsUnsavedEntity(t *testing.T) {
 			entities[2].Entity, subfolders, userAgent,
 		)
 
-		assert.JSONEq(t, expectedBodyStr, string(body))
+		assert.JSONEq(t, expectedBodyStr, withoutIDs(t, body))
 
 		// send response
 		w.WriteHeader(http.StatusCreated)
@@ -776,7 +956,7 @@ func TestSendHeartbeats_NonExistingExtraHeartbeatsEntity(t *testing.T) {
 			entities[1].Entity, subfolders, userAgent,
 		)
 
-		assert.JSONEq(t, expectedBodyStr, string(body))
+		assert.JSONEq(t, expectedBodyStr, withoutIDs(t, body))
 
 		// send response
 		w.WriteHeader(http.StatusCreated)
@@ -1021,6 +1201,9 @@ func TestSendHeartbeats_ErrBackoff_Verbose(t *testing.T) {
 func TestSendHeartbeats_ObfuscateProject(t *testing.T) {
 	resetSingleton(t)
 
+	// keep file snapshots of line changes detection apart from other runs
+	t.Setenv("WAKATIME_HOME", t.TempDir())
+
 	testServerURL, router, tearDown := setupTestServer()
 	defer tearDown()
 
@@ -1069,7 +1252,7 @@ func TestSendHeartbeats_ObfuscateProject(t *testing.T) {
 		)
 
 		assert.True(t, strings.HasSuffix(entity.Entity, "src/pkg/file.go"))
-		assert.JSONEq(t, expectedBodyStr, string(body))
+		assert.JSONEq(t, expectedBodyStr, withoutIDs(t, body))
 
 		// send response
 		w.WriteHeader(http.StatusCreated)
@@ -1116,6 +1299,9 @@ func TestSendHeartbeats_ObfuscateProject(t *testing.T) {
 func TestSendHeartbeats_ObfuscateProjectNotBranch(t *testing.T) {
 	resetSingleton(t)
 
+	// keep file snapshots of line changes detection apart from other runs
+	t.Setenv("WAKATIME_HOME", t.TempDir())
+
 	testServerURL, router, tearDown := setupTestServer()
 	defer tearDown()
 
@@ -1159,7 +1345,7 @@ func TestSendHeartbeats_ObfuscateProjectNotBranch(t *testing.T) {
 		expectedBodyStr := fmt.Sprintf(string(expectedBody), entity.Entity, lines[0], heartbeat.UserAgent(ctx, plugin))
 
 		assert.True(t, strings.HasSuffix(entity.Entity, "src/pkg/file.go"))
-		assert.JSONEq(t, expectedBodyStr, string(body))
+		assert.JSONEq(t, expectedBodyStr, withoutIDs(t, body))
 
 		// send response
 		w.WriteHeader(http.StatusCreated)
@@ -1292,6 +1478,30 @@ func TestResetRateLimit(t *testing.T) {
 	assert.WithinDuration(t, time.Now(), lastSentAt, 1*time.Second)
 }
 
+// withoutIDs asserts all heartbeats of a request body have a uuid v7 id and
+// returns the body without them.
+const uuidv7Regex = "^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$"
+
+func withoutIDs(t *testing.T, body []byte) string {
+	t.Helper()
+
+	var heartbeats []map[string]any
+
+	err := json.Unmarshal(body, &heartbeats)
+	require.NoError(t, err)
+
+	for _, h := range heartbeats {
+		assert.Regexp(t, uuidv7Regex, h["id"])
+
+		delete(h, "id")
+	}
+
+	data, err := json.Marshal(heartbeats)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
 func setupTestServer() (string, *http.ServeMux, func()) {
 	router := http.NewServeMux()
 	srv := httptest.NewServer(router)
@@ -1338,4 +1548,5 @@ func resetSingleton(t *testing.T) {
 	t.Helper()
 
 	cmdparams.Once = sync.Once{}
+	cmdparams.ShellCommandOnce = sync.Once{}
 }
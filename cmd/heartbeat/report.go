@@ -0,0 +1,217 @@
+package heartbeat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	paramscmd "github.com/optiflow-os/tracelens-cli/cmd/params"
+	"github.com/optiflow-os/tracelens-cli/pkg/api"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+)
+
+// Fate is the final outcome of a heartbeat passed to the heartbeat command.
+type Fate string
+
+const (
+	// FateFiltered means a pipeline stage skipped the heartbeat.
+	FateFiltered Fate = "filtered"
+	// FateQueued means the heartbeat was saved to the offline queue.
+	FateQueued Fate = "queued"
+	// FateRejected means the heartbeat was invalid or refused by the api. Heartbeats
+	// refused by the api are kept as dead letters, if offline queueing is enabled.
+	FateRejected Fate = "rejected"
+	// FateSent means the api accepted the heartbeat.
+	FateSent Fate = "sent"
+)
+
+// Record is the outcome of a single input heartbeat, printed with --output json.
+type Record struct {
+	// Entity is the entity as passed in, before formatting and sanitization.
+	Entity string `json:"entity,omitempty"`
+	Fate   Fate   `json:"fate"`
+	// Line is the line number of an invalid extra heartbeat read as ndjson.
+	Line   int    `json:"line,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Status is the http status code returned by the api for this heartbeat.
+	Status int `json:"status,omitempty"`
+	// Payload is the sanitized heartbeat sent to the api.
+	Payload *heartbeat.Heartbeat `json:"payload,omitempty"`
+}
+
+// report collects the records of the input heartbeats in their initial order.
+// Invalid extra heartbeats are kept apart, so records are indexed like the
+// heartbeats passed through the pipeline.
+type report struct {
+	invalid []paramscmd.ExtraHeartbeatError
+	records []Record
+}
+
+func newReport(heartbeats []heartbeat.Heartbeat, invalid []paramscmd.ExtraHeartbeatError) *report {
+	records := make([]Record, 0, len(heartbeats))
+
+	for _, h := range heartbeats {
+		records = append(records, Record{Entity: h.Entity})
+	}
+
+	return &report{
+		invalid: invalid,
+		records: records,
+	}
+}
+
+// set sets fate and reason of the input heartbeats in range [from, to), which
+// have no fate yet.
+func (r *report) set(from, to int, fate Fate, reason string) {
+	if r == nil {
+		return
+	}
+
+	for n := from; n < to && n < len(r.records); n++ {
+		if r.records[n].Fate != "" {
+			continue
+		}
+
+		r.records[n].Fate = fate
+		r.records[n].Reason = reason
+	}
+}
+
+// setAll sets fate and reason of all input heartbeats, which have no fate yet.
+func (r *report) setAll(fate Fate, reason string) {
+	if r == nil {
+		return
+	}
+
+	r.set(0, len(r.records), fate, reason)
+}
+
+// trace sets the fates of the heartbeats passed through a traced pipeline. The
+// ids of the tracer are relative to offset in the input heartbeats. Heartbeats
+// passed on by the last stage are matched to the api results by their order.
+// Failures are queued, if queueing is true, otherwise they are rejected.
+func (r *report) trace(offset int, tracer *heartbeat.Tracer, results []heartbeat.Result, err error, queueing bool) {
+	if r == nil {
+		return
+	}
+
+	var errbadrequest api.ErrBadRequest
+
+	failed := FateRejected
+	if queueing && !errors.As(err, &errbadrequest) {
+		failed = FateQueued
+	}
+
+	for _, step := range tracer.Steps {
+		if step.After == nil {
+			for id := range step.Before {
+				reason := fmt.Sprintf("aborted by %s stage", step.Stage)
+				if err != nil {
+					reason = err.Error()
+				}
+
+				r.set(offset+id, offset+id+1, FateRejected, reason)
+			}
+
+			return
+		}
+
+		for id := range step.Before {
+			if _, ok := step.After[id]; ok {
+				continue
+			}
+
+			reason, ok := step.Reasons[id]
+			if !ok {
+				reason = fmt.Sprintf("skipped by %s stage", step.Stage)
+			}
+
+			r.set(offset+id, offset+id+1, FateFiltered, reason)
+		}
+	}
+
+	if len(tracer.Steps) == 0 {
+		return
+	}
+
+	last := tracer.Steps[len(tracer.Steps)-1]
+
+	for n, id := range tracer.IDs() {
+		if offset+id >= len(r.records) || r.records[offset+id].Fate != "" {
+			continue
+		}
+
+		record := &r.records[offset+id]
+
+		payload := last.After[id]
+		record.Payload = &payload
+
+		switch {
+		case err != nil:
+			record.Fate = failed
+			record.Reason = err.Error()
+		case n >= len(results):
+			record.Fate = failed
+			record.Reason = "missing result from api"
+		default:
+			record.Status = results[n].Status
+			record.Reason = strings.Join(results[n].Errors, " ")
+
+			switch {
+			case results[n].Status >= http.StatusOK && results[n].Status < http.StatusMultipleChoices:
+				record.Fate = FateSent
+			case results[n].Status == http.StatusBadRequest:
+				record.Fate = FateRejected
+			default:
+				record.Fate = failed
+			}
+		}
+	}
+}
+
+// Records returns the records of all input heartbeats. Invalid extra heartbeats
+// are inserted at the position of their line.
+func (r *report) Records() []Record {
+	if r == nil {
+		return []Record{}
+	}
+
+	records := make([]Record, 0, len(r.records)+len(r.invalid))
+
+	var next int
+
+	for n, record := range r.records {
+		// the first heartbeat is passed by flags, followed by the extra heartbeats
+		for ; next < len(r.invalid) && r.invalid[next].Index < n; next++ {
+			records = append(records, invalidRecord(r.invalid[next]))
+		}
+
+		records = append(records, record)
+	}
+
+	for _, e := range r.invalid[next:] {
+		records = append(records, invalidRecord(e))
+	}
+
+	return records
+}
+
+func invalidRecord(e paramscmd.ExtraHeartbeatError) Record {
+	return Record{
+		Fate:   FateRejected,
+		Line:   e.Line,
+		Reason: e.Err.Error(),
+	}
+}
+
+// renderReport renders the records as json.
+func renderReport(records []Record) (string, error) {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return "", fmt.Errorf("failed to json marshal heartbeat records: %s", err)
+	}
+
+	return string(data), nil
+}
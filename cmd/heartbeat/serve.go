@@ -0,0 +1,509 @@
+package heartbeat
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	apicmd "github.com/optiflow-os/tracelens-cli/cmd/api"
+	paramscmd "github.com/optiflow-os/tracelens-cli/cmd/params"
+	"github.com/optiflow-os/tracelens-cli/pkg/api"
+	"github.com/optiflow-os/tracelens-cli/pkg/apikey"
+	"github.com/optiflow-os/tracelens-cli/pkg/backoff"
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+	"github.com/optiflow-os/tracelens-cli/pkg/vipertools"
+	"github.com/optiflow-os/tracelens-cli/pkg/wakaerror"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// ServeListenDefault is the default address the serve command listens on.
+	ServeListenDefault = "127.0.0.1:9291"
+	// serveMaxBodyBytes is the maximum size of a request body.
+	serveMaxBodyBytes = 10 << 20
+	// serveShutdownTimeout is the maximum duration to wait for in-flight requests on shutdown.
+	serveShutdownTimeout = 10 * time.Second
+)
+
+// RunServe executes the serve command. It listens on localhost and exposes the
+// heartbeats.bulk and statusbar/today api endpoints, for tools which can speak
+// http but can't execute the cli.
+func RunServe(ctx context.Context, v *viper.Viper) (int, error) {
+	err := serve(ctx, v)
+	if err != nil {
+		if errwaka, ok := err.(wakaerror.Error); ok {
+			return errwaka.ExitCode(), fmt.Errorf("serving api failed: %w", errwaka)
+		}
+
+		return exitcode.ErrGeneric, fmt.Errorf("serving api failed: %w", err)
+	}
+
+	return exitcode.Success, nil
+}
+
+func serve(ctx context.Context, v *viper.Viper) error {
+	logger := log.Extract(ctx)
+
+	addr := vipertools.GetString(v, "serve-listen")
+	if addr == "" {
+		addr = ServeListenDefault
+	}
+
+	if err := validateLoopback(addr); err != nil {
+		return err
+	}
+
+	queueFilepath, err := offline.QueueFilepath(ctx, v)
+	if err != nil {
+		logger.Warnf("failed to load offline queue filepath: %s", err)
+	}
+
+	mux, err := NewServeMux(ctx, v, queueFilepath)
+	if err != nil {
+		return err
+	}
+
+	stopKeepingOpen := offline.KeepOpen(queueFilepath, daemonDBIdleTimeout)
+	defer stopKeepingOpen()
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %q: %s", addr, err)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Warnf("failed to shut down server: %s", err)
+		}
+	}()
+
+	logger.Infof("serving api on http://%s", l.Addr())
+
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %s", err)
+	}
+
+	return nil
+}
+
+// NewServeMux returns a mux serving the heartbeats.bulk and statusbar/today
+// api endpoints, using the offline queue at queueFilepath.
+func NewServeMux(ctx context.Context, v *viper.Viper, queueFilepath string) (*http.ServeMux, error) {
+	params, err := loadPipelineParams(ctx, v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load command parameters: %w", err)
+	}
+
+	logger := log.Extract(ctx)
+	logger.Debugf("params: %s", params)
+
+	apiClient, err := apicmd.NewClientWithoutAuth(ctx, params.API)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize api client: %w", err)
+	}
+
+	apiClientWithAuth, err := apicmd.NewClient(ctx, params.API)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize api client: %w", err)
+	}
+
+	s := newServeHandler(v, params, apiClient, apiClientWithAuth, queueFilepath)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /users/current/heartbeats.bulk", s.authenticate(s.heartbeatsBulk))
+	mux.HandleFunc("GET /users/current/statusbar/today", s.authenticate(s.statusBarToday))
+
+	return mux, nil
+}
+
+// validateLoopback returns an error, if addr is not a loopback address, as
+// the served endpoints use the configured api keys.
+func validateLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %s", addr, err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("invalid listen address %q: only loopback addresses are allowed", addr)
+}
+
+// serveHandler handles requests to the served api endpoints.
+type serveHandler struct {
+	backoff heartbeat.HandleOption
+	keys    []string
+	// mu serializes heartbeat processing, as the backoff option keeps state across requests.
+	mu            sync.Mutex
+	params        paramscmd.Params
+	queueFilepath string
+	sender        heartbeat.Sender
+	sync          heartbeat.Handle
+	today         *api.Client
+}
+
+func newServeHandler(
+	v *viper.Viper,
+	params paramscmd.Params,
+	sender heartbeat.Sender,
+	today *api.Client,
+	queueFilepath string,
+) *serveHandler {
+	keys := []string{params.API.Key}
+	for _, p := range params.API.KeyPatterns {
+		keys = append(keys, p.APIKey)
+	}
+
+	return &serveHandler{
+		backoff: backoff.WithBackoff(backoff.Config{
+			V:        v,
+			At:       params.API.BackoffAt,
+			Retries:  params.API.BackoffRetries,
+			HasProxy: params.API.ProxyURL != "",
+		}),
+		keys:          keys,
+		params:        params,
+		queueFilepath: queueFilepath,
+		sender:        sender,
+		sync: heartbeat.NewHandle(sender,
+			offline.WithSync(queueFilepath, params.Offline.SyncMax, params.Offline.Retention),
+			apikey.WithReplacing(apikey.Config{
+				APIURL:        params.API.URL,
+				DefaultAPIKey: params.API.Key,
+				MapPatterns:   params.API.KeyPatterns,
+			}),
+		),
+		today: today,
+	}
+}
+
+// authenticate only passes requests authenticated with one of the configured
+// api keys to the next handler, either via basic auth, bearer token or the
+// api_key query parameter like supported by the api.
+func (s *serveHandler) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := requestAPIKey(r)
+
+		for _, k := range s.keys {
+			if k != "" && subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+				next(w, r)
+
+				return
+			}
+		}
+
+		writeJSON(r.Context(), w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+}
+
+func requestAPIKey(r *http.Request) string {
+	if key := r.URL.Query().Get("api_key"); key != "" {
+		return key
+	}
+
+	auth := r.Header.Get("Authorization")
+
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+
+	if encoded, ok := strings.CutPrefix(auth, "Basic "); ok {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return ""
+		}
+
+		// the api key is sent either as user or as password
+		user, password, _ := strings.Cut(string(decoded), ":")
+		if password != "" {
+			return password
+		}
+
+		return user
+	}
+
+	return ""
+}
+
+// heartbeatsBulk processes the posted heartbeats like the heartbeat command
+// does and responds with one result per posted heartbeat, in the format of the
+// api's heartbeats.bulk endpoint. Heartbeats, which were filtered or saved to
+// the offline queue, are reported as accepted. Heartbeats rejected by the api
+// are reported as bad request.
+func (s *serveHandler) heartbeatsBulk(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := log.Extract(ctx)
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, serveMaxBodyBytes))
+	if err != nil {
+		writeJSON(ctx, w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("failed to read body: %s", err)})
+
+		return
+	}
+
+	hh, err := paramscmd.ParseExtraHeartbeats(ctx, string(body))
+	if err != nil {
+		writeJSON(ctx, w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+
+		return
+	}
+
+	if len(hh) > offline.SendLimit {
+		writeJSON(ctx, w, http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("too many heartbeats, maximum is %d", offline.SendLimit),
+		})
+
+		return
+	}
+
+	userAgent := r.Header.Get("User-Agent")
+	if userAgent == "" {
+		userAgent = heartbeat.UserAgent(ctx, s.params.API.Plugin)
+	}
+
+	for n := range hh {
+		if hh[n].UserAgent == "" {
+			hh[n].UserAgent = userAgent
+		}
+
+		if hh[n].UUID == "" {
+			hh[n].UUID = heartbeat.NewUUID(hh[n].Time)
+		}
+	}
+
+	logger.Debugf("received %d heartbeat(s)", len(hh))
+
+	responses, err := s.process(ctx, hh)
+	if err != nil {
+		logger.Errorf("failed to process heartbeats: %s", err)
+
+		writeJSON(ctx, w, errorStatus(err), map[string]string{"error": err.Error()})
+
+		return
+	}
+
+	writeJSON(ctx, w, http.StatusAccepted, map[string]any{"responses": responses})
+}
+
+// process runs the heartbeats through the processing pipeline and returns
+// one response per heartbeat. The heartbeat of each stage is traced to map
+// results back to the posted heartbeats, as stages may remove heartbeats.
+func (s *serveHandler) process(ctx context.Context, hh []heartbeat.Heartbeat) ([][]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	initial := make([]heartbeat.Heartbeat, len(hh))
+	copy(initial, hh)
+
+	tracer := &heartbeat.Tracer{}
+
+	stages := initStages(s.params, false)
+
+	opts := make([]heartbeat.HandleOption, 0, len(stages)+2)
+	for _, st := range stages {
+		opts = append(opts, tracer.Trace(st.Name, st.Option))
+	}
+
+	if !s.params.Offline.Disabled {
+		opts = append(opts, offline.WithQueue(s.queueFilepath, s.params.Offline.Retention))
+	}
+
+	opts = append(opts, s.backoff)
+
+	handle := heartbeat.NewHandle(orderedSender{s.sender}, opts...)
+
+	results, err := handle(ctx, hh)
+	if err != nil && s.params.Offline.Disabled {
+		return nil, err
+	}
+
+	// ids of the heartbeats, which passed all stages, in order
+	var (
+		ids       []int
+		processed = map[int]heartbeat.Heartbeat{}
+	)
+
+	if len(tracer.Steps) == len(stages) && tracer.Steps[len(stages)-1].After != nil {
+		processed = tracer.Steps[len(stages)-1].After
+
+		for id := range initial {
+			if _, ok := processed[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	responses := make([][]any, len(initial))
+
+	for id, h := range initial {
+		responses[id] = []any{map[string]any{"data": h}, http.StatusAccepted}
+	}
+
+	if err != nil {
+		// heartbeats rejected by the api went to dead letters instead of the queue
+		if errorStatus(err) == http.StatusBadRequest {
+			for _, id := range ids {
+				responses[id] = []any{map[string]any{"error": err.Error()}, http.StatusBadRequest}
+			}
+
+			return responses, nil
+		}
+
+		log.Extract(ctx).Debugf("saved heartbeat(s) to offline queue after error: %s", err)
+
+		return responses, nil
+	}
+
+	for n, id := range ids {
+		if n >= len(results) {
+			break
+		}
+
+		responses[id] = resultResponse(results[n], processed[id])
+	}
+
+	if len(results) > 0 && !s.params.Offline.Disabled {
+		if _, err := s.sync(ctx, nil); err != nil {
+			log.Extract(ctx).Warnf("failed to sync offline activity: %s", err)
+		}
+	}
+
+	return responses, nil
+}
+
+func resultResponse(result heartbeat.Result, processed heartbeat.Heartbeat) []any {
+	if result.Status < http.StatusOK || result.Status > 299 {
+		return []any{map[string]any{"error": strings.Join(result.Errors, " ")}, result.Status}
+	}
+
+	h := result.Heartbeat
+	if h.Entity == "" {
+		h = processed
+	}
+
+	return []any{map[string]any{"data": h}, result.Status}
+}
+
+// statusBarToday responds with today's code stats fetched from the api.
+func (s *serveHandler) statusBarToday(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	summary, err := s.today.Today(ctx)
+	if err != nil {
+		log.Extract(ctx).Errorf("failed fetching today from api: %s", err)
+
+		writeJSON(ctx, w, errorStatus(err), map[string]string{"error": err.Error()})
+
+		return
+	}
+
+	writeJSON(ctx, w, http.StatusOK, summary)
+}
+
+// orderedSender sends heartbeats grouped by api key like the api client does,
+// but returns the results in the order of the passed in heartbeats.
+type orderedSender struct {
+	heartbeat.Sender
+}
+
+// SendHeartbeats sends the heartbeats of each api key separately.
+func (s orderedSender) SendHeartbeats(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+	var keys []string
+
+	indexes := map[string][]int{}
+
+	for n, h := range hh {
+		if _, ok := indexes[h.APIKey]; !ok {
+			keys = append(keys, h.APIKey)
+		}
+
+		indexes[h.APIKey] = append(indexes[h.APIKey], n)
+	}
+
+	results := make([]heartbeat.Result, len(hh))
+
+	for _, k := range keys {
+		group := make([]heartbeat.Heartbeat, 0, len(indexes[k]))
+		for _, n := range indexes[k] {
+			group = append(group, hh[n])
+		}
+
+		res, err := s.Sender.SendHeartbeats(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(res) != len(group) {
+			return nil, api.Err{Err: fmt.Errorf("got %d results for %d heartbeats", len(res), len(group))}
+		}
+
+		for i, n := range indexes[k] {
+			results[n] = res[i]
+		}
+	}
+
+	return results, nil
+}
+
+func errorStatus(err error) int {
+	var (
+		errauth       api.ErrAuth
+		errbadrequest api.ErrBadRequest
+	)
+
+	switch {
+	case errors.As(err, &errauth):
+		return http.StatusUnauthorized
+	case errors.As(err, &errbadrequest):
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Extract(ctx).Warnf("failed to write response: %s", err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 
 	paramscmd "github.com/optiflow-os/tracelens-cli/cmd/params"
+	"github.com/optiflow-os/tracelens-cli/pkg/apikey"
+	"github.com/optiflow-os/tracelens-cli/pkg/category"
 	"github.com/optiflow-os/tracelens-cli/pkg/deps"
 	"github.com/optiflow-os/tracelens-cli/pkg/filestats"
 	"github.com/optiflow-os/tracelens-cli/pkg/filter"
@@ -45,7 +47,7 @@ func SaveHeartbeats(ctx context.Context, v *viper.Viper, heartbeats []heartbeat.
 
 	handleOpts := initHandleOptions(params)
 
-	handleOpts = append(handleOpts, offline.WithQueue(queueFilepath))
+	handleOpts = append(handleOpts, offline.WithQueue(queueFilepath, params.Offline.Retention))
 
 	sender := offline.Noop{}
 	handle := heartbeat.NewHandle(sender, handleOpts...)
@@ -103,6 +105,12 @@ func buildHeartbeats(ctx context.Context, params paramscmd.Params) []heartbeat.H
 		userAgent,
 	))
 
+	heartbeats[0].AILineChanges = params.Heartbeat.AILineChanges
+	heartbeats[0].AITool = params.Heartbeat.AITool
+	heartbeats[0].CategoryExplicit = params.Heartbeat.CategoryExplicit
+	heartbeats[0].Cwd = params.Heartbeat.Cwd
+	heartbeats[0].HumanLineChanges = params.Heartbeat.HumanLineChanges
+
 	if len(params.Heartbeat.ExtraHeartbeats) > 0 {
 		logger := log.Extract(ctx)
 		logger.Debugf("include %d extra heartbeat(s) from stdin", len(params.Heartbeat.ExtraHeartbeats))
@@ -130,6 +138,17 @@ func buildHeartbeats(ctx context.Context, params paramscmd.Params) []heartbeat.H
 				h.Time,
 				userAgent,
 			))
+
+			heartbeats[len(heartbeats)-1].AILineChanges = h.AILineChanges
+			heartbeats[len(heartbeats)-1].AITool = h.AITool
+			heartbeats[len(heartbeats)-1].CategoryExplicit = h.CategoryExplicit
+			heartbeats[len(heartbeats)-1].Cwd = h.Cwd
+			heartbeats[len(heartbeats)-1].HumanLineChanges = h.HumanLineChanges
+
+			// keep the uuid passed by the plugin, if it sorts by heartbeat time
+			if heartbeat.ValidUUID(h.UUID, h.Time) {
+				heartbeats[len(heartbeats)-1].UUID = h.UUID
+			}
 		}
 	}
 
@@ -137,40 +156,68 @@ func buildHeartbeats(ctx context.Context, params paramscmd.Params) []heartbeat.H
 }
 
 func initHandleOptions(params paramscmd.Params) []heartbeat.HandleOption {
+	// options depending on settings of repository-local config files
+	repoParams := func(build func(paramscmd.Heartbeat) heartbeat.HandleOption) heartbeat.HandleOption {
+		return paramscmd.WithRepoParams(params.Heartbeat, build)
+	}
+
 	return []heartbeat.HandleOption{
 		heartbeat.WithFormatting(),
 		heartbeat.WithEntityModifier(),
-		filter.WithFiltering(filter.Config{
-			Exclude:                    params.Heartbeat.Filter.Exclude,
-			Include:                    params.Heartbeat.Filter.Include,
-			IncludeOnlyWithProjectFile: params.Heartbeat.Filter.IncludeOnlyWithProjectFile,
+		paramscmd.WithRepoConfig(),
+		repoParams(func(p paramscmd.Heartbeat) heartbeat.HandleOption {
+			return filter.WithFiltering(filter.Config{
+				Exclude:                    p.Filter.Exclude,
+				Include:                    p.Filter.Include,
+				IncludeOnlyWithProjectFile: p.Filter.IncludeOnlyWithProjectFile,
+			})
 		}),
 		remote.WithDetection(),
-		filestats.WithDetection(),
+		apikey.WithReplacing(apikey.Config{
+			APIURL:        params.API.URL,
+			DefaultAPIKey: params.API.Key,
+			MapPatterns:   params.API.KeyPatterns,
+		}),
 		language.WithDetection(language.Config{
 			GuessLanguage: params.Heartbeat.GuessLanguage,
 		}),
-		deps.WithDetection(deps.Config{
-			FilePatterns: params.Heartbeat.Sanitize.HideFileNames,
+		filestats.WithDetection(),
+		filestats.WithLineChanges(filestats.LineChangesConfig{}),
+		repoParams(func(p paramscmd.Heartbeat) heartbeat.HandleOption {
+			return deps.WithDetection(deps.Config{
+				FilePatterns: p.Sanitize.HideFileNames,
+			})
+		}),
+		repoParams(func(p paramscmd.Heartbeat) heartbeat.HandleOption {
+			return project.WithDetection(project.Config{
+				DomainRules:          p.Project.DomainRules,
+				HideProjectNames:     p.Sanitize.HideProjectNames,
+				MapPatterns:          p.Project.MapPatterns,
+				ProjectFromGitRemote: p.Project.ProjectFromGitRemote,
+				Submodule: project.Submodule{
+					DisabledPatterns: p.Project.SubmodulesDisabled,
+					MapPatterns:      p.Project.SubmoduleMapPatterns,
+				},
+			})
 		}),
-		project.WithDetection(project.Config{
-			HideProjectNames:     params.Heartbeat.Sanitize.HideProjectNames,
-			MapPatterns:          params.Heartbeat.Project.MapPatterns,
-			ProjectFromGitRemote: params.Heartbeat.Project.ProjectFromGitRemote,
-			Submodule: project.Submodule{
-				DisabledPatterns: params.Heartbeat.Project.SubmodulesDisabled,
-				MapPatterns:      params.Heartbeat.Project.SubmoduleMapPatterns,
-			},
+		category.WithDetection(category.Config{
+			Rules: params.Heartbeat.CategoryRules,
 		}),
-		project.WithFiltering(project.FilterConfig{
-			ExcludeUnknownProject: params.Heartbeat.Filter.ExcludeUnknownProject,
+		repoParams(func(p paramscmd.Heartbeat) heartbeat.HandleOption {
+			return project.WithFiltering(project.FilterConfig{
+				ExcludeUnknownProject: p.Filter.ExcludeUnknownProject,
+			})
 		}),
-		heartbeat.WithSanitization(heartbeat.SanitizeConfig{
-			BranchPatterns:     params.Heartbeat.Sanitize.HideBranchNames,
-			DependencyPatterns: params.Heartbeat.Sanitize.HideDependencies,
-			FilePatterns:       params.Heartbeat.Sanitize.HideFileNames,
-			HideProjectFolder:  params.Heartbeat.Sanitize.HideProjectFolder,
-			ProjectPatterns:    params.Heartbeat.Sanitize.HideProjectNames,
+		repoParams(func(p paramscmd.Heartbeat) heartbeat.HandleOption {
+			return heartbeat.WithSanitization(heartbeat.SanitizeConfig{
+				BranchPatterns:     p.Sanitize.HideBranchNames,
+				CommandArgPatterns: p.Sanitize.CommandArgPatterns,
+				DependencyPatterns: p.Sanitize.HideDependencies,
+				FilePatterns:       p.Sanitize.HideFileNames,
+				HideProjectFolder:  p.Sanitize.HideProjectFolder,
+				ProjectPatterns:    p.Sanitize.HideProjectNames,
+				SendCommandArgs:    p.Sanitize.SendCommandArgs,
+			})
 		}),
 		remote.WithCleanup(),
 		filter.WithLengthValidator(),
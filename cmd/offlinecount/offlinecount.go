@@ -2,16 +2,42 @@ package offlinecount
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
 	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+	"github.com/optiflow-os/tracelens-cli/pkg/output"
+	"github.com/optiflow-os/tracelens-cli/pkg/vipertools"
 
 	"github.com/spf13/viper"
 )
 
+// Stats is the json representation of the offline db statistics. Oldest and
+// Newest are the times of the oldest and newest heartbeat and null for an
+// empty offline db.
+type Stats struct {
+	Count       int      `json:"count"`
+	DeadLetters int      `json:"dead_letters"`
+	Dropped     int      `json:"dropped"`
+	Newest      *float64 `json:"newest"`
+	Oldest      *float64 `json:"oldest"`
+}
+
 // Run executes the offline-count command.
 func Run(ctx context.Context, v *viper.Viper) (int, error) {
+	var out output.Output
+
+	if outputStr := vipertools.GetString(v, "output"); outputStr != "" {
+		parsed, err := output.Parse(outputStr)
+		if err != nil {
+			return exitcode.ErrGeneric, fmt.Errorf("failed to parse output: %s", err)
+		}
+
+		out = parsed
+	}
+
 	queueFilepath, err := offline.QueueFilepath(ctx, v)
 	if err != nil {
 		return exitcode.ErrGeneric, fmt.Errorf(
@@ -20,13 +46,43 @@ func Run(ctx context.Context, v *viper.Viper) (int, error) {
 		)
 	}
 
-	count, err := offline.CountHeartbeats(ctx, queueFilepath)
+	stats, err := offline.ReadStats(ctx, queueFilepath)
 	if err != nil {
-		fmt.Println(err)
-		return exitcode.ErrGeneric, fmt.Errorf("failed to count offline heartbeats: %w", err)
+		return exitcode.ErrGeneric, fmt.Errorf("failed to read offline heartbeats stats: %w", err)
+	}
+
+	if out == output.JSONOutput || out == output.RawJSONOutput {
+		data, err := json.Marshal(newStats(stats))
+		if err != nil {
+			return exitcode.ErrGeneric, fmt.Errorf("failed to marshal json: %s", err)
+		}
+
+		fmt.Println(string(data))
+
+		return exitcode.Success, nil
 	}
 
-	fmt.Println(count)
+	fmt.Println(stats.Count)
+
+	// stdout only contains the count, as plugins parse it
+	if stats.DeadLetters > 0 {
+		fmt.Fprintf(os.Stderr, "%d dead letter(s) rejected by the api, see offline dead-letters list\n", stats.DeadLetters)
+	}
 
 	return exitcode.Success, nil
 }
+
+func newStats(stats offline.Stats) Stats {
+	s := Stats{
+		Count:       stats.Count,
+		DeadLetters: stats.DeadLetters,
+		Dropped:     stats.Dropped,
+	}
+
+	if stats.Count > 0 {
+		s.Newest = &stats.Newest
+		s.Oldest = &stats.Oldest
+	}
+
+	return s
+}
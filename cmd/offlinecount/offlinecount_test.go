@@ -125,6 +125,105 @@ func TestOfflineCount(t *testing.T) {
 	assert.Equal(t, "2\n", output)
 }
 
+func TestOfflineCount_JSON(t *testing.T) {
+	// setup offline queue
+	f, err := os.CreateTemp(t.TempDir(), "")
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	require.NoError(t, err)
+
+	dataGo, err := os.ReadFile("testdata/heartbeat_go.json")
+	require.NoError(t, err)
+
+	dataPy, err := os.ReadFile("testdata/heartbeat_py.json")
+	require.NoError(t, err)
+
+	insertHeartbeatRecords(t, db, "heartbeats", []heartbeatRecord{
+		{
+			ID:        "1592868367.219124-file-coding-wakatime-cli-heartbeat-/tmp/main.go-true",
+			Heartbeat: string(dataGo),
+		},
+		{
+			ID:        "1592868386.079084-file-debugging-wakatime-summary-/tmp/main.py-false",
+			Heartbeat: string(dataPy),
+		},
+	})
+
+	err = db.Close()
+	require.NoError(t, err)
+
+	v := viper.New()
+	v.Set("offline-count", true)
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+	v.Set("offline-queue-file", f.Name())
+	v.Set("output", "json")
+
+	stdout := os.Stdout // keep backup of the real stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	code, err := offlinecount.Run(context.Background(), v)
+
+	outC := make(chan string)
+	// copy the output in a separate goroutine so printing can't block indefinitely
+	go func() {
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, r)
+		require.NoError(t, err)
+		outC <- buf.String()
+	}()
+
+	w.Close()
+
+	os.Stdout = stdout
+	output := <-outC
+
+	assert.Equal(t, exitcode.Success, code)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"count":2,"dead_letters":0,"dropped":0,"newest":1592868386.079084,"oldest":1592868367.219124}`, output)
+}
+
+func TestOfflineCount_JSON_Empty(t *testing.T) {
+	// setup offline queue
+	f, err := os.CreateTemp(t.TempDir(), "")
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	v := viper.New()
+	v.Set("offline-count", true)
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+	v.Set("offline-queue-file", f.Name())
+	v.Set("output", "json")
+
+	stdout := os.Stdout // keep backup of the real stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	code, err := offlinecount.Run(context.Background(), v)
+
+	outC := make(chan string)
+	// copy the output in a separate goroutine so printing can't block indefinitely
+	go func() {
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, r)
+		require.NoError(t, err)
+		outC <- buf.String()
+	}()
+
+	w.Close()
+
+	os.Stdout = stdout
+	output := <-outC
+
+	assert.Equal(t, exitcode.Success, code)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"count":0,"dead_letters":0,"dropped":0,"newest":null,"oldest":null}`, output)
+}
+
 type heartbeatRecord struct {
 	ID        string
 	Heartbeat string
@@ -0,0 +1,140 @@
+package offlinedeadletter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	paramscmd "github.com/optiflow-os/tracelens-cli/cmd/params"
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+
+	"github.com/spf13/viper"
+)
+
+// Params contains offline dead-letters parameters.
+type Params struct {
+	// IDs are the ids of the dead letters to retry or purge. Empty selects all.
+	IDs []string
+	// Truncate truncates the fields of retried heartbeats to at most this
+	// number of characters. Zero disables truncation.
+	Truncate int
+}
+
+// RunList prints the dead letters in the offline db as json.
+func RunList(ctx context.Context, v *viper.Viper) (int, error) {
+	queueFilepath, err := offline.QueueFilepath(ctx, v)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf(
+			"failed to load offline queue filepath: %s",
+			err,
+		)
+	}
+
+	dd, err := offline.ReadDeadLetters(ctx, queueFilepath)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf("failed to read dead letters: %w", err)
+	}
+
+	data, err := jsonWithoutEscaping(dd)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf("failed to json marshal dead letters: %w", err)
+	}
+
+	fmt.Print(string(data))
+
+	return exitcode.Success, nil
+}
+
+// RunRetry moves dead letters back to the offline queue and prints their number.
+func RunRetry(ctx context.Context, v *viper.Viper) (int, error) {
+	params, err := LoadParams(v)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf("failed to load command parameters: %w", err)
+	}
+
+	queueFilepath, err := offline.QueueFilepath(ctx, v)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf(
+			"failed to load offline queue filepath: %s",
+			err,
+		)
+	}
+
+	var fixUps []offline.FixUp
+
+	if params.Truncate > 0 {
+		fixUps = append(fixUps, offline.Truncate(params.Truncate))
+	}
+
+	paramOffline := paramscmd.LoadOfflineParams(ctx, v)
+
+	count, err := offline.RequeueDeadLetters(ctx, queueFilepath, paramOffline.Retention, params.IDs, fixUps...)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf("failed to requeue dead letters: %w", err)
+	}
+
+	fmt.Printf("requeued %d heartbeat(s)\n", count)
+
+	return exitcode.Success, nil
+}
+
+// RunPurge deletes dead letters from the offline db and prints their number.
+func RunPurge(ctx context.Context, v *viper.Viper) (int, error) {
+	params, err := LoadParams(v)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf("failed to load command parameters: %w", err)
+	}
+
+	queueFilepath, err := offline.QueueFilepath(ctx, v)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf(
+			"failed to load offline queue filepath: %s",
+			err,
+		)
+	}
+
+	count, err := offline.PurgeDeadLetters(ctx, queueFilepath, params.IDs)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf("failed to purge dead letters: %w", err)
+	}
+
+	fmt.Printf("purged %d dead letter(s)\n", count)
+
+	return exitcode.Success, nil
+}
+
+// LoadParams loads needed data from the configuration file.
+func LoadParams(v *viper.Viper) (Params, error) {
+	var ids []string
+
+	for _, id := range v.GetStringSlice("offline-dead-letters-id") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	truncate := v.GetInt("offline-dead-letters-truncate")
+	if truncate < 0 {
+		return Params{}, errors.New("truncate must be zero or positive")
+	}
+
+	return Params{
+		IDs:      ids,
+		Truncate: truncate,
+	}, nil
+}
+
+// jsonWithoutEscaping returns a string representation of the given array of dead letters.
+// It does not escape the angle brackets "<", ">" and "&".
+func jsonWithoutEscaping(dd []offline.DeadLetter) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(dd)
+
+	return buffer.Bytes(), err
+}
@@ -0,0 +1,209 @@
+package offlinedeadletter_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/cmd/offlinedeadletter"
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunList(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	pushDeadLetters(t, queueFilepath, testHeartbeats())
+
+	v := viper.New()
+	v.Set("offline-queue-file", queueFilepath)
+
+	var (
+		code int
+		err  error
+	)
+
+	output := captureStdout(t, func() {
+		code, err = offlinedeadletter.RunList(context.Background(), v)
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, exitcode.Success, code)
+
+	var dd []offline.DeadLetter
+
+	err = json.Unmarshal([]byte(output), &dd)
+	require.NoError(t, err)
+
+	require.Len(t, dd, 2)
+
+	assert.Equal(t, "entity too long", dd[0].Error)
+	assert.Equal(t, testHeartbeats()[0].ID(), dd[0].ID)
+	assert.Equal(t, 400, dd[0].Status)
+}
+
+func TestRunRetry(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	pushDeadLetters(t, queueFilepath, testHeartbeats())
+
+	v := viper.New()
+	v.Set("offline-queue-file", queueFilepath)
+	v.Set("offline-dead-letters-id", []string{testHeartbeats()[0].ID()})
+	v.Set("offline-dead-letters-truncate", 4)
+
+	var (
+		code int
+		err  error
+	)
+
+	output := captureStdout(t, func() {
+		code, err = offlinedeadletter.RunRetry(context.Background(), v)
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, exitcode.Success, code)
+	assert.Equal(t, "requeued 1 heartbeat(s)\n", output)
+
+	hh, err := offline.ReadHeartbeats(context.Background(), queueFilepath, 10)
+	require.NoError(t, err)
+
+	require.Len(t, hh, 1)
+
+	assert.Equal(t, "/tmp", hh[0].Entity)
+
+	stats, err := offline.ReadStats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, stats.DeadLetters)
+}
+
+func TestRunPurge(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	pushDeadLetters(t, queueFilepath, testHeartbeats())
+
+	v := viper.New()
+	v.Set("offline-queue-file", queueFilepath)
+
+	var (
+		code int
+		err  error
+	)
+
+	output := captureStdout(t, func() {
+		code, err = offlinedeadletter.RunPurge(context.Background(), v)
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, exitcode.Success, code)
+	assert.Equal(t, "purged 2 dead letter(s)\n", output)
+
+	stats, err := offline.ReadStats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Zero(t, stats.DeadLetters)
+	assert.Zero(t, stats.Count)
+}
+
+func TestLoadParams(t *testing.T) {
+	v := viper.New()
+	v.Set("offline-dead-letters-id", []string{"id1", " ", " id2 "})
+	v.Set("offline-dead-letters-truncate", 100)
+
+	params, err := offlinedeadletter.LoadParams(v)
+	require.NoError(t, err)
+
+	assert.Equal(t, offlinedeadletter.Params{
+		IDs:      []string{"id1", "id2"},
+		Truncate: 100,
+	}, params)
+}
+
+func TestLoadParams_NegativeTruncate(t *testing.T) {
+	v := viper.New()
+	v.Set("offline-dead-letters-truncate", -1)
+
+	_, err := offlinedeadletter.LoadParams(v)
+	require.Error(t, err)
+}
+
+// pushDeadLetters stores the heartbeats as dead letters, by letting the api
+// reject them.
+func pushDeadLetters(t *testing.T, queueFilepath string, hh []heartbeat.Heartbeat) {
+	t.Helper()
+
+	handle := offline.WithQueue(queueFilepath, offline.Retention{})(
+		func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			var results []heartbeat.Result
+
+			for _, h := range hh {
+				results = append(results, heartbeat.Result{
+					Status:    400,
+					Heartbeat: h,
+					Errors:    []string{"entity too long"},
+				})
+			}
+
+			return results, nil
+		})
+
+	_, err := handle(context.Background(), hh)
+	require.NoError(t, err)
+}
+
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	stdout := os.Stdout // keep backup of the real stdout
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	os.Stdout = w
+
+	fn()
+
+	outC := make(chan string)
+	// copy the output in a separate goroutine so printing can't block indefinitely
+	go func() {
+		var buf bytes.Buffer
+		_, _ = io.Copy(&buf, r)
+		outC <- buf.String()
+	}()
+
+	w.Close()
+
+	os.Stdout = stdout
+
+	return <-outC
+}
+
+func testHeartbeats() []heartbeat.Heartbeat {
+	return []heartbeat.Heartbeat{
+		{
+			Category:   heartbeat.CodingCategory,
+			Entity:     "/tmp/main.go",
+			EntityType: heartbeat.FileType,
+			Time:       1592868367.219124,
+			UserAgent:  "wakatime/13.0.6",
+			UUID:       "01900000-0000-7000-8000-000000000001",
+		},
+		{
+			Category:   heartbeat.DebuggingCategory,
+			Entity:     "/tmp/main.py",
+			EntityType: heartbeat.FileType,
+			Time:       1592868386.079084,
+			UserAgent:  "wakatime/13.0.7",
+			UUID:       "01900000-0000-7000-8000-000000000002",
+		},
+	}
+}
@@ -0,0 +1,110 @@
+package offlineexport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+	"github.com/optiflow-os/tracelens-cli/pkg/vipertools"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/viper"
+)
+
+// Params contains offline export parameters.
+type Params struct {
+	// Delete deletes the exported heartbeats from the offline db.
+	Delete bool
+	// Filepath is the ndjson file to export the heartbeats to.
+	Filepath string
+}
+
+// Run exports the heartbeats in the offline db and prints their number.
+func Run(ctx context.Context, v *viper.Viper) (int, error) {
+	params, err := LoadParams(v)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf("failed to load command parameters: %w", err)
+	}
+
+	queueFilepath, err := offline.QueueFilepath(ctx, v)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf(
+			"failed to load offline queue filepath: %s",
+			err,
+		)
+	}
+
+	count, skipped, err := Export(ctx, queueFilepath, params)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf("failed to export offline heartbeats: %w", err)
+	}
+
+	fmt.Printf("exported %d heartbeat(s) to %s\n", count, params.Filepath)
+
+	if skipped > 0 {
+		fmt.Printf("skipped %d unreadable heartbeat(s), which were kept in the offline db\n", skipped)
+	}
+
+	return exitcode.Success, nil
+}
+
+// Export writes the heartbeats in the offline db at queueFilepath to a new
+// ndjson file. It never overwrites an existing file. Heartbeats are only
+// deleted from the offline db, after the file was written and synced to disk
+// successfully. Unreadable heartbeats are skipped and kept in the offline db.
+// Returns the number of exported and skipped heartbeats.
+func Export(ctx context.Context, queueFilepath string, params Params) (int, int, error) {
+	// exported heartbeats are not encrypted, so only the user may read them
+	f, err := os.OpenFile(params.Filepath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) // nolint:gosec
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create %s: %s", params.Filepath, err)
+	}
+
+	keys, skipped, err := offline.ExportHeartbeats(ctx, queueFilepath, f)
+	if err != nil {
+		_ = f.Close()
+
+		return 0, 0, err
+	}
+
+	// make sure the heartbeats are on disk, before deleting them from the offline db
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+
+		return 0, 0, fmt.Errorf("failed to sync %s: %s", params.Filepath, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return 0, 0, fmt.Errorf("failed to write %s: %s", params.Filepath, err)
+	}
+
+	if params.Delete && len(keys) > 0 {
+		if err := offline.DeleteHeartbeats(ctx, queueFilepath, keys); err != nil {
+			return 0, 0, fmt.Errorf("failed to delete exported heartbeats: %s", err)
+		}
+	}
+
+	return len(keys), skipped, nil
+}
+
+// LoadParams loads needed data from the configuration file.
+func LoadParams(v *viper.Viper) (Params, error) {
+	fp := strings.TrimSpace(vipertools.GetString(v, "offline-export-file"))
+	if fp == "" {
+		return Params{}, errors.New("file cannot be empty")
+	}
+
+	fp, err := homedir.Expand(fp)
+	if err != nil {
+		return Params{}, fmt.Errorf("failed expanding file: %s", err)
+	}
+
+	return Params{
+		Delete:   v.GetBool("offline-export-delete"),
+		Filepath: fp,
+	}, nil
+}
@@ -0,0 +1,189 @@
+package offlineexport_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/cmd/offlineexport"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	tmpDir := t.TempDir()
+	queueFilepath := filepath.Join(tmpDir, "offline_heartbeats.bdb")
+	target := filepath.Join(tmpDir, "out.ndjson")
+
+	_, err := offline.ImportHeartbeats(context.Background(), queueFilepath, offline.Retention{}, testHeartbeats())
+	require.NoError(t, err)
+
+	count, skipped, err := offlineexport.Export(context.Background(), queueFilepath, offlineexport.Params{
+		Filepath: target,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, count)
+	assert.Zero(t, skipped)
+
+	info, err := os.Stat(target)
+	require.NoError(t, err)
+
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2)
+
+	assert.JSONEq(t, `{
+		"api_key_fingerprint": "db8055e0e0307d5a016bec4dc338d69875eb0fb7e614a8b125b08fb082095d98",
+		"api_url": "https://example.org/api/v1",
+		"category": "coding",
+		"entity": "/tmp/main.go",
+		"id": "01900000-0000-7000-8000-000000000001",
+		"is_write": true,
+		"time": 1592868367.219124,
+		"type": "file",
+		"user_agent": "wakatime/13.0.6"
+	}`, lines[0])
+
+	// heartbeats are kept without --delete
+	queued, err := offline.CountHeartbeats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, queued)
+}
+
+func TestExport_Delete(t *testing.T) {
+	tmpDir := t.TempDir()
+	queueFilepath := filepath.Join(tmpDir, "offline_heartbeats.bdb")
+
+	_, err := offline.ImportHeartbeats(context.Background(), queueFilepath, offline.Retention{}, testHeartbeats())
+	require.NoError(t, err)
+
+	count, skipped, err := offlineexport.Export(context.Background(), queueFilepath, offlineexport.Params{
+		Delete:   true,
+		Filepath: filepath.Join(tmpDir, "out.ndjson"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, count)
+	assert.Zero(t, skipped)
+
+	queued, err := offline.CountHeartbeats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Zero(t, queued)
+}
+
+func TestExport_UnreadableHeartbeat(t *testing.T) {
+	tmpDir := t.TempDir()
+	queueFilepath := filepath.Join(tmpDir, "offline_heartbeats.bdb")
+	target := filepath.Join(tmpDir, "out.ndjson")
+
+	_, err := offline.ImportHeartbeats(context.Background(), queueFilepath, offline.Retention{}, testHeartbeats()[:1])
+	require.NoError(t, err)
+
+	// the first heartbeat can no longer be decrypted
+	err = os.WriteFile(offline.KeyFilepath(queueFilepath), []byte(strings.Repeat("ab", 32)), 0600)
+	require.NoError(t, err)
+
+	_, err = offline.ImportHeartbeats(context.Background(), queueFilepath, offline.Retention{}, testHeartbeats()[1:])
+	require.NoError(t, err)
+
+	count, skipped, err := offlineexport.Export(context.Background(), queueFilepath, offlineexport.Params{
+		Delete:   true,
+		Filepath: target,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 1, skipped)
+
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(data), "/tmp/main.py")
+	assert.NotContains(t, string(data), "/tmp/main.go")
+
+	// skipped heartbeats are kept
+	queued, err := offline.CountHeartbeats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, queued)
+}
+
+func TestExport_FileExists(t *testing.T) {
+	tmpDir := t.TempDir()
+	queueFilepath := filepath.Join(tmpDir, "offline_heartbeats.bdb")
+	target := filepath.Join(tmpDir, "out.ndjson")
+
+	_, err := offline.ImportHeartbeats(context.Background(), queueFilepath, offline.Retention{}, testHeartbeats())
+	require.NoError(t, err)
+
+	err = os.WriteFile(target, []byte("existing"), 0600)
+	require.NoError(t, err)
+
+	_, _, err = offlineexport.Export(context.Background(), queueFilepath, offlineexport.Params{
+		Delete:   true,
+		Filepath: target,
+	})
+	require.Error(t, err)
+
+	// nothing is deleted, if the export failed
+	queued, err := offline.CountHeartbeats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, queued)
+}
+
+func TestLoadParams(t *testing.T) {
+	v := viper.New()
+	v.Set("offline-export-file", "/tmp/out.ndjson")
+	v.Set("offline-export-delete", true)
+
+	params, err := offlineexport.LoadParams(v)
+	require.NoError(t, err)
+
+	assert.Equal(t, offlineexport.Params{
+		Delete:   true,
+		Filepath: "/tmp/out.ndjson",
+	}, params)
+}
+
+func TestLoadParams_EmptyFile(t *testing.T) {
+	_, err := offlineexport.LoadParams(viper.New())
+	require.Error(t, err)
+}
+
+func testHeartbeats() []heartbeat.Heartbeat {
+	return []heartbeat.Heartbeat{
+		{
+			APIKey:     "00000000-0000-4000-8000-000000000000",
+			APIURL:     "https://example.org/api/v1",
+			Category:   heartbeat.CodingCategory,
+			Entity:     "/tmp/main.go",
+			EntityType: heartbeat.FileType,
+			IsWrite:    heartbeat.PointerTo(true),
+			Time:       1592868367.219124,
+			UserAgent:  "wakatime/13.0.6",
+			UUID:       "01900000-0000-7000-8000-000000000001",
+		},
+		{
+			Category:   heartbeat.DebuggingCategory,
+			Entity:     "/tmp/main.py",
+			EntityType: heartbeat.FileType,
+			Time:       1592868386.079084,
+			UserAgent:  "wakatime/13.0.7",
+			UUID:       "01900000-0000-7000-8000-000000000002",
+		},
+	}
+}
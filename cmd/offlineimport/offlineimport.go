@@ -0,0 +1,188 @@
+package offlineimport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	paramscmd "github.com/optiflow-os/tracelens-cli/cmd/params"
+	"github.com/optiflow-os/tracelens-cli/pkg/apikey"
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+	"github.com/optiflow-os/tracelens-cli/pkg/vipertools"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/viper"
+)
+
+// Params contains offline import parameters.
+type Params struct {
+	// Filepath is the ndjson file to import the heartbeats from.
+	Filepath string
+	// Routing contains the configured api keys and api url. Heartbeats routed
+	// to other api keys or api urls are rejected.
+	Routing apikey.Config
+}
+
+// Result is the result of an import.
+type Result struct {
+	Duplicates int
+	Imported   int
+	Invalid    []paramscmd.ExtraHeartbeatError
+}
+
+// Run imports heartbeats into the offline db and prints their number.
+func Run(ctx context.Context, v *viper.Viper) (int, error) {
+	params, err := LoadParams(ctx, v)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf("failed to load command parameters: %w", err)
+	}
+
+	queueFilepath, err := offline.QueueFilepath(ctx, v)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf(
+			"failed to load offline queue filepath: %s",
+			err,
+		)
+	}
+
+	paramOffline := paramscmd.LoadOfflineParams(ctx, v)
+
+	result, err := Import(ctx, queueFilepath, paramOffline.Retention, params)
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf("failed to import offline heartbeats: %w", err)
+	}
+
+	fmt.Printf(
+		"imported %d heartbeat(s) from %s, skipped %d duplicate(s)\n",
+		result.Imported,
+		params.Filepath,
+		result.Duplicates,
+	)
+
+	if len(result.Invalid) > 0 {
+		return exitcode.ErrGeneric, fmt.Errorf("skipped %d invalid line(s)", len(result.Invalid))
+	}
+
+	return exitcode.Success, nil
+}
+
+// Import reads heartbeats exported by offline export from an ndjson file and
+// stores them in the offline db at queueFilepath. Lines are validated with
+// the rules applied to extra heartbeats and their api key fingerprint and api
+// url must be found in the config. Invalid lines are skipped and returned with
+// their line number. Heartbeats already in the offline db are
+// skipped as duplicates.
+func Import(ctx context.Context, queueFilepath string, retention offline.Retention, params Params) (Result, error) {
+	f, err := os.Open(params.Filepath)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open %s: %s", params.Filepath, err)
+	}
+
+	defer f.Close()
+
+	hh, invalid, err := parseRecords(f, params.Routing)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read %s: %s", params.Filepath, err)
+	}
+
+	logger := log.Extract(ctx)
+
+	for _, e := range invalid {
+		logger.Errorf("skipping invalid heartbeat: %s", e)
+	}
+
+	imported, err := offline.ImportHeartbeats(ctx, queueFilepath, retention, hh)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Duplicates: len(hh) - imported,
+		Imported:   imported,
+		Invalid:    invalid,
+	}, nil
+}
+
+// parseRecords parses one record per line until EOF. Blank lines are skipped.
+func parseRecords(r io.Reader, routing apikey.Config) ([]heartbeat.Heartbeat, []paramscmd.ExtraHeartbeatError, error) {
+	var (
+		heartbeats []heartbeat.Heartbeat
+		invalid    []paramscmd.ExtraHeartbeatError
+	)
+
+	in := bufio.NewReader(r)
+
+	for n := 1; ; n++ {
+		line, err := in.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+
+		if data := bytes.TrimSpace(line); len(data) > 0 {
+			h, parseErr := parseRecord(data, routing)
+			if parseErr != nil {
+				invalid = append(invalid, paramscmd.ExtraHeartbeatError{Index: len(heartbeats), Line: n, Err: parseErr})
+			} else {
+				heartbeats = append(heartbeats, h)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return heartbeats, invalid, nil
+}
+
+func parseRecord(data []byte, routing apikey.Config) (heartbeat.Heartbeat, error) {
+	if err := paramscmd.ValidateExtraHeartbeat(data); err != nil {
+		return heartbeat.Heartbeat{}, err
+	}
+
+	h, err := offline.ParseRecord(data)
+	if err != nil {
+		return heartbeat.Heartbeat{}, err
+	}
+
+	if err := apikey.ValidateRouting(h, routing); err != nil {
+		return heartbeat.Heartbeat{}, fmt.Errorf("skipping heartbeat, as %s", err)
+	}
+
+	return h, nil
+}
+
+// LoadParams loads needed data from the configuration file.
+func LoadParams(ctx context.Context, v *viper.Viper) (Params, error) {
+	fp := strings.TrimSpace(vipertools.GetString(v, "offline-import-file"))
+	if fp == "" {
+		return Params{}, errors.New("file cannot be empty")
+	}
+
+	fp, err := homedir.Expand(fp)
+	if err != nil {
+		return Params{}, fmt.Errorf("failed expanding file: %s", err)
+	}
+
+	paramAPI, err := paramscmd.LoadAPIParams(ctx, v)
+	if err != nil {
+		return Params{}, fmt.Errorf("failed to load API parameters: %w", err)
+	}
+
+	return Params{
+		Filepath: fp,
+		Routing: apikey.Config{
+			APIURL:        paramAPI.URL,
+			DefaultAPIKey: paramAPI.Key,
+			MapPatterns:   paramAPI.KeyPatterns,
+		},
+	}, nil
+}
@@ -0,0 +1,184 @@
+package offlineimport_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/cmd/offlineexport"
+	"github.com/optiflow-os/tracelens-cli/cmd/offlineimport"
+	"github.com/optiflow-os/tracelens-cli/pkg/apikey"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImport_RoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	source := filepath.Join(tmpDir, "source.bdb")
+	target := filepath.Join(tmpDir, "target.bdb")
+	exported := filepath.Join(tmpDir, "out.ndjson")
+
+	_, err := offline.ImportHeartbeats(context.Background(), source, offline.Retention{}, testHeartbeats())
+	require.NoError(t, err)
+
+	_, _, err = offlineexport.Export(context.Background(), source, offlineexport.Params{
+		Delete:   true,
+		Filepath: exported,
+	})
+	require.NoError(t, err)
+
+	result, err := offlineimport.Import(context.Background(), target, offline.Retention{}, offlineimport.Params{
+		Filepath: exported,
+		Routing:  testRouting(),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, offlineimport.Result{Imported: 2}, result)
+
+	hh, err := offline.ReadHeartbeats(context.Background(), target, 10)
+	require.NoError(t, err)
+
+	// routing metadata is kept, so heartbeats are synced to the same account and api
+	expected := testHeartbeats()
+	expected[0].APIKey = ""
+	expected[0].APIKeyFingerprint = apikey.Fingerprint("00000000-0000-4000-8000-000000000000")
+
+	assert.Equal(t, expected, hh)
+}
+
+func TestImport_Duplicates(t *testing.T) {
+	tmpDir := t.TempDir()
+	queueFilepath := filepath.Join(tmpDir, "offline_heartbeats.bdb")
+
+	_, err := offline.ImportHeartbeats(context.Background(), queueFilepath, offline.Retention{}, testHeartbeats()[:1])
+	require.NoError(t, err)
+
+	result, err := offlineimport.Import(
+		context.Background(),
+		queueFilepath,
+		offline.Retention{},
+		offlineimport.Params{Filepath: "testdata/heartbeats.ndjson", Routing: testRouting()},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.Imported)
+	assert.Equal(t, 1, result.Duplicates)
+	assert.Empty(t, result.Invalid)
+
+	queued, err := offline.CountHeartbeats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, queued)
+}
+
+func TestImport_Invalid(t *testing.T) {
+	tmpDir := t.TempDir()
+	queueFilepath := filepath.Join(tmpDir, "offline_heartbeats.bdb")
+
+	result, err := offlineimport.Import(
+		context.Background(),
+		queueFilepath,
+		offline.Retention{},
+		offlineimport.Params{Filepath: "testdata/heartbeats_invalid.ndjson", Routing: testRouting()},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.Imported)
+	require.Len(t, result.Invalid, 3)
+	assert.Equal(t, 2, result.Invalid[0].Line)
+	assert.EqualError(t, result.Invalid[0], "line 2: skipping extra heartbeat, as no valid timestamp was defined")
+	assert.Equal(t, 4, result.Invalid[1].Line)
+	assert.Equal(t, 5, result.Invalid[2].Line)
+}
+
+func TestImport_ForeignRouting(t *testing.T) {
+	tmpDir := t.TempDir()
+	queueFilepath := filepath.Join(tmpDir, "offline_heartbeats.bdb")
+
+	result, err := offlineimport.Import(
+		context.Background(),
+		queueFilepath,
+		offline.Retention{},
+		offlineimport.Params{Filepath: "testdata/heartbeats_foreign.ndjson", Routing: testRouting()},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.Imported)
+	require.Len(t, result.Invalid, 2)
+	assert.EqualError(t, result.Invalid[0], "line 1: skipping heartbeat, as api key fingerprint not found in config")
+	assert.EqualError(
+		t,
+		result.Invalid[1],
+		`line 2: skipping heartbeat, as api url "https://attacker.example.com/api/v1" not found in config`,
+	)
+}
+
+func TestLoadParams(t *testing.T) {
+	v := viper.New()
+	v.Set("api-url", "https://example.org/api/v1")
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+	v.Set("offline-import-file", "/tmp/in.ndjson")
+
+	params, err := offlineimport.LoadParams(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/tmp/in.ndjson", params.Filepath)
+	assert.Equal(t, "https://example.org/api/v1", params.Routing.APIURL)
+	assert.Equal(t, "00000000-0000-4000-8000-000000000000", params.Routing.DefaultAPIKey)
+}
+
+func TestLoadParams_EmptyFile(t *testing.T) {
+	v := viper.New()
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+
+	_, err := offlineimport.LoadParams(context.Background(), v)
+	require.Error(t, err)
+}
+
+func TestImport_FileNotFound(t *testing.T) {
+	_, err := offlineimport.Import(
+		context.Background(),
+		filepath.Join(t.TempDir(), "offline_heartbeats.bdb"),
+		offline.Retention{},
+		offlineimport.Params{Filepath: filepath.Join(os.TempDir(), "nonexisting.ndjson")},
+	)
+	require.Error(t, err)
+}
+
+func testRouting() apikey.Config {
+	return apikey.Config{
+		APIURL:        "https://example.org/api/v1",
+		DefaultAPIKey: "00000000-0000-4000-8000-000000000000",
+	}
+}
+
+func testHeartbeats() []heartbeat.Heartbeat {
+	return []heartbeat.Heartbeat{
+		{
+			APIKey:     "00000000-0000-4000-8000-000000000000",
+			APIURL:     "https://example.org/api/v1",
+			Branch:     heartbeat.PointerTo("main"),
+			Category:   heartbeat.CodingCategory,
+			Entity:     "/tmp/main.go",
+			EntityType: heartbeat.FileType,
+			IsWrite:    heartbeat.PointerTo(true),
+			Project:    heartbeat.PointerTo("wakatime-cli"),
+			Time:       1592868367.219124,
+			UserAgent:  "wakatime/13.0.6",
+			UUID:       "01900000-0000-7000-8000-000000000001",
+		},
+		{
+			Category:   heartbeat.DebuggingCategory,
+			Entity:     "/tmp/main.py",
+			EntityType: heartbeat.FileType,
+			Time:       1592868386.079084,
+			UserAgent:  "wakatime/13.0.7",
+			UUID:       "01900000-0000-7000-8000-000000000002",
+		},
+	}
+}
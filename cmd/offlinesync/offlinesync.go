@@ -106,8 +106,9 @@ func syncOfflineActivityLegacy(ctx context.Context, v *viper.Viper, queueFilepat
 	}
 
 	handle := heartbeat.NewHandle(apiClient,
-		offline.WithSync(queueFilepath, paramOffline.SyncMax),
+		offline.WithSync(queueFilepath, paramOffline.SyncMax, paramOffline.Retention),
 		apikey.WithReplacing(apikey.Config{
+			APIURL:        paramAPI.URL,
 			DefaultAPIKey: paramAPI.Key,
 			MapPatterns:   paramAPI.KeyPatterns,
 		}),
@@ -124,6 +125,10 @@ func syncOfflineActivityLegacy(ctx context.Context, v *viper.Viper, queueFilepat
 		logger.Warnf("failed to delete legacy offline file: %s", err)
 	}
 
+	if err := os.Remove(offline.KeyFilepath(queueFilepath)); err != nil && !os.IsNotExist(err) {
+		logger.Warnf("failed to delete legacy offline key file: %s", err)
+	}
+
 	return nil
 }
 
@@ -143,8 +148,9 @@ func SyncOfflineActivity(ctx context.Context, v *viper.Viper, queueFilepath stri
 	paramOffline := params.LoadOfflineParams(ctx, v)
 
 	handle := heartbeat.NewHandle(apiClient,
-		offline.WithSync(queueFilepath, paramOffline.SyncMax),
+		offline.WithSync(queueFilepath, paramOffline.SyncMax, paramOffline.Retention),
 		apikey.WithReplacing(apikey.Config{
+			APIURL:        paramAPI.URL,
 			DefaultAPIKey: paramAPI.Key,
 			MapPatterns:   paramAPI.KeyPatterns,
 		}),
@@ -0,0 +1,94 @@
+package params
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+
+	"github.com/spf13/viper"
+)
+
+// envVarPrefix is the prefix of environment variables overriding params and settings.
+const envVarPrefix = "TRACELENS_"
+
+// EnvVarName returns the environment variable of a param or config key,
+// e.g. TRACELENS_API_URL for --api-url and api_url.
+func EnvVarName(key string) string {
+	return envVarPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// ApplyEnv overrides params and config settings with the values of TRACELENS_*
+// environment variables. It has to be called before the config files are read.
+// The resulting precedence is: command line flag > environment variable >
+// repository config > user config.
+//
+// Keys of [settings] are set by their name, e.g. TRACELENS_HIDE_FILE_NAMES.
+// Command line flags without a [settings] key of the same name are set, unless
+// passed on the command line, e.g. TRACELENS_KEY. List values, like exclude,
+// take one pattern per line. Sections with regex pattern keys, like [projectmap],
+// take one `pattern = value` pair per line, e.g. TRACELENS_PROJECTMAP.
+func ApplyEnv(ctx context.Context, v *viper.Viper) {
+	logger := log.Extract(ctx)
+
+	settings := configSchema["settings"].Keys
+
+	for key := range settings {
+		value, ok := os.LookupEnv(EnvVarName(key))
+		if !ok {
+			continue
+		}
+
+		logger.Debugf("setting %q from env var %s", key, EnvVarName(key))
+
+		v.Set("settings."+key, value)
+	}
+
+	for section, schema := range configSchema {
+		if !schema.Patterns {
+			continue
+		}
+
+		value, ok := os.LookupEnv(EnvVarName(section))
+		if !ok {
+			continue
+		}
+
+		logger.Debugf("setting [%s] from env var %s", section, EnvVarName(section))
+
+		for _, line := range strings.Split(value, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+
+			pattern, val, found := strings.Cut(line, "=")
+			if !found {
+				logger.Warnf("invalid line %q in env var %s, expected `pattern = value`", line, EnvVarName(section))
+				continue
+			}
+
+			v.Set(section+"."+strings.ToLower(strings.TrimSpace(pattern)), strings.TrimSpace(val))
+		}
+	}
+
+	for _, key := range v.AllKeys() {
+		// flags are the only keys outside of a section
+		if strings.Contains(key, ".") {
+			continue
+		}
+
+		if _, ok := settings[strings.ReplaceAll(key, "-", "_")]; ok {
+			continue
+		}
+
+		value, ok := os.LookupEnv(EnvVarName(key))
+		if !ok || v.IsSet(key) {
+			continue
+		}
+
+		logger.Debugf("setting param %q from env var %s", key, EnvVarName(key))
+
+		v.Set(key, value)
+	}
+}
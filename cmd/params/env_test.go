@@ -0,0 +1,71 @@
+package params_test
+
+import (
+	"context"
+	"testing"
+
+	cmdparams "github.com/optiflow-os/tracelens-cli/cmd/params"
+	"github.com/optiflow-os/tracelens-cli/pkg/vipertools"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvVarName(t *testing.T) {
+	assert.Equal(t, "TRACELENS_API_URL", cmdparams.EnvVarName("api-url"))
+	assert.Equal(t, "TRACELENS_HIDE_FILE_NAMES", cmdparams.EnvVarName("hide_file_names"))
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("TRACELENS_API_URL", "https://example.org/api/v1")
+	t.Setenv("TRACELENS_EXCLUDE", "^/tmp/\n^/var/")
+	t.Setenv("TRACELENS_PROJECTMAP", "^/home/user/projects/foo = foo\n\n^/home/user/work/(.+) = {0}")
+	t.Setenv("TRACELENS_KEY", "00000000-0000-4000-8000-000000000001")
+	t.Setenv("TRACELENS_PROJECT", "env-project")
+	t.Setenv("TRACELENS_INCLUDE", ".*\\.go$")
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("api-url", "", "")
+	flags.String("key", "", "")
+	flags.String("project", "", "")
+	flags.StringSlice("include", nil, "")
+
+	require.NoError(t, flags.Parse([]string{"--project", "flag-project"}))
+
+	v := viper.New()
+	require.NoError(t, v.BindPFlags(flags))
+
+	cmdparams.ApplyEnv(context.Background(), v)
+
+	assert.Equal(t, "https://example.org/api/v1", v.GetString("settings.api_url"))
+	assert.Empty(t, v.GetString("api-url"))
+	assert.Equal(t, []string{"^/tmp/", "^/var/"}, v.GetStringSlice("settings.exclude"))
+	assert.Equal(t, map[string]string{
+		"^/home/user/projects/foo": "foo",
+		"^/home/user/work/(.+)":    "{0}",
+	}, vipertools.GetStringMapString(v, "projectmap"))
+	assert.Equal(t, "00000000-0000-4000-8000-000000000001", v.GetString("key"))
+	assert.Equal(t, "flag-project", v.GetString("project"))
+	assert.Empty(t, v.GetStringSlice("include"))
+	assert.Equal(t, []string{".*\\.go$"}, v.GetStringSlice("settings.include"))
+}
+
+func TestApplyEnv_Precedence(t *testing.T) {
+	t.Setenv("TRACELENS_API_URL", "https://env.example.org/api/v1")
+
+	v := viper.New()
+	v.Set("profile", "work")
+
+	cmdparams.ApplyEnv(context.Background(), v)
+
+	v.Set("profile work.api_url", "https://profile.example.org/api/v1")
+	v.Set("profile work.debug", "true")
+
+	_, err := cmdparams.ApplyProfile(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://env.example.org/api/v1", v.GetString("settings.api_url"))
+	assert.True(t, v.GetBool("settings.debug"))
+}
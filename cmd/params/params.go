@@ -2,6 +2,7 @@ package params
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -10,8 +11,10 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -19,6 +22,7 @@ import (
 
 	"github.com/optiflow-os/tracelens-cli/pkg/api"
 	"github.com/optiflow-os/tracelens-cli/pkg/apikey"
+	"github.com/optiflow-os/tracelens-cli/pkg/category"
 	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
 	"github.com/optiflow-os/tracelens-cli/pkg/ini"
 	"github.com/optiflow-os/tracelens-cli/pkg/log"
@@ -80,47 +84,60 @@ type (
 
 	// ExtraHeartbeat contains extra heartbeat.
 	ExtraHeartbeat struct {
-		BranchAlternate   string             `json:"alternate_branch"`
-		Category          heartbeat.Category `json:"category"`
-		CursorPosition    any                `json:"cursorpos"`
-		Entity            string             `json:"entity"`
-		EntityType        string             `json:"entity_type"`
-		Type              string             `json:"type"`
-		IsUnsavedEntity   any                `json:"is_unsaved_entity"`
-		IsWrite           any                `json:"is_write"`
-		Language          *string            `json:"language"`
-		LanguageAlternate string             `json:"alternate_language"`
-		LineAdditions     any                `json:"line_additions"`
-		LineDeletions     any                `json:"line_deletions"`
-		LineNumber        any                `json:"lineno"`
-		Lines             any                `json:"lines"`
-		Project           string             `json:"project"`
-		ProjectAlternate  string             `json:"alternate_project"`
-		Time              any                `json:"time"`
-		Timestamp         any                `json:"timestamp"`
+		AILineChanges     any                 `json:"ai_line_changes"`
+		AITool            string              `json:"ai_tool"`
+		BranchAlternate   string              `json:"alternate_branch"`
+		Category          *heartbeat.Category `json:"category"`
+		CursorPosition    any                 `json:"cursorpos"`
+		Cwd               string              `json:"cwd"`
+		Entity            string              `json:"entity"`
+		EntityType        string              `json:"entity_type"`
+		HumanLineChanges  any                 `json:"human_line_changes"`
+		ID                string              `json:"id"`
+		Type              string              `json:"type"`
+		IsUnsavedEntity   any                 `json:"is_unsaved_entity"`
+		IsWrite           any                 `json:"is_write"`
+		Language          *string             `json:"language"`
+		LanguageAlternate string              `json:"alternate_language"`
+		LineAdditions     any                 `json:"line_additions"`
+		LineDeletions     any                 `json:"line_deletions"`
+		LineNumber        any                 `json:"lineno"`
+		Lines             any                 `json:"lines"`
+		Project           string              `json:"project"`
+		ProjectAlternate  string              `json:"alternate_project"`
+		Time              any                 `json:"time"`
+		Timestamp         any                 `json:"timestamp"`
+		UserAgent         string              `json:"user_agent"`
 	}
 
 	// Heartbeat contains heartbeat command parameters.
 	Heartbeat struct {
-		Category          heartbeat.Category
-		CursorPosition    *int
-		Entity            string
-		EntityType        heartbeat.EntityType
-		ExtraHeartbeats   []heartbeat.Heartbeat
-		GuessLanguage     bool
-		IsUnsavedEntity   bool
-		IsWrite           *bool
-		Language          *string
-		LanguageAlternate string
-		LineAdditions     *int
-		LineDeletions     *int
-		LineNumber        *int
-		LinesInFile       *int
-		LocalFile         string
-		Time              float64
-		Filter            FilterParams
-		Project           ProjectParams
-		Sanitize          SanitizeParams
+		AILineChanges      *int
+		AITool             string
+		Category           heartbeat.Category
+		CategoryExplicit   bool
+		CategoryRules      []category.Rule
+		CursorPosition     *int
+		Cwd                string
+		Entity             string
+		EntityType         heartbeat.EntityType
+		ExtraHeartbeats    []heartbeat.Heartbeat
+		ExtraHeartbeatErrs []ExtraHeartbeatError
+		GuessLanguage      bool
+		HumanLineChanges   *int
+		IsUnsavedEntity    bool
+		IsWrite            *bool
+		Language           *string
+		LanguageAlternate  string
+		LineAdditions      *int
+		LineDeletions      *int
+		LineNumber         *int
+		LinesInFile        *int
+		LocalFile          string
+		Time               float64
+		Filter             FilterParams
+		Project            ProjectParams
+		Sanitize           SanitizeParams
 	}
 
 	// FilterParams contains heartbeat filtering related command parameters.
@@ -137,6 +154,7 @@ type (
 		LastSentAt time.Time
 		PrintMax   int
 		RateLimit  time.Duration
+		Retention  offline.Retention
 		SyncMax    int
 	}
 
@@ -144,6 +162,7 @@ type (
 	ProjectParams struct {
 		Alternate            string
 		BranchAlternate      string
+		DomainRules          []project.DomainRule
 		MapPatterns          []project.MapPattern
 		Override             string
 		ProjectFromGitRemote bool
@@ -153,12 +172,14 @@ type (
 
 	// SanitizeParams params for heartbeat sanitization.
 	SanitizeParams struct {
+		CommandArgPatterns  []regex.Regex
 		HideBranchNames     []regex.Regex
 		HideDependencies    []regex.Regex
 		HideFileNames       []regex.Regex
 		HideProjectFolder   bool
 		HideProjectNames    []regex.Regex
 		ProjectPathOverride string
+		SendCommandArgs     bool
 	}
 
 	// StatusBar contains status bar related parameters.
@@ -319,6 +340,11 @@ func LoadAPIParams(ctx context.Context, v *viper.Viper) (API, error) {
 	}, nil
 }
 
+// IsValidAPIKey returns true if the key has a valid WakaTime API Key format.
+func IsValidAPIKey(key string) bool {
+	return apiKeyRegex.MatchString(key)
+}
+
 // LoadAPIKey loads a valid default WakaTime API Key or returns an error.
 func LoadAPIKey(ctx context.Context, v *viper.Viper) (string, error) {
 	apiKey := vipertools.FirstNonEmptyString(v, "key", "settings.api_key", "settings.apikey")
@@ -330,7 +356,7 @@ func LoadAPIKey(ctx context.Context, v *viper.Viper) (string, error) {
 		return apiKey, nil
 	}
 
-	apiKey, err := readAPIKeyFromCommand(vipertools.GetString(v, "settings.api_key_vault_cmd"))
+	apiKey, err := ReadAPIKeyFromCommand(vipertools.GetString(v, "settings.api_key_vault_cmd"))
 	if err != nil {
 		return "", api.ErrAuth{Err: fmt.Errorf("failed to read api key from vault: %s", err)}
 	}
@@ -384,6 +410,11 @@ func LoadHeartbeatParams(ctx context.Context, v *viper.Viper) (Heartbeat, error)
 	}
 
 	entity := vipertools.FirstNonEmptyString(v, "entity", "file")
+	if entity == "" && v.GetBool("shell-hook") {
+		// shell-init hooks pass the command line on stdin, so it's not visible to other users
+		entity = readShellCommand(ctx)
+	}
+
 	if entity == "" {
 		return Heartbeat{}, errors.New("failed to retrieve entity")
 	}
@@ -404,10 +435,38 @@ func LoadHeartbeatParams(ctx context.Context, v *viper.Viper) (Heartbeat, error)
 		entityType = parsed
 	}
 
-	var extraHeartbeats []heartbeat.Heartbeat
+	categoryExplicit := vipertools.GetString(v, "category") != ""
+
+	if v.GetBool("shell-hook") {
+		var detected heartbeat.Category
+
+		entity, detected = parseShellCommand(ctx, v, entity)
+		if entity == "" {
+			return Heartbeat{}, errors.New("failed to retrieve executable from shell command")
+		}
+
+		if !categoryExplicit {
+			category = detected
+		}
+	}
+
+	cwd, err := loadCwd(v, entityType)
+	if err != nil {
+		return Heartbeat{}, err
+	}
+
+	var (
+		extraHeartbeats    []heartbeat.Heartbeat
+		extraHeartbeatErrs []ExtraHeartbeatError
+	)
 
 	if v.GetBool("extra-heartbeats") {
-		extraHeartbeats = readExtraHeartbeats(ctx)
+		format, err := parseExtraHeartbeatsFormat(vipertools.GetString(v, "extra-heartbeats-format"))
+		if err != nil {
+			return Heartbeat{}, err
+		}
+
+		extraHeartbeats, extraHeartbeatErrs = readExtraHeartbeats(ctx, format)
 	}
 
 	var isWrite *bool
@@ -415,6 +474,16 @@ func LoadHeartbeatParams(ctx context.Context, v *viper.Viper) (Heartbeat, error)
 		isWrite = heartbeat.PointerTo(b)
 	}
 
+	var aiLineChanges *int
+	if num := v.GetInt("ai-line-changes"); v.IsSet("ai-line-changes") {
+		aiLineChanges = heartbeat.PointerTo(num)
+	}
+
+	var humanLineChanges *int
+	if num := v.GetInt("human-line-changes"); v.IsSet("human-line-changes") {
+		humanLineChanges = heartbeat.PointerTo(num)
+	}
+
 	var lineAdditions *int
 	if num := v.GetInt("line-additions"); v.IsSet("line-additions") {
 		lineAdditions = heartbeat.PointerTo(num)
@@ -440,6 +509,80 @@ func LoadHeartbeatParams(ctx context.Context, v *viper.Viper) (Heartbeat, error)
 		timeSecs = float64(time.Now().UnixNano()) / 1000000000
 	}
 
+	params, err := LoadHeartbeatPipelineParams(ctx, v)
+	if err != nil {
+		return Heartbeat{}, err
+	}
+
+	var language *string
+	if l := vipertools.GetString(v, "language"); l != "" {
+		language = &l
+	}
+
+	params.AILineChanges = aiLineChanges
+	params.AITool = vipertools.GetString(v, "ai-tool")
+	params.Category = category
+	params.CategoryExplicit = categoryExplicit
+	params.CursorPosition = cursorPosition
+	params.Cwd = cwd
+	params.Entity = entity
+	params.ExtraHeartbeats = extraHeartbeats
+	params.ExtraHeartbeatErrs = extraHeartbeatErrs
+	params.EntityType = entityType
+	params.HumanLineChanges = humanLineChanges
+	params.IsUnsavedEntity = v.GetBool("is-unsaved-entity")
+	params.IsWrite = isWrite
+	params.Language = language
+	params.LanguageAlternate = vipertools.GetString(v, "alternate-language")
+	params.LineAdditions = lineAdditions
+	params.LineDeletions = lineDeletions
+	params.LineNumber = lineNumber
+	params.LinesInFile = linesInFile
+	params.LocalFile = vipertools.GetString(v, "local-file")
+	params.Time = timeSecs
+
+	return params, nil
+}
+
+// parseShellCommand reduces a command line passed by shell-init hooks to its
+// executable name and detects its category from [shell_categories] and the
+// default command rules.
+func parseShellCommand(ctx context.Context, v *viper.Viper, command string) (string, heartbeat.Category) {
+	rules := loadCategoryRules(ctx, v, "shell_categories", compileCaseInsensitive)
+
+	detected, _ := category.DetectCommand(ctx, command, rules)
+
+	return category.Executable(command), detected
+}
+
+// loadCwd loads the working directory of command entities, which defaults to
+// the current working directory.
+func loadCwd(v *viper.Viper, entityType heartbeat.EntityType) (string, error) {
+	if entityType != heartbeat.CommandType {
+		return "", nil
+	}
+
+	cwd := vipertools.GetString(v, "cwd")
+	if cwd == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to get working directory: %s", err)
+		}
+
+		return wd, nil
+	}
+
+	cwd, err := homedir.Expand(cwd)
+	if err != nil {
+		return "", fmt.Errorf("failed expanding cwd: %s", err)
+	}
+
+	return cwd, nil
+}
+
+// LoadHeartbeatPipelineParams loads only the heartbeat params configuring the
+// heartbeat processing pipeline, which don't depend on a specific entity.
+func LoadHeartbeatPipelineParams(ctx context.Context, v *viper.Viper) (Heartbeat, error) {
 	filterParams, err := loadFilterParams(ctx, v)
 	if err != nil {
 		return Heartbeat{}, fmt.Errorf("failed to load filter params: %s", err)
@@ -455,34 +598,59 @@ func LoadHeartbeatParams(ctx context.Context, v *viper.Viper) (Heartbeat, error)
 		return Heartbeat{}, fmt.Errorf("failed to load sanitize params: %s", err)
 	}
 
-	var language *string
-	if l := vipertools.GetString(v, "language"); l != "" {
-		language = &l
-	}
-
 	return Heartbeat{
-		Category:          category,
-		CursorPosition:    cursorPosition,
-		Entity:            entity,
-		ExtraHeartbeats:   extraHeartbeats,
-		EntityType:        entityType,
-		GuessLanguage:     vipertools.FirstNonEmptyBool(v, "guess-language", "settings.guess_language"),
-		IsUnsavedEntity:   v.GetBool("is-unsaved-entity"),
-		IsWrite:           isWrite,
-		Language:          language,
-		LanguageAlternate: vipertools.GetString(v, "alternate-language"),
-		LineAdditions:     lineAdditions,
-		LineDeletions:     lineDeletions,
-		LineNumber:        lineNumber,
-		LinesInFile:       linesInFile,
-		LocalFile:         vipertools.GetString(v, "local-file"),
-		Time:              timeSecs,
-		Filter:            filterParams,
-		Project:           projectParams,
-		Sanitize:          sanitizeParams,
+		CategoryRules: loadCategoryRules(ctx, v, "categories", category.CompilePattern),
+		GuessLanguage: vipertools.FirstNonEmptyBool(v, "guess-language", "settings.guess_language"),
+		Filter:        filterParams,
+		Project:       projectParams,
+		Sanitize:      sanitizeParams,
 	}, nil
 }
 
+// loadCategoryRules loads a section mapping patterns to categories, like
+// [categories] or [shell_categories]. Patterns are sorted to be checked in a
+// stable order.
+func loadCategoryRules(
+	ctx context.Context,
+	v *viper.Viper,
+	section string,
+	compile func(string) (regex.Regex, error),
+) []category.Rule {
+	logger := log.Extract(ctx)
+
+	values := vipertools.GetStringMapString(v, section)
+
+	patterns := make([]string, 0, len(values))
+	for k := range values {
+		patterns = append(patterns, k)
+	}
+
+	sort.Strings(patterns)
+
+	var rules []category.Rule
+
+	for _, pattern := range patterns {
+		parsed, err := heartbeat.ParseCategory(values[pattern])
+		if err != nil {
+			logger.Warnf("invalid category %q for pattern %q: %s", values[pattern], pattern, err)
+			continue
+		}
+
+		compiled, err := compile(pattern)
+		if err != nil {
+			logger.Warnf("failed to compile %s pattern: %s", section, err)
+			continue
+		}
+
+		rules = append(rules, category.Rule{
+			Category: parsed,
+			Pattern:  compiled,
+		})
+	}
+
+	return rules
+}
+
 func loadFilterParams(ctx context.Context, v *viper.Viper) (FilterParams, error) {
 	exclude := v.GetStringSlice("exclude")
 	exclude = append(exclude, v.GetStringSlice("settings.exclude")...)
@@ -610,13 +778,53 @@ func loadSanitizeParams(ctx context.Context, v *viper.Viper) (SanitizeParams, er
 		)
 	}
 
+	// hide command args, stripping all arguments by default
+	hideCommandArgsStr := vipertools.FirstNonEmptyString(
+		v,
+		"hide-command-args",
+		"settings.hide_command_args",
+	)
+
+	var (
+		commandArgPatterns []regex.Regex
+		sendCommandArgs    bool
+	)
+
+	switch strings.ToLower(strings.TrimSpace(hideCommandArgsStr)) {
+	case "", "true":
+	case "false":
+		sendCommandArgs = true
+	default:
+		sendCommandArgs = true
+
+		commandArgPatterns, err = parseBoolOrRegexList(ctx, hideCommandArgsStr)
+		if err != nil {
+			return SanitizeParams{}, fmt.Errorf(
+				"failed to parse regex hide command args param %q: %s",
+				hideCommandArgsStr,
+				err,
+			)
+		}
+	}
+
+	projectPathOverride := vipertools.GetString(v, "project-folder")
+
+	// shell hooks pass their working directory, which project detection must search
+	// from instead of its parent. Detectors do so for folders with a trailing separator.
+	if v.GetBool("shell-hook") && projectPathOverride != "" &&
+		!strings.HasSuffix(projectPathOverride, string(filepath.Separator)) {
+		projectPathOverride += string(filepath.Separator)
+	}
+
 	return SanitizeParams{
+		CommandArgPatterns:  commandArgPatterns,
 		HideBranchNames:     hideBranchNamesPatterns,
 		HideDependencies:    hideDependenciesPatterns,
 		HideFileNames:       hideFileNamesPatterns,
 		HideProjectFolder:   vipertools.FirstNonEmptyBool(v, "hide-project-folder", "settings.hide_project_folder"),
 		HideProjectNames:    hideProjectNamesPatterns,
-		ProjectPathOverride: vipertools.GetString(v, "project-folder"),
+		ProjectPathOverride: projectPathOverride,
+		SendCommandArgs:     sendCommandArgs,
 	}, nil
 }
 
@@ -632,6 +840,7 @@ func loadProjectParams(ctx context.Context, v *viper.Viper) (ProjectParams, erro
 	return ProjectParams{
 		Alternate:            vipertools.GetString(v, "alternate-project"),
 		BranchAlternate:      vipertools.GetString(v, "alternate-branch"),
+		DomainRules:          loadDomainRules(ctx, v),
 		MapPatterns:          loadProjectMapPatterns(ctx, v, "projectmap"),
 		Override:             vipertools.GetString(v, "project"),
 		ProjectFromGitRemote: v.GetBool("git.project_from_git_remote"),
@@ -668,6 +877,91 @@ func loadProjectMapPatterns(ctx context.Context, v *viper.Viper, prefix string)
 	return mapPatterns
 }
 
+// loadDomainRules loads the [domain_rules] section mapping domain and url
+// patterns to a project and category. Patterns are sorted to be checked in a
+// stable order.
+func loadDomainRules(ctx context.Context, v *viper.Viper) []project.DomainRule {
+	logger := log.Extract(ctx)
+
+	values := vipertools.GetStringMapString(v, "domain_rules")
+
+	patterns := make([]string, 0, len(values))
+	for k := range values {
+		patterns = append(patterns, k)
+	}
+
+	sort.Strings(patterns)
+
+	var rules []project.DomainRule
+
+	for _, pattern := range patterns {
+		rule, err := parseDomainRule(values[pattern])
+		if err != nil {
+			logger.Warnf("invalid domain rule for pattern %q: %s", pattern, err)
+			continue
+		}
+
+		k := pattern
+
+		// make all regex case insensitive
+		if !strings.HasPrefix(k, "(?i)") {
+			k = "(?i)" + k
+		}
+
+		compiled, err := regex.Compile(k)
+		if err != nil {
+			logger.Warnf("failed to compile domain_rules regex pattern %q", k)
+			continue
+		}
+
+		rule.Regex = compiled
+
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// parseDomainRule parses a domain rule value of semicolon separated
+// "project: name" and "category: name" pairs, like "project: {0}; category: code reviewing".
+func parseDomainRule(value string) (project.DomainRule, error) {
+	var rule project.DomainRule
+
+	for _, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, val, ok := strings.Cut(part, ":")
+		if !ok {
+			return project.DomainRule{}, fmt.Errorf("invalid rule %q, expected project: name or category: name", part)
+		}
+
+		val = strings.TrimSpace(val)
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "project":
+			rule.Project = val
+		case "category":
+			parsed, err := heartbeat.ParseCategory(val)
+			if err != nil {
+				return project.DomainRule{}, err
+			}
+
+			rule.Category = &parsed
+		default:
+			return project.DomainRule{}, fmt.Errorf("invalid rule key %q, expected project or category", key)
+		}
+	}
+
+	if rule.Project == "" && rule.Category == nil {
+		return project.DomainRule{}, errors.New("rule sets neither project nor category")
+	}
+
+	return rule, nil
+}
+
 // LoadOfflineParams loads offline params from viper.Viper instance.
 func LoadOfflineParams(ctx context.Context, v *viper.Viper) Offline {
 	disabled := vipertools.FirstNonEmptyBool(v, "disable-offline", "disableoffline")
@@ -720,10 +1014,40 @@ func LoadOfflineParams(ctx context.Context, v *viper.Viper) Offline {
 		LastSentAt: lastSentAt,
 		PrintMax:   v.GetInt("print-offline-heartbeats"),
 		RateLimit:  time.Duration(rateLimit) * time.Second,
+		Retention:  loadOfflineRetention(ctx, v),
 		SyncMax:    syncMax,
 	}
 }
 
+func loadOfflineRetention(ctx context.Context, v *viper.Viper) offline.Retention {
+	logger := log.Extract(ctx)
+
+	var retention offline.Retention
+
+	if maxHeartbeats := v.GetInt("settings.offline_max_heartbeats"); maxHeartbeats >= 0 {
+		retention.MaxHeartbeats = maxHeartbeats
+	} else {
+		logger.Warnf("offline_max_heartbeats must be zero or a positive integer number, got %d", maxHeartbeats)
+	}
+
+	if maxAgeDays := v.GetInt("settings.offline_max_age_days"); maxAgeDays >= 0 {
+		retention.MaxAge = time.Duration(maxAgeDays) * 24 * time.Hour
+	} else {
+		logger.Warnf("offline_max_age_days must be zero or a positive integer number, got %d", maxAgeDays)
+	}
+
+	if strategyStr := vipertools.GetString(v, "settings.offline_drop_strategy"); strategyStr != "" {
+		strategy, err := offline.ParseDropStrategy(strategyStr)
+		if err != nil {
+			logger.Warnf("failed to parse offline_drop_strategy: %s", err)
+		}
+
+		retention.DropStrategy = strategy
+	}
+
+	return retention
+}
+
 // LoadStatusBarParams loads status bar params from viper.Viper instance.
 func LoadStatusBarParams(v *viper.Viper) (StatusBar, error) {
 	var hideCategories bool
@@ -768,7 +1092,9 @@ func safeTimeParse(format string, s string) (parsed time.Time, err error) {
 	return time.Parse(format, s)
 }
 
-func readAPIKeyFromCommand(cmdStr string) (string, error) {
+// ReadAPIKeyFromCommand executes the api key vault command and returns its
+// trimmed output. Returns an empty string if no command is given.
+func ReadAPIKeyFromCommand(cmdStr string) (string, error) {
 	if cmdStr == "" {
 		return "", nil
 	}
@@ -800,23 +1126,85 @@ func readAPIKeyFromCommand(cmdStr string) (string, error) {
 	return strings.TrimSpace(string(out)), nil
 }
 
-var extraHeartbeatsCache []heartbeat.Heartbeat // nolint:gochecknoglobals
+var (
+	extraHeartbeatsCache    []heartbeat.Heartbeat // nolint:gochecknoglobals
+	extraHeartbeatErrsCache []ExtraHeartbeatError // nolint:gochecknoglobals
+	shellCommandCache       string                // nolint:gochecknoglobals
+)
 
-// Once prevents reading from stdin twice.
+// Once prevents reading extra heartbeats from stdin twice.
 var Once sync.Once // nolint:gochecknoglobals
 
-func readExtraHeartbeats(ctx context.Context) []heartbeat.Heartbeat {
+// ShellCommandOnce prevents reading the shell command from stdin twice.
+var ShellCommandOnce sync.Once // nolint:gochecknoglobals
+
+// maxShellCommandSize is the max size of a command line read from stdin.
+const maxShellCommandSize = 64 * 1024
+
+const (
+	// extraHeartbeatsFormatJSON reads a single line json array from stdin.
+	extraHeartbeatsFormatJSON = "json"
+	// extraHeartbeatsFormatNDJSON reads one json heartbeat per line from stdin until EOF.
+	extraHeartbeatsFormatNDJSON = "ndjson"
+)
+
+// ExtraHeartbeatError is an invalid line of extra heartbeats read as ndjson.
+type ExtraHeartbeatError struct {
+	// Index is the number of valid heartbeats on the lines before.
+	Index int
+	Line  int
+	Err   error
+}
+
+// Error method to implement error interface.
+func (e ExtraHeartbeatError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// Unwrap returns the parsing error of the line.
+func (e ExtraHeartbeatError) Unwrap() error {
+	return e.Err
+}
+
+func parseExtraHeartbeatsFormat(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", extraHeartbeatsFormatJSON:
+		return extraHeartbeatsFormatJSON, nil
+	case extraHeartbeatsFormatNDJSON:
+		return extraHeartbeatsFormatNDJSON, nil
+	default:
+		return "", fmt.Errorf("invalid extra heartbeats format %q, expected json or ndjson", s)
+	}
+}
+
+func readExtraHeartbeats(ctx context.Context, format string) ([]heartbeat.Heartbeat, []ExtraHeartbeatError) {
 	Once.Do(func() {
 		logger := log.Extract(ctx)
 
 		in := bufio.NewReader(os.Stdin)
 
+		if format == extraHeartbeatsFormatNDJSON {
+			heartbeats, errs, err := ParseExtraHeartbeatsNDJSON(ctx, in)
+			if err != nil {
+				logger.Errorf("failed to read data from stdin: %s", err)
+			}
+
+			for _, e := range errs {
+				logger.Errorf("skipping invalid extra heartbeat: %s", e)
+			}
+
+			extraHeartbeatsCache = heartbeats
+			extraHeartbeatErrsCache = errs
+
+			return
+		}
+
 		input, err := in.ReadString('\n')
 		if err != nil && err != io.EOF {
 			logger.Debugf("failed to read data from stdin: %s", err)
 		}
 
-		heartbeats, err := parseExtraHeartbeats(ctx, input)
+		heartbeats, err := ParseExtraHeartbeats(ctx, input)
 		if err != nil {
 			logger.Errorf("failed parsing: %s", err)
 		}
@@ -824,10 +1212,86 @@ func readExtraHeartbeats(ctx context.Context) []heartbeat.Heartbeat {
 		extraHeartbeatsCache = heartbeats
 	})
 
-	return extraHeartbeatsCache
+	return extraHeartbeatsCache, extraHeartbeatErrsCache
+}
+
+// readShellCommand reads the command line passed by shell-init hooks from stdin.
+func readShellCommand(ctx context.Context) string {
+	ShellCommandOnce.Do(func() {
+		data, err := io.ReadAll(io.LimitReader(os.Stdin, maxShellCommandSize))
+		if err != nil {
+			log.Extract(ctx).Debugf("failed to read shell command from stdin: %s", err)
+		}
+
+		shellCommandCache = strings.TrimSpace(string(data))
+	})
+
+	return shellCommandCache
+}
+
+// ParseExtraHeartbeatsNDJSON parses newline delimited json heartbeats, one
+// per line, until EOF. Lines have no size limit and blank lines are skipped.
+// Invalid lines don't stop parsing, but are returned with their line number.
+// An error is only returned, if reading fails.
+func ParseExtraHeartbeatsNDJSON(
+	ctx context.Context,
+	r io.Reader,
+) ([]heartbeat.Heartbeat, []ExtraHeartbeatError, error) {
+	logger := log.Extract(ctx)
+
+	var (
+		heartbeats []heartbeat.Heartbeat
+		errs       []ExtraHeartbeatError
+	)
+
+	in := bufio.NewReader(r)
+
+	for n := 1; ; n++ {
+		line, err := in.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return heartbeats, errs, err
+		}
+
+		if data := bytes.TrimSpace(line); len(data) > 0 {
+			parsed, parseErr := parseExtraHeartbeatLine(data)
+			if parseErr != nil {
+				errs = append(errs, ExtraHeartbeatError{Index: len(heartbeats), Line: n, Err: parseErr})
+			} else {
+				heartbeats = append(heartbeats, *parsed)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	logger.Debugf("parsed %d extra heartbeat(s) from ndjson, %d invalid line(s)", len(heartbeats), len(errs))
+
+	return heartbeats, errs, nil
+}
+
+// ValidateExtraHeartbeat validates a json heartbeat with the rules applied
+// to extra heartbeats.
+func ValidateExtraHeartbeat(data []byte) error {
+	_, err := parseExtraHeartbeatLine(data)
+
+	return err
+}
+
+func parseExtraHeartbeatLine(data []byte) (*heartbeat.Heartbeat, error) {
+	var h ExtraHeartbeat
+
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("failed to json decode: %s", err)
+	}
+
+	return parseExtraHeartbeat(h)
 }
 
-func parseExtraHeartbeats(ctx context.Context, data string) ([]heartbeat.Heartbeat, error) {
+// ParseExtraHeartbeats parses a json array of heartbeats, as accepted by the
+// --extra-heartbeats flag and the heartbeats.bulk api endpoint.
+func ParseExtraHeartbeats(ctx context.Context, data string) ([]heartbeat.Heartbeat, error) {
 	logger := log.Extract(ctx)
 
 	if data == "" {
@@ -876,6 +1340,11 @@ func parseExtraHeartbeat(h ExtraHeartbeat) (*heartbeat.Heartbeat, error) {
 		}
 	}
 
+	h.Cwd, err = homedir.Expand(h.Cwd)
+	if err != nil {
+		return nil, fmt.Errorf("failed expanding cwd: %s", err)
+	}
+
 	var cursorPosition *int
 
 	switch cursorPositionVal := h.CursorPosition.(type) {
@@ -932,6 +1401,34 @@ func parseExtraHeartbeat(h ExtraHeartbeat) (*heartbeat.Heartbeat, error) {
 		lines = heartbeat.PointerTo(val)
 	}
 
+	var aiLineChanges *int
+
+	switch aiLineChangesVal := h.AILineChanges.(type) {
+	case float64:
+		aiLineChanges = heartbeat.PointerTo(int(aiLineChangesVal))
+	case string:
+		val, err := strconv.Atoi(aiLineChangesVal)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert ai line changes to int: %s", err)
+		}
+
+		aiLineChanges = heartbeat.PointerTo(val)
+	}
+
+	var humanLineChanges *int
+
+	switch humanLineChangesVal := h.HumanLineChanges.(type) {
+	case float64:
+		humanLineChanges = heartbeat.PointerTo(int(humanLineChangesVal))
+	case string:
+		val, err := strconv.Atoi(humanLineChangesVal)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert human line changes to int: %s", err)
+		}
+
+		humanLineChanges = heartbeat.PointerTo(val)
+	}
+
 	var time float64
 
 	switch timeVal := h.Time.(type) {
@@ -985,12 +1482,22 @@ func parseExtraHeartbeat(h ExtraHeartbeat) (*heartbeat.Heartbeat, error) {
 		isUnsavedEntity = val
 	}
 
+	category := heartbeat.CodingCategory
+	if h.Category != nil {
+		category = *h.Category
+	}
+
 	return &heartbeat.Heartbeat{
+		AILineChanges:     aiLineChanges,
+		AITool:            h.AITool,
 		BranchAlternate:   h.BranchAlternate,
-		Category:          h.Category,
+		Category:          category,
+		CategoryExplicit:  h.Category != nil,
 		CursorPosition:    cursorPosition,
+		Cwd:               h.Cwd,
 		Entity:            h.Entity,
 		EntityType:        entityType,
+		HumanLineChanges:  humanLineChanges,
 		IsUnsavedEntity:   isUnsavedEntity,
 		IsWrite:           isWrite,
 		Language:          h.Language,
@@ -1000,6 +1507,8 @@ func parseExtraHeartbeat(h ExtraHeartbeat) (*heartbeat.Heartbeat, error) {
 		ProjectAlternate:  h.ProjectAlternate,
 		ProjectOverride:   h.Project,
 		Time:              timestampParsed,
+		UserAgent:         h.UserAgent,
+		UUID:              h.ID,
 	}, nil
 }
 
@@ -1059,11 +1568,21 @@ func (p FilterParams) String() string {
 }
 
 func (p Heartbeat) String() string {
+	var aiLineChanges string
+	if p.AILineChanges != nil {
+		aiLineChanges = strconv.Itoa(*p.AILineChanges)
+	}
+
 	var cursorPosition string
 	if p.CursorPosition != nil {
 		cursorPosition = strconv.Itoa(*p.CursorPosition)
 	}
 
+	var humanLineChanges string
+	if p.HumanLineChanges != nil {
+		humanLineChanges = strconv.Itoa(*p.HumanLineChanges)
+	}
+
 	var isWrite bool
 	if p.IsWrite != nil {
 		isWrite = *p.IsWrite
@@ -1095,17 +1614,20 @@ func (p Heartbeat) String() string {
 	}
 
 	return fmt.Sprintf(
-		"category: '%s', cursor position: '%s', entity: '%s', entity type: '%s',"+
-			" num extra heartbeats: %d, guess language: %t, is unsaved entity: %t,"+
-			" is write: %t, language: '%s', line additions: '%s', line deletions: '%s',"+
-			" line number: '%s', lines in file: '%s', time: %.5f, filter params: (%s),"+
-			" project params: (%s), sanitize params: (%s)",
+		"ai line changes: '%s', ai tool: '%s', category: '%s', cursor position: '%s',"+
+			" entity: '%s', entity type: '%s', num extra heartbeats: %d, guess language: %t,"+
+			" human line changes: '%s', is unsaved entity: %t, is write: %t, language: '%s',"+
+			" line additions: '%s', line deletions: '%s', line number: '%s', lines in file: '%s',"+
+			" time: %.5f, filter params: (%s), project params: (%s), sanitize params: (%s)",
+		aiLineChanges,
+		p.AITool,
 		p.Category,
 		cursorPosition,
 		p.Entity,
 		p.EntityType,
 		len(p.ExtraHeartbeats),
 		p.GuessLanguage,
+		humanLineChanges,
 		p.IsUnsavedEntity,
 		isWrite,
 		language,
@@ -1128,11 +1650,12 @@ func (p Offline) String() string {
 	}
 
 	return fmt.Sprintf(
-		"disabled: %t, last sent at: '%s', print max: %d, rate limit: %s, num sync max: %d",
+		"disabled: %t, last sent at: '%s', print max: %d, rate limit: %s, retention: (%s), num sync max: %d",
 		p.Disabled,
 		lastSentAt,
 		p.PrintMax,
 		p.RateLimit,
+		p.Retention,
 		p.SyncMax,
 	)
 }
@@ -1223,6 +1746,15 @@ func parseBoolOrRegexList(ctx context.Context, s string) ([]regex.Regex, error)
 	return patterns, nil
 }
 
+// compileCaseInsensitive compiles the regex pattern case insensitive.
+func compileCaseInsensitive(s string) (regex.Regex, error) {
+	if !strings.HasPrefix(s, "(?i)") {
+		s = "(?i)" + s
+	}
+
+	return regex.Compile(s)
+}
+
 // firstNonEmptyString accepts multiple values and return the first non empty string value.
 func firstNonEmptyString(values ...string) string {
 	for _, v := range values {
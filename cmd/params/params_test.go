@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -17,6 +18,7 @@ import (
 	cmdparams "github.com/optiflow-os/tracelens-cli/cmd/params"
 	"github.com/optiflow-os/tracelens-cli/pkg/api"
 	"github.com/optiflow-os/tracelens-cli/pkg/apikey"
+	"github.com/optiflow-os/tracelens-cli/pkg/category"
 	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
 	inipkg "github.com/optiflow-os/tracelens-cli/pkg/ini"
 	"github.com/optiflow-os/tracelens-cli/pkg/log"
@@ -182,9 +184,10 @@ func TestLoadHeartbeatParams_EntityType(t *testing.T) {
 	ctx := context.Background()
 
 	tests := map[string]heartbeat.EntityType{
-		"file":   heartbeat.FileType,
-		"domain": heartbeat.DomainType,
-		"app":    heartbeat.AppType,
+		"file":    heartbeat.FileType,
+		"domain":  heartbeat.DomainType,
+		"app":     heartbeat.AppType,
+		"command": heartbeat.CommandType,
 	}
 
 	for name, entityType := range tests {
@@ -201,6 +204,45 @@ func TestLoadHeartbeatParams_EntityType(t *testing.T) {
 	}
 }
 
+func TestLoadHeartbeatParams_Cwd(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		EntityType string
+		Cwd        string
+		Expected   string
+	}{
+		"command": {
+			EntityType: "command",
+			Cwd:        "/path/to/project",
+			Expected:   "/path/to/project",
+		},
+		"command defaults to working directory": {
+			EntityType: "command",
+			Expected:   wd,
+		},
+		"file": {
+			EntityType: "file",
+			Cwd:        "/path/to/project",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := setupViper(t)
+			v.Set("entity", "go test ./...")
+			v.Set("entity-type", test.EntityType)
+			v.Set("cwd", test.Cwd)
+
+			params, err := cmdparams.LoadHeartbeatParams(context.Background(), v)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.Expected, params.Cwd)
+		})
+	}
+}
+
 func TestLoadHeartbeatParams_EntityType_Default(t *testing.T) {
 	v := setupViper(t)
 	v.Set("entity", "/path/to/file")
@@ -225,6 +267,21 @@ func TestLoadHeartbeatParams_EntityType_Invalid(t *testing.T) {
 		err.Error())
 }
 
+func TestLoadHeartbeatParams_AIAttribution(t *testing.T) {
+	v := setupViper(t)
+	v.Set("entity", "/path/to/file")
+	v.Set("ai-line-changes", 12)
+	v.Set("ai-tool", "copilot")
+	v.Set("human-line-changes", 3)
+
+	params, err := cmdparams.LoadHeartbeatParams(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, heartbeat.PointerTo(12), params.AILineChanges)
+	assert.Equal(t, "copilot", params.AITool)
+	assert.Equal(t, heartbeat.PointerTo(3), params.HumanLineChanges)
+}
+
 func TestLoadHeartbeatParams_ExtraHeartbeats(t *testing.T) {
 	r, w, err := os.Pipe()
 	require.NoError(t, err)
@@ -269,6 +326,7 @@ func TestLoadHeartbeatParams_ExtraHeartbeats(t *testing.T) {
 	assert.Equal(t, []heartbeat.Heartbeat{
 		{
 			Category:          heartbeat.CodingCategory,
+			CategoryExplicit:  true,
 			CursorPosition:    heartbeat.PointerTo(12),
 			Entity:            "testdata/main.go",
 			EntityType:        heartbeat.FileType,
@@ -285,6 +343,7 @@ func TestLoadHeartbeatParams_ExtraHeartbeats(t *testing.T) {
 		},
 		{
 			Category:          heartbeat.DebuggingCategory,
+			CategoryExplicit:  true,
 			Entity:            "testdata/main.py",
 			EntityType:        heartbeat.FileType,
 			IsWrite:           nil,
@@ -342,28 +401,30 @@ func TestLoadHeartbeatParams_ExtraHeartbeats_WithStringValues(t *testing.T) {
 
 	assert.Equal(t, []heartbeat.Heartbeat{
 		{
-			Category:        heartbeat.CodingCategory,
-			CursorPosition:  heartbeat.PointerTo(12),
-			Entity:          "testdata/main.go",
-			EntityType:      heartbeat.FileType,
-			IsUnsavedEntity: true,
-			IsWrite:         heartbeat.PointerTo(true),
-			Language:        params.ExtraHeartbeats[0].Language,
-			Lines:           heartbeat.PointerTo(45),
-			LineNumber:      heartbeat.PointerTo(42),
-			Time:            1585598059,
+			Category:         heartbeat.CodingCategory,
+			CategoryExplicit: true,
+			CursorPosition:   heartbeat.PointerTo(12),
+			Entity:           "testdata/main.go",
+			EntityType:       heartbeat.FileType,
+			IsUnsavedEntity:  true,
+			IsWrite:          heartbeat.PointerTo(true),
+			Language:         params.ExtraHeartbeats[0].Language,
+			Lines:            heartbeat.PointerTo(45),
+			LineNumber:       heartbeat.PointerTo(42),
+			Time:             1585598059,
 		},
 		{
-			Category:        heartbeat.CodingCategory,
-			CursorPosition:  heartbeat.PointerTo(13),
-			Entity:          "testdata/main.go",
-			EntityType:      heartbeat.FileType,
-			IsUnsavedEntity: true,
-			IsWrite:         heartbeat.PointerTo(true),
-			Language:        params.ExtraHeartbeats[1].Language,
-			LineNumber:      heartbeat.PointerTo(43),
-			Lines:           heartbeat.PointerTo(46),
-			Time:            1585598060,
+			Category:         heartbeat.CodingCategory,
+			CategoryExplicit: true,
+			CursorPosition:   heartbeat.PointerTo(13),
+			Entity:           "testdata/main.go",
+			EntityType:       heartbeat.FileType,
+			IsUnsavedEntity:  true,
+			IsWrite:          heartbeat.PointerTo(true),
+			Language:         params.ExtraHeartbeats[1].Language,
+			LineNumber:       heartbeat.PointerTo(43),
+			Lines:            heartbeat.PointerTo(46),
+			Time:             1585598060,
 		},
 	}, params.ExtraHeartbeats)
 }
@@ -413,6 +474,7 @@ func TestLoadHeartbeatParams_ExtraHeartbeats_WithEOF(t *testing.T) {
 	assert.Equal(t, []heartbeat.Heartbeat{
 		{
 			Category:          heartbeat.CodingCategory,
+			CategoryExplicit:  true,
 			CursorPosition:    heartbeat.PointerTo(12),
 			Entity:            "testdata/main.go",
 			EntityType:        heartbeat.FileType,
@@ -429,6 +491,7 @@ func TestLoadHeartbeatParams_ExtraHeartbeats_WithEOF(t *testing.T) {
 		},
 		{
 			Category:          heartbeat.DebuggingCategory,
+			CategoryExplicit:  true,
 			Entity:            "testdata/main.py",
 			EntityType:        heartbeat.FileType,
 			IsWrite:           nil,
@@ -499,6 +562,122 @@ func TestLoadHeartbeatParams_ExtraHeartbeats_NoData(t *testing.T) {
 	assert.NotContains(t, string(output), "failed to read extra heartbeats: failed parsing")
 }
 
+func TestLoadHeartbeatParams_ExtraHeartbeats_NDJSON(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	defer func() {
+		r.Close()
+		w.Close()
+	}()
+
+	origStdin := os.Stdin
+
+	defer func() { os.Stdin = origStdin }()
+
+	os.Stdin = r
+
+	cmdparams.Once = sync.Once{}
+
+	data, err := os.ReadFile("testdata/extra_heartbeats.ndjson")
+	require.NoError(t, err)
+
+	go func() {
+		_, err := w.Write(data)
+		require.NoError(t, err)
+
+		w.Close()
+	}()
+
+	v := setupViper(t)
+	v.Set("entity", "/path/to/file")
+	v.Set("extra-heartbeats", true)
+	v.Set("extra-heartbeats-format", "ndjson")
+
+	params, err := cmdparams.LoadHeartbeatParams(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, []heartbeat.Heartbeat{
+		{
+			Category:          heartbeat.CodingCategory,
+			CategoryExplicit:  true,
+			Entity:            "testdata/main.go",
+			EntityType:        heartbeat.FileType,
+			LanguageAlternate: "Golang",
+			LineNumber:        heartbeat.PointerTo(42),
+			ProjectOverride:   "wakatime-cli",
+			Time:              1585598059,
+		},
+		{
+			Category:         heartbeat.DebuggingCategory,
+			CategoryExplicit: true,
+			Entity:           "testdata/main.py",
+			EntityType:       heartbeat.FileType,
+			Language:         heartbeat.PointerTo("Python"),
+			ProjectOverride:  "wakatime-cli",
+			Time:             1585598060,
+		},
+	}, params.ExtraHeartbeats)
+
+	require.Len(t, params.ExtraHeartbeatErrs, 2)
+
+	assert.Equal(t, 3, params.ExtraHeartbeatErrs[0].Line)
+	assert.Equal(t, "line 3: failed to json decode: unexpected end of JSON input", params.ExtraHeartbeatErrs[0].Error())
+	assert.Equal(t, 4, params.ExtraHeartbeatErrs[1].Line)
+	assert.Equal(
+		t,
+		"line 4: skipping extra heartbeat, as no valid timestamp was defined",
+		params.ExtraHeartbeatErrs[1].Error(),
+	)
+}
+
+func TestLoadHeartbeatParams_ExtraHeartbeats_InvalidFormat(t *testing.T) {
+	v := setupViper(t)
+	v.Set("entity", "/path/to/file")
+	v.Set("extra-heartbeats", true)
+	v.Set("extra-heartbeats-format", "xml")
+
+	_, err := cmdparams.LoadHeartbeatParams(context.Background(), v)
+	require.Error(t, err)
+
+	assert.Equal(t, `invalid extra heartbeats format "xml", expected json or ndjson`, err.Error())
+}
+
+func TestParseExtraHeartbeats_AIAttribution(t *testing.T) {
+	data := `[{"entity": "/path/to/file.go", "time": 1585598059, "category": "ai coding",` +
+		` "ai_line_changes": 12, "ai_tool": "copilot", "human_line_changes": "3"}]`
+
+	heartbeats, err := cmdparams.ParseExtraHeartbeats(context.Background(), data)
+	require.NoError(t, err)
+
+	require.Len(t, heartbeats, 1)
+	assert.Equal(t, heartbeat.AICodingCategory, heartbeats[0].Category)
+	assert.Equal(t, heartbeat.PointerTo(12), heartbeats[0].AILineChanges)
+	assert.Equal(t, "copilot", heartbeats[0].AITool)
+	assert.Equal(t, heartbeat.PointerTo(3), heartbeats[0].HumanLineChanges)
+}
+
+func TestParseExtraHeartbeatsNDJSON(t *testing.T) {
+	// long lines have no size limit
+	entity := "/path/to/" + strings.Repeat("a", 1024*1024) + ".go"
+
+	data := `{"entity": "` + entity + `", "time": 1585598059}` + "\r\n" +
+		"not json\n" +
+		`{"entity": "/path/to/file.py", "time": "1585598060"}`
+
+	heartbeats, errs, err := cmdparams.ParseExtraHeartbeatsNDJSON(context.Background(), strings.NewReader(data))
+	require.NoError(t, err)
+
+	require.Len(t, heartbeats, 2)
+	assert.Equal(t, entity, heartbeats[0].Entity)
+	assert.Equal(t, "/path/to/file.py", heartbeats[1].Entity)
+	assert.Equal(t, 1585598060.0, heartbeats[1].Time)
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, 1, errs[0].Index)
+	assert.Equal(t, 2, errs[0].Line)
+}
+
 func TestLoadHeartbeat_GuessLanguage_FlagTakesPrecedence(t *testing.T) {
 	v := setupViper(t)
 	v.Set("entity", "/path/to/file")
@@ -709,6 +888,149 @@ func TestLoadHeartbeatParams_ProjectMap(t *testing.T) {
 	}
 }
 
+func TestLoadHeartbeatParams_DomainRules(t *testing.T) {
+	v := setupViper(t)
+	v.Set("entity", "https://github.com/org/billing/pull/42")
+	v.Set(`domain_rules.github.com/org/(\w+)/pull`, "project: {0}; category: code reviewing")
+	v.Set("domain_rules.meet.google.com", "category: meeting")
+	v.Set("domain_rules.example.org", "category: invalid")
+	v.Set("domain_rules.example.com", "owner: me")
+
+	params, err := cmdparams.LoadHeartbeatParams(context.Background(), v)
+	require.NoError(t, err)
+
+	codeReviewing, meeting := heartbeat.CodeReviewingCategory, heartbeat.MeetingCategory
+
+	assert.Equal(t, []project.DomainRule{
+		{
+			Category: &codeReviewing,
+			Project:  "{0}",
+			Regex:    regex.NewRegexpWrap(regexp.MustCompile(`(?i)github.com/org/(\w+)/pull`)),
+		},
+		{
+			Category: &meeting,
+			Regex:    regex.NewRegexpWrap(regexp.MustCompile(`(?i)meet.google.com`)),
+		},
+	}, params.Project.DomainRules)
+}
+
+func TestLoadHeartbeatParams_CategoryRules(t *testing.T) {
+	v := setupViper(t)
+	v.Set("entity", "/path/to/file")
+	v.Set("categories._test\\.go$", "writing tests")
+	v.Set("categories.*.md", "writing docs")
+	v.Set("categories.^/notes/", "invalid")
+
+	params, err := cmdparams.LoadHeartbeatParams(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, []category.Rule{
+		{
+			Category: heartbeat.WritingDocsCategory,
+			Pattern:  regex.NewRegexpWrap(regexp.MustCompile(`(?i)(^|/)[^/]*\.md$`)),
+		},
+		{
+			Category: heartbeat.WritingTestsCategory,
+			Pattern:  regex.NewRegexpWrap(regexp.MustCompile(`(?i)_test\.go$`)),
+		},
+	}, params.CategoryRules)
+	assert.False(t, params.CategoryExplicit)
+}
+
+func TestLoadHeartbeatParams_ShellHook(t *testing.T) {
+	tests := map[string]struct {
+		Entity           string
+		Category         string
+		ExpectedEntity   string
+		ExpectedCategory heartbeat.Category
+	}{
+		"default rules": {
+			Entity:           "CGO_ENABLED=0 /usr/local/go/bin/go test ./...",
+			ExpectedEntity:   "go",
+			ExpectedCategory: heartbeat.RunningTestsCategory,
+		},
+		"shell categories": {
+			Entity:           "./deploy.sh staging",
+			ExpectedEntity:   "deploy.sh",
+			ExpectedCategory: heartbeat.ManualTestingCategory,
+		},
+		"no match": {
+			Entity:           "vim main.go",
+			ExpectedEntity:   "vim",
+			ExpectedCategory: heartbeat.CodingCategory,
+		},
+		"explicit category": {
+			Entity:           "make",
+			Category:         "debugging",
+			ExpectedEntity:   "make",
+			ExpectedCategory: heartbeat.DebuggingCategory,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := setupViper(t)
+			v.Set("entity", test.Entity)
+			v.Set("entity-type", "app")
+			v.Set("category", test.Category)
+			v.Set("shell-hook", true)
+			v.Set("shell_categories.^deploy", "manual testing")
+
+			params, err := cmdparams.LoadHeartbeatParams(context.Background(), v)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.ExpectedEntity, params.Entity)
+			assert.Equal(t, test.ExpectedCategory, params.Category)
+		})
+	}
+}
+
+func TestLoadHeartbeatParams_ShellHookStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	origStdin := os.Stdin
+
+	defer func() { os.Stdin = origStdin }()
+
+	os.Stdin = r
+
+	cmdparams.Once = sync.Once{}
+
+	_, err = w.WriteString("curl -H 'Authorization: Bearer secret' https://example.org\n")
+	require.NoError(t, err)
+
+	err = w.Close()
+	require.NoError(t, err)
+
+	v := setupViper(t)
+	v.Set("entity-type", "app")
+	v.Set("shell-hook", true)
+
+	params, err := cmdparams.LoadHeartbeatParams(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, "curl", params.Entity)
+
+	// stdin is only read once
+	params, err = cmdparams.LoadHeartbeatParams(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, "curl", params.Entity)
+}
+
+func TestLoadHeartbeatParams_CategoryExplicit(t *testing.T) {
+	v := setupViper(t)
+	v.Set("entity", "/path/to/file_test.go")
+	v.Set("category", "coding")
+
+	params, err := cmdparams.LoadHeartbeatParams(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, heartbeat.CodingCategory, params.Category)
+	assert.True(t, params.CategoryExplicit)
+}
+
 func TestLoadAPIParams_ProjectApiKey(t *testing.T) {
 	ctx := context.Background()
 
@@ -1777,6 +2099,58 @@ func TestLoadHeartbeatParams_SanitizeParams_OverrideProjectPath(t *testing.T) {
 	}, params.Sanitize)
 }
 
+func TestLoadHeartbeatParams_SanitizeParams_OverrideProjectPath_ShellHook(t *testing.T) {
+	v := setupViper(t)
+	v.Set("entity", "make")
+	v.Set("entity-type", "app")
+	v.Set("project-folder", "/custom-path")
+	v.Set("shell-hook", true)
+
+	params, err := cmdparams.LoadHeartbeatParams(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/custom-path"+string(filepath.Separator), params.Sanitize.ProjectPathOverride)
+}
+
+func TestLoadHeartbeatParams_SanitizeParams_HideCommandArgs(t *testing.T) {
+	tests := map[string]struct {
+		Value    string
+		Expected cmdparams.SanitizeParams
+	}{
+		"true": {
+			Value:    "true",
+			Expected: cmdparams.SanitizeParams{},
+		},
+		"false": {
+			Value:    "false",
+			Expected: cmdparams.SanitizeParams{SendCommandArgs: true},
+		},
+		"list": {
+			Value: "token\npassword",
+			Expected: cmdparams.SanitizeParams{
+				CommandArgPatterns: []regex.Regex{
+					regex.NewRegexpWrap(regexp.MustCompile("(?i)token")),
+					regex.NewRegexpWrap(regexp.MustCompile("(?i)password")),
+				},
+				SendCommandArgs: true,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := setupViper(t)
+			v.Set("entity", "git push")
+			v.Set("settings.hide_command_args", test.Value)
+
+			params, err := cmdparams.LoadHeartbeatParams(context.Background(), v)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.Expected, params.Sanitize)
+		})
+	}
+}
+
 func TestLoadHeartbeatParams_SubmodulesDisabled_True(t *testing.T) {
 	tests := map[string]string{
 		"lowercase":       "true",
@@ -2171,6 +2545,32 @@ func TestLoadOfflineParams_SyncMax_NonIntegerValue(t *testing.T) {
 	assert.Zero(t, params.SyncMax)
 }
 
+func TestLoadOfflineParams_Retention(t *testing.T) {
+	v := setupViper(t)
+	v.Set("settings.offline_max_heartbeats", 1000)
+	v.Set("settings.offline_max_age_days", 14)
+	v.Set("settings.offline_drop_strategy", "coalesce")
+
+	params := cmdparams.LoadOfflineParams(context.Background(), v)
+
+	assert.Equal(t, offline.Retention{
+		DropStrategy:  offline.DropCoalesce,
+		MaxAge:        14 * 24 * time.Hour,
+		MaxHeartbeats: 1000,
+	}, params.Retention)
+}
+
+func TestLoadOfflineParams_Retention_Invalid(t *testing.T) {
+	v := setupViper(t)
+	v.Set("settings.offline_max_heartbeats", -1)
+	v.Set("settings.offline_max_age_days", -1)
+	v.Set("settings.offline_drop_strategy", "invalid")
+
+	params := cmdparams.LoadOfflineParams(context.Background(), v)
+
+	assert.Equal(t, offline.Retention{}, params.Retention)
+}
+
 func TestLoadAPIParams_APIKey(t *testing.T) {
 	ctx := context.Background()
 
@@ -2856,28 +3256,32 @@ func TestFilterParams_String(t *testing.T) {
 
 func TestHeartbeat_String(t *testing.T) {
 	heartbeat := cmdparams.Heartbeat{
-		Category:        heartbeat.CodingCategory,
-		CursorPosition:  heartbeat.PointerTo(15),
-		Entity:          "path/to/entity.go",
-		EntityType:      heartbeat.FileType,
-		ExtraHeartbeats: make([]heartbeat.Heartbeat, 3),
-		GuessLanguage:   true,
-		IsUnsavedEntity: true,
-		IsWrite:         heartbeat.PointerTo(true),
-		Language:        heartbeat.PointerTo("Golang"),
-		LineAdditions:   heartbeat.PointerTo(123),
-		LineDeletions:   heartbeat.PointerTo(456),
-		LineNumber:      heartbeat.PointerTo(4),
-		LinesInFile:     heartbeat.PointerTo(56),
-		Time:            1585598059,
+		AILineChanges:    heartbeat.PointerTo(12),
+		AITool:           "copilot",
+		Category:         heartbeat.CodingCategory,
+		CursorPosition:   heartbeat.PointerTo(15),
+		Entity:           "path/to/entity.go",
+		EntityType:       heartbeat.FileType,
+		ExtraHeartbeats:  make([]heartbeat.Heartbeat, 3),
+		GuessLanguage:    true,
+		HumanLineChanges: heartbeat.PointerTo(34),
+		IsUnsavedEntity:  true,
+		IsWrite:          heartbeat.PointerTo(true),
+		Language:         heartbeat.PointerTo("Golang"),
+		LineAdditions:    heartbeat.PointerTo(123),
+		LineDeletions:    heartbeat.PointerTo(456),
+		LineNumber:       heartbeat.PointerTo(4),
+		LinesInFile:      heartbeat.PointerTo(56),
+		Time:             1585598059,
 	}
 
 	assert.Equal(
 		t,
-		"category: 'coding', cursor position: '15', entity: 'path/to/entity.go', entity type: 'file',"+
-			" num extra heartbeats: 3, guess language: true, is unsaved entity: true, is write: true,"+
-			" language: 'Golang', line additions: '123', line deletions: '456', line number: '4',"+
-			" lines in file: '56', time: 1585598059.00000, filter params: (exclude: '[]',"+
+		"ai line changes: '12', ai tool: 'copilot', category: 'coding', cursor position: '15',"+
+			" entity: 'path/to/entity.go', entity type: 'file', num extra heartbeats: 3, guess language: true,"+
+			" human line changes: '34', is unsaved entity: true, is write: true, language: 'Golang',"+
+			" line additions: '123', line deletions: '456', line number: '4', lines in file: '56',"+
+			" time: 1585598059.00000, filter params: (exclude: '[]',"+
 			" exclude unknown project: false, include: '[]', include only with"+
 			" project file: false), project params: (alternate: '', branch alternate: '', map patterns:"+
 			" '[]', override: '', git submodules disabled: '[]', git submodule project map: '[]'), sanitize"+
@@ -2896,13 +3300,19 @@ func TestOffline_String(t *testing.T) {
 		LastSentAt: lastSentAt,
 		PrintMax:   6,
 		RateLimit:  time.Duration(15) * time.Second,
-		SyncMax:    12,
+		Retention: offline.Retention{
+			DropStrategy:  offline.DropCoalesce,
+			MaxAge:        48 * time.Hour,
+			MaxHeartbeats: 1000,
+		},
+		SyncMax: 12,
 	}
 
 	assert.Equal(
 		t,
 		"disabled: true, last sent at: '2021-08-30T18:50:42-03:00', print max: 6,"+
-			" rate limit: 15s, num sync max: 12",
+			" rate limit: 15s, retention: (drop strategy: coalesce, max age: 48h0m0s, max heartbeats: 1000),"+
+			" num sync max: 12",
 		offline.String(),
 	)
 }
@@ -3049,6 +3459,42 @@ func TestLoadHeartbeatParams_ExtraHeartbeats_StdinReadOnlyOnce(t *testing.T) {
 	assert.Empty(t, params.ExtraHeartbeats[0].LanguageAlternate)
 }
 
+func TestLoadHeartbeatParams_ShellHook_AfterExtraHeartbeats(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	defer func() {
+		r.Close()
+		w.Close()
+	}()
+
+	origStdin := os.Stdin
+
+	defer func() { os.Stdin = origStdin }()
+
+	os.Stdin = r
+
+	// extra heartbeats were read from stdin already
+	cmdparams.Once = sync.Once{}
+	cmdparams.Once.Do(func() {})
+
+	cmdparams.ShellCommandOnce = sync.Once{}
+
+	_, err = w.WriteString("git status\n")
+	require.NoError(t, err)
+
+	w.Close()
+
+	v := setupViper(t)
+	v.Set("entity-type", "app")
+	v.Set("shell-hook", true)
+
+	params, err := cmdparams.LoadHeartbeatParams(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, "git", params.Entity)
+}
+
 func setupViper(t *testing.T) *viper.Viper {
 	multilineOption := iniv1.LoadOptions{AllowPythonMultilineValues: true}
 	iniCodec := viperini.Codec{LoadOptions: multilineOption}
@@ -0,0 +1,114 @@
+package params
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+	"github.com/optiflow-os/tracelens-cli/pkg/regex"
+	"github.com/optiflow-os/tracelens-cli/pkg/vipertools"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// profileEnvVar is the environment variable selecting a profile.
+	profileEnvVar = "TRACELENS_PROFILE"
+	// profileSectionPrefix is the prefix of profile sections, e.g. [profile work].
+	profileSectionPrefix = "profile "
+)
+
+// ApplyProfile overlays [settings] with the keys of the selected [profile <name>]
+// section. The profile is selected by the --profile flag, the TRACELENS_PROFILE
+// env var or by the first [project_profile] pattern matching the entity, in this
+// order. Returns the name of the applied profile or an empty string, if no
+// profile was selected.
+func ApplyProfile(ctx context.Context, v *viper.Viper) (string, error) {
+	name := vipertools.FirstNonEmptyString(v, "profile")
+	if name == "" {
+		name = strings.TrimSpace(os.Getenv(profileEnvVar))
+	}
+
+	if name == "" {
+		name = matchProfile(ctx, v)
+	}
+
+	if name == "" {
+		return "", nil
+	}
+
+	section := profileSectionPrefix + strings.ToLower(name)
+
+	values := vipertools.GetStringMapString(v, section)
+	if len(values) == 0 {
+		return "", fmt.Errorf("profile %q not found or empty, expected [%s]", name, section)
+	}
+
+	for k, value := range values {
+		// environment variables take precedence over profiles
+		if _, ok := os.LookupEnv(EnvVarName(k)); ok {
+			continue
+		}
+
+		v.Set("settings."+k, value)
+	}
+
+	log.Extract(ctx).Debugf("applied profile %q", name)
+
+	return name, nil
+}
+
+// matchProfile returns the profile of the first [project_profile] pattern
+// matching the entity, like [project_api_key] patterns are matched.
+func matchProfile(ctx context.Context, v *viper.Viper) string {
+	entity := vipertools.GetString(v, "entity")
+	if entity == "" {
+		return ""
+	}
+
+	if entityType := vipertools.GetString(v, "entity-type"); entityType == "" || entityType == "file" {
+		if abs, err := filepath.Abs(entity); err == nil {
+			entity = abs
+		}
+	}
+
+	logger := log.Extract(ctx)
+
+	values := vipertools.GetStringMapString(v, "project_profile")
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		pattern := k
+
+		// make all regex case insensitive
+		if !strings.HasPrefix(pattern, "(?i)") {
+			pattern = "(?i)" + pattern
+		}
+
+		compiled, err := regex.Compile(pattern)
+		if err != nil {
+			logger.Warnf("failed to compile project_profile regex pattern %q", pattern)
+			continue
+		}
+
+		if compiled.MatchString(ctx, entity) {
+			logger.Debugf("profile pattern %q matched path %q", pattern, entity)
+
+			return values[k]
+		}
+
+		logger.Debugf("profile pattern %q did not match path %q", pattern, entity)
+	}
+
+	return ""
+}
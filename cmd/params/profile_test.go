@@ -0,0 +1,95 @@
+package params_test
+
+import (
+	"context"
+	"testing"
+
+	cmdparams "github.com/optiflow-os/tracelens-cli/cmd/params"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyProfile(t *testing.T) {
+	tests := map[string]struct {
+		Flag     string
+		EnvVar   string
+		Entity   string
+		Expected string
+		APIKey   string
+	}{
+		"no profile": {
+			Entity: "/tmp/personal/main.go",
+			APIKey: "00000000-0000-4000-8000-000000000000",
+		},
+		"flag": {
+			Flag:     "work",
+			EnvVar:   "personal",
+			Entity:   "/tmp/personal/main.go",
+			Expected: "work",
+			APIKey:   "00000000-0000-4000-8000-000000000001",
+		},
+		"env var": {
+			EnvVar:   "Personal",
+			Entity:   "/tmp/work/main.go",
+			Expected: "Personal",
+			APIKey:   "00000000-0000-4000-8000-000000000002",
+		},
+		"path pattern": {
+			Entity:   "/tmp/work/main.go",
+			Expected: "work",
+			APIKey:   "00000000-0000-4000-8000-000000000001",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("TRACELENS_PROFILE", test.EnvVar)
+
+			v := viper.New()
+			v.Set("entity", test.Entity)
+			v.Set("profile", test.Flag)
+			v.Set("settings.api_key", "00000000-0000-4000-8000-000000000000")
+			v.Set("settings.debug", "true")
+			v.Set("profile work.api_key", "00000000-0000-4000-8000-000000000001")
+			v.Set("profile personal.api_key", "00000000-0000-4000-8000-000000000002")
+			v.Set("project_profile.^/tmp/work/", "work")
+
+			profile, err := cmdparams.ApplyProfile(context.Background(), v)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.Expected, profile)
+			assert.Equal(t, test.APIKey, v.GetString("settings.api_key"))
+			assert.Equal(t, "true", v.GetString("settings.debug"))
+		})
+	}
+}
+
+func TestApplyProfile_FlagTakesPrecedence(t *testing.T) {
+	v := viper.New()
+	v.Set("key", "00000000-0000-4000-8000-000000000000")
+	v.Set("profile", "work")
+	v.Set("profile work.api_key", "00000000-0000-4000-8000-000000000001")
+
+	_, err := cmdparams.ApplyProfile(context.Background(), v)
+	require.NoError(t, err)
+
+	apiKey, err := cmdparams.LoadAPIKey(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, "00000000-0000-4000-8000-000000000000", apiKey)
+}
+
+func TestApplyProfile_NotFound(t *testing.T) {
+	t.Setenv("TRACELENS_PROFILE", "")
+
+	v := viper.New()
+	v.Set("profile", "missing")
+	v.Set("profile work.api_key", "00000000-0000-4000-8000-000000000001")
+
+	_, err := cmdparams.ApplyProfile(context.Background(), v)
+	require.Error(t, err)
+
+	assert.EqualError(t, err, `profile "missing" not found or empty, expected [profile missing]`)
+}
@@ -0,0 +1,321 @@
+package params
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/ini"
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+	"github.com/optiflow-os/tracelens-cli/pkg/project"
+	"github.com/optiflow-os/tracelens-cli/pkg/regex"
+)
+
+// RepoConfigFile is the name of the repository-local config file.
+const RepoConfigFile = ".tracelens.cfg"
+
+// RepoConfig contains the allow-listed [settings] of a repository-local config
+// file. They are merged over the global settings for heartbeats inside the
+// repository. Bool and pattern settings can only hide or exclude more, never
+// less than the global settings.
+type RepoConfig struct {
+	Category                   *heartbeat.Category
+	Exclude                    []regex.Regex
+	ExcludeUnknownProject      bool
+	Filepath                   string
+	HideBranchNames            []regex.Regex
+	HideDependencies           []regex.Regex
+	HideFileNames              []regex.Regex
+	HideProjectFolder          bool
+	HideProjectNames           []regex.Regex
+	IncludeOnlyWithProjectFile bool
+	Project                    string
+}
+
+// repoConfigKeys is the allow-list of [settings] keys, which a repository-local
+// config file may set. The api key, api url and similar keys cannot be changed.
+// nolint:gochecknoglobals
+var repoConfigKeys = map[string]func(ctx context.Context, c *RepoConfig, value string){
+	"category": func(ctx context.Context, c *RepoConfig, value string) {
+		parsed, err := heartbeat.ParseCategory(value)
+		if err != nil {
+			log.Extract(ctx).Warnf("failed to parse category %q in %s: %s", value, c.Filepath, err)
+			return
+		}
+
+		c.Category = &parsed
+	},
+	"exclude": func(ctx context.Context, c *RepoConfig, value string) {
+		c.Exclude = append(c.Exclude, parseRepoPatterns(ctx, value)...)
+	},
+	"exclude_unknown_project": func(_ context.Context, c *RepoConfig, value string) {
+		c.ExcludeUnknownProject = c.ExcludeUnknownProject || parseRepoBool(value)
+	},
+	"hide_branch_names":  setHideBranchNames,
+	"hide_branchnames":   setHideBranchNames,
+	"hidebranchnames":    setHideBranchNames,
+	"hide_dependencies":  setHideDependencies,
+	"hide_file_names":    setHideFileNames,
+	"hide_filenames":     setHideFileNames,
+	"hidefilenames":      setHideFileNames,
+	"hide_project_names": setHideProjectNames,
+	"hide_projectnames":  setHideProjectNames,
+	"hideprojectnames":   setHideProjectNames,
+	"hide_project_folder": func(_ context.Context, c *RepoConfig, value string) {
+		c.HideProjectFolder = c.HideProjectFolder || parseRepoBool(value)
+	},
+	"include_only_with_project_file": func(_ context.Context, c *RepoConfig, value string) {
+		c.IncludeOnlyWithProjectFile = c.IncludeOnlyWithProjectFile || parseRepoBool(value)
+	},
+	"project": func(_ context.Context, c *RepoConfig, value string) {
+		c.Project = value
+	},
+}
+
+func setHideBranchNames(ctx context.Context, c *RepoConfig, value string) {
+	c.HideBranchNames = append(c.HideBranchNames, parseRepoPatterns(ctx, value)...)
+}
+
+func setHideDependencies(ctx context.Context, c *RepoConfig, value string) {
+	c.HideDependencies = append(c.HideDependencies, parseRepoPatterns(ctx, value)...)
+}
+
+func setHideFileNames(ctx context.Context, c *RepoConfig, value string) {
+	c.HideFileNames = append(c.HideFileNames, parseRepoPatterns(ctx, value)...)
+}
+
+func setHideProjectNames(ctx context.Context, c *RepoConfig, value string) {
+	c.HideProjectNames = append(c.HideProjectNames, parseRepoPatterns(ctx, value)...)
+}
+
+// FindRepoConfig looks for a repository-local config file by walking up from
+// the directory. Returns its path and true, if one was found.
+func FindRepoConfig(ctx context.Context, dir string) (string, bool) {
+	return project.FindFileOrDirectory(ctx, dir, RepoConfigFile)
+}
+
+// LoadRepoConfig loads the allow-listed [settings] keys of the repository-local
+// config file at fp. Other keys are ignored with a warning.
+func LoadRepoConfig(ctx context.Context, fp string) (RepoConfig, error) {
+	entries, err := ini.ReadEntries(fp)
+	if err != nil {
+		return RepoConfig{}, err
+	}
+
+	logger := log.Extract(ctx)
+
+	c := RepoConfig{Filepath: fp}
+
+	for _, e := range entries {
+		set, ok := repoConfigKeys[strings.ToLower(e.Key)]
+		if !ok || !strings.EqualFold(e.Section, "settings") {
+			logger.Warnf("%s:%d: ignoring %q in [%s], not allowed in %s", fp, e.Line, e.Key, e.Section, RepoConfigFile)
+
+			continue
+		}
+
+		if value := strings.TrimSpace(e.Value); value != "" {
+			set(ctx, &c, value)
+		}
+	}
+
+	return c, nil
+}
+
+// Apply merges the repository config over the heartbeat params. Patterns are
+// combined, so the result matches whatever either matched.
+func (c RepoConfig) Apply(params Heartbeat) Heartbeat {
+	params.Filter.Exclude = mergePatterns(params.Filter.Exclude, c.Exclude)
+	params.Filter.ExcludeUnknownProject = params.Filter.ExcludeUnknownProject || c.ExcludeUnknownProject
+	params.Filter.IncludeOnlyWithProjectFile = params.Filter.IncludeOnlyWithProjectFile || c.IncludeOnlyWithProjectFile
+	params.Sanitize.HideBranchNames = mergePatterns(params.Sanitize.HideBranchNames, c.HideBranchNames)
+	params.Sanitize.HideDependencies = mergePatterns(params.Sanitize.HideDependencies, c.HideDependencies)
+	params.Sanitize.HideFileNames = mergePatterns(params.Sanitize.HideFileNames, c.HideFileNames)
+	params.Sanitize.HideProjectFolder = params.Sanitize.HideProjectFolder || c.HideProjectFolder
+	params.Sanitize.HideProjectNames = mergePatterns(params.Sanitize.HideProjectNames, c.HideProjectNames)
+
+	return params
+}
+
+// repoConfigsKey is the context key of the repository configs found by WithRepoConfig.
+type repoConfigsKey struct{}
+
+// repoConfigs caches repository configs by entity directory and by filepath.
+// A nil config means, that none was found.
+type repoConfigs struct {
+	byDir  map[string]*RepoConfig
+	byFile map[string]*RepoConfig
+}
+
+// resolve returns the repository config of the heartbeat or nil, if there is
+// none. Only local file entities have a repository config.
+func (r *repoConfigs) resolve(ctx context.Context, h heartbeat.Heartbeat) *RepoConfig {
+	if h.EntityType != heartbeat.FileType || h.IsRemote() {
+		return nil
+	}
+
+	dir := filepath.Dir(h.Entity)
+
+	if c, ok := r.byDir[dir]; ok {
+		return c
+	}
+
+	var c *RepoConfig
+
+	if fp, ok := FindRepoConfig(ctx, dir); ok {
+		c, ok = r.byFile[fp]
+		if !ok {
+			loaded, err := LoadRepoConfig(ctx, fp)
+			if err != nil {
+				log.Extract(ctx).Warnf("failed to load repository config %s: %s", fp, err)
+			} else {
+				c = &loaded
+			}
+
+			r.byFile[fp] = c
+		}
+	}
+
+	r.byDir[dir] = c
+
+	return c
+}
+
+// lookup returns the repository config of the heartbeat already resolved by
+// resolve or nil.
+func (r *repoConfigs) lookup(h heartbeat.Heartbeat) *RepoConfig {
+	if h.EntityType != heartbeat.FileType || h.IsRemote() {
+		return nil
+	}
+
+	return r.byDir[filepath.Dir(h.Entity)]
+}
+
+// WithRepoConfig initializes and returns a heartbeat handle option, which looks
+// for the repository-local config file of each heartbeat by walking up from its
+// entity's directory. The configs are passed on to the stages built by
+// WithRepoParams. A config's project and category are set on heartbeats
+// without an explicit project or category.
+func WithRepoConfig() heartbeat.HandleOption {
+	return func(next heartbeat.Handle) heartbeat.Handle {
+		return func(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			logger := log.Extract(ctx)
+			logger.Debugln("execute repository config detection")
+
+			configs := &repoConfigs{
+				byDir:  map[string]*RepoConfig{},
+				byFile: map[string]*RepoConfig{},
+			}
+
+			for n, h := range hh {
+				c := configs.resolve(ctx, h)
+				if c == nil {
+					continue
+				}
+
+				if h.ProjectOverride == "" && c.Project != "" {
+					hh[n].ProjectOverride = c.Project
+				}
+
+				if !h.CategoryExplicit && c.Category != nil {
+					hh[n].Category = *c.Category
+					hh[n].CategoryExplicit = true
+				}
+			}
+
+			return next(context.WithValue(ctx, repoConfigsKey{}, configs), hh)
+		}
+	}
+}
+
+// WithRepoParams initializes and returns a heartbeat handle option, which
+// processes heartbeats with the handle option built from the heartbeat params
+// merged with their repository config found by WithRepoConfig. If heartbeats
+// have different repository configs, they are processed one by one and passed
+// on to next at once, keeping their order.
+func WithRepoParams(params Heartbeat, build func(Heartbeat) heartbeat.HandleOption) heartbeat.HandleOption {
+	global := build(params)
+
+	return func(next heartbeat.Handle) heartbeat.Handle {
+		return func(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			configs, ok := ctx.Value(repoConfigsKey{}).(*repoConfigs)
+			if !ok {
+				return global(next)(ctx, hh)
+			}
+
+			opts := map[*RepoConfig]heartbeat.HandleOption{}
+
+			for _, h := range hh {
+				c := configs.lookup(h)
+				if _, ok := opts[c]; ok {
+					continue
+				}
+
+				opts[c] = global
+				if c != nil {
+					opts[c] = build(c.Apply(params))
+				}
+			}
+
+			// all heartbeats share the same option
+			if len(opts) <= 1 {
+				opt := global
+				for _, o := range opts {
+					opt = o
+				}
+
+				return opt(next)(ctx, hh)
+			}
+
+			var processed []heartbeat.Heartbeat
+
+			collect := func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+				processed = append(processed, hh...)
+				return nil, nil
+			}
+
+			for _, h := range hh {
+				if _, err := opts[configs.lookup(h)](collect)(ctx, []heartbeat.Heartbeat{h}); err != nil {
+					return nil, err
+				}
+			}
+
+			return next(ctx, processed)
+		}
+	}
+}
+
+// parseRepoPatterns parses a bool or regex list value of a repository config.
+// False is ignored, as it cannot hide or exclude less than the global settings.
+func parseRepoPatterns(ctx context.Context, value string) []regex.Regex {
+	if strings.EqualFold(strings.TrimSpace(value), "false") {
+		return nil
+	}
+
+	// never returns an error
+	patterns, _ := parseBoolOrRegexList(ctx, value)
+
+	return patterns
+}
+
+// parseRepoBool parses a bool value of a repository config. Only true is
+// accepted, as it cannot hide or exclude less than the global settings.
+func parseRepoBool(value string) bool {
+	b, err := strconv.ParseBool(value)
+
+	return err == nil && b
+}
+
+// mergePatterns returns a new list of the global and the repository patterns.
+func mergePatterns(global, repo []regex.Regex) []regex.Regex {
+	if len(repo) == 0 {
+		return global
+	}
+
+	merged := make([]regex.Regex, 0, len(global)+len(repo))
+	merged = append(merged, global...)
+
+	return append(merged, repo...)
+}
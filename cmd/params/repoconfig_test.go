@@ -0,0 +1,184 @@
+package params_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cmdparams "github.com/optiflow-os/tracelens-cli/cmd/params"
+	"github.com/optiflow-os/tracelens-cli/pkg/filter"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/regex"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRepoConfig(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), cmdparams.RepoConfigFile)
+
+	err := os.WriteFile(fp, []byte(
+		"[settings]\n"+
+			"api_key = 00000000-0000-4000-8000-000000000001\n"+
+			"api_url = https://example.org\n"+
+			"include = .*\n"+
+			"exclude = ^vendor/\n"+
+			"hidefilenames = secret\n"+
+			"hide_branch_names = false\n"+
+			"hide_project_folder = true\n"+
+			"exclude_unknown_project = false\n"+
+			"project = team-project\n"+
+			"category = code reviewing\n"+
+			"[projectmap]\n"+
+			".* = other\n",
+	), 0600)
+	require.NoError(t, err)
+
+	c, err := cmdparams.LoadRepoConfig(context.Background(), fp)
+	require.NoError(t, err)
+
+	codeReviewing := heartbeat.CodeReviewingCategory
+
+	// not allowed keys are ignored and settings can only be tightened
+	assert.Equal(t, cmdparams.RepoConfig{
+		Category:          &codeReviewing,
+		Exclude:           []regex.Regex{regex.MustCompile("(?i)^vendor/")},
+		Filepath:          fp,
+		HideFileNames:     []regex.Regex{regex.MustCompile("(?i)secret")},
+		HideProjectFolder: true,
+		Project:           "team-project",
+	}, c)
+}
+
+func TestRepoConfig_Apply(t *testing.T) {
+	c := cmdparams.RepoConfig{
+		Exclude:           []regex.Regex{regex.MustCompile("^vendor/")},
+		HideFileNames:     []regex.Regex{regex.MustCompile("secret")},
+		HideProjectFolder: true,
+	}
+
+	params := cmdparams.Heartbeat{
+		Filter: cmdparams.FilterParams{
+			Exclude: []regex.Regex{regex.MustCompile("^/tmp/")},
+		},
+		Sanitize: cmdparams.SanitizeParams{
+			HideBranchNames: []regex.Regex{regex.MustCompile(".*")},
+			HideFileNames:   []regex.Regex{regex.MustCompile("^/private/")},
+		},
+	}
+
+	merged := c.Apply(params)
+
+	assert.Equal(t, cmdparams.Heartbeat{
+		Filter: cmdparams.FilterParams{
+			Exclude: []regex.Regex{regex.MustCompile("^/tmp/"), regex.MustCompile("^vendor/")},
+		},
+		Sanitize: cmdparams.SanitizeParams{
+			HideBranchNames:   []regex.Regex{regex.MustCompile(".*")},
+			HideFileNames:     []regex.Regex{regex.MustCompile("^/private/"), regex.MustCompile("secret")},
+			HideProjectFolder: true,
+		},
+	}, merged)
+
+	// global params are unchanged
+	assert.Len(t, params.Filter.Exclude, 1)
+}
+
+func TestWithRepoParams(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// only the first repository has a config file
+	for _, repo := range []string{"team", "other"} {
+		err := os.MkdirAll(filepath.Join(tmpDir, repo, "vendor"), 0755)
+		require.NoError(t, err)
+
+		for _, name := range []string{"main.go", filepath.Join("vendor", "lib.go")} {
+			err = os.WriteFile(filepath.Join(tmpDir, repo, name), nil, 0600)
+			require.NoError(t, err)
+		}
+	}
+
+	err := os.WriteFile(filepath.Join(tmpDir, "team", cmdparams.RepoConfigFile), []byte(
+		"[settings]\n"+
+			"exclude = /vendor/\n"+
+			"project = team-project\n"+
+			"category = code reviewing\n",
+	), 0600)
+	require.NoError(t, err)
+
+	opts := []heartbeat.HandleOption{
+		cmdparams.WithRepoConfig(),
+		cmdparams.WithRepoParams(cmdparams.Heartbeat{}, func(p cmdparams.Heartbeat) heartbeat.HandleOption {
+			return filter.WithFiltering(filter.Config{Exclude: p.Filter.Exclude})
+		}),
+	}
+
+	var handled []heartbeat.Heartbeat
+
+	handle := heartbeat.NewHandle(senderFunc(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		handled = hh
+		return nil, nil
+	}), opts...)
+
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{
+		{
+			Category:   heartbeat.CodingCategory,
+			Entity:     filepath.Join(tmpDir, "team", "main.go"),
+			EntityType: heartbeat.FileType,
+		},
+		{
+			Category:         heartbeat.DebuggingCategory,
+			CategoryExplicit: true,
+			Entity:           filepath.Join(tmpDir, "team", "main.go"),
+			EntityType:       heartbeat.FileType,
+			ProjectOverride:  "explicit",
+		},
+		{
+			Entity:     filepath.Join(tmpDir, "team", "vendor", "lib.go"),
+			EntityType: heartbeat.FileType,
+		},
+		{
+			Category:   heartbeat.CodingCategory,
+			Entity:     filepath.Join(tmpDir, "other", "main.go"),
+			EntityType: heartbeat.FileType,
+		},
+		{
+			Entity:     filepath.Join(tmpDir, "other", "vendor", "lib.go"),
+			EntityType: heartbeat.FileType,
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []heartbeat.Heartbeat{
+		{
+			Category:         heartbeat.CodeReviewingCategory,
+			CategoryExplicit: true,
+			Entity:           filepath.Join(tmpDir, "team", "main.go"),
+			EntityType:       heartbeat.FileType,
+			ProjectOverride:  "team-project",
+		},
+		{
+			Category:         heartbeat.DebuggingCategory,
+			CategoryExplicit: true,
+			Entity:           filepath.Join(tmpDir, "team", "main.go"),
+			EntityType:       heartbeat.FileType,
+			ProjectOverride:  "explicit",
+		},
+		{
+			Category:   heartbeat.CodingCategory,
+			Entity:     filepath.Join(tmpDir, "other", "main.go"),
+			EntityType: heartbeat.FileType,
+		},
+		{
+			Entity:     filepath.Join(tmpDir, "other", "vendor", "lib.go"),
+			EntityType: heartbeat.FileType,
+		},
+	}, handled)
+}
+
+type senderFunc func(context.Context, []heartbeat.Heartbeat) ([]heartbeat.Result, error)
+
+func (f senderFunc) SendHeartbeats(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+	return f(ctx, hh)
+}
@@ -0,0 +1,323 @@
+package params
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/category"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/ini"
+
+	"github.com/spf13/viper"
+)
+
+// valueType is the type of a config value.
+type valueType int
+
+const (
+	stringType valueType = iota
+	boolType
+	intType
+	dateType
+	apiKeyType
+	urlType
+	categoryType
+	// domainRuleType is a list of project and category pairs, like "project: {0}; category: meeting".
+	domainRuleType
+	// boolOrRegexListType is either true, false or a list of regex patterns, one per line.
+	boolOrRegexListType
+)
+
+// sectionSchema describes the keys of a config file section.
+type sectionSchema struct {
+	// Keys maps the known keys to their value type.
+	Keys map[string]valueType
+	// Patterns is true for sections with regex patterns as keys, like [projectmap].
+	Patterns bool
+	// Values is the value type of all keys, if Patterns is true.
+	Values valueType
+	// Globs is true for sections, which also accept globs as keys, like [categories].
+	Globs bool
+}
+
+// configSchema holds all config file sections and keys read by the cli.
+// nolint:gochecknoglobals
+var configSchema = map[string]sectionSchema{
+	"settings": {Keys: map[string]valueType{
+		"api_key":                        apiKeyType,
+		"api_key_vault_cmd":              stringType,
+		"api_url":                        urlType,
+		"apikey":                         apiKeyType,
+		"debug":                          boolType,
+		"exclude":                        boolOrRegexListType,
+		"exclude_unknown_project":        boolType,
+		"guess_language":                 boolType,
+		"heartbeat_rate_limit_seconds":   intType,
+		"hide_branch_names":              boolOrRegexListType,
+		"hide_branchnames":               boolOrRegexListType,
+		"hide_command_args":              boolOrRegexListType,
+		"hide_dependencies":              boolOrRegexListType,
+		"hide_file_names":                boolOrRegexListType,
+		"hide_filenames":                 boolOrRegexListType,
+		"hide_project_folder":            boolType,
+		"hide_project_names":             boolOrRegexListType,
+		"hide_projectnames":              boolOrRegexListType,
+		"hidebranchnames":                boolOrRegexListType,
+		"hidefilenames":                  boolOrRegexListType,
+		"hideprojectnames":               boolOrRegexListType,
+		"hostname":                       stringType,
+		"ignore":                         boolOrRegexListType,
+		"import_cfg":                     stringType,
+		"include":                        boolOrRegexListType,
+		"include_only_with_project_file": boolType,
+		"log_file":                       stringType,
+		"metrics":                        boolType,
+		"no_ssl_verify":                  boolType,
+		"offline":                        boolType,
+		"proxy":                          stringType,
+		"send_diagnostics_on_errors":     boolType,
+		"ssl_certs_file":                 stringType,
+		"status_bar_hide_categories":     boolType,
+		"strict_config":                  boolType,
+		"timeout":                        intType,
+	}},
+	"internal": {Keys: map[string]valueType{
+		"backoff_at":                dateType,
+		"backoff_retries":           intType,
+		"cli_version":               stringType,
+		"cli_version_last_modified": stringType,
+		"heartbeats_last_sent_at":   dateType,
+	}},
+	"git": {Keys: map[string]valueType{
+		"project_from_git_remote": boolType,
+		"submodules_disabled":     boolOrRegexListType,
+	}},
+	"categories":               {Patterns: true, Values: categoryType, Globs: true},
+	"domain_rules":             {Patterns: true, Values: domainRuleType},
+	"git_submodule_projectmap": {Patterns: true, Values: stringType},
+	"project_api_key":          {Patterns: true, Values: apiKeyType},
+	"project_profile":          {Patterns: true, Values: stringType},
+	"projectmap":               {Patterns: true, Values: stringType},
+	"shell_categories":         {Patterns: true, Values: categoryType},
+}
+
+// ConfigIssue is a problem found when validating a config file.
+type ConfigIssue struct {
+	Filepath string
+	Line     int
+	Message  string
+}
+
+// String implements fmt.Stringer interface.
+func (i ConfigIssue) String() string {
+	return fmt.Sprintf("%s:%d: %s", i.Filepath, i.Line, i.Message)
+}
+
+// ValidateConfigFiles validates the config file, the import config file and
+// the internal config file, if present. It returns the validated files and all
+// issues found.
+func ValidateConfigFiles(ctx context.Context, v *viper.Viper) ([]string, []ConfigIssue, error) {
+	var (
+		files  []string
+		issues []ConfigIssue
+	)
+
+	for _, filePathFn := range []func(context.Context, *viper.Viper) (string, error){
+		ini.FilePath,
+		ini.ImportFilePath,
+		ini.InternalFilePath,
+	} {
+		configFile, err := filePathFn(ctx, v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error getting config file path: %s", err)
+		}
+
+		if configFile == "" {
+			continue
+		}
+
+		if _, err := os.Stat(configFile); err != nil {
+			continue
+		}
+
+		fileIssues, err := ValidateConfigFile(configFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		files = append(files, configFile)
+		issues = append(issues, fileIssues...)
+	}
+
+	return files, issues, nil
+}
+
+// ValidateConfigFile checks every section and key of the config file against
+// the keys read by the cli and returns unknown keys, values of the wrong type
+// and regex patterns, which don't compile.
+func ValidateConfigFile(filepath string) ([]ConfigIssue, error) {
+	entries, err := ini.ReadEntries(filepath)
+	if err != nil {
+		var errsyntax ini.SyntaxError
+		if errors.As(err, &errsyntax) {
+			return []ConfigIssue{{Filepath: filepath, Line: errsyntax.Line, Message: errsyntax.Msg}}, nil
+		}
+
+		return nil, err
+	}
+
+	var issues []ConfigIssue
+
+	for _, e := range entries {
+		for _, issue := range validateEntry(e) {
+			issue.Filepath = filepath
+			issues = append(issues, issue)
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Line < issues[j].Line
+	})
+
+	return issues, nil
+}
+
+func validateEntry(e ini.Entry) []ConfigIssue {
+	section := strings.ToLower(e.Section)
+	key := strings.ToLower(e.Key)
+
+	if section == "" {
+		return []ConfigIssue{{Line: e.Line, Message: fmt.Sprintf("key %q outside of a section", e.Key)}}
+	}
+
+	// profiles overlay [settings]
+	if strings.HasPrefix(section, profileSectionPrefix) {
+		section = "settings"
+	}
+
+	schema, ok := configSchema[section]
+	if !ok {
+		return []ConfigIssue{{Line: e.Line, Message: fmt.Sprintf("unknown section [%s]", e.Section)}}
+	}
+
+	if schema.Patterns {
+		var issues []ConfigIssue
+
+		compile := compilePattern
+		if schema.Globs {
+			compile = func(s string) error {
+				_, err := category.CompilePattern(s)
+				return err
+			}
+		}
+
+		if err := compile(e.Key); err != nil {
+			issues = append(issues, ConfigIssue{Line: e.Line, Message: fmt.Sprintf("[%s] %s", e.Section, err)})
+		}
+
+		return append(issues, validateValue(e, schema.Values)...)
+	}
+
+	typ, ok := schema.Keys[key]
+	if !ok {
+		return []ConfigIssue{{Line: e.Line, Message: fmt.Sprintf("unknown key %q in [%s]", e.Key, e.Section)}}
+	}
+
+	return validateValue(e, typ)
+}
+
+func validateValue(e ini.Entry, typ valueType) []ConfigIssue {
+	value := strings.TrimSpace(e.Value)
+
+	// empty values are treated like unset values
+	if value == "" {
+		return nil
+	}
+
+	var err error
+
+	switch typ {
+	case stringType:
+	case boolType:
+		if _, perr := strconv.ParseBool(value); perr != nil {
+			err = fmt.Errorf("invalid bool value %q", value)
+		}
+	case intType:
+		if _, perr := strconv.Atoi(value); perr != nil {
+			err = fmt.Errorf("invalid integer value %q", value)
+		}
+	case dateType:
+		if _, perr := time.Parse(ini.DateFormat, value); perr != nil {
+			err = fmt.Errorf("invalid date value %q, expected format %s", value, ini.DateFormat)
+		}
+	case apiKeyType:
+		if !IsValidAPIKey(value) {
+			err = errors.New("invalid api key format")
+		}
+	case urlType:
+		if _, perr := url.Parse(value); perr != nil {
+			err = fmt.Errorf("invalid url %q: %s", value, perr)
+		}
+	case categoryType:
+		if _, perr := heartbeat.ParseCategory(value); perr != nil {
+			err = perr
+		}
+	case domainRuleType:
+		if _, perr := parseDomainRule(value); perr != nil {
+			err = perr
+		}
+	case boolOrRegexListType:
+		return validateBoolOrRegexList(e)
+	}
+
+	if err != nil {
+		return []ConfigIssue{{Line: e.Line, Message: fmt.Sprintf("%s in [%s]: %s", e.Key, e.Section, err)}}
+	}
+
+	return nil
+}
+
+// validateBoolOrRegexList reports each pattern of a multiline value, which
+// doesn't compile, at its own line.
+func validateBoolOrRegexList(e ini.Entry) []ConfigIssue {
+	value := strings.TrimSpace(e.Value)
+	if strings.EqualFold(value, "true") || strings.EqualFold(value, "false") {
+		return nil
+	}
+
+	var issues []ConfigIssue
+
+	for n, s := range strings.Split(strings.ReplaceAll(e.Value, "\r", "\n"), "\n") {
+		s = strings.Trim(s, "\n\t ")
+		if s == "" {
+			continue
+		}
+
+		line := e.Line
+		if n < len(e.ValueLines) {
+			line = e.ValueLines[n]
+		}
+
+		if err := compilePattern(s); err != nil {
+			issues = append(issues, ConfigIssue{
+				Line:    line,
+				Message: fmt.Sprintf("%s in [%s]: %s", e.Key, e.Section, err),
+			})
+		}
+	}
+
+	return issues
+}
+
+// compilePattern compiles the pattern case insensitive, like when loading params.
+func compilePattern(s string) error {
+	_, err := compileCaseInsensitive(s)
+	return err
+}
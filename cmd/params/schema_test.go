@@ -0,0 +1,137 @@
+package params_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cmdparams "github.com/optiflow-os/tracelens-cli/cmd/params"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfigFile(t *testing.T) {
+	issues, err := cmdparams.ValidateConfigFile("testdata/invalid.cfg")
+	require.NoError(t, err)
+
+	var messages []string
+	for _, issue := range issues {
+		messages = append(messages, issue.String())
+	}
+
+	assert.Equal(t, []string{
+		`testdata/invalid.cfg:3: unknown key "hide_file_name" in [settings]`,
+		`testdata/invalid.cfg:4: debug in [settings]: invalid bool value "yes"`,
+		"testdata/invalid.cfg:8: exclude in [settings]: failed to compile regex \"(?i)(broken\":" +
+			" error parsing regexp: missing closing ) in `(?i)(broken`",
+		`testdata/invalid.cfg:9: unknown key "backoff_at" in [settings]`,
+		`testdata/invalid.cfg:12: backoff_at in [internal]: invalid date value "yesterday",` +
+			` expected format 2006-01-02T15:04:05Z07:00`,
+		"testdata/invalid.cfg:15: [projectmap] failed to compile regex \"(?i)foo[\":" +
+			" error parsing regexp: unterminated [] set in `(?i)foo[`",
+		`testdata/invalid.cfg:19: ^/work/ in [project_api_key]: invalid api key format`,
+		`testdata/invalid.cfg:22: unknown section [unknown]`,
+	}, messages)
+}
+
+func TestValidateConfigFile_SyntaxError(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "wakatime.cfg")
+
+	err := os.WriteFile(fp, []byte("[settings]\ndebug = true\ninvalid\n"), 0600)
+	require.NoError(t, err)
+
+	issues, err := cmdparams.ValidateConfigFile(fp)
+	require.NoError(t, err)
+
+	assert.Equal(t, []cmdparams.ConfigIssue{
+		{Filepath: fp, Line: 3, Message: "key-value delimiter not found: invalid"},
+	}, issues)
+}
+
+func TestValidateConfigFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	internalFilepath := filepath.Join(tmpDir, "wakatime-internal.cfg")
+
+	err := os.WriteFile(internalFilepath, []byte("[internal]\nbackoff_retries = 3\n"), 0600)
+	require.NoError(t, err)
+
+	v := viper.New()
+	v.Set("config", "testdata/invalid.cfg")
+	v.Set("internal-config", internalFilepath)
+	v.Set("settings.import_cfg", filepath.Join(tmpDir, "missing.cfg"))
+
+	files, issues, err := cmdparams.ValidateConfigFiles(context.Background(), v)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"testdata/invalid.cfg", internalFilepath}, files)
+	assert.Len(t, issues, 8)
+}
+
+func TestValidateConfigFile_Profile(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "wakatime.cfg")
+
+	err := os.WriteFile(fp, []byte(
+		"[profile work]\napi_key = 00000000-0000-4000-8000-000000000001\nhide_file_name = true\n"+
+			"[project_profile]\n^/work/ = work\n",
+	), 0600)
+	require.NoError(t, err)
+
+	issues, err := cmdparams.ValidateConfigFile(fp)
+	require.NoError(t, err)
+
+	assert.Equal(t, []cmdparams.ConfigIssue{
+		{Filepath: fp, Line: 3, Message: `unknown key "hide_file_name" in [profile work]`},
+	}, issues)
+}
+
+func TestValidateConfigFile_Categories(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "wakatime.cfg")
+
+	err := os.WriteFile(fp, []byte(
+		"[categories]\n*.md = writing docs\n_test\\.go$ = writing tests\ninvalid( = coding\n^/notes/ = notes\n",
+	), 0600)
+	require.NoError(t, err)
+
+	issues, err := cmdparams.ValidateConfigFile(fp)
+	require.NoError(t, err)
+
+	assert.Equal(t, []cmdparams.ConfigIssue{
+		{
+			Filepath: fp,
+			Line:     4,
+			Message: "[categories] failed to compile regex \"(?i)invalid(\": error parsing regexp:" +
+				" missing closing ) in `(?i)invalid(`",
+		},
+		{Filepath: fp, Line: 5, Message: `^/notes/ in [categories]: invalid category "notes"`},
+	}, issues)
+}
+
+func TestValidateConfigFile_DomainRules(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "wakatime.cfg")
+
+	err := os.WriteFile(fp, []byte(
+		"[domain_rules]\ngithub.com/org/(\\w+)/pull = project: {0}; category: code reviewing\n"+
+			"meet.google.com = category: meeting\nexample.org = owner: me\nexample.com = project\n",
+	), 0600)
+	require.NoError(t, err)
+
+	issues, err := cmdparams.ValidateConfigFile(fp)
+	require.NoError(t, err)
+
+	assert.Equal(t, []cmdparams.ConfigIssue{
+		{
+			Filepath: fp,
+			Line:     4,
+			Message:  `example.org in [domain_rules]: invalid rule key "owner", expected project or category`,
+		},
+		{
+			Filepath: fp,
+			Line:     5,
+			Message:  `example.com in [domain_rules]: invalid rule "project", expected project: name or category: name`,
+		},
+	}, issues)
+}
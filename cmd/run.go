@@ -9,21 +9,14 @@ import (
 	"os"
 	"path/filepath"
 	"runtime/debug"
+	"sort"
 	"strings"
 
 	cmdapi "github.com/optiflow-os/tracelens-cli/cmd/api"
-	"github.com/optiflow-os/tracelens-cli/cmd/configread"
-	"github.com/optiflow-os/tracelens-cli/cmd/configwrite"
-	"github.com/optiflow-os/tracelens-cli/cmd/fileexperts"
-	cmdheartbeat "github.com/optiflow-os/tracelens-cli/cmd/heartbeat"
 	"github.com/optiflow-os/tracelens-cli/cmd/logfile"
 	cmdoffline "github.com/optiflow-os/tracelens-cli/cmd/offline"
-	"github.com/optiflow-os/tracelens-cli/cmd/offlinecount"
-	"github.com/optiflow-os/tracelens-cli/cmd/offlineprint"
 	"github.com/optiflow-os/tracelens-cli/cmd/offlinesync"
 	"github.com/optiflow-os/tracelens-cli/cmd/params"
-	"github.com/optiflow-os/tracelens-cli/cmd/today"
-	"github.com/optiflow-os/tracelens-cli/cmd/todaygoal"
 	"github.com/optiflow-os/tracelens-cli/pkg/diagnostic"
 	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
 	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
@@ -48,47 +41,17 @@ type diagnostics struct {
 	Stack         string
 }
 
-// RunE executes commands parsed from a command line.
+// RunE executes commands parsed from a command line. It selects the
+// command via top-level flags, as supported before subcommands were added.
 func RunE(cmd *cobra.Command, v *viper.Viper) error {
-	ctx := context.Background()
-
-	// extract logger from context despite it's not fully initialized yet
-	logger := log.Extract(ctx)
-
-	err := parseConfigFiles(ctx, v)
-	if err != nil {
-		logger.Errorf("failed to parse config files: %s", err)
-
-		if v.IsSet("entity") {
-			_ = saveHeartbeats(ctx, v)
-
-			return exitcode.Err{Code: exitcode.ErrConfigFileParse}
-		}
-	}
-
-	logger, err = SetupLogging(ctx, v)
+	ctx, shutdown, err := initialize(v)
 	if err != nil {
-		// log to std out and exit, as logger instance failed to setup
-		stdlog.Fatalf("failed to setup logging: %s", err)
+		return err
 	}
 
-	// save logger to context
-	ctx = log.ToContext(ctx, logger)
-
-	// register all custom lexers
-	if err := lexer.RegisterAll(); err != nil {
-		logger.Fatalf("failed to register custom lexers: %s", err)
-	}
+	defer shutdown()
 
-	// start profiling if enabled
-	if logger.IsMetricsEnabled() {
-		shutdown, err := metrics.StartProfiling(ctx)
-		if err != nil {
-			logger.Errorf("failed to start profiling: %s", err)
-		} else {
-			defer shutdown()
-		}
-	}
+	logger := log.Extract(ctx)
 
 	if v.GetBool("user-agent") {
 		logger.Debugln("command: user-agent")
@@ -98,83 +61,103 @@ func RunE(cmd *cobra.Command, v *viper.Viper) error {
 		return nil
 	}
 
-	if v.GetBool("version") {
-		logger.Debugln("command: version")
+	for _, c := range legacyCommands {
+		if isFlagSet(v, c.Flag) {
+			return c.run(ctx, v)
+		}
+	}
 
-		return RunCmd(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(), runVersion)
+	required := []string{"--user-agent"}
+	for _, c := range legacyCommands {
+		required = append(required, "--"+c.Flag)
 	}
 
-	if v.IsSet("config-read") {
-		logger.Debugln("command: config-read")
+	sort.Strings(required)
 
-		return RunCmd(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(), configread.Run)
-	}
+	logger.Warnf("one of the following parameters has to be provided: %s", strings.Join(required, ", "))
 
-	if v.IsSet("config-write") {
-		logger.Debugln("command: config-write")
+	_ = cmd.Help()
 
-		return RunCmd(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(), configwrite.Run)
-	}
+	return exitcode.Err{Code: exitcode.ErrGeneric}
+}
 
-	if v.GetBool("today") {
-		logger.Debugln("command: today")
+// runCommand executes a command invoked as subcommand. The subcommand's local
+// flags are bound to viper first, overriding the root command's flags of the same name.
+func runCommand(cmd *cobra.Command, v *viper.Viper, c command) error {
+	if err := v.BindPFlags(cmd.LocalNonPersistentFlags()); err != nil {
+		return fmt.Errorf("failed to bind cobra flags to viper: %s", err)
+	}
 
-		return RunCmd(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(), today.Run)
+	ctx, shutdown, err := initialize(v)
+	if err != nil {
+		return err
 	}
 
-	if v.IsSet("today-goal") {
-		logger.Debugln("command: today-goal")
+	defer shutdown()
 
-		return RunCmd(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(), todaygoal.Run)
-	}
+	return c.run(ctx, v)
+}
 
-	if v.GetBool("file-experts") {
-		logger.Debugln("command: file-experts")
+// initialize parses config files, sets up logging and starts profiling if
+// enabled. It returns a context holding the logger and a function, which has to
+// be called once the command finished. Custom lexers are registered by
+// registerLexers only when a command runs in-process, so forwarding heartbeats
+// to the daemon stays cheap.
+func initialize(v *viper.Viper) (context.Context, func(), error) {
+	ctx := context.Background()
 
-		return RunCmd(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(), fileexperts.Run)
-	}
+	// extract logger from context despite it's not fully initialized yet
+	logger := log.Extract(ctx)
 
-	if v.IsSet("entity") {
-		logger.Debugln("command: heartbeat")
+	err := parseConfigFiles(ctx, v)
+	if err != nil {
+		logger.Errorf("failed to parse config files: %s", err)
 
-		return RunCmdWithOfflineSync(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(), cmdheartbeat.Run)
-	}
+		if v.IsSet("entity") && !v.GetBool("dry-run") {
+			_ = saveHeartbeats(ctx, v)
 
-	if v.IsSet("sync-offline-activity") {
-		logger.Debugln("command: sync-offline-activity")
+			return ctx, nil, exitcode.Err{Code: exitcode.ErrConfigFileParse}
+		}
+	}
 
-		return RunCmd(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(), offlinesync.RunWithoutRateLimiting)
+	logger, err = SetupLogging(ctx, v)
+	if err != nil {
+		// log to std out and exit, as logger instance failed to setup
+		stdlog.Fatalf("failed to setup logging: %s", err)
 	}
 
-	if v.GetBool("offline-count") {
-		logger.Debugln("command: offline-count")
+	// save logger to context
+	ctx = log.ToContext(ctx, logger)
+
+	shutdown := func() {}
 
-		return RunCmd(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(), offlinecount.Run)
+	// start profiling if enabled
+	if logger.IsMetricsEnabled() {
+		stop, err := metrics.StartProfiling(ctx)
+		if err != nil {
+			logger.Errorf("failed to start profiling: %s", err)
+		} else {
+			shutdown = stop
+		}
 	}
 
-	if v.IsSet("print-offline-heartbeats") {
-		logger.Debugln("command: print-offline-heartbeats")
+	return ctx, shutdown, nil
+}
 
-		return RunCmd(ctx, v, logger.IsVerboseEnabled(), logger.SendDiagsOnErrors(), offlineprint.Run)
+// registerLexers registers all custom lexers.
+func registerLexers(ctx context.Context) {
+	if err := lexer.RegisterAll(); err != nil {
+		log.Extract(ctx).Fatalf("failed to register custom lexers: %s", err)
 	}
+}
 
-	logger.Warnf("one of the following parameters has to be provided: %s", strings.Join([]string{
-		"--config-read",
-		"--config-write",
-		"--entity",
-		"--file-experts",
-		"--offline-count",
-		"--print-offline-heartbeats",
-		"--sync-offline-activity",
-		"--today",
-		"--today-goal",
-		"--user-agent",
-		"--version",
-	}, ", "))
-
-	_ = cmd.Help()
+// isFlagSet returns true if a bool flag is set to true or any other flag was set.
+func isFlagSet(v *viper.Viper, key string) bool {
+	if b, ok := v.Get(key).(bool); ok {
+		return b
+	}
 
-	return exitcode.Err{Code: exitcode.ErrGeneric}
+	return v.IsSet(key)
 }
 
 func parseConfigFiles(ctx context.Context, v *viper.Viper) error {
@@ -194,6 +177,8 @@ func parseConfigFiles(ctx context.Context, v *viper.Viper) error {
 		},
 	}
 
+	params.ApplyEnv(ctx, v)
+
 	for _, c := range configFiles {
 		configFile, err := c.filePathFn(ctx, v)
 		if err != nil {
@@ -215,6 +200,28 @@ func parseConfigFiles(ctx context.Context, v *viper.Viper) error {
 		}
 	}
 
+	if _, err := params.ApplyProfile(ctx, v); err != nil {
+		return fmt.Errorf("failed to apply profile: %s", err)
+	}
+
+	if !v.GetBool("settings.strict_config") {
+		return nil
+	}
+
+	_, issues, err := params.ValidateConfigFiles(ctx, v)
+	if err != nil {
+		return fmt.Errorf("failed to validate config files: %s", err)
+	}
+
+	if len(issues) > 0 {
+		messages := make([]string, 0, len(issues))
+		for _, issue := range issues {
+			messages = append(messages, issue.String())
+		}
+
+		return fmt.Errorf("invalid config with strict_config enabled: %s", strings.Join(messages, "; "))
+	}
+
 	return nil
 }
 
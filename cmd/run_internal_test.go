@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -448,6 +449,27 @@ func TestParseConfigFiles_APIKey_FlagTakesPrecedence(t *testing.T) {
 		v.GetString("key"))
 }
 
+func TestParseConfigFiles_StrictConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configFilepath := filepath.Join(tmpDir, "wakatime.cfg")
+
+	err := os.WriteFile(configFilepath, []byte("[settings]\nstrict_config = true\nhide_file_name = true\n"), 0600)
+	require.NoError(t, err)
+
+	v := setupViper(t)
+	v.Set("config", configFilepath)
+	v.Set("internal-config", filepath.Join(tmpDir, "wakatime-internal.cfg"))
+
+	err = parseConfigFiles(context.Background(), v)
+	require.Error(t, err)
+
+	assert.Equal(t,
+		"invalid config with strict_config enabled: "+configFilepath+`:3: unknown key "hide_file_name" in [settings]`,
+		err.Error(),
+	)
+}
+
 func jsonEscape(t *testing.T, i string) string {
 	b, err := json.Marshal(i)
 	require.NoError(t, err)
@@ -464,6 +486,18 @@ func setupTestServer() (string, *http.ServeMux, func()) {
 	return srv.URL, router, func() { srv.Close() }
 }
 
+func TestIsFlagSet(t *testing.T) {
+	v := setupViper(t)
+	v.Set("today", false)
+	v.Set("version", true)
+	v.Set("today-goal", "00000000-0000-4000-8000-000000000000")
+
+	assert.False(t, isFlagSet(v, "today"))
+	assert.True(t, isFlagSet(v, "version"))
+	assert.True(t, isFlagSet(v, "today-goal"))
+	assert.False(t, isFlagSet(v, "entity"))
+}
+
 func setupViper(t *testing.T) *viper.Viper {
 	multilineOption := iniv1.LoadOptions{AllowPythonMultilineValues: true}
 	iniCodec := viperini.Codec{LoadOptions: multilineOption}
@@ -0,0 +1,172 @@
+package shellinit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/version"
+	"github.com/optiflow-os/tracelens-cli/pkg/vipertools"
+
+	"github.com/spf13/viper"
+)
+
+// Shell is a shell supported by the shell-init command.
+type Shell string
+
+const (
+	// Bash is the bash shell.
+	Bash Shell = "bash"
+	// Fish is the fish shell.
+	Fish Shell = "fish"
+	// Zsh is the zsh shell.
+	Zsh Shell = "zsh"
+)
+
+// ParseShell parses a shell from a string.
+func ParseShell(s string) (Shell, error) {
+	switch Shell(strings.ToLower(s)) {
+	case Bash:
+		return Bash, nil
+	case Fish:
+		return Fish, nil
+	case Zsh:
+		return Zsh, nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q, expected bash, zsh or fish", s)
+	}
+}
+
+// bashHooks uses the DEBUG trap as preexec and PROMPT_COMMAND as precmd hook.
+// Only the first command after the prompt was shown is tracked, so commands of
+// PROMPT_COMMAND and completion functions are ignored.
+const bashHooks = `# tracelens shell integration for bash
+# load with: eval "$({{exe}} shell-init bash)"
+__tracelens_heartbeat() {
+    ( printf '%s\n' "$1" | {{exe}} heartbeat --entity-type=app --shell-hook \
+        --project-folder="$PWD" --plugin="bash/${BASH_VERSION%%(*} bash-tracelens/{{version}}" \
+        >/dev/null 2>&1 & )
+}
+
+__tracelens_preexec() {
+    case "$BASH_COMMAND" in __tracelens_*) return 0 ;; esac
+    [ -n "$COMP_LINE" ] && return 0
+    [ -n "$__tracelens_at_prompt" ] || return 0
+    __tracelens_at_prompt=
+    __tracelens_command=$BASH_COMMAND
+    __tracelens_heartbeat "$__tracelens_command"
+}
+
+__tracelens_precmd() {
+    __tracelens_at_prompt=
+    if [ -n "$__tracelens_command" ]; then
+        __tracelens_heartbeat "$__tracelens_command"
+        __tracelens_command=
+    fi
+}
+
+__tracelens_ready() {
+    __tracelens_at_prompt=1
+}
+
+case "$PROMPT_COMMAND" in
+    *__tracelens_precmd*) ;;
+    *) PROMPT_COMMAND="__tracelens_precmd
+${PROMPT_COMMAND}
+__tracelens_ready" ;;
+esac
+
+trap '__tracelens_preexec' DEBUG
+`
+
+const zshHooks = `# tracelens shell integration for zsh
+# load with: eval "$({{exe}} shell-init zsh)"
+__tracelens_heartbeat() {
+    print -r -- "$1" | {{exe}} heartbeat --entity-type=app --shell-hook \
+        --project-folder="$PWD" --plugin="zsh/$ZSH_VERSION zsh-tracelens/{{version}}" \
+        >/dev/null 2>&1 &!
+}
+
+__tracelens_preexec() {
+    __tracelens_command=$1
+    __tracelens_heartbeat "$1"
+}
+
+__tracelens_precmd() {
+    [[ -n "$__tracelens_command" ]] || return 0
+    __tracelens_heartbeat "$__tracelens_command"
+    __tracelens_command=
+}
+
+autoload -Uz add-zsh-hook
+add-zsh-hook preexec __tracelens_preexec
+add-zsh-hook precmd __tracelens_precmd
+`
+
+const fishHooks = `# tracelens shell integration for fish
+# load with: {{exe}} shell-init fish | source
+function __tracelens_heartbeat
+    test -n "$argv[1]"; or return 0
+    printf '%s\n' $argv[1] | command {{exe}} heartbeat --entity-type=app --shell-hook \
+        --project-folder="$PWD" --plugin="fish/$FISH_VERSION fish-tracelens/{{version}}" \
+        >/dev/null 2>&1 &
+    disown 2>/dev/null
+end
+
+function __tracelens_preexec --on-event fish_preexec
+    __tracelens_heartbeat $argv[1]
+end
+
+function __tracelens_postexec --on-event fish_postexec
+    __tracelens_heartbeat $argv[1]
+end
+`
+
+// Run prints the hooks for the shell given as argument.
+func Run(_ context.Context, v *viper.Viper) (int, error) {
+	shell, err := ParseShell(vipertools.GetString(v, "shell-init"))
+	if err != nil {
+		return exitcode.ErrGeneric, err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return exitcode.ErrGeneric, fmt.Errorf("failed to get executable path: %s", err)
+	}
+
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	fmt.Print(Hooks(shell, exe))
+
+	return exitcode.Success, nil
+}
+
+// Hooks returns the hook code for the shell. The hooks send a heartbeat in the
+// background, when a command starts and when it ends, so the prompt is never
+// blocked. The command line is passed on stdin, so arguments like tokens are
+// not visible to other users in the process list. Heartbeats sent too often are queued offline by the rate limit.
+func Hooks(shell Shell, exe string) string {
+	var (
+		hooks  string
+		quoted string
+	)
+
+	switch shell {
+	case Fish:
+		hooks = fishHooks
+		quoted = "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(exe) + "'"
+	case Zsh:
+		hooks = zshHooks
+		quoted = "'" + strings.ReplaceAll(exe, `'`, `'\''`) + "'"
+	default:
+		hooks = bashHooks
+		quoted = "'" + strings.ReplaceAll(exe, `'`, `'\''`) + "'"
+	}
+
+	return strings.NewReplacer("{{exe}}", quoted, "{{version}}", version.Version).Replace(hooks)
+}
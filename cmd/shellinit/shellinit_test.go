@@ -0,0 +1,93 @@
+package shellinit_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/cmd/shellinit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseShell(t *testing.T) {
+	for _, s := range []string{"bash", "zsh", "fish", "Bash"} {
+		t.Run(s, func(t *testing.T) {
+			_, err := shellinit.ParseShell(s)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestParseShell_Invalid(t *testing.T) {
+	_, err := shellinit.ParseShell("tcsh")
+
+	assert.EqualError(t, err, `unsupported shell "tcsh", expected bash, zsh or fish`)
+}
+
+func TestHooks(t *testing.T) {
+	tests := map[shellinit.Shell]struct {
+		Exe      string
+		Expected []string
+	}{
+		shellinit.Bash: {
+			Exe: "/opt/it's/tracelens-cli",
+			Expected: []string{
+				`( printf '%s\n' "$1" | '/opt/it'\''s/tracelens-cli' heartbeat --entity-type=app --shell-hook`,
+				`--project-folder="$PWD"`,
+				"trap '__tracelens_preexec' DEBUG",
+			},
+		},
+		shellinit.Zsh: {
+			Exe: "/opt/tracelens-cli",
+			Expected: []string{
+				`print -r -- "$1" | '/opt/tracelens-cli' heartbeat --entity-type=app --shell-hook`,
+				">/dev/null 2>&1 &!",
+				"add-zsh-hook preexec __tracelens_preexec",
+				"add-zsh-hook precmd __tracelens_precmd",
+			},
+		},
+		shellinit.Fish: {
+			Exe: "/opt/it's/tracelens-cli",
+			Expected: []string{
+				`printf '%s\n' $argv[1] | command '/opt/it\'s/tracelens-cli' heartbeat --entity-type=app --shell-hook`,
+				"function __tracelens_preexec --on-event fish_preexec",
+				"function __tracelens_postexec --on-event fish_postexec",
+			},
+		},
+	}
+
+	for shell, test := range tests {
+		t.Run(string(shell), func(t *testing.T) {
+			hooks := shellinit.Hooks(shell, test.Exe)
+
+			for _, expected := range test.Expected {
+				assert.Contains(t, hooks, expected)
+			}
+
+			// the command line is never passed as argument, as it might contain secrets
+			assert.NotContains(t, hooks, "--entity=")
+		})
+	}
+}
+
+func TestHooks_Syntax(t *testing.T) {
+	for _, shell := range []shellinit.Shell{shellinit.Bash, shellinit.Zsh, shellinit.Fish} {
+		t.Run(string(shell), func(t *testing.T) {
+			bin, err := exec.LookPath(string(shell))
+			if err != nil {
+				t.Skipf("%s not installed", shell)
+			}
+
+			fp := filepath.Join(t.TempDir(), "hooks")
+
+			err = os.WriteFile(fp, []byte(shellinit.Hooks(shell, "/opt/tracelens-cli")), 0600)
+			require.NoError(t, err)
+
+			out, err := exec.Command(bin, "-n", fp).CombinedOutput() // nolint:gosec
+			require.NoError(t, err, string(out))
+		})
+	}
+}
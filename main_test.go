@@ -3,6 +3,7 @@ package main_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -17,6 +18,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/optiflow-os/tracelens-cli/cmd/shellinit"
 	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
 	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
 	"github.com/optiflow-os/tracelens-cli/pkg/offline"
@@ -93,7 +95,7 @@ func testSendHeartbeats(t *testing.T, projectFolder, entity, p string) {
 		body, err := io.ReadAll(req.Body)
 		require.NoError(t, err)
 
-		assert.JSONEq(t, expectedBody, string(body))
+		assert.JSONEq(t, expectedBody, withoutIDs(t, body))
 
 		// write response
 		f, err := os.Open("testdata/api_heartbeats_response.json")
@@ -193,7 +195,7 @@ func TestSendHeartbeats_SecondaryApiKey(t *testing.T) {
 		body, err := io.ReadAll(req.Body)
 		require.NoError(t, err)
 
-		assert.JSONEq(t, expectedBody, string(body))
+		assert.JSONEq(t, expectedBody, withoutIDs(t, body))
 
 		// write response
 		f, err := os.Open("testdata/api_heartbeats_response.json")
@@ -603,7 +605,7 @@ func TestSendHeartbeats_Err(t *testing.T) {
 		body, err := io.ReadAll(req.Body)
 		require.NoError(t, err)
 
-		assert.JSONEq(t, expectedBody, string(body))
+		assert.JSONEq(t, expectedBody, withoutIDs(t, body))
 
 		// write response
 		w.WriteHeader(http.StatusBadGateway)
@@ -804,6 +806,62 @@ func TestSendHeartbeats_MalformedInternalConfig(t *testing.T) {
 	assert.Equal(t, 1, count)
 }
 
+func TestShellHook(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+
+	apiURL, router, close := setupTestServer()
+	defer close()
+
+	var (
+		mu       sync.Mutex
+		entities []string
+	)
+
+	router.HandleFunc("/users/current/heartbeats.bulk", func(w http.ResponseWriter, req *http.Request) {
+		var hh []heartbeat.Heartbeat
+
+		err := json.NewDecoder(req.Body).Decode(&hh)
+		require.NoError(t, err)
+
+		mu.Lock()
+		for _, h := range hh {
+			entities = append(entities, h.Entity)
+		}
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"responses":[[null,201]]}`))
+	})
+
+	tmpDir := t.TempDir()
+
+	err = os.WriteFile(filepath.Join(tmpDir, ".wakatime.cfg"), []byte(
+		"[settings]\n"+
+			"api_key = 00000000-0000-4000-8000-000000000000\n"+
+			"api_url = "+apiURL+"\n",
+	), 0600)
+	require.NoError(t, err)
+
+	exe, err := filepath.Abs(binaryPath(t))
+	require.NoError(t, err)
+
+	// run the generated hook like the shell does, without --entity
+	cmd := exec.Command(bash, "-c", `eval "$TRACELENS_HOOKS"; __tracelens_heartbeat 'git status'`) // #nosec G204
+	cmd.Env = append(os.Environ(), "WAKATIME_HOME="+tmpDir, "TRACELENS_HOOKS="+shellinit.Hooks(shellinit.Bash, exe))
+
+	runCmd(cmd, &bytes.Buffer{})
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(entities) == 1 && entities[0] == "git"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
 func TestFileExperts(t *testing.T) {
 	apiURL, router, close := setupTestServer()
 	defer close()
@@ -1089,6 +1147,26 @@ func TestOfflineCountEmpty(t *testing.T) {
 	assert.Equal(t, "0\n", out)
 }
 
+func TestOfflineCountSubcommand(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	offlineQueueFile, err := os.CreateTemp(tmpDir, "")
+	require.NoError(t, err)
+
+	defer offlineQueueFile.Close()
+
+	out := runTraceLensCli(
+		t,
+		&bytes.Buffer{},
+		"offline", "count",
+		"--key", "00000000-0000-4000-8000-000000000000",
+		"--offline-queue-file", offlineQueueFile.Name(),
+		"--verbose",
+	)
+
+	assert.Equal(t, "0\n", out)
+}
+
 func TestPrintOfflineHeartbeats(t *testing.T) {
 	apiURL, router, close := setupTestServer()
 	defer close()
@@ -1177,7 +1255,7 @@ func TestPrintOfflineHeartbeats(t *testing.T) {
 		heartbeat.UserAgent(ctx, ""),
 	)
 
-	assert.Equal(t, offlineHeartbeatStr+"\n", out)
+	assert.JSONEq(t, offlineHeartbeatStr, withoutIDs(t, []byte(out)))
 }
 
 func TestUserAgent(t *testing.T) {
@@ -1207,6 +1285,44 @@ func TestVersionVerbose(t *testing.T) {
 	)), out)
 }
 
+func TestVersionSubcommand(t *testing.T) {
+	out := runTraceLensCli(t, &bytes.Buffer{}, "version")
+
+	assert.Equal(t, "<local-build>\n", out)
+}
+
+func TestConfigSubcommand(t *testing.T) {
+	tmpFile, err := os.CreateTemp(t.TempDir(), "wakatime.cfg")
+	require.NoError(t, err)
+
+	defer tmpFile.Close()
+
+	out := runTraceLensCli(
+		t,
+		&bytes.Buffer{},
+		"config", "set", "debug", "true", "--config", tmpFile.Name(), "--section", "git",
+	)
+
+	assert.Empty(t, out)
+
+	out = runTraceLensCli(
+		t,
+		&bytes.Buffer{},
+		"config", "get", "debug", "--config", tmpFile.Name(), "--section", "git",
+	)
+
+	assert.Equal(t, "true\n", out)
+
+	// legacy flags read the same value
+	out = runTraceLensCli(
+		t,
+		&bytes.Buffer{},
+		"--config", tmpFile.Name(), "--config-section", "git", "--config-read", "debug",
+	)
+
+	assert.Equal(t, "true\n", out)
+}
+
 func TestMultipleRunners(t *testing.T) {
 	var wg sync.WaitGroup
 
@@ -1341,6 +1457,27 @@ func runCmdExpectErr(cmd *exec.Cmd) (string, int) {
 	return stdout.String(), -1
 }
 
+// withoutIDs removes the generated uuids from a json list of heartbeats.
+func withoutIDs(t *testing.T, body []byte) string {
+	t.Helper()
+
+	var heartbeats []map[string]any
+
+	err := json.Unmarshal(body, &heartbeats)
+	require.NoError(t, err)
+
+	for _, h := range heartbeats {
+		assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", h["id"])
+
+		delete(h, "id")
+	}
+
+	data, err := json.Marshal(heartbeats)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
 func setupTestServer() (string, *http.ServeMux, func()) {
 	router := http.NewServeMux()
 	srv := httptest.NewServer(router)
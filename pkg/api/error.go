@@ -73,9 +73,11 @@ func (ErrAuth) ShouldLogError() bool {
 	return true
 }
 
-// ErrBadRequest represents a 400 response from the API.
+// ErrBadRequest represents a 400 response from the API. Body is the response
+// body with the error returned by the API.
 type ErrBadRequest struct {
-	Err error
+	Body string
+	Err  error
 }
 
 var _ wakaerror.Error = ErrBadRequest{}
@@ -64,7 +64,7 @@ func (c *Client) FileExperts(ctx context.Context, heartbeats []heartbeat.Heartbe
 	case http.StatusUnauthorized:
 		return nil, ErrAuth{Err: fmt.Errorf("authentication failed at %q. body: %q", url, string(body))}
 	case http.StatusBadRequest:
-		return nil, ErrBadRequest{fmt.Errorf("bad request at %q", url)}
+		return nil, ErrBadRequest{Err: fmt.Errorf("bad request at %q", url)}
 	default:
 		return nil, Err{fmt.Errorf(
 			"invalid response status from %q. got: %d, want: %d. body: %q",
@@ -3,6 +3,8 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,6 +20,8 @@ import (
 // SendHeartbeats sends a bulk of heartbeats to the wakatime api and returns the result.
 // The API does not guarantuee the setting of the Heartbeat property of the result.
 // On certain errors, like 429/too many heartbeats, this is omitted and not set.
+// Heartbeats with an api url, like the ones queued for a different api, are sent
+// to that api instead of the client's base url.
 //
 // ErrRequest is returned upon request failure with no received response from api.
 // ErrAuth is returned upon receiving a 401 Unauthorized api response.
@@ -25,22 +29,26 @@ import (
 func (c *Client) SendHeartbeats(ctx context.Context, heartbeats []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
 	logger := log.Extract(ctx)
 
-	url := c.baseURL + "/users/current/heartbeats.bulk"
+	var results []heartbeat.Result
 
-	logger.Debugf("sending %d heartbeat(s) to api at %s", len(heartbeats), url)
+	byURL := groupByAPIURL(heartbeats, c.baseURL)
 
-	var results []heartbeat.Result
+	for _, baseURL := range sortKeys(byURL) {
+		url := baseURL + "/users/current/heartbeats.bulk"
 
-	grouped := groupByAPIKey(heartbeats)
-	keys := sortKeys(grouped)
+		logger.Debugf("sending %d heartbeat(s) to api at %s", len(byURL[baseURL]), url)
 
-	for _, k := range keys {
-		res, err := c.sendHeartbeats(ctx, url, grouped[k])
-		if err != nil {
-			return nil, err
-		}
+		grouped := groupByAPIKey(byURL[baseURL])
+		keys := sortKeys(grouped)
+
+		for _, k := range keys {
+			res, err := c.sendHeartbeats(ctx, url, grouped[k])
+			if err != nil {
+				return nil, err
+			}
 
-		results = append(results, res...)
+			results = append(results, res...)
+		}
 	}
 
 	return results, nil
@@ -62,6 +70,7 @@ func (c *Client) sendHeartbeats(ctx context.Context, url string, hh []heartbeat.
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotencyKey(hh))
 
 	// set auth header here for every request due to multiple api key support
 	setAuthHeader(req, hh[0].APIKey)
@@ -86,7 +95,7 @@ func (c *Client) sendHeartbeats(ctx context.Context, url string, hh []heartbeat.
 	case http.StatusUnauthorized:
 		return nil, ErrAuth{Err: fmt.Errorf("authentication failed at %q", url)}
 	case http.StatusBadRequest:
-		return nil, ErrBadRequest{Err: fmt.Errorf("bad request at %q", url)}
+		return nil, ErrBadRequest{Body: string(body), Err: fmt.Errorf("bad request at %q", url)}
 	default:
 		return nil, Err{Err: fmt.Errorf(
 			"invalid response status from %q. got: %d, want: %d/%d. body: %q",
@@ -224,6 +233,21 @@ func parseHeartbeatResponseError(ctx context.Context, data json.RawMessage) ([]s
 	return errs, nil
 }
 
+func groupByAPIURL(hh []heartbeat.Heartbeat, baseURL string) map[string][]heartbeat.Heartbeat {
+	var grouped = make(map[string][]heartbeat.Heartbeat, 0)
+
+	for _, h := range hh {
+		url := h.APIURL
+		if url == "" {
+			url = baseURL
+		}
+
+		grouped[url] = append(grouped[url], h)
+	}
+
+	return grouped
+}
+
 func groupByAPIKey(hh []heartbeat.Heartbeat) map[string][]heartbeat.Heartbeat {
 	var grouped = make(map[string][]heartbeat.Heartbeat, 0)
 
@@ -253,3 +277,21 @@ func setAuthHeader(req *http.Request, apiKey string) {
 
 	req.Header.Set("Authorization", authHeaderValue)
 }
+
+// idempotencyKey returns the key for a request sending the heartbeats. It's the
+// id of a single heartbeat or a hash of all ids, so a request resent after a
+// timeout has the same key.
+func idempotencyKey(hh []heartbeat.Heartbeat) string {
+	if len(hh) == 1 && hh[0].UUID != "" {
+		return hh[0].UUID
+	}
+
+	hash := sha256.New()
+
+	for _, h := range hh {
+		_, _ = io.WriteString(hash, h.ID())
+		_, _ = hash.Write([]byte{'\n'})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -2,6 +2,7 @@ package api_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -80,6 +81,7 @@ func TestClient_SendHeartbeats(t *testing.T) {
 						Project:        heartbeat.PointerTo("wakatime-cli"),
 						Time:           1585598059,
 						UserAgent:      "wakatime/13.0.6",
+						UUID:           "845a922e-9e65-4775-bd68-bb3196d2e06a",
 					},
 				},
 				{
@@ -90,6 +92,7 @@ func TestClient_SendHeartbeats(t *testing.T) {
 						EntityType: heartbeat.FileType,
 						Time:       1585598060,
 						UserAgent:  "wakatime/13.0.7",
+						UUID:       "604bae69-a7fa-42ff-a38d-8354fd10e601",
 					},
 				},
 			}, results)
@@ -136,6 +139,98 @@ func TestClient_SendHeartbeats_MultipleApiKey(t *testing.T) {
 	assert.Eventually(t, func() bool { return numCalls == 2 }, time.Second, 50*time.Millisecond)
 }
 
+func TestClient_SendHeartbeats_APIURL(t *testing.T) {
+	url, router, close := setupTestServer()
+	defer close()
+
+	queuedURL, queuedRouter, queuedClose := setupTestServer()
+	defer queuedClose()
+
+	var (
+		numCalls       int
+		numCallsQueued int
+	)
+
+	handler := func(calls *int) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			*calls++
+
+			// write response
+			f, err := os.Open("testdata/api_heartbeats_response.json")
+			require.NoError(t, err)
+
+			w.WriteHeader(http.StatusCreated)
+			_, err = io.Copy(w, f)
+			require.NoError(t, err)
+		}
+	}
+
+	router.HandleFunc("/users/current/heartbeats.bulk", handler(&numCalls))
+	queuedRouter.HandleFunc("/users/current/heartbeats.bulk", handler(&numCallsQueued))
+
+	c := api.NewClient(url)
+
+	hh := testHeartbeats()
+	hh[1].APIURL = queuedURL
+
+	_, err := c.SendHeartbeats(context.Background(), hh)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, numCalls)
+	assert.Equal(t, 1, numCallsQueued)
+}
+
+func TestClient_SendHeartbeats_IdempotencyKey(t *testing.T) {
+	url, router, close := setupTestServer()
+	defer close()
+
+	var keys []string
+
+	router.HandleFunc("/users/current/heartbeats.bulk", func(w http.ResponseWriter, req *http.Request) {
+		keys = append(keys, req.Header.Get("Idempotency-Key"))
+
+		var body []struct {
+			ID string `json:"id"`
+		}
+
+		err := json.NewDecoder(req.Body).Decode(&body)
+		require.NoError(t, err)
+
+		require.NotEmpty(t, body)
+		assert.Equal(t, "01712d02-525c-798e-a1fb-2bf08490b8bc", body[0].ID)
+
+		// write response
+		f, err := os.Open("testdata/api_heartbeats_response.json")
+		require.NoError(t, err)
+
+		w.WriteHeader(http.StatusCreated)
+		_, err = io.Copy(w, f)
+		require.NoError(t, err)
+	})
+
+	hh := testHeartbeats()
+	hh[0].UUID = "01712d02-525c-798e-a1fb-2bf08490b8bc"
+	hh[1].UUID = "01712d02-5644-71af-a2ea-718b3c163a83"
+
+	c := api.NewClient(url)
+
+	// single heartbeat
+	_, err := c.SendHeartbeats(context.Background(), hh[:1])
+	require.NoError(t, err)
+
+	// bulk is resent after timeout
+	_, err = c.SendHeartbeats(context.Background(), hh)
+	require.NoError(t, err)
+
+	_, err = c.SendHeartbeats(context.Background(), hh)
+	require.NoError(t, err)
+
+	require.Len(t, keys, 3)
+	assert.Equal(t, "01712d02-525c-798e-a1fb-2bf08490b8bc", keys[0])
+	assert.Len(t, keys[1], 64)
+	assert.Equal(t, keys[1], keys[2])
+}
+
 func TestClient_SendHeartbeats_Timeout(t *testing.T) {
 	url, router, close := setupTestServer()
 	defer close()
@@ -284,6 +379,7 @@ func TestParseHeartbeatResponses(t *testing.T) {
 				Project:        heartbeat.PointerTo("wakatime-cli"),
 				Time:           1585598059,
 				UserAgent:      "wakatime/13.0.6",
+				UUID:           "845a922e-9e65-4775-bd68-bb3196d2e06a",
 			},
 		},
 		{
@@ -301,6 +397,7 @@ func TestParseHeartbeatResponses(t *testing.T) {
 				Project:        nil,
 				Time:           1585598060,
 				UserAgent:      "wakatime/13.0.7",
+				UUID:           "604bae69-a7fa-42ff-a38d-8354fd10e601",
 			},
 		},
 	})
@@ -2,6 +2,12 @@ package apikey
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 
 	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
 	"github.com/optiflow-os/tracelens-cli/pkg/log"
@@ -10,6 +16,9 @@ import (
 
 // Config contains apikey project detection configurations.
 type Config struct {
+	// APIURL is the url of the api heartbeats are sent to. Queued heartbeats
+	// only keep their api url, if it matches this one.
+	APIURL string
 	// DefaultAPIKey contains the default api key.
 	DefaultAPIKey string
 	// Patterns contains the overridden api key per path.
@@ -26,27 +35,152 @@ type MapPattern struct {
 
 // WithReplacing initializes and returns a heartbeat handle option, which
 // can be used in a heartbeat processing pipeline to replace default api key
-// for a heartbeat following the provided configurations.
+// for a heartbeat following the provided configurations. Heartbeats from the
+// offline queue get the api key they were queued with, resolved by its fingerprint,
+// as their entity might already be sanitized. Queued heartbeats, whose fingerprint
+// is not found in config or whose api url differs from the configured one, are
+// not sent but returned with a bad request result, so they are moved to the dead
+// letters instead of being sent to another account or api url.
 func WithReplacing(config Config) heartbeat.HandleOption {
 	return func(next heartbeat.Handle) heartbeat.Handle {
 		return func(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
 			logger := log.Extract(ctx)
 			logger.Debugln("execute api key replacing")
 
+			var (
+				rejected = make(map[int]heartbeat.Result)
+				send     []heartbeat.Heartbeat
+			)
+
 			for n, h := range hh {
-				result, ok := MatchPattern(ctx, h.Entity, config.MapPatterns)
-				if ok {
-					hh[n].APIKey = result
+				if err := ValidateRouting(h, config); err != nil {
+					logger.Warnf("queued heartbeat not sent: %s", err)
+
+					rejected[n] = heartbeat.Result{
+						Errors:    []string{err.Error()},
+						Status:    http.StatusBadRequest,
+						Heartbeat: h,
+					}
 
 					continue
 				}
 
-				hh[n].APIKey = config.DefaultAPIKey
+				hh[n].APIURL = config.APIURL
+				hh[n].APIKey = replaceAPIKey(ctx, h, config)
+
+				send = append(send, hh[n])
 			}
 
-			return next(ctx, hh)
+			if len(rejected) == 0 {
+				return next(ctx, hh)
+			}
+
+			var (
+				results []heartbeat.Result
+				err     error
+			)
+
+			if len(send) > 0 {
+				results, err = next(ctx, send)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			return mergeResults(len(hh), rejected, results), nil
+		}
+	}
+}
+
+// replaceAPIKey returns the api key a heartbeat is sent with. The api key of a
+// queued heartbeat is resolved by its fingerprint, otherwise the entity is
+// matched against the configured patterns.
+func replaceAPIKey(ctx context.Context, h heartbeat.Heartbeat, config Config) string {
+	if h.APIKeyFingerprint != "" {
+		if apiKey, ok := resolveFingerprint(h.APIKeyFingerprint, config); ok {
+			return apiKey
+		}
+	}
+
+	if apiKey, ok := MatchPattern(ctx, h.Entity, config.MapPatterns); ok {
+		return apiKey
+	}
+
+	return config.DefaultAPIKey
+}
+
+// mergeResults returns the results of the sent heartbeats with the results of
+// the rejected ones inserted at their original position.
+func mergeResults(n int, rejected map[int]heartbeat.Result, sent []heartbeat.Result) []heartbeat.Result {
+	results := make([]heartbeat.Result, 0, n)
+
+	var i int
+
+	for pos := range n {
+		if result, ok := rejected[pos]; ok {
+			results = append(results, result)
+
+			continue
+		}
+
+		if i < len(sent) {
+			results = append(results, sent[i])
+			i++
 		}
 	}
+
+	return append(results, sent[i:]...)
+}
+
+// Fingerprint returns the fingerprint of an api key, which is stored with
+// queued heartbeats instead of the api key itself. Returns an empty string for
+// an empty api key.
+func Fingerprint(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(apiKey))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateRouting returns an error, if the api key fingerprint or the api url
+// of a heartbeat read from an untrusted source, like an imported file, are not
+// found in config. Empty values are valid, as they are replaced by the
+// configured ones.
+func ValidateRouting(h heartbeat.Heartbeat, config Config) error {
+	if h.APIKeyFingerprint != "" {
+		if _, ok := resolveFingerprint(h.APIKeyFingerprint, config); !ok {
+			return errors.New("api key fingerprint not found in config")
+		}
+	}
+
+	if h.APIURL != "" && !sameURL(h.APIURL, config.APIURL) {
+		return fmt.Errorf("api url %q not found in config", h.APIURL)
+	}
+
+	return nil
+}
+
+// resolveFingerprint returns the configured api key matching the fingerprint.
+func resolveFingerprint(fingerprint string, config Config) (string, bool) {
+	if Fingerprint(config.DefaultAPIKey) == fingerprint {
+		return config.DefaultAPIKey, true
+	}
+
+	for _, pattern := range config.MapPatterns {
+		if Fingerprint(pattern.APIKey) == fingerprint {
+			return pattern.APIKey, true
+		}
+	}
+
+	return "", false
+}
+
+// sameURL returns true, if both api urls are equal, ignoring a trailing slash.
+func sameURL(a, b string) bool {
+	return strings.TrimSuffix(a, "/") == strings.TrimSuffix(b, "/")
 }
 
 // MatchPattern matches regex against entity's path to find alternate api key.
@@ -67,6 +67,246 @@ func TestWithReplacing(t *testing.T) {
 	}, result)
 }
 
+func TestWithReplacing_Fingerprint(t *testing.T) {
+	config := apikey.Config{
+		APIURL:        "https://example.org/api/v1",
+		DefaultAPIKey: "00000000-0000-4000-8000-000000000000",
+		MapPatterns: []apikey.MapPattern{
+			{
+				APIKey: "00000000-0000-4000-8000-000000000001",
+				Regex:  regex.NewRegexpWrap(regexp.MustCompile(`.workdir.`)),
+			},
+		},
+	}
+
+	opt := apikey.WithReplacing(config)
+	h := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		assert.Equal(t, []heartbeat.Heartbeat{
+			{
+				APIKey:            "00000000-0000-4000-8000-000000000001",
+				APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000001"),
+				APIURL:            "https://example.org/api/v1",
+				Entity:            "HIDDEN.go",
+			},
+			{
+				APIKey:            "00000000-0000-4000-8000-000000000000",
+				APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000000"),
+				APIURL:            "https://example.org/api/v1",
+				Entity:            "HIDDEN.go",
+			},
+		}, hh)
+
+		return []heartbeat.Result{}, nil
+	})
+
+	_, err := h(context.Background(), []heartbeat.Heartbeat{
+		{
+			APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000001"),
+			APIURL:            "https://example.org/api/v1/",
+			Entity:            "HIDDEN.go",
+		},
+		{
+			APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000000"),
+			Entity:            "HIDDEN.go",
+		},
+	})
+	require.NoError(t, err)
+}
+
+func TestWithReplacing_UnresolvableFingerprint(t *testing.T) {
+	config := apikey.Config{
+		APIURL:        "https://example.org/api/v1",
+		DefaultAPIKey: "00000000-0000-4000-8000-000000000000",
+		MapPatterns: []apikey.MapPattern{
+			{
+				APIKey: "00000000-0000-4000-8000-000000000001",
+				Regex:  regex.NewRegexpWrap(regexp.MustCompile(`.workdir.`)),
+			},
+		},
+	}
+
+	removed := heartbeat.Heartbeat{
+		// api key was removed from config
+		APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000002"),
+		Entity:            "/workdir/main.go",
+	}
+
+	opt := apikey.WithReplacing(config)
+	h := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		// the heartbeat is never sent with the api key matching its entity
+		assert.Equal(t, []heartbeat.Heartbeat{
+			{
+				APIKey:            "00000000-0000-4000-8000-000000000000",
+				APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000000"),
+				APIURL:            "https://example.org/api/v1",
+				Entity:            "/tmp/main.go",
+			},
+		}, hh)
+
+		return []heartbeat.Result{
+			{
+				Status: 201,
+			},
+		}, nil
+	})
+
+	results, err := h(context.Background(), []heartbeat.Heartbeat{
+		removed,
+		{
+			APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000000"),
+			Entity:            "/tmp/main.go",
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []heartbeat.Result{
+		{
+			Errors:    []string{"api key fingerprint not found in config"},
+			Status:    400,
+			Heartbeat: removed,
+		},
+		{
+			Status: 201,
+		},
+	}, results)
+}
+
+func TestWithReplacing_UnresolvableFingerprint_NothingToSend(t *testing.T) {
+	config := apikey.Config{
+		APIURL:        "https://example.org/api/v1",
+		DefaultAPIKey: "00000000-0000-4000-8000-000000000000",
+	}
+
+	removed := heartbeat.Heartbeat{
+		APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000002"),
+		Entity:            "/tmp/main.go",
+	}
+
+	opt := apikey.WithReplacing(config)
+	h := opt(func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		require.FailNow(t, "no heartbeat expected to be sent")
+
+		return nil, nil
+	})
+
+	results, err := h(context.Background(), []heartbeat.Heartbeat{removed})
+	require.NoError(t, err)
+
+	assert.Equal(t, []heartbeat.Result{
+		{
+			Errors:    []string{"api key fingerprint not found in config"},
+			Status:    400,
+			Heartbeat: removed,
+		},
+	}, results)
+}
+
+func TestWithReplacing_ForeignAPIURL(t *testing.T) {
+	config := apikey.Config{
+		APIURL:        "https://example.org/api/v1",
+		DefaultAPIKey: "00000000-0000-4000-8000-000000000000",
+	}
+
+	foreign := heartbeat.Heartbeat{
+		APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000000"),
+		APIURL:            "https://attacker.example.com/api/v1",
+		Entity:            "/tmp/main.go",
+	}
+
+	opt := apikey.WithReplacing(config)
+	h := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		// the api key is never sent to an api url other than the configured one
+		assert.Equal(t, []heartbeat.Heartbeat{
+			{
+				APIKey:            "00000000-0000-4000-8000-000000000000",
+				APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000000"),
+				APIURL:            "https://example.org/api/v1",
+				Entity:            "/tmp/main.go",
+			},
+		}, hh)
+
+		return []heartbeat.Result{
+			{
+				Status: 201,
+			},
+		}, nil
+	})
+
+	results, err := h(context.Background(), []heartbeat.Heartbeat{
+		{
+			APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000000"),
+			APIURL:            "https://example.org/api/v1",
+			Entity:            "/tmp/main.go",
+		},
+		foreign,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []heartbeat.Result{
+		{
+			Status: 201,
+		},
+		{
+			Errors:    []string{`api url "https://attacker.example.com/api/v1" not found in config`},
+			Status:    400,
+			Heartbeat: foreign,
+		},
+	}, results)
+}
+
+func TestValidateRouting(t *testing.T) {
+	config := apikey.Config{
+		APIURL:        "https://example.org/api/v1",
+		DefaultAPIKey: "00000000-0000-4000-8000-000000000000",
+	}
+
+	tests := map[string]struct {
+		Heartbeat heartbeat.Heartbeat
+		Error     string
+	}{
+		"empty": {},
+		"configured": {
+			Heartbeat: heartbeat.Heartbeat{
+				APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000000"),
+				APIURL:            "https://example.org/api/v1/",
+			},
+		},
+		"unknown fingerprint": {
+			Heartbeat: heartbeat.Heartbeat{
+				APIKeyFingerprint: apikey.Fingerprint("unknown"),
+			},
+			Error: "api key fingerprint not found in config",
+		},
+		"foreign api url": {
+			Heartbeat: heartbeat.Heartbeat{
+				APIURL: "https://attacker.example.com/api/v1",
+			},
+			Error: `api url "https://attacker.example.com/api/v1" not found in config`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := apikey.ValidateRouting(test.Heartbeat, config)
+			if test.Error == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			assert.EqualError(t, err, test.Error)
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	assert.Equal(
+		t,
+		"db8055e0e0307d5a016bec4dc338d69875eb0fb7e614a8b125b08fb082095d98",
+		apikey.Fingerprint("00000000-0000-4000-8000-000000000000"),
+	)
+	assert.Empty(t, apikey.Fingerprint(""))
+}
+
 func TestApiKey_MatchPattern(t *testing.T) {
 	wd, err := os.Getwd()
 	require.NoError(t, err)
@@ -53,12 +53,22 @@ func WithBackoff(config Config) heartbeat.HandleOption {
 			}
 
 			results, err := next(ctx, hh)
+
+			// the api rejecting heartbeats as invalid is not a reason to backoff
+			var errbadrequest api.ErrBadRequest
+			if errors.As(err, &errbadrequest) {
+				return nil, err
+			}
+
 			if err != nil {
 				// error response, increment backoff
 				if updateErr := updateBackoffSettings(ctx, config.V, config.Retries+1, time.Now()); updateErr != nil {
 					logger.Warnf("failed to update backoff settings: %s", updateErr)
 				}
 
+				// keep state for handles used more than once, e.g. by the daemon
+				config.Retries, config.At = config.Retries+1, time.Now()
+
 				return nil, err
 			}
 
@@ -67,6 +77,8 @@ func WithBackoff(config Config) heartbeat.HandleOption {
 				if resetErr := updateBackoffSettings(ctx, config.V, 0, time.Time{}); resetErr != nil {
 					logger.Warnf("failed to reset backoff settings: %s", resetErr)
 				}
+
+				config.Retries, config.At = 0, time.Time{}
 			}
 
 			return results, nil
@@ -74,6 +86,26 @@ func WithBackoff(config Config) heartbeat.HandleOption {
 	}
 }
 
+// Until returns the time until which heartbeats are not sent to the api due
+// to the backoff state, or the zero time if no backoff applies.
+func Until(retries int, at time.Time) time.Time {
+	if retries < 1 || at.IsZero() {
+		return time.Time{}
+	}
+
+	backoffSeconds := float64(factor) * math.Pow(2, float64(retries))
+	if backoffSeconds > maxBackoffSecs {
+		return time.Time{}
+	}
+
+	until := at.Add(time.Duration(backoffSeconds) * time.Second)
+	if until.Before(time.Now()) {
+		return time.Time{}
+	}
+
+	return until
+}
+
 // shouldBackoff returns true if we should save heartbeats directly to offline
 // database and skip sending to API due to rate limiting from too many recent
 // networking errors.
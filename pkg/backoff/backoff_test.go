@@ -169,6 +169,79 @@ func TestWithBackoff_ApiError(t *testing.T) {
 	assert.Equal(t, "1", v.GetString("internal.backoff_retries"))
 }
 
+func TestWithBackoff_BadRequest(t *testing.T) {
+	v := setupViper(t)
+
+	tmpFile, err := os.CreateTemp(t.TempDir(), "wakatime")
+	require.NoError(t, err)
+
+	defer tmpFile.Close()
+
+	v.Set("internal-config", tmpFile.Name())
+
+	opt := backoff.WithBackoff(backoff.Config{
+		V: v,
+	})
+
+	var numCalls int
+
+	handle := opt(func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		numCalls++
+
+		return nil, api.ErrBadRequest{Err: errors.New("bad request")}
+	})
+
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{})
+	require.Error(t, err)
+
+	// rejected heartbeats don't trigger a backoff
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{})
+	require.Error(t, err)
+
+	var errbadrequest api.ErrBadRequest
+
+	assert.ErrorAs(t, err, &errbadrequest)
+	assert.Equal(t, 2, numCalls)
+	assert.Empty(t, v.GetString("internal.backoff_at"))
+}
+
+func TestWithBackoff_ReusedHandle(t *testing.T) {
+	v := setupViper(t)
+
+	tmpFile, err := os.CreateTemp(t.TempDir(), "wakatime")
+	require.NoError(t, err)
+
+	defer tmpFile.Close()
+
+	v.Set("internal-config", tmpFile.Name())
+
+	opt := backoff.WithBackoff(backoff.Config{
+		V: v,
+	})
+
+	var numCalls int
+
+	handle := opt(func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		numCalls++
+
+		return []heartbeat.Result{}, errors.New("error")
+	})
+
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{})
+	require.Error(t, err)
+
+	assert.Equal(t, "error", err.Error())
+
+	// second call with the same handle is in backoff
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{})
+	require.Error(t, err)
+
+	var errbackoff api.ErrBackoff
+
+	assert.ErrorAs(t, err, &errbackoff)
+	assert.Equal(t, 1, numCalls)
+}
+
 func TestWithBackoff_BackoffAndNotReset(t *testing.T) {
 	tmpFile, err := os.CreateTemp(t.TempDir(), "wakatime")
 	require.NoError(t, err)
@@ -390,3 +463,39 @@ func setupViper(t *testing.T) *viper.Viper {
 
 	return v
 }
+
+func TestUntil(t *testing.T) {
+	at := time.Now().Add(-10 * time.Second)
+
+	tests := map[string]struct {
+		Retries  int
+		At       time.Time
+		Expected time.Time
+	}{
+		"no retries": {
+			At: at,
+		},
+		"zero time": {
+			Retries: 1,
+		},
+		"backing off": {
+			Retries:  2,
+			At:       at,
+			Expected: at.Add(60 * time.Second),
+		},
+		"expired": {
+			Retries: 1,
+			At:      time.Now().Add(-time.Minute),
+		},
+		"max reached": {
+			Retries: 8,
+			At:      at,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Expected, backoff.Until(test.Retries, test.At))
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package category
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+	"github.com/optiflow-os/tracelens-cli/pkg/regex"
+)
+
+// globPrefix marks a pattern as glob instead of regex.
+const globPrefix = "glob:"
+
+// Rule maps file paths matching a pattern to a category.
+type Rule struct {
+	Category heartbeat.Category
+	Pattern  regex.Regex
+}
+
+// Config defines category detection options.
+type Config struct {
+	// Rules are checked in order before the default rules. The first matching
+	// rule wins. They are matched against the absolute file path.
+	Rules []Rule
+}
+
+// defaultRules are the shipped rules for common test and docs conventions.
+// nolint:gochecknoglobals
+var defaultRules = []struct {
+	Category heartbeat.Category
+	Pattern  string
+}{
+	// tests
+	{heartbeat.WritingTestsCategory, `_test\.(go|py|rb|exs|dart|c|cc|cpp)$`},
+	{heartbeat.WritingTestsCategory, `(^|/)test_[^/]+\.py$`},
+	{heartbeat.WritingTestsCategory, `\.(test|spec)\.[cm]?[jt]sx?$`},
+	{heartbeat.WritingTestsCategory, `_spec\.rb$`},
+	{heartbeat.WritingTestsCategory, `[a-z0-9]Tests?\.(java|kt|scala|groovy|cs|swift|php)$`},
+	{heartbeat.WritingTestsCategory, `(^|/)(__tests__|tests?|spec)/`},
+	{heartbeat.WritingTestsCategory, `(^|/)src/test/`},
+	// docs
+	{heartbeat.WritingDocsCategory, `(?i)\.(md|mdx|markdown|rst|adoc|asciidoc)$`},
+	{heartbeat.WritingDocsCategory, `(?i)(^|/)docs?/`},
+	{heartbeat.WritingDocsCategory, `(?i)(^|/)(readme|changelog|contributing)(\.[^/]*)?$`},
+}
+
+// DefaultRules returns the shipped rules for common test and docs conventions.
+func DefaultRules() []Rule {
+	rules := make([]Rule, 0, len(defaultRules))
+
+	for _, r := range defaultRules {
+		rules = append(rules, Rule{
+			Category: r.Category,
+			Pattern:  regex.MustCompile(r.Pattern),
+		})
+	}
+
+	return rules
+}
+
+// WithDetection initializes and returns a heartbeat handle option, which
+// can be used in a heartbeat processing pipeline to detect the category of
+// heartbeats of entity type 'file' from their path. Categories set explicitly
+// are never changed. The default rules are matched against the path relative
+// to the project folder, so folders above it, like ~/docs, don't match. Must
+// run after project detection.
+func WithDetection(config Config) heartbeat.HandleOption {
+	rules := DefaultRules()
+
+	return func(next heartbeat.Handle) heartbeat.Handle {
+		return func(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			logger := log.Extract(ctx)
+			logger.Debugln("execute category detection")
+
+			for n, h := range hh {
+				if h.EntityType != heartbeat.FileType || h.CategoryExplicit {
+					continue
+				}
+
+				category, ok := Detect(ctx, h.Entity, config.Rules)
+				if !ok {
+					category, ok = Detect(ctx, projectRelativePath(h), rules)
+				}
+
+				if !ok {
+					continue
+				}
+
+				logger.Debugf("detected category %q for file entity %q", category, h.Entity)
+
+				hh[n].Category = category
+			}
+
+			return next(ctx, hh)
+		}
+	}
+}
+
+// Detect returns the category of the first rule matching the file path.
+func Detect(ctx context.Context, fp string, rules []Rule) (heartbeat.Category, bool) {
+	// windows paths are matched with forward slashes, too
+	fp = strings.ReplaceAll(fp, `\`, "/")
+
+	for _, r := range rules {
+		if r.Pattern.MatchString(ctx, fp) {
+			return r.Category, true
+		}
+	}
+
+	return heartbeat.CodingCategory, false
+}
+
+// projectRelativePath returns the path of the file entity relative to its
+// project folder. Without project folder, only the file name is returned.
+func projectRelativePath(h heartbeat.Heartbeat) string {
+	if h.ProjectPath != "" {
+		rel, err := filepath.Rel(h.ProjectPath, h.Entity)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel
+		}
+	}
+
+	return filepath.Base(h.Entity)
+}
+
+// CompilePattern compiles a config pattern case insensitive. Patterns prefixed
+// with "glob:" or starting with "*" are globs, all others are regex.
+func CompilePattern(pattern string) (regex.Regex, error) {
+	if glob, ok := strings.CutPrefix(pattern, globPrefix); ok {
+		pattern = globToRegex(strings.TrimSpace(glob))
+	} else if strings.HasPrefix(pattern, "*") {
+		pattern = globToRegex(pattern)
+	}
+
+	// make all regex case insensitive
+	if !strings.HasPrefix(pattern, "(?i)") {
+		pattern = "(?i)" + pattern
+	}
+
+	return regex.Compile(pattern)
+}
+
+// globToRegex converts a glob into a regex matching the end of a path. Globs
+// without a slash match the file name. "**" matches across folders.
+func globToRegex(glob string) string {
+	var b strings.Builder
+
+	b.WriteString("(^|/)")
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+
+				continue
+			}
+
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	// globs ending with a slash match folders
+	if !strings.HasSuffix(glob, "/") {
+		b.WriteString("$")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,175 @@
+package category_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/category"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDetection(t *testing.T) {
+	pattern, err := category.CompilePattern("^/home/user/notes/")
+	require.NoError(t, err)
+
+	opt := category.WithDetection(category.Config{
+		Rules: []category.Rule{
+			{Category: heartbeat.PlanningCategory, Pattern: pattern},
+		},
+	})
+
+	h := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		assert.Equal(t, []heartbeat.Heartbeat{
+			{Entity: "/home/user/project/main_test.go", Category: heartbeat.WritingTestsCategory},
+			{Entity: "/home/user/notes/README.md", Category: heartbeat.PlanningCategory},
+			{Entity: "/home/user/project/main.go", Category: heartbeat.CodingCategory},
+			{
+				Entity:           "/home/user/project/docs/index.md",
+				Category:         heartbeat.CodingCategory,
+				CategoryExplicit: true,
+			},
+			{Entity: "docs.example.org", EntityType: heartbeat.DomainType, Category: heartbeat.BrowsingCategory},
+		}, hh)
+
+		return nil, nil
+	})
+
+	_, err = h(context.Background(), []heartbeat.Heartbeat{
+		{Entity: "/home/user/project/main_test.go"},
+		{Entity: "/home/user/notes/README.md"},
+		{Entity: "/home/user/project/main.go"},
+		{Entity: "/home/user/project/docs/index.md", CategoryExplicit: true},
+		{Entity: "docs.example.org", EntityType: heartbeat.DomainType, Category: heartbeat.BrowsingCategory},
+	})
+	require.NoError(t, err)
+}
+
+func TestWithDetection_AncestorFolders(t *testing.T) {
+	opt := category.WithDetection(category.Config{})
+
+	h := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		assert.Equal(t, []heartbeat.Category{
+			heartbeat.CodingCategory,
+			heartbeat.CodingCategory,
+			heartbeat.WritingDocsCategory,
+			heartbeat.WritingTestsCategory,
+			heartbeat.CodingCategory,
+		}, []heartbeat.Category{hh[0].Category, hh[1].Category, hh[2].Category, hh[3].Category, hh[4].Category})
+
+		return nil, nil
+	})
+
+	_, err := h(context.Background(), []heartbeat.Heartbeat{
+		{Entity: "/home/user/docs/project/main.go", ProjectPath: "/home/user/docs/project"},
+		{Entity: "/home/user/test/project/src/main.go", ProjectPath: "/home/user/test/project"},
+		{Entity: "/home/user/test/project/docs/index.html", ProjectPath: "/home/user/test/project"},
+		{Entity: "/home/user/docs/project/tests/fixture.json", ProjectPath: "/home/user/docs/project"},
+		// without project folder only the file name is matched
+		{Entity: "/home/user/docs/notes.txt"},
+	})
+	require.NoError(t, err)
+}
+
+func TestDetect_DefaultRules(t *testing.T) {
+	tests := map[string]heartbeat.Category{
+		"/src/project/handler_test.go":                     heartbeat.WritingTestsCategory,
+		"/src/project/test_handler.py":                     heartbeat.WritingTestsCategory,
+		"/src/project/handler_test.py":                     heartbeat.WritingTestsCategory,
+		"/src/project/handler.test.ts":                     heartbeat.WritingTestsCategory,
+		"/src/project/handler.spec.jsx":                    heartbeat.WritingTestsCategory,
+		"/src/project/handler_spec.rb":                     heartbeat.WritingTestsCategory,
+		"/src/project/HandlerTest.java":                    heartbeat.WritingTestsCategory,
+		"/src/project/HandlerTests.cs":                     heartbeat.WritingTestsCategory,
+		"/src/project/__tests__/handler.js":                heartbeat.WritingTestsCategory,
+		"/src/project/tests/integration.rs":                heartbeat.WritingTestsCategory,
+		"/src/project/src/test/java/org/example/Util.java": heartbeat.WritingTestsCategory,
+		"/src/project/README.md":                           heartbeat.WritingDocsCategory,
+		"/src/project/docs/index.html":                     heartbeat.WritingDocsCategory,
+		"/src/project/guide.rst":                           heartbeat.WritingDocsCategory,
+		"/src/project/CHANGELOG":                           heartbeat.WritingDocsCategory,
+		"C:\\src\\project\\docs\\index.html":               heartbeat.WritingDocsCategory,
+	}
+
+	for fp, expected := range tests {
+		t.Run(fp, func(t *testing.T) {
+			detected, ok := category.Detect(context.Background(), fp, category.DefaultRules())
+			require.True(t, ok)
+
+			assert.Equal(t, expected, detected)
+		})
+	}
+}
+
+func TestDetect_NoMatch(t *testing.T) {
+	for _, fp := range []string{
+		"/src/project/main.go",
+		"/src/project/Latest.java",
+		"/src/project/contest/solution.py",
+		"/src/project/requirements.txt",
+	} {
+		t.Run(fp, func(t *testing.T) {
+			detected, ok := category.Detect(context.Background(), fp, category.DefaultRules())
+			require.False(t, ok)
+
+			assert.Equal(t, heartbeat.CodingCategory, detected)
+		})
+	}
+}
+
+func TestCompilePattern(t *testing.T) {
+	tests := map[string]struct {
+		Pattern string
+		Match   []string
+		NoMatch []string
+	}{
+		"regex": {
+			Pattern: `_test\.go$`,
+			Match:   []string{"/src/main_test.go", "/src/MAIN_TEST.GO"},
+			NoMatch: []string{"/src/main.go"},
+		},
+		"glob file name": {
+			Pattern: "*.md",
+			Match:   []string{"/src/README.md", "README.md"},
+			NoMatch: []string{"/src/README.mdx", "/src/md/main.go"},
+		},
+		"glob prefix": {
+			Pattern: "glob: docs/*.html",
+			Match:   []string{"/src/docs/index.html"},
+			NoMatch: []string{"/src/docs/api/index.html", "/src/mydocs/index.html"},
+		},
+		"glob across folders": {
+			Pattern: "glob:spec/**/*.rb",
+			Match:   []string{"/src/spec/models/user.rb"},
+			NoMatch: []string{"/src/lib/models/user.rb"},
+		},
+		"glob folder": {
+			Pattern: "glob:fixtures/",
+			Match:   []string{"/src/fixtures/data.json"},
+			NoMatch: []string{"/src/testfixtures/data.json"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			compiled, err := category.CompilePattern(test.Pattern)
+			require.NoError(t, err)
+
+			for _, fp := range test.Match {
+				assert.True(t, compiled.MatchString(context.Background(), fp), fp)
+			}
+
+			for _, fp := range test.NoMatch {
+				assert.False(t, compiled.MatchString(context.Background(), fp), fp)
+			}
+		})
+	}
+}
+
+func TestCompilePattern_Invalid(t *testing.T) {
+	_, err := category.CompilePattern("invalid(")
+
+	assert.ErrorContains(t, err, `failed to compile regex "(?i)invalid("`)
+}
@@ -0,0 +1,81 @@
+package category
+
+import (
+	"context"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/regex"
+)
+
+// defaultCommandRules are the shipped rules for common build, test and debug
+// commands. Tests are checked first, so `make test` isn't building.
+// nolint:gochecknoglobals
+var defaultCommandRules = []struct {
+	Category heartbeat.Category
+	Pattern  string
+}{
+	// running tests
+	{heartbeat.RunningTestsCategory, `^(go|cargo|dotnet|mix|flutter|dart|deno|swift) test\b`},
+	{heartbeat.RunningTestsCategory, `^(npm|yarn|pnpm|bun) (run )?test\b`},
+	{heartbeat.RunningTestsCategory, `^(make|gradle|gradlew|mvn|bazel) (.* )?(test|check|verify)\b`},
+	{heartbeat.RunningTestsCategory, `^(pytest|tox|nox|jest|vitest|mocha|rspec|phpunit|ctest)\b`},
+	{heartbeat.RunningTestsCategory, `^python3? -m (pytest|unittest)\b`},
+	// debugging
+	{heartbeat.DebuggingCategory, `^(dlv|gdb|lldb|pdb|rdbg|valgrind|strace|ltrace)\b`},
+	{heartbeat.DebuggingCategory, `^python3? -m pdb\b`},
+	// building
+	{heartbeat.BuildingCategory, `^(make|cmake|ninja|meson|bazel|gradle|gradlew|mvn|ant|msbuild|xcodebuild)\b`},
+	{heartbeat.BuildingCategory, `^(go|cargo|dotnet|swift|zig) build\b`},
+	{heartbeat.BuildingCategory, `^(npm|yarn|pnpm|bun) (run )?build\b`},
+	{heartbeat.BuildingCategory, `^(docker|podman) (buildx )?build\b`},
+}
+
+// DefaultCommandRules returns the shipped rules for common build, test and debug commands.
+func DefaultCommandRules() []Rule {
+	rules := make([]Rule, 0, len(defaultCommandRules))
+
+	for _, r := range defaultCommandRules {
+		rules = append(rules, Rule{
+			Category: r.Category,
+			Pattern:  regex.MustCompile(r.Pattern),
+		})
+	}
+
+	return rules
+}
+
+// DetectCommand returns the category of the first rule matching the command
+// line. Rules are checked before the default rules. Environment variable
+// assignments, sudo and the path of the executable are ignored.
+func DetectCommand(ctx context.Context, command string, rules []Rule) (heartbeat.Category, bool) {
+	command = NormalizeCommand(command)
+
+	for _, rr := range [][]Rule{rules, DefaultCommandRules()} {
+		for _, r := range rr {
+			if r.Pattern.MatchString(ctx, command) {
+				return r.Category, true
+			}
+		}
+	}
+
+	return heartbeat.CodingCategory, false
+}
+
+// Executable returns the executable name of a command line.
+func Executable(command string) string {
+	exe, _, _ := strings.Cut(NormalizeCommand(command), " ")
+	return exe
+}
+
+// NormalizeCommand strips leading environment variable assignments, sudo and
+// env from a command line, reduces the executable to its name and collapses
+// whitespace. It splits the command line like heartbeat.SplitCommand.
+func NormalizeCommand(command string) string {
+	exe, args := heartbeat.SplitCommand(command)
+	if exe == "" {
+		return ""
+	}
+
+	return heartbeat.JoinCommand(exe, args)
+}
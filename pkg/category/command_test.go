@@ -0,0 +1,83 @@
+package category_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/category"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/regex"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectCommand_DefaultRules(t *testing.T) {
+	tests := map[string]heartbeat.Category{
+		"go test ./...":                heartbeat.RunningTestsCategory,
+		"make -j4 test":                heartbeat.RunningTestsCategory,
+		"npm run test -- --watch":      heartbeat.RunningTestsCategory,
+		"CI=1 /usr/local/bin/pytest":   heartbeat.RunningTestsCategory,
+		"python3 -m pytest tests/":     heartbeat.RunningTestsCategory,
+		"dlv debug ./cmd/server":       heartbeat.DebuggingCategory,
+		"sudo gdb -p 42":               heartbeat.DebuggingCategory,
+		"make":                         heartbeat.BuildingCategory,
+		"make testdata":                heartbeat.BuildingCategory,
+		"go build -o bin/app .":        heartbeat.BuildingCategory,
+		"docker buildx build -t app .": heartbeat.BuildingCategory,
+	}
+
+	for command, expected := range tests {
+		t.Run(command, func(t *testing.T) {
+			detected, ok := category.DetectCommand(context.Background(), command, nil)
+			require.True(t, ok)
+
+			assert.Equal(t, expected, detected)
+		})
+	}
+}
+
+func TestDetectCommand_Rules(t *testing.T) {
+	rules := []category.Rule{
+		{Category: heartbeat.ManualTestingCategory, Pattern: regex.MustCompile(`(?i)^make e2e\b`)},
+	}
+
+	detected, ok := category.DetectCommand(context.Background(), "make e2e", rules)
+	require.True(t, ok)
+
+	assert.Equal(t, heartbeat.ManualTestingCategory, detected)
+}
+
+func TestDetectCommand_NoMatch(t *testing.T) {
+	for _, command := range []string{"ls -la", "git status", "gotest", ""} {
+		t.Run(command, func(t *testing.T) {
+			detected, ok := category.DetectCommand(context.Background(), command, nil)
+			require.False(t, ok)
+
+			assert.Equal(t, heartbeat.CodingCategory, detected)
+		})
+	}
+}
+
+func TestNormalizeCommand(t *testing.T) {
+	tests := map[string]string{
+		"go  test ./...":                    "go test ./...",
+		"GOOS=linux CGO_ENABLED=0 go build": "go build",
+		"sudo env PATH=/bin /usr/bin/make":  "make",
+		`TOKEN="a b" go test -run 'A B'`:    "go test -run 'A B'",
+		`C:\tools\ninja.exe -C out`:         "ninja.exe -C out",
+		"=x ls":                             "=x ls",
+		"   ":                               "",
+	}
+
+	for command, expected := range tests {
+		t.Run(command, func(t *testing.T) {
+			assert.Equal(t, expected, category.NormalizeCommand(command))
+		})
+	}
+}
+
+func TestExecutable(t *testing.T) {
+	assert.Equal(t, "go", category.Executable("GOFLAGS=-v /usr/local/go/bin/go test ./..."))
+	assert.Empty(t, category.Executable(""))
+}
@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+)
+
+// dialTimeout is the maximum duration for connecting to the daemon.
+const dialTimeout = time.Second
+
+// Send sends heartbeats to the daemon listening on the unix socket at filepath
+// and waits up to timeout for the results. Returns ErrNotRunning if no daemon
+// is listening and ErrConfigMismatch if the daemon runs with a different
+// configuration. In both cases the heartbeats were not processed and have to
+// be handled by the caller.
+func Send(
+	ctx context.Context,
+	filepath string,
+	fingerprint string,
+	hh []heartbeat.Heartbeat,
+	timeout time.Duration,
+) ([]heartbeat.Result, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+
+	conn, err := dialer.DialContext(ctx, "unix", filepath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotRunning, err)
+	}
+
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %s", err)
+	}
+
+	req := Request{
+		Fingerprint: fingerprint,
+		Heartbeats:  make([]Heartbeat, 0, len(hh)),
+	}
+
+	for _, h := range hh {
+		req.Heartbeats = append(req.Heartbeats, newHeartbeat(h))
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send request: %s", err)
+	}
+
+	var resp Response
+
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %s", err)
+	}
+
+	switch resp.Status {
+	case StatusOK:
+	case StatusConfigMismatch:
+		return nil, ErrConfigMismatch
+	case StatusFailed:
+		return nil, Err{Code: resp.ExitCode, Msg: resp.Error}
+	default:
+		return nil, fmt.Errorf("invalid response status %q", resp.Status)
+	}
+
+	results := make([]heartbeat.Result, 0, len(resp.Results))
+	for _, r := range resp.Results {
+		results = append(results, heartbeat.Result{
+			Errors: r.Errors,
+			Status: r.Status,
+		})
+	}
+
+	return results, nil
+}
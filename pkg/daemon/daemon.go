@@ -0,0 +1,178 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/ini"
+	"github.com/optiflow-os/tracelens-cli/pkg/vipertools"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/viper"
+)
+
+// socketFilename is the default unix socket filename.
+const socketFilename = "tracelens.sock"
+
+// Status is the status of a request handled by the daemon.
+type Status string
+
+const (
+	// StatusOK means the heartbeats were processed by the daemon.
+	StatusOK Status = "ok"
+	// StatusConfigMismatch means the heartbeats were rejected without processing,
+	// because the daemon runs with a different configuration than the client.
+	StatusConfigMismatch Status = "config_mismatch"
+	// StatusFailed means processing the heartbeats failed.
+	StatusFailed Status = "failed"
+)
+
+type (
+	// Request is a request sent to the daemon.
+	Request struct {
+		// Fingerprint identifies the configuration the client expects the
+		// heartbeats to be processed with.
+		Fingerprint string      `json:"fingerprint"`
+		Heartbeats  []Heartbeat `json:"heartbeats"`
+	}
+
+	// Response is the response of the daemon to a request.
+	Response struct {
+		Status   Status   `json:"status"`
+		ExitCode int      `json:"exit_code,omitempty"`
+		Error    string   `json:"error,omitempty"`
+		Results  []Result `json:"results,omitempty"`
+	}
+
+	// Result is the result of sending a single heartbeat to the api.
+	Result struct {
+		Errors []string `json:"errors,omitempty"`
+		Status int      `json:"status"`
+	}
+
+	// Heartbeat is the representation of a heartbeat on the socket. Contrary to
+	// the api representation, it includes fields only used during processing.
+	Heartbeat struct {
+		AILineChanges        *int                 `json:"ai_line_changes,omitempty"`
+		AITool               string               `json:"ai_tool,omitempty"`
+		BranchAlternate      string               `json:"alternate_branch,omitempty"`
+		Category             heartbeat.Category   `json:"category"`
+		CategoryExplicit     bool                 `json:"category_explicit,omitempty"`
+		CursorPosition       *int                 `json:"cursorpos,omitempty"`
+		Cwd                  string               `json:"cwd,omitempty"`
+		Entity               string               `json:"entity"`
+		EntityType           heartbeat.EntityType `json:"type"`
+		HumanLineChanges     *int                 `json:"human_line_changes,omitempty"`
+		IsUnsavedEntity      bool                 `json:"is_unsaved_entity,omitempty"`
+		IsWrite              *bool                `json:"is_write,omitempty"`
+		Language             *string              `json:"language,omitempty"`
+		LanguageAlternate    string               `json:"alternate_language,omitempty"`
+		LineAdditions        *int                 `json:"line_additions,omitempty"`
+		LineDeletions        *int                 `json:"line_deletions,omitempty"`
+		LineNumber           *int                 `json:"lineno,omitempty"`
+		Lines                *int                 `json:"lines,omitempty"`
+		LocalFile            string               `json:"local_file,omitempty"`
+		ProjectAlternate     string               `json:"alternate_project,omitempty"`
+		ProjectFromGitRemote bool                 `json:"project_from_git_remote,omitempty"`
+		ProjectOverride      string               `json:"project,omitempty"`
+		ProjectPathOverride  string               `json:"project_folder,omitempty"`
+		Time                 float64              `json:"time"`
+		UserAgent            string               `json:"user_agent"`
+		UUID                 string               `json:"id,omitempty"`
+	}
+)
+
+// SocketFilepath returns the path for the daemon's unix socket. If
+// the resource directory cannot be detected, it defaults to the
+// current directory.
+func SocketFilepath(ctx context.Context, v *viper.Viper) (string, error) {
+	paramFile := vipertools.GetString(v, "daemon-socket")
+	if paramFile != "" {
+		p, err := homedir.Expand(paramFile)
+		if err != nil {
+			return "", fmt.Errorf("failed expanding daemon-socket param: %s", err)
+		}
+
+		return p, nil
+	}
+
+	folder, err := ini.WakaResourcesDir(ctx)
+	if err != nil {
+		return socketFilename, fmt.Errorf("failed getting resource directory, defaulting to current directory: %s", err)
+	}
+
+	return filepath.Join(folder, socketFilename), nil
+}
+
+// newHeartbeat converts a heartbeat into its socket representation.
+func newHeartbeat(h heartbeat.Heartbeat) Heartbeat {
+	return Heartbeat{
+		AILineChanges:        h.AILineChanges,
+		AITool:               h.AITool,
+		BranchAlternate:      h.BranchAlternate,
+		Category:             h.Category,
+		CategoryExplicit:     h.CategoryExplicit,
+		CursorPosition:       h.CursorPosition,
+		Cwd:                  h.Cwd,
+		Entity:               h.Entity,
+		EntityType:           h.EntityType,
+		HumanLineChanges:     h.HumanLineChanges,
+		IsUnsavedEntity:      h.IsUnsavedEntity,
+		IsWrite:              h.IsWrite,
+		Language:             h.Language,
+		LanguageAlternate:    h.LanguageAlternate,
+		LineAdditions:        h.LineAdditions,
+		LineDeletions:        h.LineDeletions,
+		LineNumber:           h.LineNumber,
+		Lines:                h.Lines,
+		LocalFile:            h.LocalFile,
+		ProjectAlternate:     h.ProjectAlternate,
+		ProjectFromGitRemote: h.ProjectFromGitRemote,
+		ProjectOverride:      h.ProjectOverride,
+		ProjectPathOverride:  h.ProjectPathOverride,
+		Time:                 h.Time,
+		UserAgent:            h.UserAgent,
+		UUID:                 h.UUID,
+	}
+}
+
+// Heartbeat converts the socket representation into a heartbeat.
+func (h Heartbeat) Heartbeat() heartbeat.Heartbeat {
+	hb := heartbeat.New(
+		h.BranchAlternate,
+		h.Category,
+		h.CursorPosition,
+		h.Entity,
+		h.EntityType,
+		h.IsUnsavedEntity,
+		h.IsWrite,
+		h.Language,
+		h.LanguageAlternate,
+		h.LineAdditions,
+		h.LineDeletions,
+		h.LineNumber,
+		h.Lines,
+		h.LocalFile,
+		h.ProjectAlternate,
+		h.ProjectFromGitRemote,
+		h.ProjectOverride,
+		h.ProjectPathOverride,
+		h.Time,
+		h.UserAgent,
+	)
+
+	hb.AILineChanges = h.AILineChanges
+	hb.AITool = h.AITool
+	hb.CategoryExplicit = h.CategoryExplicit
+	hb.Cwd = h.Cwd
+	hb.HumanLineChanges = h.HumanLineChanges
+
+	// keep the uuid generated by the client, if it sorts by heartbeat time
+	if heartbeat.ValidUUID(h.UUID, h.Time) {
+		hb.UUID = h.UUID
+	}
+
+	return hb
+}
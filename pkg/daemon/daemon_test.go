@@ -0,0 +1,217 @@
+package daemon_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/api"
+	"github.com/optiflow-os/tracelens-cli/pkg/daemon"
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocketFilepath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		ViperValue string
+		EnvVar     string
+		Expected   string
+	}{
+		"default": {
+			Expected: filepath.Join(home, ".wakatime", "tracelens.sock"),
+		},
+		"env_trailing_slash": {
+			EnvVar:   "~/path2/",
+			Expected: filepath.Join(home, "path2", "tracelens.sock"),
+		},
+		"flag": {
+			ViperValue: "~/path1/daemon.sock",
+			Expected:   filepath.Join(home, "path1", "daemon.sock"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := viper.New()
+			v.Set("daemon-socket", test.ViperValue)
+
+			t.Setenv("WAKATIME_HOME", test.EnvVar)
+
+			socketFilepath, err := daemon.SocketFilepath(context.Background(), v)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.Expected, socketFilepath)
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	socketFilepath := filepath.Join(t.TempDir(), "daemon.sock")
+
+	var received []heartbeat.Heartbeat
+
+	startServer(t, socketFilepath, "fingerprint",
+		func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			received = hh
+
+			return []heartbeat.Result{
+				{Status: http.StatusCreated},
+				{Status: http.StatusBadRequest, Errors: []string{"invalid entity"}},
+			}, nil
+		})
+
+	hh := []heartbeat.Heartbeat{
+		heartbeat.New(
+			"alternate-branch",
+			heartbeat.CodingCategory,
+			heartbeat.PointerTo(12),
+			"/tmp/main.go",
+			heartbeat.FileType,
+			true,
+			heartbeat.PointerTo(true),
+			heartbeat.PointerTo("Go"),
+			"Golang",
+			heartbeat.PointerTo(3),
+			heartbeat.PointerTo(1),
+			heartbeat.PointerTo(42),
+			heartbeat.PointerTo(100),
+			"/tmp/local.go",
+			"alternate-project",
+			true,
+			"override-project",
+			"/tmp",
+			1585598059.1,
+			"wakatime/13.0.7",
+		),
+		{
+			Category:   heartbeat.BrowsingCategory,
+			Entity:     "wakatime.com",
+			EntityType: heartbeat.DomainType,
+			Time:       1585598060.1,
+			UserAgent:  "wakatime/13.0.7",
+			UUID:       "01712d02-5644-71af-a2ea-718b3c163a83",
+		},
+	}
+
+	results, err := daemon.Send(context.Background(), socketFilepath, "fingerprint", hh, time.Second)
+	require.NoError(t, err)
+
+	assert.Equal(t, hh, received)
+	assert.Equal(t, []heartbeat.Result{
+		{Status: http.StatusCreated},
+		{Status: http.StatusBadRequest, Errors: []string{"invalid entity"}},
+	}, results)
+}
+
+func TestSend_ConfigMismatch(t *testing.T) {
+	socketFilepath := filepath.Join(t.TempDir(), "daemon.sock")
+
+	startServer(t, socketFilepath, "fingerprint",
+		func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			t.Fatal("heartbeats must not be processed")
+
+			return nil, nil
+		})
+
+	_, err := daemon.Send(context.Background(), socketFilepath, "other", []heartbeat.Heartbeat{{}}, time.Second)
+	require.Error(t, err)
+
+	assert.ErrorIs(t, err, daemon.ErrConfigMismatch)
+}
+
+func TestSend_Failed(t *testing.T) {
+	socketFilepath := filepath.Join(t.TempDir(), "daemon.sock")
+
+	startServer(t, socketFilepath, "fingerprint",
+		func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			return nil, api.Err{Err: errors.New("failed")}
+		})
+
+	_, err := daemon.Send(context.Background(), socketFilepath, "fingerprint", []heartbeat.Heartbeat{{}}, time.Second)
+	require.Error(t, err)
+
+	var errdaemon daemon.Err
+
+	require.ErrorAs(t, err, &errdaemon)
+
+	assert.Equal(t, exitcode.ErrAPI, errdaemon.ExitCode())
+	assert.Equal(t, "failed", errdaemon.Error())
+}
+
+func TestSend_NotRunning(t *testing.T) {
+	socketFilepath := filepath.Join(t.TempDir(), "daemon.sock")
+
+	_, err := daemon.Send(context.Background(), socketFilepath, "fingerprint", []heartbeat.Heartbeat{{}}, time.Second)
+	require.Error(t, err)
+
+	assert.ErrorIs(t, err, daemon.ErrNotRunning)
+}
+
+func TestListen_AlreadyRunning(t *testing.T) {
+	socketFilepath := filepath.Join(t.TempDir(), "daemon.sock")
+
+	l, err := daemon.Listen(context.Background(), socketFilepath)
+	require.NoError(t, err)
+
+	defer l.Close()
+
+	_, err = daemon.Listen(context.Background(), socketFilepath)
+	require.Error(t, err)
+
+	assert.True(t, errors.Is(err, daemon.ErrAlreadyRunning))
+}
+
+func TestListen_StaleSocket(t *testing.T) {
+	socketFilepath := filepath.Join(t.TempDir(), "daemon.sock")
+
+	err := os.WriteFile(socketFilepath, nil, 0600)
+	require.NoError(t, err)
+
+	l, err := daemon.Listen(context.Background(), socketFilepath)
+	require.NoError(t, err)
+
+	defer l.Close()
+
+	info, err := os.Stat(socketFilepath)
+	require.NoError(t, err)
+
+	assert.Equal(t, os.ModeSocket, info.Mode().Type())
+
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func startServer(t *testing.T, socketFilepath, fingerprint string, handle heartbeat.Handle) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	l, err := daemon.Listen(ctx, socketFilepath)
+	require.NoError(t, err)
+
+	server := daemon.NewServer(fingerprint, handle)
+
+	done := make(chan error)
+
+	go func(l net.Listener) {
+		done <- server.Serve(ctx, l)
+	}(l)
+
+	t.Cleanup(func() {
+		cancel()
+
+		assert.NoError(t, <-done)
+	})
+}
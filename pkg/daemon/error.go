@@ -0,0 +1,52 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/wakaerror"
+)
+
+var (
+	// ErrNotRunning is returned when no daemon is listening on the socket.
+	ErrNotRunning = errors.New("daemon not running")
+	// ErrAlreadyRunning is returned when trying to listen on a socket, which
+	// another daemon is already listening on.
+	ErrAlreadyRunning = errors.New("daemon already running")
+	// ErrConfigMismatch is returned when the daemon rejected the heartbeats,
+	// because it runs with a different configuration than the client.
+	ErrConfigMismatch = errors.New("daemon runs with different configuration")
+)
+
+// Err represents an error returned by the daemon after failing to process heartbeats.
+type Err struct {
+	Code int
+	Msg  string
+}
+
+var _ wakaerror.Error = Err{}
+
+// Error method to implement error interface.
+func (e Err) Error() string {
+	return e.Msg
+}
+
+// Message method to implement wakaerror.Error interface.
+func (e Err) Message() string {
+	return fmt.Sprintf("daemon error: %s", e.Msg)
+}
+
+// ExitCode method to implement wakaerror.Error interface.
+func (e Err) ExitCode() int {
+	return e.Code
+}
+
+// SendDiagsOnErrors method to implement wakaerror.SendDiagsOnErrors interface.
+func (Err) SendDiagsOnErrors() bool {
+	return false
+}
+
+// ShouldLogError method to implement wakaerror.ShouldLogError interface.
+func (Err) ShouldLogError() bool {
+	return true
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix listens on the unix socket at filepath. The socket file is created
+// without permissions for other users, so they can never connect to it.
+func listenUnix(filepath string) (net.Listener, error) {
+	mask := syscall.Umask(0177)
+	defer syscall.Umask(mask)
+
+	return net.Listen("unix", filepath)
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package daemon
+
+import "net"
+
+// listenUnix listens on the unix socket at filepath.
+func listenUnix(filepath string) (net.Listener, error) {
+	return net.Listen("unix", filepath)
+}
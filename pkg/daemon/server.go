@@ -0,0 +1,178 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/exitcode"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+	"github.com/optiflow-os/tracelens-cli/pkg/wakaerror"
+)
+
+// readTimeout is the maximum duration for reading a request from a connection.
+const readTimeout = 10 * time.Second
+
+// Server processes heartbeats received over a unix socket.
+type Server struct {
+	fingerprint string
+	handle      heartbeat.Handle
+	// mu serializes heartbeat processing, as the handle keeps state across requests.
+	mu sync.Mutex
+	wg sync.WaitGroup
+}
+
+// NewServer creates a new server, which processes heartbeats with the passed
+// in handle. Requests with a configuration fingerprint different from the
+// server's one are rejected.
+func NewServer(fingerprint string, handle heartbeat.Handle) *Server {
+	return &Server{
+		fingerprint: fingerprint,
+		handle:      handle,
+	}
+}
+
+// Listen listens on the unix socket at filepath. A socket file left behind
+// by a daemon, which was not shut down gracefully, is removed. Returns
+// ErrAlreadyRunning if another daemon is listening on the socket.
+func Listen(ctx context.Context, filepath string) (net.Listener, error) {
+	if _, err := os.Stat(filepath); err == nil {
+		conn, err := net.DialTimeout("unix", filepath, time.Second)
+		if err == nil {
+			_ = conn.Close()
+
+			return nil, ErrAlreadyRunning
+		}
+
+		logger := log.Extract(ctx)
+		logger.Debugf("removing stale socket file %q", filepath)
+
+		if err := os.Remove(filepath); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket file: %s", err)
+		}
+	}
+
+	// only allow the current user to send heartbeats with its api key
+	l, err := listenUnix(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on socket: %s", err)
+	}
+
+	if err := os.Chmod(filepath, 0600); err != nil {
+		_ = l.Close()
+
+		return nil, fmt.Errorf("failed to set socket file permissions: %s", err)
+	}
+
+	return l, nil
+}
+
+// Serve accepts connections on the listener until the context is canceled.
+// Each connection carries a single request. The listener is closed on return.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	logger := log.Extract(ctx)
+
+	go func() {
+		<-ctx.Done()
+
+		_ = l.Close()
+	}()
+
+	defer s.wg.Wait()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("failed to accept connection: %s", err)
+		}
+
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+
+			if err := s.serveConn(ctx, conn); err != nil {
+				logger.Errorf("failed to serve connection: %s", err)
+			}
+		}()
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		return fmt.Errorf("failed to set read deadline: %s", err)
+	}
+
+	var req Request
+
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return fmt.Errorf("failed to json decode request: %s", err)
+	}
+
+	resp := s.process(ctx, req)
+
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		return fmt.Errorf("failed to json encode response: %s", err)
+	}
+
+	return nil
+}
+
+func (s *Server) process(ctx context.Context, req Request) Response {
+	logger := log.Extract(ctx)
+
+	if req.Fingerprint != s.fingerprint {
+		logger.Debugln("rejecting heartbeats, as client configuration differs from daemon configuration")
+
+		return Response{Status: StatusConfigMismatch}
+	}
+
+	hh := make([]heartbeat.Heartbeat, 0, len(req.Heartbeats))
+	for _, h := range req.Heartbeats {
+		hh = append(hh, h.Heartbeat())
+	}
+
+	logger.Debugf("received %d heartbeat(s)", len(hh))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results, err := s.handle(ctx, hh)
+	if err != nil {
+		code := exitcode.ErrGeneric
+
+		var errwaka wakaerror.Error
+		if errors.As(err, &errwaka) {
+			code = errwaka.ExitCode()
+		}
+
+		return Response{
+			Status:   StatusFailed,
+			ExitCode: code,
+			Error:    err.Error(),
+		}
+	}
+
+	resp := Response{Status: StatusOK}
+
+	for _, r := range results {
+		resp.Results = append(resp.Results, Result{
+			Errors: r.Errors,
+			Status: r.Status,
+		})
+	}
+
+	return resp
+}
@@ -0,0 +1,117 @@
+package filestats
+
+import "bytes"
+
+// maxEditDistance is the max number of changed lines diffed exactly. Larger
+// changes are counted as all differing lines being replaced.
+const maxEditDistance = 1000
+
+// CountLineChanges returns the number of lines added and deleted from previous
+// to current, like a line based diff does.
+func CountLineChanges(previous, current []byte) (additions int, deletions int) {
+	return countLineChanges(splitLines(previous), splitLines(current))
+}
+
+// countLineChanges returns the number of lines added and deleted from a to b.
+// Lines are compared by their bytes, so they can also be line digests.
+func countLineChanges(a, b [][]byte) (additions int, deletions int) {
+	// strip common prefix and suffix, which are the unchanged parts for most edits
+	for len(a) > 0 && len(b) > 0 && bytes.Equal(a[0], b[0]) {
+		a, b = a[1:], b[1:]
+	}
+
+	for len(a) > 0 && len(b) > 0 && bytes.Equal(a[len(a)-1], b[len(b)-1]) {
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	if len(a) == 0 || len(b) == 0 {
+		return len(b), len(a)
+	}
+
+	x, y := lineIDs(a, b)
+
+	d := editDistance(x, y, maxEditDistance)
+	if d < 0 {
+		return len(b), len(a)
+	}
+
+	additions = (d + len(b) - len(a)) / 2
+
+	return additions, d - additions
+}
+
+// splitLines splits data into lines keeping the line endings, so a changed
+// ending at the end of file is a changed line.
+func splitLines(data []byte) [][]byte {
+	if len(data) == 0 {
+		return nil
+	}
+
+	lines := bytes.SplitAfter(data, []byte{'\n'})
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// lineIDs maps lines to ids, which are cheaper to compare.
+func lineIDs(a, b [][]byte) ([]int, []int) {
+	ids := make(map[string]int, len(a)+len(b))
+
+	convert := func(lines [][]byte) []int {
+		converted := make([]int, len(lines))
+
+		for i, line := range lines {
+			id, ok := ids[string(line)]
+			if !ok {
+				id = len(ids)
+				ids[string(line)] = id
+			}
+
+			converted[i] = id
+		}
+
+		return converted
+	}
+
+	return convert(a), convert(b)
+}
+
+// editDistance returns the min number of inserted and deleted lines to turn a
+// into b with the Myers algorithm. It returns -1, if more than max edits are needed.
+func editDistance(a, b []int, maxD int) int {
+	n, m := len(a), len(b)
+	if n+m < maxD {
+		maxD = n + m
+	}
+
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return d
+			}
+		}
+	}
+
+	return -1
+}
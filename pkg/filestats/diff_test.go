@@ -0,0 +1,89 @@
+package filestats_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/filestats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountLineChanges(t *testing.T) {
+	tests := map[string]struct {
+		Previous  string
+		Current   string
+		Additions int
+		Deletions int
+	}{
+		"unchanged": {
+			Previous: "a\nb\nc\n",
+			Current:  "a\nb\nc\n",
+		},
+		"new file": {
+			Current:   "a\nb\nc",
+			Additions: 3,
+		},
+		"emptied file": {
+			Previous:  "a\nb\n",
+			Deletions: 2,
+		},
+		"added lines": {
+			Previous:  "a\nb\nc\n",
+			Current:   "a\nx\nb\nc\ny\n",
+			Additions: 2,
+		},
+		"deleted lines": {
+			Previous:  "a\nb\nc\nd\n",
+			Current:   "a\nd\n",
+			Deletions: 2,
+		},
+		"modified line": {
+			Previous:  "a\nb\nc\n",
+			Current:   "a\nB\nc\n",
+			Additions: 1,
+			Deletions: 1,
+		},
+		"moved line": {
+			Previous:  "a\nb\nc\nd\n",
+			Current:   "b\nc\na\nd\n",
+			Additions: 1,
+			Deletions: 1,
+		},
+		"missing newline at end of file": {
+			Previous:  "a\nb",
+			Current:   "a\nb\n",
+			Additions: 1,
+			Deletions: 1,
+		},
+		"repeated lines": {
+			Previous:  "}\n}\nx\n}\n",
+			Current:   "}\nx\n}\n}\n}\n",
+			Additions: 2,
+			Deletions: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			additions, deletions := filestats.CountLineChanges([]byte(test.Previous), []byte(test.Current))
+
+			assert.Equal(t, test.Additions, additions)
+			assert.Equal(t, test.Deletions, deletions)
+		})
+	}
+}
+
+func TestCountLineChanges_ExceedsMaxEditDistance(t *testing.T) {
+	var previous, current strings.Builder
+
+	for i := 0; i < 2000; i++ {
+		previous.WriteString("a\n")
+		current.WriteString("b\n")
+	}
+
+	additions, deletions := filestats.CountLineChanges([]byte(previous.String()), []byte(current.String()))
+
+	assert.Equal(t, 2000, additions)
+	assert.Equal(t, 2000, deletions)
+}
@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/optiflow-os/tracelens-cli/pkg/file"
 	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
 	"github.com/optiflow-os/tracelens-cli/pkg/log"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
 )
 
 // Max file size supporting line number count stats. Files larger than this in
@@ -17,8 +21,10 @@ import (
 const maxFileSizeSupported = 2097152
 
 // WithDetection initializes and returns a heartbeat handle option, which
-// can be used in a heartbeat processing pipeline to detect filestats. At the
-// moment only the total number of lines in a file is detected.
+// can be used in a heartbeat processing pipeline to detect filestats. The total
+// number of lines and the file size are detected. For files of a detected
+// language the lines are split into code, comment and blank lines from the
+// chroma token stream of the language.
 func WithDetection() heartbeat.HandleOption {
 	return func(next heartbeat.Handle) heartbeat.Handle {
 		return func(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
@@ -34,10 +40,6 @@ func WithDetection() heartbeat.HandleOption {
 					continue
 				}
 
-				if h.Lines != nil {
-					continue
-				}
-
 				if h.IsRemote() {
 					continue
 				}
@@ -53,6 +55,8 @@ func WithDetection() heartbeat.HandleOption {
 					continue
 				}
 
+				hh[n].FileSize = heartbeat.PointerTo(int(fileInfo.Size()))
+
 				if fileInfo.Size() > maxFileSizeSupported {
 					logger.Debugf(
 						"file %q exceeds max file size of %d bytes. Lines won't be counted",
@@ -63,13 +67,30 @@ func WithDetection() heartbeat.HandleOption {
 					continue
 				}
 
-				lines, err := countLineNumbers(ctx, filepath)
+				data, err := readAll(ctx, filepath)
 				if err != nil {
-					logger.Warnf("failed to detect the total number of lines in file %q: %s", filepath, err)
+					logger.Warnf("failed to read file %q: %s", filepath, err)
 					continue
 				}
 
-				hh[n].Lines = heartbeat.PointerTo(lines)
+				if h.Lines == nil {
+					hh[n].Lines = heartbeat.PointerTo(bytes.Count(data, []byte{'\n'}))
+				}
+
+				lexer := chromaLexer(h.Language)
+				if lexer == nil {
+					continue
+				}
+
+				stats, err := CountLineKinds(lexer, data)
+				if err != nil {
+					logger.Warnf("failed to count code and comment lines in file %q: %s", filepath, err)
+					continue
+				}
+
+				hh[n].BlankLines = heartbeat.PointerTo(stats.Blank)
+				hh[n].CodeLines = heartbeat.PointerTo(stats.Code)
+				hh[n].CommentLines = heartbeat.PointerTo(stats.Comment)
 			}
 
 			return next(ctx, hh)
@@ -77,12 +98,106 @@ func WithDetection() heartbeat.HandleOption {
 	}
 }
 
-func countLineNumbers(ctx context.Context, filepath string) (int, error) {
+// LineKinds contains the number of code, comment and blank lines of a file.
+type LineKinds struct {
+	Blank   int
+	Code    int
+	Comment int
+}
+
+// CountLineKinds splits the lines of data into code, comment and blank lines
+// by tokenizing it with a chroma lexer. Lines with code and a comment count as
+// code. Doc string tokens count as comments.
+func CountLineKinds(lexer chroma.Lexer, data []byte) (LineKinds, error) {
+	iter, err := lexer.Tokenise(nil, string(data))
+	if err != nil {
+		return LineKinds{}, fmt.Errorf("failed to tokenize file content: %s", err)
+	}
+
+	var (
+		stats                     LineKinds
+		hasCode, hasComment, open bool
+	)
+
+	endLine := func() {
+		switch {
+		case hasCode:
+			stats.Code++
+		case hasComment:
+			stats.Comment++
+		default:
+			stats.Blank++
+		}
+
+		hasCode, hasComment, open = false, false, false
+	}
+
+	for _, token := range iter.Tokens() {
+		parts := strings.Split(token.Value, "\n")
+
+		for i, part := range parts {
+			if i > 0 {
+				endLine()
+			}
+
+			if part == "" {
+				continue
+			}
+
+			open = true
+
+			if strings.TrimSpace(part) == "" {
+				continue
+			}
+
+			if isComment(token.Type) {
+				hasComment = true
+			} else {
+				hasCode = true
+			}
+		}
+	}
+
+	if open {
+		endLine()
+	}
+
+	return stats, nil
+}
+
+// isComment returns true for comment and doc string tokens. Preprocessor
+// directives are tokenized as comments by chroma, but are code.
+func isComment(t chroma.TokenType) bool {
+	switch t {
+	case chroma.CommentPreproc, chroma.CommentPreprocFile:
+		return false
+	case chroma.LiteralStringDoc:
+		return true
+	}
+
+	return t.InCategory(chroma.Comment)
+}
+
+// chromaLexer returns the chroma lexer of a detected language or nil.
+func chromaLexer(language *string) chroma.Lexer {
+	if language == nil {
+		return nil
+	}
+
+	parsed, ok := heartbeat.ParseLanguage(*language)
+	if !ok {
+		return nil
+	}
+
+	return lexers.Get(parsed.StringChroma())
+}
+
+func readAll(ctx context.Context, filepath string) ([]byte, error) {
 	logger := log.Extract(ctx)
 
 	f, err := file.OpenNoLock(filepath) // nolint:gosec
 	if err != nil {
-		return 0, fmt.Errorf("failed to open file: %s", err)
+		return nil, fmt.Errorf("failed to open file: %s", err)
 	}
 
 	defer func() {
@@ -91,20 +206,5 @@ func countLineNumbers(ctx context.Context, filepath string) (int, error) {
 		}
 	}()
 
-	buf := make([]byte, 32*1024)
-	count := 0
-	lineSep := []byte{'\n'}
-
-	for {
-		c, err := f.Read(buf)
-		count += bytes.Count(buf[:c], lineSep)
-
-		switch {
-		case err == io.EOF:
-			return count, nil
-
-		case err != nil:
-			return count, err
-		}
-	}
+	return io.ReadAll(f)
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/optiflow-os/tracelens-cli/pkg/filestats"
 	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
 
+	"github.com/alecthomas/chroma/v2/lexers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -20,11 +21,13 @@ func TestWithDetection(t *testing.T) {
 		assert.Contains(t, hh, heartbeat.Heartbeat{
 			EntityType: heartbeat.FileType,
 			Entity:     "testdata/first.txt",
+			FileSize:   heartbeat.PointerTo(12),
 			Lines:      heartbeat.PointerTo(1),
 		})
 		assert.Contains(t, hh, heartbeat.Heartbeat{
 			EntityType: heartbeat.FileType,
 			Entity:     "testdata/second.txt",
+			FileSize:   heartbeat.PointerTo(12),
 			Lines:      heartbeat.PointerTo(2),
 		})
 
@@ -101,6 +104,7 @@ func TestWithDetection_MaxFileSizeExceeded(t *testing.T) {
 			{
 				EntityType: heartbeat.FileType,
 				Entity:     f.Name(),
+				FileSize:   heartbeat.PointerTo(2*1024*1024 + 1),
 				Lines:      nil,
 			},
 		})
@@ -116,3 +120,43 @@ func TestWithDetection_MaxFileSizeExceeded(t *testing.T) {
 	})
 	require.NoError(t, err)
 }
+
+func TestWithDetection_LineKinds(t *testing.T) {
+	opt := filestats.WithDetection()
+	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		assert.Equal(t, []heartbeat.Heartbeat{
+			{
+				BlankLines:   heartbeat.PointerTo(4),
+				CodeLines:    heartbeat.PointerTo(7),
+				CommentLines: heartbeat.PointerTo(5),
+				EntityType:   heartbeat.FileType,
+				Entity:       "testdata/main.go",
+				FileSize:     heartbeat.PointerTo(250),
+				Language:     heartbeat.PointerTo("Go"),
+				Lines:        heartbeat.PointerTo(16),
+			},
+		}, hh)
+
+		return []heartbeat.Result{}, nil
+	})
+
+	_, err := handle(context.Background(), []heartbeat.Heartbeat{
+		{
+			EntityType: heartbeat.FileType,
+			Entity:     "testdata/main.go",
+			Language:   heartbeat.PointerTo("Go"),
+		},
+	})
+	require.NoError(t, err)
+}
+
+func TestCountLineKinds(t *testing.T) {
+	stats, err := filestats.CountLineKinds(lexers.Get("C"), []byte("#include <stdio.h>\n\n/* block\n * comment */\nint x; // trailing comment\n\t\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, filestats.LineKinds{
+		Blank:   2,
+		Code:    2,
+		Comment: 2,
+	}, stats)
+}
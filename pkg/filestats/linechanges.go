@@ -0,0 +1,360 @@
+package filestats
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/file"
+	"github.com/optiflow-os/tracelens-cli/pkg/git"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/ini"
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+)
+
+const (
+	// lineDigestSize is the size of the digest of a line in a snapshot.
+	lineDigestSize = 16
+	// maxSnapshots is the max number of file snapshots kept. The least
+	// recently updated snapshots are removed first.
+	maxSnapshots = 500
+	// snapshotFolder is the folder of the file snapshots in the resources dir.
+	snapshotFolder = "snapshots"
+	// snapshotSuffix is the file suffix of snapshots.
+	snapshotSuffix = ".lines"
+	// legacySnapshotSuffix is the file suffix of snapshots keeping the file
+	// contents. They are removed when snapshots are pruned.
+	legacySnapshotSuffix = ".gz"
+)
+
+// LineChangesConfig contains line changes detection configurations.
+type LineChangesConfig struct {
+	// DryRun detects line changes without saving snapshots, so the next
+	// heartbeat is still diffed against the previous snapshot.
+	DryRun bool
+	// SnapshotDir is the folder the file snapshots are saved to. Defaults to
+	// the snapshots folder in the resources dir.
+	SnapshotDir string
+}
+
+// WithLineChanges initializes and returns a heartbeat handle option, which
+// can be used in a heartbeat processing pipeline to detect the lines added and
+// deleted in files of a git repository since the previous heartbeat. The file
+// is diffed against its snapshot saved by the previous heartbeat, or against
+// the file at HEAD, if there is no snapshot yet. Nothing is set for unchanged
+// files. Line changes passed by the plugin are kept. Snapshots only keep a
+// digest of each line, never the file contents.
+func WithLineChanges(config LineChangesConfig) heartbeat.HandleOption {
+	return func(next heartbeat.Handle) heartbeat.Handle {
+		return func(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			logger := log.Extract(ctx)
+			logger.Debugln("execute line changes detection")
+
+			dir := config.SnapshotDir
+
+			for n, h := range hh {
+				if h.EntityType != heartbeat.FileType {
+					continue
+				}
+
+				if h.IsUnsavedEntity {
+					continue
+				}
+
+				if h.LineAdditions != nil || h.LineDeletions != nil {
+					continue
+				}
+
+				if h.IsRemote() {
+					continue
+				}
+
+				if dir == "" {
+					folder, err := ini.WakaResourcesDir(ctx)
+					if err != nil {
+						logger.Warnf("failed getting resource directory: %s", err)
+						break
+					}
+
+					dir = filepath.Join(folder, snapshotFolder)
+				}
+
+				additions, deletions, ok := detectLineChanges(ctx, h, dir, config.DryRun)
+				if !ok {
+					continue
+				}
+
+				hh[n].LineAdditions = heartbeat.PointerTo(additions)
+				hh[n].LineDeletions = heartbeat.PointerTo(deletions)
+			}
+
+			return next(ctx, hh)
+		}
+	}
+}
+
+// detectLineChanges diffs the file of a heartbeat against its snapshot or
+// the file at HEAD and saves the current content as new snapshot, unless dryRun is set.
+func detectLineChanges(ctx context.Context, h heartbeat.Heartbeat, dir string, dryRun bool) (int, int, bool) {
+	logger := log.Extract(ctx)
+
+	repo, ok, err := git.FindRepository(ctx, h.Entity)
+	if err != nil {
+		logger.Warnf("failed to find git repository of file %q: %s", h.Entity, err)
+		return 0, 0, false
+	}
+
+	if !ok {
+		return 0, 0, false
+	}
+
+	fp := h.Entity
+	if h.LocalFile != "" {
+		fp = h.LocalFile
+	}
+
+	current, err := readFile(ctx, fp)
+	if err != nil {
+		logger.Warnf("failed to read file %q: %s", fp, err)
+		return 0, 0, false
+	}
+
+	if current == nil || isBinary(current) {
+		return 0, 0, false
+	}
+
+	snapshot := filepath.Join(dir, snapshotFilename(h.Entity))
+
+	currentLines := digestLines(current)
+
+	previousLines, found, err := readSnapshot(snapshot)
+	if err != nil {
+		logger.Warnf("failed to read snapshot of file %q: %s", h.Entity, err)
+	}
+
+	if !found {
+		var blob []byte
+
+		blob, ok = readHeadBlob(ctx, repo, h.Entity)
+		previousLines = digestLines(blob)
+	}
+
+	if !dryRun {
+		if err := writeSnapshot(ctx, dir, snapshot, currentLines); err != nil {
+			logger.Warnf("failed to save snapshot of file %q: %s", h.Entity, err)
+		}
+	}
+
+	if !ok {
+		return 0, 0, false
+	}
+
+	additions, deletions := countLineChanges(previousLines, currentLines)
+	if additions == 0 && deletions == 0 {
+		return 0, 0, false
+	}
+
+	return additions, deletions, true
+}
+
+// readFile reads a file, which is smaller than the max supported size. It
+// returns nil for larger files.
+func readFile(ctx context.Context, fp string) ([]byte, error) {
+	fileInfo, err := os.Stat(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	if fileInfo.Size() > maxFileSizeSupported {
+		log.Extract(ctx).Debugf(
+			"file %q exceeds max file size of %d bytes. Line changes won't be detected",
+			fp,
+			maxFileSizeSupported,
+		)
+
+		return nil, nil
+	}
+
+	f, err := file.OpenNoLock(fp) // nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Extract(ctx).Debugf("failed to close file: %s", err)
+		}
+	}()
+
+	return io.ReadAll(f)
+}
+
+// readHeadBlob returns the content of the file at HEAD. Files missing in HEAD
+// are new files, so all lines are additions.
+func readHeadBlob(ctx context.Context, repo git.Repository, fp string) ([]byte, bool) {
+	logger := log.Extract(ctx)
+
+	rel, err := filepath.Rel(repo.Root, fp)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		logger.Debugf("file %q is outside of git repository %q", fp, repo.Root)
+		return nil, false
+	}
+
+	data, err := repo.HeadBlob(ctx, filepath.ToSlash(rel))
+	if errors.Is(err, git.ErrNotFound) {
+		return nil, true
+	}
+
+	if err != nil {
+		logger.Warnf("failed to read file %q at HEAD: %s", fp, err)
+		return nil, false
+	}
+
+	return data, true
+}
+
+// isBinary detects binary files like git does, by looking for a null byte
+// in the first 8000 bytes.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// snapshotFilename returns the snapshot filename of an entity.
+func snapshotFilename(entity string) string {
+	sum := sha256.Sum256([]byte(entity))
+
+	return hex.EncodeToString(sum[:]) + snapshotSuffix
+}
+
+// digestLines splits data into lines and returns the digest of each line.
+func digestLines(data []byte) [][]byte {
+	lines := splitLines(data)
+
+	digests := make([][]byte, len(lines))
+
+	for i, line := range lines {
+		sum := sha256.Sum256(line)
+		digests[i] = sum[:lineDigestSize]
+	}
+
+	return digests
+}
+
+// readSnapshot reads the line digests of a snapshot.
+func readSnapshot(fp string) ([][]byte, bool, error) {
+	data, err := os.ReadFile(fp) // nolint:gosec
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(data)%lineDigestSize != 0 {
+		return nil, false, fmt.Errorf("invalid snapshot size of %d bytes", len(data))
+	}
+
+	digests := make([][]byte, 0, len(data)/lineDigestSize)
+
+	for len(data) > 0 {
+		digests = append(digests, data[:lineDigestSize])
+		data = data[lineDigestSize:]
+	}
+
+	return digests, true, nil
+}
+
+// writeSnapshot saves the line digests to a temporary file, which replaces the
+// snapshot, so concurrent processes never read partial snapshots.
+func writeSnapshot(ctx context.Context, dir, fp string, digests [][]byte) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create snapshot dir: %s", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "snapshot-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %s", err)
+	}
+
+	defer os.Remove(tmp.Name()) // nolint:errcheck
+
+	if _, err := tmp.Write(bytes.Join(digests, nil)); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %s", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %s", err)
+	}
+
+	if err := os.Rename(tmp.Name(), fp); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %s", err)
+	}
+
+	pruneSnapshots(ctx, dir)
+
+	return nil
+}
+
+// pruneSnapshots removes the least recently updated snapshots exceeding the
+// max number of snapshots and all legacy snapshots.
+func pruneSnapshots(ctx context.Context, dir string) {
+	logger := log.Extract(ctx)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logger.Warnf("failed to list snapshots: %s", err)
+		return
+	}
+
+	type snapshot struct {
+		name    string
+		modTime int64
+	}
+
+	snapshots := make([]snapshot, 0, len(entries))
+
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), legacySnapshotSuffix) {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				logger.Debugf("failed to remove legacy snapshot: %s", err)
+			}
+
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || !strings.HasSuffix(entry.Name(), snapshotSuffix) {
+			continue
+		}
+
+		snapshots = append(snapshots, snapshot{name: entry.Name(), modTime: info.ModTime().UnixNano()})
+	}
+
+	if len(snapshots) <= maxSnapshots {
+		return
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].modTime < snapshots[j].modTime })
+
+	for len(snapshots) > maxSnapshots {
+		if err := os.Remove(filepath.Join(dir, snapshots[0].name)); err != nil {
+			logger.Debugf("failed to remove snapshot: %s", err)
+		}
+
+		snapshots = snapshots[1:]
+	}
+}
@@ -0,0 +1,203 @@
+package filestats_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/filestats"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithLineChanges(t *testing.T) {
+	root := t.TempDir()
+	snapshotDir := t.TempDir()
+
+	// repository without commits, so the file is new
+	err := os.MkdirAll(filepath.Join(root, ".git"), 0700)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(root, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0600)
+	require.NoError(t, err)
+
+	entity := filepath.Join(root, "main.go")
+
+	err = os.WriteFile(entity, []byte("package main\n\nfunc main() {}\n"), 0600)
+	require.NoError(t, err)
+
+	var result []heartbeat.Heartbeat
+
+	handle := filestats.WithLineChanges(filestats.LineChangesConfig{SnapshotDir: snapshotDir})(
+		func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			result = hh
+			return nil, nil
+		})
+
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{
+		{EntityType: heartbeat.FileType, Entity: entity},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, result, 1)
+	assert.Equal(t, heartbeat.PointerTo(3), result[0].LineAdditions)
+	assert.Equal(t, heartbeat.PointerTo(0), result[0].LineDeletions)
+
+	// diffed against the snapshot of the previous heartbeat
+	err = os.WriteFile(entity, []byte("package main\n\nfunc main() {\n\tprintln()\n}\n"), 0600)
+	require.NoError(t, err)
+
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{
+		{EntityType: heartbeat.FileType, Entity: entity},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, result, 1)
+	assert.Equal(t, heartbeat.PointerTo(3), result[0].LineAdditions)
+	assert.Equal(t, heartbeat.PointerTo(1), result[0].LineDeletions)
+
+	// unchanged since the previous heartbeat
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{
+		{EntityType: heartbeat.FileType, Entity: entity},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, result, 1)
+	assert.Nil(t, result[0].LineAdditions)
+	assert.Nil(t, result[0].LineDeletions)
+}
+
+func TestWithLineChanges_DryRun(t *testing.T) {
+	root := t.TempDir()
+	snapshotDir := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(root, ".git"), 0700)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(root, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0600)
+	require.NoError(t, err)
+
+	entity := filepath.Join(root, "main.go")
+
+	err = os.WriteFile(entity, []byte("package main\n\nfunc main() {}\n"), 0600)
+	require.NoError(t, err)
+
+	var result []heartbeat.Heartbeat
+
+	next := func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		result = hh
+		return nil, nil
+	}
+
+	dryRun := filestats.WithLineChanges(filestats.LineChangesConfig{DryRun: true, SnapshotDir: snapshotDir})(next)
+
+	_, err = dryRun(context.Background(), []heartbeat.Heartbeat{
+		{EntityType: heartbeat.FileType, Entity: entity},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, result, 1)
+	assert.Equal(t, heartbeat.PointerTo(3), result[0].LineAdditions)
+
+	entries, err := os.ReadDir(snapshotDir)
+	require.NoError(t, err)
+
+	assert.Empty(t, entries)
+
+	// the next heartbeat is still diffed against HEAD
+	handle := filestats.WithLineChanges(filestats.LineChangesConfig{SnapshotDir: snapshotDir})(next)
+
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{
+		{EntityType: heartbeat.FileType, Entity: entity},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, result, 1)
+	assert.Equal(t, heartbeat.PointerTo(3), result[0].LineAdditions)
+}
+
+func TestWithLineChanges_SnapshotWithoutContents(t *testing.T) {
+	root := t.TempDir()
+	snapshotDir := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(root, ".git"), 0700)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(root, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0600)
+	require.NoError(t, err)
+
+	// legacy snapshot keeping the file contents
+	err = os.WriteFile(filepath.Join(snapshotDir, "legacy.gz"), []byte("secret"), 0600)
+	require.NoError(t, err)
+
+	entity := filepath.Join(root, "main.go")
+
+	err = os.WriteFile(entity, []byte("password = \"secret\"\n"), 0600)
+	require.NoError(t, err)
+
+	handle := filestats.WithLineChanges(filestats.LineChangesConfig{SnapshotDir: snapshotDir})(
+		func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			return nil, nil
+		})
+
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{
+		{EntityType: heartbeat.FileType, Entity: entity},
+	})
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(snapshotDir)
+	require.NoError(t, err)
+
+	require.Len(t, entries, 1)
+
+	data, err := os.ReadFile(filepath.Join(snapshotDir, entries[0].Name()))
+	require.NoError(t, err)
+
+	assert.NotContains(t, string(data), "secret")
+}
+
+func TestWithLineChanges_Skipped(t *testing.T) {
+	root := t.TempDir()
+	snapshotDir := t.TempDir()
+
+	entity := filepath.Join(root, "main.go")
+
+	err := os.WriteFile(entity, []byte("package main\n"), 0600)
+	require.NoError(t, err)
+
+	handle := filestats.WithLineChanges(filestats.LineChangesConfig{SnapshotDir: snapshotDir})(
+		func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			assert.Equal(t, []heartbeat.Heartbeat{
+				// outside of a git repository
+				{EntityType: heartbeat.FileType, Entity: entity},
+				// line changes passed by the plugin
+				{
+					EntityType:    heartbeat.FileType,
+					Entity:        entity,
+					LineAdditions: heartbeat.PointerTo(7),
+				},
+				{EntityType: heartbeat.AppType, Entity: "terminal"},
+			}, hh)
+
+			return nil, nil
+		})
+
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{
+		{EntityType: heartbeat.FileType, Entity: entity},
+		{
+			EntityType:    heartbeat.FileType,
+			Entity:        entity,
+			LineAdditions: heartbeat.PointerTo(7),
+		},
+		{EntityType: heartbeat.AppType, Entity: "terminal"},
+	})
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(snapshotDir)
+	require.NoError(t, err)
+
+	assert.Empty(t, entries)
+}
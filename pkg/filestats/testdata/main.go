@@ -0,0 +1,16 @@
+// Package main prints a greeting.
+package main
+
+import "fmt"
+
+/*
+greeting is printed by main.
+*/
+const greeting = "hello world"
+
+func main() {
+	// print the greeting
+	fmt.Println(greeting)
+
+	fmt.Println("done") // trailing comments are code lines
+}
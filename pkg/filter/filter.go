@@ -33,6 +33,7 @@ func WithFiltering(config Config) heartbeat.HandleOption {
 				err := Filter(ctx, h, config)
 				if err != nil {
 					logger.Debugln(err.Error())
+					heartbeat.ReportSkipped(ctx, h, err.Error())
 
 					continue
 				}
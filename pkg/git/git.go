@@ -0,0 +1,258 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/file"
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+)
+
+// maxRefDepth is the max number of symbolic refs followed to resolve a ref.
+const maxRefDepth = 5
+
+// ErrNotFound is returned when an object, ref or path doesn't exist in the repository.
+var ErrNotFound = errors.New("not found")
+
+// Repository is a git repository read directly from its git dir, without
+// shelling out to git.
+type Repository struct {
+	// CommonDir is the git dir holding objects and refs. It differs from
+	// GitDir for worktrees.
+	CommonDir string
+	// GitDir is the git dir holding HEAD.
+	GitDir string
+	// Root is the working tree folder.
+	Root string
+}
+
+// FindRepository returns the repository of the working tree containing fp.
+func FindRepository(ctx context.Context, fp string) (Repository, bool, error) {
+	dir := filepath.Dir(fp)
+
+	for {
+		dotGit := filepath.Join(dir, ".git")
+
+		info, err := os.Stat(dotGit)
+		if err == nil {
+			gitdir := dotGit
+
+			if !info.IsDir() {
+				gitdir, err = readGitdirFile(ctx, dotGit)
+				if err != nil {
+					return Repository{}, false, err
+				}
+			}
+
+			return Repository{
+				CommonDir: commondir(ctx, gitdir),
+				GitDir:    gitdir,
+				Root:      dir,
+			}, true, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return Repository{}, false, nil
+		}
+
+		dir = parent
+	}
+}
+
+// HeadBlob returns the content of the file at relpath in the HEAD commit.
+// The path is relative to the working tree and uses forward slashes.
+// ErrNotFound is returned for unborn branches and files missing in HEAD.
+func (r Repository) HeadBlob(ctx context.Context, relpath string) ([]byte, error) {
+	commit, err := r.resolveRef(ctx, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+
+	objtype, data, err := r.readObject(commit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", commit, err)
+	}
+
+	if objtype != objCommit {
+		return nil, fmt.Errorf("HEAD %s is not a commit", commit)
+	}
+
+	tree, err := parseCommitTree(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse commit %s: %s", commit, err)
+	}
+
+	oid := tree
+
+	for _, name := range strings.Split(relpath, "/") {
+		if name == "" {
+			continue
+		}
+
+		objtype, data, err = r.readObject(oid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tree %s: %w", oid, err)
+		}
+
+		if objtype != objTree {
+			return nil, ErrNotFound
+		}
+
+		oid, err = findTreeEntry(data, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	objtype, data, err = r.readObject(oid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", oid, err)
+	}
+
+	if objtype != objBlob {
+		return nil, ErrNotFound
+	}
+
+	return data, nil
+}
+
+// resolveRef resolves a ref name like HEAD or refs/heads/main to an object id.
+func (r Repository) resolveRef(ctx context.Context, name string) (string, error) {
+	for i := 0; i < maxRefDepth; i++ {
+		value, err := r.readRef(ctx, name)
+		if err != nil {
+			return "", err
+		}
+
+		target, ok := strings.CutPrefix(value, "ref: ")
+		if !ok {
+			if !isObjectID(value) {
+				return "", fmt.Errorf("invalid ref %q: %s", name, value)
+			}
+
+			return value, nil
+		}
+
+		name = strings.TrimSpace(target)
+	}
+
+	return "", fmt.Errorf("too many symbolic refs resolving %q", name)
+}
+
+// readRef reads the value of a loose ref, falling back to packed refs.
+func (r Repository) readRef(ctx context.Context, name string) (string, error) {
+	dirs := []string{r.GitDir}
+	if r.CommonDir != r.GitDir && name != "HEAD" {
+		dirs = []string{r.CommonDir, r.GitDir}
+	}
+
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name))) // nolint:gosec
+		if err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read ref %q: %s", name, err)
+		}
+	}
+
+	return r.readPackedRef(ctx, name)
+}
+
+func (r Repository) readPackedRef(ctx context.Context, name string) (string, error) {
+	f, err := file.OpenNoLock(filepath.Join(r.CommonDir, "packed-refs")) // nolint:gosec
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to open packed refs: %s", err)
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Extract(ctx).Debugf("failed to close file: %s", err)
+		}
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+
+		oid, ref, ok := strings.Cut(line, " ")
+		if ok && ref == name {
+			return oid, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read packed refs: %s", err)
+	}
+
+	return "", ErrNotFound
+}
+
+// readGitdirFile returns the git dir a .git file points to.
+func readGitdirFile(ctx context.Context, fp string) (string, error) {
+	data, err := os.ReadFile(fp) // nolint:gosec
+	if err != nil {
+		return "", fmt.Errorf("failed to read %q: %s", fp, err)
+	}
+
+	line, _, _ := strings.Cut(string(data), "\n")
+
+	gitdir, ok := strings.CutPrefix(strings.TrimSpace(line), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("invalid gitdir file %q", fp)
+	}
+
+	if !filepath.IsAbs(gitdir) {
+		gitdir = filepath.Join(filepath.Dir(fp), gitdir)
+	}
+
+	log.Extract(ctx).Debugf("found gitdir %q in %q", gitdir, fp)
+
+	return gitdir, nil
+}
+
+// commondir returns the git dir shared by all worktrees, which holds objects
+// and refs. It's the git dir itself, when it has no commondir file.
+func commondir(ctx context.Context, gitdir string) string {
+	data, err := os.ReadFile(filepath.Join(gitdir, "commondir")) // nolint:gosec
+	if err != nil {
+		return gitdir
+	}
+
+	dir := strings.TrimSpace(string(data))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(gitdir, dir)
+	}
+
+	log.Extract(ctx).Debugf("found commondir %q in %q", dir, gitdir)
+
+	return filepath.Clean(dir)
+}
+
+func isObjectID(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
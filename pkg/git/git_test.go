@@ -0,0 +1,194 @@
+package git_test
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/git"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepository_HeadBlob(t *testing.T) {
+	tests := map[string]string{
+		"loose objects": "testdata/loose",
+		"pack file":     "testdata/packed",
+	}
+
+	for name, fixture := range tests {
+		t.Run(name, func(t *testing.T) {
+			root := setupRepository(t, fixture)
+
+			repo, ok, err := git.FindRepository(context.Background(), filepath.Join(root, "src", "main.txt"))
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			assert.Equal(t, root, repo.Root)
+			assert.Equal(t, filepath.Join(root, ".git"), repo.GitDir)
+			assert.Equal(t, filepath.Join(root, ".git"), repo.CommonDir)
+
+			data, err := repo.HeadBlob(context.Background(), "src/main.txt")
+			require.NoError(t, err)
+
+			assert.Equal(t, secondVersion(), string(data))
+
+			data, err = repo.HeadBlob(context.Background(), "README.md")
+			require.NoError(t, err)
+
+			assert.Equal(t, "readme\n", string(data))
+		})
+	}
+}
+
+func TestRepository_HeadBlob_DetachedDelta(t *testing.T) {
+	root := setupRepository(t, "testdata/packed")
+
+	// the first version is stored as delta of the second one in the pack file
+	err := os.WriteFile(filepath.Join(root, ".git", "HEAD"), []byte("eded2b34e5cea8b3feec9ead70b1a0db8359d5b0\n"), 0600)
+	require.NoError(t, err)
+
+	repo, ok, err := git.FindRepository(context.Background(), filepath.Join(root, "src", "main.txt"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	data, err := repo.HeadBlob(context.Background(), "src/main.txt")
+	require.NoError(t, err)
+
+	assert.Equal(t, firstVersion(), string(data))
+}
+
+func TestRepository_HeadBlob_NotFound(t *testing.T) {
+	root := setupRepository(t, "testdata/loose")
+
+	repo, ok, err := git.FindRepository(context.Background(), filepath.Join(root, "src", "main.txt"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	for _, relpath := range []string{"src/missing.txt", "missing/main.txt", "README.md/main.txt", "src"} {
+		_, err = repo.HeadBlob(context.Background(), relpath)
+		assert.ErrorIs(t, err, git.ErrNotFound, relpath)
+	}
+}
+
+func TestRepository_HeadBlob_UnbornBranch(t *testing.T) {
+	root := setupRepository(t, "testdata/loose")
+
+	err := os.WriteFile(filepath.Join(root, ".git", "HEAD"), []byte("ref: refs/heads/unborn\n"), 0600)
+	require.NoError(t, err)
+
+	repo, ok, err := git.FindRepository(context.Background(), filepath.Join(root, "src", "main.txt"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, err = repo.HeadBlob(context.Background(), "src/main.txt")
+	assert.ErrorIs(t, err, git.ErrNotFound)
+}
+
+func TestFindRepository_Worktree(t *testing.T) {
+	root := setupRepository(t, "testdata/packed")
+
+	worktreeGitDir := filepath.Join(root, ".git", "worktrees", "feature")
+
+	err := os.MkdirAll(worktreeGitDir, 0700)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(worktreeGitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0600)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(worktreeGitDir, "commondir"), []byte("../..\n"), 0600)
+	require.NoError(t, err)
+
+	worktree := filepath.Join(t.TempDir(), "feature")
+
+	err = os.MkdirAll(filepath.Join(worktree, "src"), 0700)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(worktree, ".git"), []byte("gitdir: "+worktreeGitDir+"\n"), 0600)
+	require.NoError(t, err)
+
+	repo, ok, err := git.FindRepository(context.Background(), filepath.Join(worktree, "src", "main.txt"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	assert.Equal(t, worktree, repo.Root)
+	assert.Equal(t, worktreeGitDir, repo.GitDir)
+	assert.Equal(t, filepath.Join(root, ".git"), repo.CommonDir)
+
+	data, err := repo.HeadBlob(context.Background(), "src/main.txt")
+	require.NoError(t, err)
+
+	assert.Equal(t, secondVersion(), string(data))
+}
+
+func TestFindRepository_NotFound(t *testing.T) {
+	_, ok, err := git.FindRepository(context.Background(), filepath.Join(t.TempDir(), "main.go"))
+	require.NoError(t, err)
+
+	assert.False(t, ok)
+}
+
+// setupRepository copies the git dir fixture to a temporary working tree and
+// returns the working tree folder.
+func setupRepository(t *testing.T, fixture string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	gitDir := filepath.Join(root, ".git")
+
+	err := filepath.WalkDir(fixture, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(fixture, path)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(gitDir, rel), 0700)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(filepath.Join(gitDir, rel), data, 0600)
+	})
+	require.NoError(t, err)
+
+	return root
+}
+
+func firstVersion() string {
+	var lines []string
+
+	for i := 1; i <= 30; i++ {
+		lines = append(lines, fmt.Sprintf("line %d\n", i))
+	}
+
+	return strings.Join(lines, "")
+}
+
+func secondVersion() string {
+	var lines []string
+
+	for i := 1; i <= 31; i++ {
+		switch i {
+		case 5:
+			lines = append(lines, "line five\n")
+		case 20:
+		default:
+			lines = append(lines, fmt.Sprintf("line %d\n", i))
+		}
+	}
+
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,458 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/file"
+)
+
+type objectType int
+
+const (
+	objCommit   objectType = 1
+	objTree     objectType = 2
+	objBlob     objectType = 3
+	objTag      objectType = 4
+	objOfsDelta objectType = 6
+	objRefDelta objectType = 7
+)
+
+const (
+	// maxDeltaDepth is the max length of a delta chain in a pack file.
+	maxDeltaDepth = 100
+	// maxObjectSize is the max size of objects read from the repository.
+	// Larger objects are rejected to keep memory usage low. Default is 16MB.
+	maxObjectSize = 16 * 1024 * 1024
+)
+
+// readObject reads an object by its hex id from the loose objects or pack files.
+func (r Repository) readObject(oid string) (objectType, []byte, error) {
+	return r.readObjectDepth(oid, 0)
+}
+
+func (r Repository) readObjectDepth(oid string, depth int) (objectType, []byte, error) {
+	if !isObjectID(oid) {
+		return 0, nil, fmt.Errorf("invalid object id %q", oid)
+	}
+
+	objtype, data, err := r.readLooseObject(oid)
+	if !errors.Is(err, ErrNotFound) {
+		return objtype, data, err
+	}
+
+	packs, err := filepath.Glob(filepath.Join(r.CommonDir, "objects", "pack", "pack-*.idx"))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to list pack files: %s", err)
+	}
+
+	for _, idx := range packs {
+		offset, err := findPackOffset(idx, oid)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		return r.readPackObject(strings.TrimSuffix(idx, ".idx")+".pack", offset, depth)
+	}
+
+	return 0, nil, ErrNotFound
+}
+
+func (r Repository) readLooseObject(oid string) (objectType, []byte, error) {
+	f, err := file.OpenNoLock(filepath.Join(r.CommonDir, "objects", oid[:2], oid[2:])) // nolint:gosec
+	if os.IsNotExist(err) {
+		return 0, nil, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open object %s: %s", oid, err)
+	}
+
+	defer f.Close() // nolint:errcheck
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to decompress object %s: %s", oid, err)
+	}
+
+	defer zr.Close() // nolint:errcheck
+
+	br := bufio.NewReader(zr)
+
+	header, err := br.ReadString(0)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read header of object %s: %s", oid, err)
+	}
+
+	name, sizeStr, ok := strings.Cut(strings.TrimSuffix(header, "\x00"), " ")
+	if !ok {
+		return 0, nil, fmt.Errorf("invalid header of object %s", oid)
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil || size < 0 {
+		return 0, nil, fmt.Errorf("invalid size of object %s", oid)
+	}
+
+	var objtype objectType
+
+	switch name {
+	case "commit":
+		objtype = objCommit
+	case "tree":
+		objtype = objTree
+	case "blob":
+		objtype = objBlob
+	case "tag":
+		objtype = objTag
+	default:
+		return 0, nil, fmt.Errorf("invalid type %q of object %s", name, oid)
+	}
+
+	data, err := readFull(br, size)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read object %s: %s", oid, err)
+	}
+
+	return objtype, data, nil
+}
+
+// findPackOffset looks up the offset of an object in a version 2 pack index.
+// The index is searched in place, so large indexes aren't read into memory.
+func findPackOffset(idx string, oid string) (int64, error) {
+	want, err := hex.DecodeString(oid)
+	if err != nil {
+		return 0, fmt.Errorf("invalid object id %q", oid)
+	}
+
+	f, err := file.OpenNoLock(idx) // nolint:gosec
+	if err != nil {
+		return 0, fmt.Errorf("failed to open pack index %q: %s", idx, err)
+	}
+
+	defer f.Close() // nolint:errcheck
+
+	header := make([]byte, 8+256*4)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return 0, fmt.Errorf("failed to read pack index %q: %s", idx, err)
+	}
+
+	if !bytes.Equal(header[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(header[4:8]) != 2 {
+		return 0, fmt.Errorf("unsupported pack index version of %q", idx)
+	}
+
+	fanout := header[8:]
+	total := int64(binary.BigEndian.Uint32(fanout[255*4:]))
+
+	var lo int64
+	if want[0] > 0 {
+		lo = int64(binary.BigEndian.Uint32(fanout[(int(want[0])-1)*4:]))
+	}
+
+	hi := int64(binary.BigEndian.Uint32(fanout[int(want[0])*4:]))
+
+	const (
+		namesOffset = 8 + 256*4
+		hashSize    = 20
+	)
+
+	name := make([]byte, hashSize)
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		if _, err := f.ReadAt(name, namesOffset+mid*hashSize); err != nil {
+			return 0, fmt.Errorf("failed to read pack index %q: %s", idx, err)
+		}
+
+		switch cmp := bytes.Compare(name, want); {
+		case cmp < 0:
+			lo = mid + 1
+		case cmp > 0:
+			hi = mid
+		default:
+			offsetsOffset := namesOffset + total*hashSize + total*4
+
+			buf := make([]byte, 8)
+			if _, err := f.ReadAt(buf[:4], offsetsOffset+mid*4); err != nil {
+				return 0, fmt.Errorf("failed to read pack index %q: %s", idx, err)
+			}
+
+			offset := binary.BigEndian.Uint32(buf[:4])
+			if offset&0x80000000 == 0 {
+				return int64(offset), nil
+			}
+
+			largeOffset := offsetsOffset + total*4 + int64(offset&0x7fffffff)*8
+			if _, err := f.ReadAt(buf, largeOffset); err != nil {
+				return 0, fmt.Errorf("failed to read pack index %q: %s", idx, err)
+			}
+
+			return int64(binary.BigEndian.Uint64(buf)), nil // nolint:gosec
+		}
+	}
+
+	return 0, ErrNotFound
+}
+
+// readPackObject reads the object at offset in a pack file and resolves deltas.
+func (r Repository) readPackObject(pack string, offset int64, depth int) (objectType, []byte, error) {
+	if depth > maxDeltaDepth {
+		return 0, nil, fmt.Errorf("delta chain in %q exceeds max depth of %d", pack, maxDeltaDepth)
+	}
+
+	f, err := file.OpenNoLock(pack) // nolint:gosec
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open pack %q: %s", pack, err)
+	}
+
+	defer f.Close() // nolint:errcheck
+
+	br := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read pack %q: %s", pack, err)
+	}
+
+	objtype := objectType((c >> 4) & 0x07)
+	size := int64(c & 0x0f)
+
+	for shift := 4; c&0x80 != 0; shift += 7 {
+		if c, err = br.ReadByte(); err != nil {
+			return 0, nil, fmt.Errorf("failed to read pack %q: %s", pack, err)
+		}
+
+		size |= int64(c&0x7f) << shift
+	}
+
+	var (
+		basetype objectType
+		base     []byte
+	)
+
+	switch objtype {
+	case objCommit, objTree, objBlob, objTag:
+	case objOfsDelta:
+		rel, err := readOfsDeltaOffset(br)
+		if err != nil || rel > offset {
+			return 0, nil, fmt.Errorf("invalid delta base offset in pack %q", pack)
+		}
+
+		basetype, base, err = r.readPackObject(pack, offset-rel, depth+1)
+		if err != nil {
+			return 0, nil, err
+		}
+	case objRefDelta:
+		oid := make([]byte, 20)
+		if _, err := io.ReadFull(br, oid); err != nil {
+			return 0, nil, fmt.Errorf("failed to read pack %q: %s", pack, err)
+		}
+
+		basetype, base, err = r.readObjectDepth(hex.EncodeToString(oid), depth+1)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to read delta base: %w", err)
+		}
+	default:
+		return 0, nil, fmt.Errorf("invalid object type %d in pack %q", objtype, pack)
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to decompress pack object: %s", err)
+	}
+
+	defer zr.Close() // nolint:errcheck
+
+	data, err := readFull(zr, size)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read pack object: %s", err)
+	}
+
+	if base == nil {
+		return objtype, data, nil
+	}
+
+	data, err = applyDelta(base, data)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to apply delta in pack %q: %s", pack, err)
+	}
+
+	return basetype, data, nil
+}
+
+// readOfsDeltaOffset reads the relative offset of the base of an offset delta.
+func readOfsDeltaOffset(br io.ByteReader) (int64, error) {
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	offset := int64(c & 0x7f)
+
+	for c&0x80 != 0 {
+		if c, err = br.ReadByte(); err != nil {
+			return 0, err
+		}
+
+		offset = ((offset + 1) << 7) | int64(c&0x7f)
+	}
+
+	return offset, nil
+}
+
+// applyDelta builds an object from its base and a git delta.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	srcSize, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	if srcSize != uint64(len(base)) {
+		return nil, fmt.Errorf("base size %d doesn't match delta source size %d", len(base), srcSize)
+	}
+
+	dstSize, delta, err := readDeltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	if dstSize > maxObjectSize {
+		return nil, fmt.Errorf("object size %d exceeds max size of %d bytes", dstSize, maxObjectSize)
+	}
+
+	out := make([]byte, 0, dstSize)
+
+	for len(delta) > 0 {
+		cmd := delta[0]
+		delta = delta[1:]
+
+		switch {
+		case cmd&0x80 != 0:
+			var offset, size uint64
+
+			for i := 0; i < 7; i++ {
+				if cmd&(1<<i) == 0 {
+					continue
+				}
+
+				if len(delta) == 0 {
+					return nil, errors.New("truncated copy instruction")
+				}
+
+				if i < 4 {
+					offset |= uint64(delta[0]) << (8 * i)
+				} else {
+					size |= uint64(delta[0]) << (8 * (i - 4))
+				}
+
+				delta = delta[1:]
+			}
+
+			if size == 0 {
+				size = 0x10000
+			}
+
+			if offset+size > uint64(len(base)) {
+				return nil, errors.New("copy instruction out of base bounds")
+			}
+
+			out = append(out, base[offset:offset+size]...)
+		case cmd != 0:
+			if int(cmd) > len(delta) {
+				return nil, errors.New("truncated insert instruction")
+			}
+
+			out = append(out, delta[:cmd]...)
+			delta = delta[cmd:]
+		default:
+			return nil, errors.New("invalid delta instruction")
+		}
+	}
+
+	if uint64(len(out)) != dstSize {
+		return nil, fmt.Errorf("result size %d doesn't match delta target size %d", len(out), dstSize)
+	}
+
+	return out, nil
+}
+
+func readDeltaSize(delta []byte) (uint64, []byte, error) {
+	var size uint64
+
+	for shift := 0; len(delta) > 0; shift += 7 {
+		c := delta[0]
+		delta = delta[1:]
+
+		size |= uint64(c&0x7f) << shift
+
+		if c&0x80 == 0 {
+			return size, delta, nil
+		}
+	}
+
+	return 0, nil, errors.New("truncated delta header")
+}
+
+// readFull reads exactly size bytes of an object.
+func readFull(r io.Reader, size int64) ([]byte, error) {
+	if size > maxObjectSize {
+		return nil, fmt.Errorf("object size %d exceeds max size of %d bytes", size, maxObjectSize)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// parseCommitTree returns the tree id of a commit object.
+func parseCommitTree(data []byte) (string, error) {
+	line, _, _ := bytes.Cut(data, []byte{'\n'})
+
+	tree, ok := bytes.CutPrefix(line, []byte("tree "))
+	if !ok || !isObjectID(string(tree)) {
+		return "", errors.New("missing tree")
+	}
+
+	return string(tree), nil
+}
+
+// findTreeEntry returns the id of the entry with name in a tree object.
+func findTreeEntry(data []byte, name string) (string, error) {
+	for len(data) > 0 {
+		header, rest, ok := bytes.Cut(data, []byte{0})
+		if !ok || len(rest) < 20 {
+			return "", errors.New("invalid tree")
+		}
+
+		_, entry, ok := bytes.Cut(header, []byte{' '})
+		if !ok {
+			return "", errors.New("invalid tree entry")
+		}
+
+		if string(entry) == name {
+			return hex.EncodeToString(rest[:20]), nil
+		}
+
+		data = rest[20:]
+	}
+
+	return "", ErrNotFound
+}
@@ -47,10 +47,13 @@ const (
 	WritingDocsCategory
 	// WritingTestsCategory means user is currently writing tests.
 	WritingTestsCategory
+	// AICodingCategory means user is currently pair-programming with an AI tool.
+	AICodingCategory
 )
 
 const (
 	advisingCategoryString      = "advising"
+	aiCodingCategoryString      = "ai coding"
 	browsingCategoryString      = "browsing"
 	buildingCategoryString      = "building"
 	codeReviewingCategoryString = "code reviewing"
@@ -76,6 +79,8 @@ func ParseCategory(s string) (Category, error) {
 	switch s {
 	case advisingCategoryString:
 		return AdvisingCategory, nil
+	case aiCodingCategoryString:
+		return AICodingCategory, nil
 	case browsingCategoryString:
 		return BrowsingCategory, nil
 	case buildingCategoryString:
@@ -146,6 +151,8 @@ func (c Category) String() string {
 	switch c {
 	case AdvisingCategory:
 		return advisingCategoryString
+	case AICodingCategory:
+		return aiCodingCategoryString
 	case BrowsingCategory:
 		return browsingCategoryString
 	case BuildingCategory:
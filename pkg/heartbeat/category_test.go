@@ -13,6 +13,7 @@ import (
 func categoryTests() map[string]heartbeat.Category {
 	return map[string]heartbeat.Category{
 		"advising":       heartbeat.AdvisingCategory,
+		"ai coding":      heartbeat.AICodingCategory,
 		"browsing":       heartbeat.BrowsingCategory,
 		"building":       heartbeat.BuildingCategory,
 		"code reviewing": heartbeat.CodeReviewingCategory,
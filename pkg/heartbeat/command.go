@@ -0,0 +1,185 @@
+package heartbeat
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+	"github.com/optiflow-os/tracelens-cli/pkg/regex"
+	"github.com/optiflow-os/tracelens-cli/pkg/windows"
+)
+
+// redactedArg replaces command arguments matching a redaction pattern.
+const redactedArg = "REDACTED"
+
+// formatCommand strips environment variable assignments and sudo from a
+// command entity, reduces its executable to its name and makes the working
+// directory absolute.
+func formatCommand(ctx context.Context, h Heartbeat) Heartbeat {
+	if exe, args := SplitCommand(h.Entity); exe != "" {
+		h.Entity = JoinCommand(exe, args)
+	}
+
+	if h.Cwd == "" {
+		return h
+	}
+
+	formatted, err := filepath.Abs(h.Cwd)
+	if err != nil {
+		log.Extract(ctx).Debugf("failed to resolve absolute path for %q: %s", h.Cwd, err)
+		return h
+	}
+
+	if runtime.GOOS == "windows" {
+		formatted = windows.FormatFilePath(formatted)
+	}
+
+	h.Cwd = formatted
+
+	return h
+}
+
+// sanitizeCommandArgs strips all arguments of a command entity unless send is
+// true. Sent arguments matching one of the patterns are redacted, keeping the
+// option name of `--option=value` arguments.
+func sanitizeCommandArgs(ctx context.Context, h Heartbeat, send bool, patterns []regex.Regex) Heartbeat {
+	exe, args := SplitCommand(h.Entity)
+	if exe == "" {
+		return h
+	}
+
+	if !send {
+		h.Entity = exe
+		return h
+	}
+
+	for n, arg := range args {
+		for _, p := range patterns {
+			if !p.MatchString(ctx, arg) {
+				continue
+			}
+
+			if option, _, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(option, "-") {
+				args[n] = option + "=" + redactedArg
+			} else {
+				args[n] = redactedArg
+			}
+
+			break
+		}
+	}
+
+	h.Entity = JoinCommand(exe, args)
+
+	return h
+}
+
+// SplitCommand splits a command line into executable and arguments. Words are
+// split by whitespace, except inside single or double quotes, which are
+// removed. Leading environment variable assignments, sudo and env are
+// skipped, as they are not the executable and may contain secrets. The
+// executable is reduced to its name. Backslashes are kept as they are, as they
+// separate the folders of windows paths.
+func SplitCommand(command string) (string, []string) {
+	fields := splitWords(command)
+
+	for len(fields) > 0 {
+		if fields[0] == "sudo" || fields[0] == "env" || isEnvAssignment(fields[0]) {
+			fields = fields[1:]
+			continue
+		}
+
+		break
+	}
+
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	// executables may be passed with their full path on any platform
+	exe := fields[0][strings.LastIndexAny(fields[0], `/\`)+1:]
+
+	return exe, fields[1:]
+}
+
+// JoinCommand joins executable and arguments to a command line. Arguments
+// containing whitespace or quotes are quoted, so SplitCommand returns them
+// unchanged.
+func JoinCommand(exe string, args []string) string {
+	words := make([]string, 0, len(args)+1)
+	words = append(words, exe)
+
+	for _, arg := range args {
+		switch {
+		case arg != "" && !strings.ContainsAny(arg, " \t\n\r'\""):
+			words = append(words, arg)
+		case !strings.Contains(arg, "'"):
+			words = append(words, "'"+arg+"'")
+		default:
+			words = append(words, `"`+strings.ReplaceAll(arg, `"`, `'`)+`"`)
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// splitWords splits a command line into words by whitespace outside of quotes
+// and removes the quotes.
+func splitWords(command string) []string {
+	var (
+		words []string
+		word  strings.Builder
+		quote rune
+		found bool
+	)
+
+	for _, c := range command {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote = c
+			found = true
+		case unicode.IsSpace(c):
+			if found {
+				words = append(words, word.String())
+				word.Reset()
+			}
+
+			found = false
+		default:
+			word.WriteRune(c)
+			found = true
+		}
+	}
+
+	if found {
+		words = append(words, word.String())
+	}
+
+	return words
+}
+
+// isEnvAssignment returns true for `NAME=value` prefixes of a command line.
+func isEnvAssignment(s string) bool {
+	name, _, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return false
+	}
+
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,71 @@
+package heartbeat_test
+
+import (
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := map[string]struct {
+		Command string
+		Exe     string
+		Args    []string
+	}{
+		"plain": {
+			Command: "/usr/local/go/bin/go  test ./...",
+			Exe:     "go",
+			Args:    []string{"test", "./..."},
+		},
+		"env prefixed": {
+			Command: "GITHUB_TOKEN=abc curl https://api.github.com",
+			Exe:     "curl",
+			Args:    []string{"https://api.github.com"},
+		},
+		"quoted env prefixed": {
+			Command: `TOKEN="a b" API_KEY='c d' make deploy`,
+			Exe:     "make",
+			Args:    []string{"deploy"},
+		},
+		"sudo": {
+			Command: "sudo env PATH=/bin /usr/bin/apt install go",
+			Exe:     "apt",
+			Args:    []string{"install", "go"},
+		},
+		"quoted": {
+			Command: `git commit -m "fix the bug" --author='me <me@example.org>' ""`,
+			Exe:     "git",
+			Args:    []string{"commit", "-m", "fix the bug", "--author=me <me@example.org>", ""},
+		},
+		"windows path": {
+			Command: `C:\tools\ninja.exe -C out`,
+			Exe:     "ninja.exe",
+			Args:    []string{"-C", "out"},
+		},
+		"only env": {
+			Command: "FOO=bar ",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			exe, args := heartbeat.SplitCommand(test.Command)
+
+			assert.Equal(t, test.Exe, exe)
+			assert.Equal(t, test.Args, args)
+		})
+	}
+}
+
+func TestJoinCommand(t *testing.T) {
+	command := heartbeat.JoinCommand("git", []string{"commit", "-m", "fix the bug", "it's", ""})
+
+	assert.Equal(t, `git commit -m 'fix the bug' "it's" ''`, command)
+
+	exe, args := heartbeat.SplitCommand(command)
+
+	assert.Equal(t, "git", exe)
+	assert.Equal(t, []string{"commit", "-m", "fix the bug", "it's", ""}, args)
+}
@@ -19,14 +19,17 @@ const (
 	EventType
 	// AppType represents an app entity.
 	AppType
+	// CommandType represents a terminal command entity.
+	CommandType
 )
 
 const (
-	fileTypeString   = "file"
-	domainTypeString = "domain"
-	urlTypeString    = "url"
-	eventTypeString  = "event"
-	appTypeString    = "app"
+	fileTypeString    = "file"
+	domainTypeString  = "domain"
+	urlTypeString     = "url"
+	eventTypeString   = "event"
+	appTypeString     = "app"
+	commandTypeString = "command"
 )
 
 // ParseEntityType parses an entity type from a string.
@@ -42,6 +45,8 @@ func ParseEntityType(s string) (EntityType, error) {
 		return EventType, nil
 	case appTypeString:
 		return AppType, nil
+	case commandTypeString:
+		return CommandType, nil
 	default:
 		return 0, fmt.Errorf("invalid entity type %q", s)
 	}
@@ -84,6 +89,8 @@ func (t EntityType) String() string {
 		return eventTypeString
 	case AppType:
 		return appTypeString
+	case CommandType:
+		return commandTypeString
 	default:
 		return ""
 	}
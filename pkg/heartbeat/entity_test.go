@@ -12,11 +12,12 @@ import (
 
 func typeTests() map[string]heartbeat.EntityType {
 	return map[string]heartbeat.EntityType{
-		"file":   heartbeat.FileType,
-		"domain": heartbeat.DomainType,
-		"url":    heartbeat.URLType,
-		"event":  heartbeat.EventType,
-		"app":    heartbeat.AppType,
+		"file":    heartbeat.FileType,
+		"domain":  heartbeat.DomainType,
+		"url":     heartbeat.URLType,
+		"event":   heartbeat.EventType,
+		"app":     heartbeat.AppType,
+		"command": heartbeat.CommandType,
 	}
 }
 
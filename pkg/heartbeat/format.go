@@ -12,7 +12,8 @@ import (
 )
 
 // WithFormatting initializes and returns a heartbeat handle option, which
-// can be used in a heartbeat processing pipeline to format entity's filepath.
+// can be used in a heartbeat processing pipeline to format entity's filepath
+// and the executable and working directory of command entities.
 func WithFormatting() HandleOption {
 	return func(next Handle) Handle {
 		return func(ctx context.Context, hh []Heartbeat) ([]Result, error) {
@@ -20,6 +21,11 @@ func WithFormatting() HandleOption {
 			logger.Debugln("execute heartbeat filepath formatting")
 
 			for n, h := range hh {
+				if h.EntityType == CommandType {
+					hh[n] = formatCommand(ctx, h)
+					continue
+				}
+
 				if h.EntityType != FileType {
 					continue
 				}
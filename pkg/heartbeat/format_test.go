@@ -54,6 +54,36 @@ func TestWithFormatting(t *testing.T) {
 	}, result)
 }
 
+func TestWithFormatting_Command(t *testing.T) {
+	opt := heartbeat.WithFormatting()
+
+	cwd, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+
+	if runtime.GOOS == "windows" {
+		cwd = windows.FormatFilePath(cwd)
+	}
+
+	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		assert.Equal(t, []heartbeat.Heartbeat{
+			{
+				Cwd:        cwd,
+				Entity:     "go test ./...",
+				EntityType: heartbeat.CommandType,
+			},
+		}, hh)
+
+		return nil, nil
+	})
+
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{{
+		Cwd:        "testdata",
+		Entity:     "/usr/local/go/bin/go  test ./...",
+		EntityType: heartbeat.CommandType,
+	}})
+	require.NoError(t, err)
+}
+
 func TestFormat_NotFileType(t *testing.T) {
 	tests := map[string]heartbeat.EntityType{
 		"app":    heartbeat.AppType,
@@ -20,14 +20,25 @@ var remoteAddressRegex = regexp.MustCompile(`(?i)^((ssh|sftp)://)+(?P<credential
 
 // Heartbeat is a structure representing activity for a user on a some entity.
 type Heartbeat struct {
+	AILineChanges         *int       `json:"ai_line_changes,omitempty"`
+	AITool                string     `json:"ai_tool,omitempty"`
 	APIKey                string     `json:"-"`
+	APIKeyFingerprint     string     `json:"-"`
+	APIURL                string     `json:"-"`
+	BlankLines            *int       `json:"blank_lines,omitempty"`
 	Branch                *string    `json:"branch,omitempty"`
 	BranchAlternate       string     `json:"-"`
 	Category              Category   `json:"category"`
+	CategoryExplicit      bool       `json:"-"`
+	CodeLines             *int       `json:"code_lines,omitempty"`
+	CommentLines          *int       `json:"comment_lines,omitempty"`
 	CursorPosition        *int       `json:"cursorpos,omitempty"`
+	Cwd                   string     `json:"cwd,omitempty"`
 	Dependencies          []string   `json:"dependencies,omitempty"`
 	Entity                string     `json:"entity"`
 	EntityType            EntityType `json:"type"`
+	FileSize              *int       `json:"file_size,omitempty"`
+	HumanLineChanges      *int       `json:"human_line_changes,omitempty"`
 	IsUnsavedEntity       bool       `json:"-"`
 	IsWrite               *bool      `json:"is_write,omitempty"`
 	Language              *string    `json:"language,omitempty"`
@@ -47,10 +58,13 @@ type Heartbeat struct {
 	ProjectRootCount      *int       `json:"project_root_count,omitempty"`
 	Time                  float64    `json:"time"`
 	UserAgent             string     `json:"user_agent"`
+	// UUID is a version 7 uuid generated once per heartbeat. It's sent as id
+	// and used as idempotency key, so resent heartbeats can be deduplicated.
+	UUID string `json:"id,omitempty"`
 }
 
 // New creates a new instance of Heartbeat with formatted entity
-// and local file paths for file type heartbeats.
+// and local file paths for file type heartbeats and a new UUID.
 func New(
 	branchAlternate string,
 	category Category,
@@ -94,11 +108,17 @@ func New(
 		ProjectPathOverride:  projectPathOverride,
 		Time:                 time,
 		UserAgent:            userAgent,
+		UUID:                 NewUUID(time),
 	}
 }
 
-// ID returns an ID generated from the heartbeat data.
+// ID returns the UUID of the heartbeat. Heartbeats without, like the ones
+// queued by older versions, get an ID generated from the heartbeat data.
 func (h Heartbeat) ID() string {
+	if h.UUID != "" {
+		return h.UUID
+	}
+
 	branch := "unset"
 	if h.Branch != nil {
 		branch = *h.Branch
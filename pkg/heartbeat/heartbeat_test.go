@@ -63,7 +63,10 @@ func TestNew(t *testing.T) {
 		Time:                1592868313.541149,
 		UserAgent:           "wakatime/13.0.7",
 		Entity:              h.Entity,
+		UUID:                h.UUID,
 	}, h)
+
+	assert.Regexp(t, "^0172de59-99c5-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", h.UUID)
 }
 
 func TestHeartbeat_ID(t *testing.T) {
@@ -89,6 +92,15 @@ func TestHeartbeat_ID_NilFields(t *testing.T) {
 	assert.Equal(t, "1592868313.541149-nil-file-coding-unset-unset-/tmp/main.go-false", h.ID())
 }
 
+func TestHeartbeat_ID_UUID(t *testing.T) {
+	h := heartbeat.Heartbeat{
+		Entity: "/tmp/main.go",
+		Time:   1592868313.541149,
+		UUID:   "0172de59-99c5-7b1e-9f3a-1c2d3e4f5a6b",
+	}
+	assert.Equal(t, "0172de59-99c5-7b1e-9f3a-1c2d3e4f5a6b", h.ID())
+}
+
 func TestHeartbeat_JSON(t *testing.T) {
 	h := heartbeat.Heartbeat{
 		Branch:         heartbeat.PointerTo("heartbeat"),
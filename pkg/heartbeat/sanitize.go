@@ -13,6 +13,9 @@ import (
 type SanitizeConfig struct {
 	// BranchPatterns will be matched against the entity file path and if matching, will obfuscate it.
 	BranchPatterns []regex.Regex
+	// CommandArgPatterns will be matched against each argument of a command entity, when sending
+	// arguments, and if matching, will redact it.
+	CommandArgPatterns []regex.Regex
 	// DependencyPatterns will be matched against the entity file path and if matching, will omit all dependencies.
 	DependencyPatterns []regex.Regex
 	// FilePatterns will be matched against a file entity's name and if matching will obfuscate
@@ -23,6 +26,9 @@ type SanitizeConfig struct {
 	// ProjectPatterns will be matched against the entity file path and if matching will obfuscate
 	// common heartbeat meta data (cursor position, dependencies, line number and lines).
 	ProjectPatterns []regex.Regex
+	// SendCommandArgs determines if the arguments of a command entity are sent. By default
+	// only the executable name is sent.
+	SendCommandArgs bool
 }
 
 // WithSanitization initializes and returns a heartbeat handle option, which
@@ -43,7 +49,8 @@ func WithSanitization(config SanitizeConfig) HandleOption {
 }
 
 // Sanitize accepts a heartbeat sanitizes it's sensitive data following passed
-// in configuration and returns the sanitized version. On empty config will do nothing.
+// in configuration and returns the sanitized version. On empty config will only
+// strip the arguments of command entities.
 func Sanitize(ctx context.Context, h Heartbeat, config SanitizeConfig) Heartbeat {
 	if len(h.Dependencies) == 0 {
 		h.Dependencies = nil
@@ -55,6 +62,11 @@ func Sanitize(ctx context.Context, h Heartbeat, config SanitizeConfig) Heartbeat
 		ProjectPathOverride: h.ProjectPathOverride,
 	}
 
+	// commands are matched by their working directory
+	if h.EntityType == CommandType {
+		check.Entity = h.Cwd
+	}
+
 	// project patterns
 	if h.Project != nil {
 		check.Patterns = config.ProjectPatterns
@@ -70,6 +82,7 @@ func Sanitize(ctx context.Context, h Heartbeat, config SanitizeConfig) Heartbeat
 			h.Entity = "HIDDEN" + filepath.Ext(h.Entity)
 		} else {
 			h.Entity = "HIDDEN"
+			h.Cwd = ""
 		}
 
 		if len(config.BranchPatterns) == 0 {
@@ -99,6 +112,10 @@ func Sanitize(ctx context.Context, h Heartbeat, config SanitizeConfig) Heartbeat
 		}
 	}
 
+	if h.EntityType == CommandType {
+		h = sanitizeCommandArgs(ctx, h, config.SendCommandArgs, config.CommandArgPatterns)
+	}
+
 	h = hideProjectFolder(h, config.HideProjectFolder)
 	h = hideCredentials(h)
 
@@ -107,6 +124,15 @@ func Sanitize(ctx context.Context, h Heartbeat, config SanitizeConfig) Heartbeat
 
 // hideProjectFolder makes entity relative to project folder if we're hiding the project folder.
 func hideProjectFolder(h Heartbeat, hideProjectFolder bool) Heartbeat {
+	// commands have no file path, but a working directory
+	if h.EntityType == CommandType && hideProjectFolder && h.ProjectPath != "" {
+		if rel, err := filepath.Rel(h.ProjectPath, h.Cwd); err == nil && !strings.HasPrefix(rel, "..") {
+			h.Cwd = rel
+		}
+
+		return h
+	}
+
 	if h.EntityType != FileType || !hideProjectFolder {
 		return h
 	}
@@ -159,9 +185,13 @@ func hideCredentials(h Heartbeat) Heartbeat {
 	return h
 }
 
-// sanitizeMetaData sanitizes metadata (cursor position, line number, lines and project root count).
+// sanitizeMetaData sanitizes metadata (cursor position, line number, file stats and project root count).
 func sanitizeMetaData(h Heartbeat) Heartbeat {
+	h.BlankLines = nil
+	h.CodeLines = nil
+	h.CommentLines = nil
 	h.CursorPosition = nil
+	h.FileSize = nil
 	h.LineNumber = nil
 	h.Lines = nil
 	h.ProjectRootCount = nil
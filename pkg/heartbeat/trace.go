@@ -0,0 +1,182 @@
+package heartbeat
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+)
+
+// Recorder is a Sender, which records heartbeats instead of sending them to
+// the api. Used to run a processing pipeline without side effects on the api.
+type Recorder struct {
+	Heartbeats []Heartbeat
+}
+
+// SendHeartbeats records the heartbeats and returns a created result for each of them.
+func (r *Recorder) SendHeartbeats(_ context.Context, hh []Heartbeat) ([]Result, error) {
+	results := make([]Result, 0, len(hh))
+
+	for _, h := range hh {
+		r.Heartbeats = append(r.Heartbeats, h)
+		results = append(results, Result{
+			Status:    http.StatusCreated,
+			Heartbeat: h,
+		})
+	}
+
+	return results, nil
+}
+
+// TraceStep contains the heartbeats before and after execution of a pipeline stage.
+// Heartbeats are indexed by their position in the list of heartbeats initially
+// passed into the pipeline. After is nil if the stage did not call the next handle.
+// Reasons contains why the stage skipped heartbeats, if it reported them.
+type TraceStep struct {
+	Stage   string
+	Before  map[int]Heartbeat
+	After   map[int]Heartbeat
+	Reasons map[int]string
+}
+
+// Tracer records the heartbeats passing through the traced stages of a processing pipeline.
+type Tracer struct {
+	Steps []TraceStep
+	ids   []int
+	prev  []Heartbeat
+}
+
+type (
+	ctxTracerMarker struct{}
+
+	ctxTracer struct {
+		tracer *Tracer
+	}
+)
+
+// nolint:gochecknoglobals
+var ctxTracerKey = &ctxTracerMarker{}
+
+// TracerToContext adds the tracer to the context, so traced stages can report
+// why they skipped a heartbeat.
+func TracerToContext(ctx context.Context, t *Tracer) context.Context {
+	return context.WithValue(ctx, ctxTracerKey, &ctxTracer{tracer: t})
+}
+
+// ReportSkipped records the reason a stage skipped a heartbeat. It's a no-op,
+// if the context has no tracer.
+func ReportSkipped(ctx context.Context, h Heartbeat, reason string) {
+	t, ok := ctx.Value(ctxTracerKey).(*ctxTracer)
+	if !ok || t == nil || t.tracer == nil {
+		return
+	}
+
+	t.tracer.skipped(h, reason)
+}
+
+// IDs returns the positions in the initial list of the heartbeats passed to the
+// next handle by the last traced stage, in their current order.
+func (t *Tracer) IDs() []int {
+	return append([]int(nil), t.ids...)
+}
+
+// Trace wraps a handle option, which records the heartbeats before and after its execution.
+func (t *Tracer) Trace(stage string, opt HandleOption) HandleOption {
+	return func(next Handle) Handle {
+		inner := opt(func(ctx context.Context, hh []Heartbeat) ([]Result, error) {
+			t.after(hh)
+
+			return next(ctx, hh)
+		})
+
+		return func(ctx context.Context, hh []Heartbeat) ([]Result, error) {
+			t.before(stage, hh)
+
+			return inner(ctx, hh)
+		}
+	}
+}
+
+func (t *Tracer) before(stage string, hh []Heartbeat) {
+	if t.ids == nil {
+		t.ids = make([]int, len(hh))
+		for n := range hh {
+			t.ids[n] = n
+		}
+	}
+
+	t.prev = append([]Heartbeat(nil), hh...)
+
+	step := TraceStep{
+		Stage:  stage,
+		Before: make(map[int]Heartbeat, len(hh)),
+	}
+
+	for n, h := range t.prev {
+		step.Before[t.ids[n]] = h
+	}
+
+	t.Steps = append(t.Steps, step)
+}
+
+func (t *Tracer) after(hh []Heartbeat) {
+	// stages removing heartbeats don't modify the remaining ones and keep their
+	// order, so identities can be restored by matching them against the input.
+	if len(hh) != len(t.prev) {
+		var (
+			ids []int
+			j   int
+		)
+
+		for _, h := range hh {
+			for j < len(t.prev) && !reflect.DeepEqual(t.prev[j], h) {
+				j++
+			}
+
+			if j == len(t.prev) {
+				break
+			}
+
+			ids = append(ids, t.ids[j])
+			j++
+		}
+
+		t.ids = ids
+	}
+
+	step := &t.Steps[len(t.Steps)-1]
+	step.After = make(map[int]Heartbeat, len(hh))
+
+	for n, h := range hh {
+		if n >= len(t.ids) {
+			break
+		}
+
+		step.After[t.ids[n]] = h
+	}
+}
+
+// skipped matches a heartbeat skipped by the current stage against its input.
+// Stages skipping heartbeats don't modify them before.
+func (t *Tracer) skipped(h Heartbeat, reason string) {
+	if len(t.Steps) == 0 {
+		return
+	}
+
+	step := &t.Steps[len(t.Steps)-1]
+
+	for n, prev := range t.prev {
+		id := t.ids[n]
+
+		if _, ok := step.Reasons[id]; ok || !reflect.DeepEqual(prev, h) {
+			continue
+		}
+
+		if step.Reasons == nil {
+			step.Reasons = make(map[int]string)
+		}
+
+		step.Reasons[id] = reason
+
+		return
+	}
+}
@@ -0,0 +1,144 @@
+package heartbeat_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_SendHeartbeats(t *testing.T) {
+	recorder := &heartbeat.Recorder{}
+
+	results, err := recorder.SendHeartbeats(context.Background(), []heartbeat.Heartbeat{
+		{Entity: "/tmp/main.go"},
+		{Entity: "/tmp/main.py"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []heartbeat.Result{
+		{Status: http.StatusCreated, Heartbeat: heartbeat.Heartbeat{Entity: "/tmp/main.go"}},
+		{Status: http.StatusCreated, Heartbeat: heartbeat.Heartbeat{Entity: "/tmp/main.py"}},
+	}, results)
+	assert.Equal(t, []heartbeat.Heartbeat{
+		{Entity: "/tmp/main.go"},
+		{Entity: "/tmp/main.py"},
+	}, recorder.Heartbeats)
+}
+
+func TestTracer_Trace(t *testing.T) {
+	tracer := &heartbeat.Tracer{}
+
+	filter := func(next heartbeat.Handle) heartbeat.Handle {
+		return func(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			var filtered []heartbeat.Heartbeat
+
+			for _, h := range hh {
+				if strings.HasSuffix(h.Entity, ".py") {
+					continue
+				}
+
+				filtered = append(filtered, h)
+			}
+
+			return next(ctx, filtered)
+		}
+	}
+
+	branch := func(next heartbeat.Handle) heartbeat.Handle {
+		return func(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			for n := range hh {
+				hh[n].Branch = heartbeat.PointerTo("main")
+			}
+
+			return next(ctx, hh)
+		}
+	}
+
+	recorder := &heartbeat.Recorder{}
+
+	handle := heartbeat.NewHandle(recorder,
+		tracer.Trace("filter", filter),
+		tracer.Trace("branch", branch),
+	)
+
+	_, err := handle(context.Background(), []heartbeat.Heartbeat{
+		{Entity: "/tmp/main.go"},
+		{Entity: "/tmp/main.py"},
+		{Entity: "/tmp/lib.go"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []heartbeat.TraceStep{
+		{
+			Stage: "filter",
+			Before: map[int]heartbeat.Heartbeat{
+				0: {Entity: "/tmp/main.go"},
+				1: {Entity: "/tmp/main.py"},
+				2: {Entity: "/tmp/lib.go"},
+			},
+			After: map[int]heartbeat.Heartbeat{
+				0: {Entity: "/tmp/main.go"},
+				2: {Entity: "/tmp/lib.go"},
+			},
+		},
+		{
+			Stage: "branch",
+			Before: map[int]heartbeat.Heartbeat{
+				0: {Entity: "/tmp/main.go"},
+				2: {Entity: "/tmp/lib.go"},
+			},
+			After: map[int]heartbeat.Heartbeat{
+				0: {Entity: "/tmp/main.go", Branch: heartbeat.PointerTo("main")},
+				2: {Entity: "/tmp/lib.go", Branch: heartbeat.PointerTo("main")},
+			},
+		},
+	}, tracer.Steps)
+
+	assert.Len(t, recorder.Heartbeats, 2)
+}
+
+func TestTracer_ReportSkipped(t *testing.T) {
+	tracer := &heartbeat.Tracer{}
+
+	filter := func(next heartbeat.Handle) heartbeat.Handle {
+		return func(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			var filtered []heartbeat.Heartbeat
+
+			for _, h := range hh {
+				if strings.HasSuffix(h.Entity, ".py") {
+					heartbeat.ReportSkipped(ctx, h, "skipping python")
+					continue
+				}
+
+				filtered = append(filtered, h)
+			}
+
+			return next(ctx, filtered)
+		}
+	}
+
+	ctx := heartbeat.TracerToContext(context.Background(), tracer)
+
+	handle := heartbeat.NewHandle(&heartbeat.Recorder{}, tracer.Trace("filter", filter))
+
+	_, err := handle(ctx, []heartbeat.Heartbeat{
+		{Entity: "/tmp/main.py"},
+		{Entity: "/tmp/main.go"},
+		{Entity: "/tmp/lib.py"},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, tracer.Steps, 1)
+	assert.Equal(t, map[int]string{0: "skipping python", 2: "skipping python"}, tracer.Steps[0].Reasons)
+	assert.Equal(t, []int{1}, tracer.IDs())
+}
+
+func TestReportSkipped_NoTracer(_ *testing.T) {
+	heartbeat.ReportSkipped(context.Background(), heartbeat.Heartbeat{}, "skipping")
+}
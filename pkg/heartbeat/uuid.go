@@ -0,0 +1,96 @@
+package heartbeat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewUUID returns a version 7 uuid for a heartbeat at the unix time in seconds.
+// The uuid starts with the unix time in milliseconds, followed by random bits,
+// so uuids sort by time. The current time is used, if secs is not positive.
+func NewUUID(secs float64) string {
+	ms := time.Now().UnixMilli()
+	if secs > 0 {
+		ms = int64(secs * 1000)
+	}
+
+	var b [16]byte
+
+	// never returns an error
+	_, _ = rand.Read(b[6:])
+
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	b[6] = b[6]&0x0f | 0x70 // version 7
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+
+	var s [36]byte
+
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+
+	return string(s[:])
+}
+
+// uuidTimeTolerance is the maximum difference between the time of a uuid passed
+// by a plugin and the time of its heartbeat.
+const uuidTimeTolerance = 60 * time.Second
+
+// ValidUUID returns true, if id is a lowercase version 7 uuid, whose time is
+// within a minute of the heartbeat time secs. The offline queue relies on
+// heartbeat uuids sorting by time, so uuids passed by plugins are only kept,
+// if valid. The time is not checked, if secs is not positive.
+func ValidUUID(id string, secs float64) bool {
+	t, ok := UUIDTime(id)
+	if !ok {
+		return false
+	}
+
+	if secs <= 0 {
+		return true
+	}
+
+	return math.Abs(t-secs) <= uuidTimeTolerance.Seconds()
+}
+
+// UUIDTime returns the unix time in seconds of a lowercase version 7 uuid.
+func UUIDTime(id string) (float64, bool) {
+	if len(id) != 36 || id[8] != '-' || id[13] != '-' || id[18] != '-' || id[23] != '-' {
+		return 0, false
+	}
+
+	for i := range len(id) {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+		case id[i] >= '0' && id[i] <= '9', id[i] >= 'a' && id[i] <= 'f':
+		default:
+			return 0, false
+		}
+	}
+
+	if id[14] != '7' || !strings.ContainsRune("89ab", rune(id[19])) {
+		return 0, false
+	}
+
+	ms, err := strconv.ParseInt(id[0:8]+id[9:13], 16, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return float64(ms) / 1000, true
+}
@@ -0,0 +1,92 @@
+package heartbeat_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewUUID(t *testing.T) {
+	uuid := heartbeat.NewUUID(1592868313.541149)
+
+	assert.Regexp(t, "^0172de59-99c5-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", uuid)
+	assert.NotEqual(t, uuid, heartbeat.NewUUID(1592868313.541149))
+}
+
+func TestNewUUID_CurrentTime(t *testing.T) {
+	before := heartbeat.NewUUID(float64(time.Now().Add(-time.Second).UnixMilli()) / 1000)
+	uuid := heartbeat.NewUUID(0)
+
+	assert.Less(t, before, uuid)
+}
+
+func TestNewUUID_TimeOrdered(t *testing.T) {
+	uuids := []string{
+		heartbeat.NewUUID(1592868313.541),
+		heartbeat.NewUUID(1592868313.542),
+		heartbeat.NewUUID(1592868314),
+		heartbeat.NewUUID(1692868313),
+	}
+
+	assert.True(t, sort.StringsAreSorted(uuids))
+}
+
+func TestValidUUID(t *testing.T) {
+	tests := map[string]struct {
+		ID       string
+		Time     float64
+		Expected bool
+	}{
+		"valid": {
+			ID:       heartbeat.NewUUID(1592868313.541149),
+			Time:     1592868313.541149,
+			Expected: true,
+		},
+		"valid without time": {
+			ID:       heartbeat.NewUUID(1592868313.541149),
+			Expected: true,
+		},
+		"time within tolerance": {
+			ID:       heartbeat.NewUUID(1592868313.541149),
+			Time:     1592868343,
+			Expected: true,
+		},
+		"time mismatch": {
+			ID:   heartbeat.NewUUID(1592868313.541149),
+			Time: 1692868313,
+		},
+		"version 4": {
+			ID: "0172de59-99c5-4abc-8def-0123456789ab",
+		},
+		"invalid variant": {
+			ID: "0172de59-99c5-7abc-cdef-0123456789ab",
+		},
+		"uppercase": {
+			ID: "0172DE59-99C5-7ABC-8DEF-0123456789AB",
+		},
+		"legacy id": {
+			ID: "1592868313.541149-12-file-coding-wakatime-cli-heartbeat-/tmp/main.go-true",
+		},
+		"arbitrary": {
+			ID: "zzzzzzzz",
+		},
+		"empty": {},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.Expected, heartbeat.ValidUUID(test.ID, test.Time))
+		})
+	}
+}
+
+func TestUUIDTime(t *testing.T) {
+	secs, ok := heartbeat.UUIDTime(heartbeat.NewUUID(1592868313.541149))
+	assert.True(t, ok)
+
+	assert.Equal(t, 1592868313.541, secs)
+}
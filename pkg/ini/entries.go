@@ -0,0 +1,359 @@
+package ini
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Entry is a key value pair read from a config file, with its position.
+type Entry struct {
+	Section string
+	Key     string
+	Value   string
+	// Line is the line number of the key.
+	Line int
+	// ValueLines are the line numbers of the lines of a multiline value.
+	ValueLines []int
+}
+
+// SyntaxError is returned, if a config file cannot be parsed.
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+// Error method to implement error interface.
+func (e SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// ReadEntries reads all key value pairs of a config file in order. Ini config
+// files are read following the same rules as the parser used to load the config
+// into viper, including python style and triple quoted multiline values.
+func ReadEntries(filepath string) ([]Entry, error) {
+	switch FormatOf(filepath) {
+	case FormatTOML:
+		return readTOMLEntries(filepath)
+	case FormatYAML:
+		return readYAMLEntries(filepath)
+	default:
+		return readINIEntries(filepath)
+	}
+}
+
+func readINIEntries(filepath string) ([]Entry, error) {
+	f, err := os.Open(filepath) // nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %s", err)
+	}
+
+	defer f.Close()
+
+	var (
+		entries []Entry
+		section string
+		// current is the entry, which may be continued on the following lines
+		current *Entry
+		// quoted is true, while reading a triple quoted multiline value
+		quoted bool
+		number int
+	)
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		number++
+
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+
+		if quoted {
+			before, _, found := strings.Cut(line, `"""`)
+
+			current.Value += "\n" + before
+			current.ValueLines = append(current.ValueLines, number)
+
+			if found {
+				quoted = false
+				current = nil
+			}
+
+			continue
+		}
+
+		// python style multiline values continue on indented lines
+		if current != nil && line != "" && (line[0] == ' ' || line[0] == '\t' || line[0] == '\f') {
+			current.Value += "\n" + line
+			current.ValueLines = append(current.ValueLines, number)
+
+			continue
+		}
+
+		current = nil
+
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "", trimmed[0] == '#', trimmed[0] == ';':
+			continue
+		case trimmed[0] == '[':
+			closeIdx := strings.LastIndexByte(trimmed, ']')
+			if closeIdx == -1 {
+				return nil, SyntaxError{Line: number, Msg: fmt.Sprintf("unclosed section: %s", trimmed)}
+			}
+
+			section = strings.TrimSpace(trimmed[1:closeIdx])
+
+			continue
+		}
+
+		idx := strings.IndexAny(trimmed, "=:")
+		if idx == -1 {
+			return nil, SyntaxError{Line: number, Msg: fmt.Sprintf("key-value delimiter not found: %s", trimmed)}
+		}
+
+		if idx == 0 {
+			return nil, SyntaxError{Line: number, Msg: fmt.Sprintf("empty key name: %s", trimmed)}
+		}
+
+		entries = append(entries, Entry{
+			Section:    section,
+			Key:        strings.TrimSpace(trimmed[:idx]),
+			Line:       number,
+			ValueLines: []int{number},
+		})
+
+		current = &entries[len(entries)-1]
+
+		value := strings.TrimSpace(trimmed[idx+1:])
+
+		if rest, ok := strings.CutPrefix(value, `"""`); ok {
+			before, _, found := strings.Cut(rest, `"""`)
+			current.Value = before
+
+			if !found {
+				quoted = true
+			} else {
+				current = nil
+			}
+
+			continue
+		}
+
+		if i := strings.IndexAny(value, "#;"); i > -1 {
+			value = strings.TrimSpace(value[:i])
+		}
+
+		if len(value) > 1 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		current.Value = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %s", err)
+	}
+
+	if quoted {
+		return nil, SyntaxError{Line: number, Msg: "unclosed multiline value"}
+	}
+
+	return entries, nil
+}
+
+// readYAMLEntries reads the key value pairs of a yaml config file. Sections
+// are the top level mappings. Lists are read as multiline values.
+func readYAMLEntries(filepath string) ([]Entry, error) {
+	b, err := os.ReadFile(filepath) // nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %s", err)
+	}
+
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		var line int
+		if _, serr := fmt.Sscanf(err.Error(), "yaml: line %d:", &line); serr == nil {
+			_, msg, _ := strings.Cut(err.Error(), ": line "+strconv.Itoa(line)+": ")
+			return nil, SyntaxError{Line: line, Msg: msg}
+		}
+
+		return nil, SyntaxError{Line: 1, Msg: strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, SyntaxError{Line: root.Line, Msg: "expected a mapping of sections"}
+	}
+
+	var entries []Entry
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		name, value := root.Content[i], root.Content[i+1]
+
+		if value.Kind != yaml.MappingNode {
+			entries = append(entries, yamlEntry("", name, value))
+			continue
+		}
+
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			entries = append(entries, yamlEntry(name.Value, value.Content[j], value.Content[j+1]))
+		}
+	}
+
+	return entries, nil
+}
+
+func yamlEntry(section string, key, value *yaml.Node) Entry {
+	e := Entry{
+		Section:    section,
+		Key:        key.Value,
+		Line:       key.Line,
+		ValueLines: []int{value.Line},
+	}
+
+	if value.Kind == yaml.SequenceNode {
+		lines := make([]string, 0, len(value.Content))
+		e.ValueLines = make([]int, 0, len(value.Content))
+
+		for _, item := range value.Content {
+			lines = append(lines, item.Value)
+			e.ValueLines = append(e.ValueLines, item.Line)
+		}
+
+		e.Value = strings.Join(lines, "\n")
+
+		return e
+	}
+
+	var decoded any
+
+	if err := value.Decode(&decoded); err == nil {
+		e.Value = toString(decoded)
+	}
+
+	return e
+}
+
+// readTOMLEntries reads the key value pairs of a toml config file. Sections
+// are the tables. Arrays are read as multiline values.
+func readTOMLEntries(filepath string) ([]Entry, error) {
+	b, err := os.ReadFile(filepath) // nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %s", err)
+	}
+
+	m := map[string]any{}
+
+	if err := toml.Unmarshal(b, &m); err != nil {
+		var errdecode *toml.DecodeError
+		if errors.As(err, &errdecode) {
+			row, _ := errdecode.Position()
+			return nil, SyntaxError{Line: row, Msg: errdecode.Error()}
+		}
+
+		return nil, SyntaxError{Line: 1, Msg: err.Error()}
+	}
+
+	var (
+		entries []Entry
+		section string
+	)
+
+	// the decoded values have no positions, so keys are looked up line by line
+	for n, line := range strings.Split(string(b), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "", trimmed[0] == '#':
+			continue
+		case trimmed[0] == '[':
+			section, _ = parseTOMLKey(strings.TrimPrefix(trimmed, "["), ']')
+
+			continue
+		}
+
+		key, ok := parseTOMLKey(trimmed, '=')
+		if !ok {
+			// continuation of a multiline array or string
+			continue
+		}
+
+		value := m[key]
+		if section != "" {
+			kv, _ := m[section].(map[string]any)
+			value = kv[key]
+		}
+
+		entries = append(entries, Entry{
+			Section:    section,
+			Key:        key,
+			Value:      toString(value),
+			Line:       n + 1,
+			ValueLines: []int{n + 1},
+		})
+	}
+
+	return entries, nil
+}
+
+// parseTOMLKey parses a bare or quoted key up to the delimiter.
+func parseTOMLKey(s string, delim byte) (string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", false
+	}
+
+	var key string
+
+	switch s[0] {
+	case '"':
+		end := 1
+		for end < len(s) && (s[end] != '"' || s[end-1] == '\\') {
+			end++
+		}
+
+		if end == len(s) {
+			return "", false
+		}
+
+		unquoted, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return "", false
+		}
+
+		key, s = unquoted, s[end+1:]
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end == -1 {
+			return "", false
+		}
+
+		key, s = s[1:end+1], s[end+2:]
+	default:
+		idx := strings.IndexByte(s, delim)
+		if idx == -1 {
+			return "", false
+		}
+
+		key, s = strings.TrimSpace(s[:idx]), s[idx:]
+	}
+
+	s = strings.TrimSpace(s)
+	if s == "" || s[0] != delim {
+		return "", false
+	}
+
+	return key, true
+}
@@ -0,0 +1,150 @@
+package ini_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/ini"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadEntries(t *testing.T) {
+	entries, err := ini.ReadEntries("testdata/entries.cfg")
+	require.NoError(t, err)
+
+	assert.Equal(t, []ini.Entry{
+		{
+			Section:    "settings",
+			Key:        "api_key",
+			Value:      "00000000-0000-4000-8000-000000000000",
+			Line:       3,
+			ValueLines: []int{3},
+		},
+		{
+			Section:    "settings",
+			Key:        "debug",
+			Value:      "true",
+			Line:       4,
+			ValueLines: []int{4},
+		},
+		{
+			Section:    "settings",
+			Key:        "exclude",
+			Value:      "\n  ^/tmp/\n  COMMIT_EDITMSG$",
+			Line:       5,
+			ValueLines: []int{5, 6, 7},
+		},
+		{
+			Section:    "git",
+			Key:        "submodules_disabled",
+			Value:      "\n  .*secret.*\n  fix.*",
+			Line:       10,
+			ValueLines: []int{10, 11, 12},
+		},
+	}, entries)
+}
+
+func TestReadEntries_SyntaxError(t *testing.T) {
+	tests := map[string]struct {
+		Content  string
+		Expected ini.SyntaxError
+	}{
+		"unclosed section": {
+			Content:  "[settings\ndebug = true\n",
+			Expected: ini.SyntaxError{Line: 1, Msg: "unclosed section: [settings"},
+		},
+		"missing delimiter": {
+			Content:  "[settings]\ndebug = true\ninvalid\n",
+			Expected: ini.SyntaxError{Line: 3, Msg: "key-value delimiter not found: invalid"},
+		},
+		"unclosed multiline value": {
+			Content:  "[settings]\nexclude = \"\"\"\n  ^/tmp/\n",
+			Expected: ini.SyntaxError{Line: 3, Msg: "unclosed multiline value"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fp := filepath.Join(t.TempDir(), "wakatime.cfg")
+
+			err := os.WriteFile(fp, []byte(test.Content), 0600)
+			require.NoError(t, err)
+
+			_, err = ini.ReadEntries(fp)
+			require.Error(t, err)
+
+			var errsyntax ini.SyntaxError
+
+			require.ErrorAs(t, err, &errsyntax)
+
+			assert.Equal(t, test.Expected, errsyntax)
+		})
+	}
+}
+
+func TestReadEntries_Formats(t *testing.T) {
+	expected := []ini.Entry{
+		{Section: "settings", Key: "api_key", Value: "b9485572-74bf-419a-916b-22056ca3a24c", Line: 2, ValueLines: []int{2}},
+		{Section: "settings", Key: "debug", Value: "true", Line: 3, ValueLines: []int{3}},
+		{Section: "settings", Key: "timeout", Value: "30", Line: 4, ValueLines: []int{4}},
+		{Section: "settings", Key: "exclude", Value: "^/tmp/\nCOMMIT_EDITMSG$", Line: 5, ValueLines: []int{6, 7}},
+		{Section: "projectmap", Key: "/some/path", Value: "project-y", Line: 10, ValueLines: []int{10}},
+		{Section: "project_api_key", Key: "/some/path", Value: "project-x", Line: 13, ValueLines: []int{13}},
+		{Section: "project_api_key", Key: "/other/tmp/path", Value: "project-2", Line: 14, ValueLines: []int{14}},
+	}
+
+	entries, err := ini.ReadEntries("testdata/wakatime.yaml")
+	require.NoError(t, err)
+
+	assert.Equal(t, expected, entries)
+
+	// toml values have no positions
+	expected[3].ValueLines = []int{5}
+	expected[4].Line, expected[4].ValueLines = 11, []int{11}
+	expected[5].Line, expected[5].ValueLines = 14, []int{14}
+	expected[6].Line, expected[6].ValueLines = 15, []int{15}
+
+	entries, err = ini.ReadEntries("testdata/wakatime.toml")
+	require.NoError(t, err)
+
+	assert.Equal(t, expected, entries)
+}
+
+func TestReadEntries_FormatsSyntaxError(t *testing.T) {
+	tests := map[string]struct {
+		Filename string
+		Content  string
+		Expected int
+	}{
+		"toml": {
+			Filename: "wakatime.toml",
+			Content:  "[settings]\ndebug = true\ninvalid\n",
+			Expected: 3,
+		},
+		"yaml": {
+			Filename: "wakatime.yaml",
+			Content:  "settings:\n  debug: true\n invalid: [\n",
+			Expected: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fp := filepath.Join(t.TempDir(), test.Filename)
+
+			err := os.WriteFile(fp, []byte(test.Content), 0600)
+			require.NoError(t, err)
+
+			_, err = ini.ReadEntries(fp)
+			require.Error(t, err)
+
+			var errsyntax ini.SyntaxError
+			require.ErrorAs(t, err, &errsyntax)
+
+			assert.Equal(t, test.Expected, errsyntax.Line, errsyntax.Msg)
+		})
+	}
+}
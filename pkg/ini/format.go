@@ -0,0 +1,264 @@
+package ini
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a config file format.
+type Format string
+
+const (
+	// FormatINI is the ini config file format, used by default.
+	FormatINI Format = "ini"
+	// FormatTOML is the toml config file format.
+	FormatTOML Format = "toml"
+	// FormatYAML is the yaml config file format.
+	FormatYAML Format = "yaml"
+)
+
+// ParseFormat parses a config file format from a string.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "ini", "cfg":
+		return FormatINI, nil
+	case "toml":
+		return FormatTOML, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	default:
+		return "", fmt.Errorf("invalid config format %q, expected ini, toml or yaml", s)
+	}
+}
+
+// FormatOf returns the format of a config file by its extension. Files
+// without a .toml, .yaml or .yml extension are ini files.
+func FormatOf(fp string) Format {
+	switch strings.ToLower(filepath.Ext(fp)) {
+	case ".toml":
+		return FormatTOML
+	case ".yaml", ".yml":
+		return FormatYAML
+	default:
+		return FormatINI
+	}
+}
+
+// Ext returns the file extension of the format.
+func (f Format) Ext() string {
+	switch f {
+	case FormatTOML:
+		return ".toml"
+	case FormatYAML:
+		return ".yaml"
+	default:
+		return ".cfg"
+	}
+}
+
+// String implements fmt.Stringer interface.
+func (f Format) String() string {
+	return string(f)
+}
+
+// YAMLCodec decodes yaml config files into the same key structure as ini
+// config files. It implements viper.Codec interface.
+type YAMLCodec struct{}
+
+// Decode decodes yaml into sections of string values. Lists become multiline values.
+func (YAMLCodec) Decode(b []byte, v map[string]any) error {
+	m := map[string]any{}
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	normalize(m, v)
+
+	return nil
+}
+
+// Encode encodes sections of string values into yaml. Multiline values become lists.
+func (YAMLCodec) Encode(v map[string]any) ([]byte, error) {
+	return yaml.Marshal(denormalize(v))
+}
+
+// TOMLCodec decodes toml config files into the same key structure as ini
+// config files. It implements viper.Codec interface.
+type TOMLCodec struct{}
+
+// Decode decodes toml into sections of string values. Arrays become multiline values.
+func (TOMLCodec) Decode(b []byte, v map[string]any) error {
+	m := map[string]any{}
+	if err := toml.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	normalize(m, v)
+
+	return nil
+}
+
+// Encode encodes sections of string values into toml. Multiline values become arrays.
+func (TOMLCodec) Encode(v map[string]any) ([]byte, error) {
+	return toml.Marshal(denormalize(v))
+}
+
+// Encode encodes sections of key value pairs into a config file of the given format.
+func Encode(format Format, sections map[string]map[string]string) ([]byte, error) {
+	v := make(map[string]any, len(sections))
+
+	for section, kv := range sections {
+		m := make(map[string]any, len(kv))
+		for key, value := range kv {
+			m[key] = value
+		}
+
+		v[section] = m
+	}
+
+	switch format {
+	case FormatTOML:
+		return TOMLCodec{}.Encode(v)
+	case FormatYAML:
+		return YAMLCodec{}.Encode(v)
+	}
+
+	f := ini.Empty()
+
+	names := make([]string, 0, len(sections))
+	for section := range sections {
+		names = append(names, section)
+	}
+
+	sort.Strings(names)
+
+	for _, section := range names {
+		keys := make([]string, 0, len(sections[section]))
+		for key := range sections[section] {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			f.Section(section).Key(key).SetValue(sections[section][key])
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if _, err := f.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// normalize copies sections of decoded values into dst, converting each value
+// into a string like read from an ini config file.
+func normalize(src, dst map[string]any) {
+	for section, value := range src {
+		kv, ok := value.(map[string]any)
+		if !ok {
+			dst[section] = toString(value)
+			continue
+		}
+
+		m := make(map[string]any, len(kv))
+		for key, value := range kv {
+			m[key] = toString(value)
+		}
+
+		dst[section] = m
+	}
+}
+
+// denormalize converts sections of string values into typed values, so bools
+// and integers aren't quoted and multiline values are written as lists.
+func denormalize(src map[string]any) map[string]any {
+	dst := make(map[string]any, len(src))
+
+	for section, value := range src {
+		kv, ok := value.(map[string]any)
+		if !ok {
+			dst[section] = fromString(value)
+			continue
+		}
+
+		m := make(map[string]any, len(kv))
+		for key, value := range kv {
+			m[key] = fromString(value)
+		}
+
+		dst[section] = m
+	}
+
+	return dst
+}
+
+func toString(value any) string {
+	switch val := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case time.Time:
+		return val.Format(DateFormat)
+	case []any:
+		lines := make([]string, 0, len(val))
+		for _, item := range val {
+			lines = append(lines, toString(item))
+		}
+
+		return strings.Join(lines, "\n")
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func fromString(value any) any {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	s = strings.Trim(s, "\n\t ")
+
+	switch {
+	case strings.EqualFold(s, "true"):
+		return true
+	case strings.EqualFold(s, "false"):
+		return false
+	case isInt(s):
+		n, _ := strconv.Atoi(s)
+		return n
+	case strings.Contains(s, "\n"):
+		var lines []string
+
+		for _, line := range strings.Split(s, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+
+		return lines
+	default:
+		return s
+	}
+}
+
+// isInt returns true for integers, which are formatted the same way again, so
+// values with leading zeros stay strings.
+func isInt(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && strconv.Itoa(n) == s
+}
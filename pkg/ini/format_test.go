@@ -0,0 +1,71 @@
+package ini_test
+
+import (
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/ini"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	for value, expected := range map[string]ini.Format{
+		"ini":  ini.FormatINI,
+		"cfg":  ini.FormatINI,
+		"TOML": ini.FormatTOML,
+		"yaml": ini.FormatYAML,
+		"yml":  ini.FormatYAML,
+	} {
+		t.Run(value, func(t *testing.T) {
+			format, err := ini.ParseFormat(value)
+			require.NoError(t, err)
+
+			assert.Equal(t, expected, format)
+		})
+	}
+}
+
+func TestParseFormat_Invalid(t *testing.T) {
+	_, err := ini.ParseFormat("json")
+
+	assert.EqualError(t, err, `invalid config format "json", expected ini, toml or yaml`)
+}
+
+func TestFormatOf(t *testing.T) {
+	assert.Equal(t, ini.FormatINI, ini.FormatOf("/home/user/.wakatime.cfg"))
+	assert.Equal(t, ini.FormatINI, ini.FormatOf("/home/user/wakatime"))
+	assert.Equal(t, ini.FormatTOML, ini.FormatOf("/home/user/.tracelens.toml"))
+	assert.Equal(t, ini.FormatYAML, ini.FormatOf("/home/user/.tracelens.YAML"))
+	assert.Equal(t, ini.FormatYAML, ini.FormatOf("/home/user/.tracelens.yml"))
+}
+
+func TestEncode(t *testing.T) {
+	sections := map[string]map[string]string{
+		"settings": {
+			"debug":   "true",
+			"exclude": "\n  ^/tmp/\n  COMMIT_EDITMSG$",
+		},
+		"projectmap": {
+			"^/some/path/(.+)": "{0}",
+		},
+	}
+
+	tests := map[ini.Format]string{
+		ini.FormatINI: "[projectmap]\n^/some/path/(.+) = {0}\n\n[settings]\ndebug   = true\n" +
+			"exclude = \"\"\"\n  ^/tmp/\n  COMMIT_EDITMSG$\"\"\"\n",
+		ini.FormatTOML: "[projectmap]\n'^/some/path/(.+)' = '{0}'\n\n[settings]\ndebug = true\n" +
+			"exclude = ['^/tmp/', 'COMMIT_EDITMSG$']\n",
+		ini.FormatYAML: "projectmap:\n    ^/some/path/(.+): '{0}'\nsettings:\n    debug: true\n" +
+			"    exclude:\n        - ^/tmp/\n        - COMMIT_EDITMSG$\n",
+	}
+
+	for format, expected := range tests {
+		t.Run(format.String(), func(t *testing.T) {
+			b, err := ini.Encode(format, sections)
+			require.NoError(t, err)
+
+			assert.Equal(t, expected, string(b))
+		})
+	}
+}
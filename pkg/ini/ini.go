@@ -16,8 +16,10 @@ import (
 
 	"github.com/juju/mutex"
 	"github.com/mitchellh/go-homedir"
+	"github.com/pelletier/go-toml/v2"
 	"github.com/spf13/viper"
 	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
 )
 
 // WakaHomeType is WakaTime home type.
@@ -27,6 +29,12 @@ const (
 	defaultFolder = ".wakatime"
 	// defaultFile is the name of the default wakatime config file.
 	defaultFile = ".wakatime.cfg"
+	// defaultTOMLFile is the name of the default config file in toml format.
+	defaultTOMLFile = ".tracelens.toml"
+	// defaultYAMLFile is the name of the default config file in yaml format.
+	defaultYAMLFile = ".tracelens.yaml"
+	// defaultYMLFile is the alternative name of the default config file in yaml format.
+	defaultYMLFile = ".tracelens.yml"
 	// defaultInternalFile is the name of the default wakatime internal config file.
 	defaultInternalFile = "wakatime-internal.cfg"
 	// DateFormat is the default format for date in config file.
@@ -50,7 +58,12 @@ type Writer interface {
 // WriterConfig stores the configuration necessary to write to config file.
 type WriterConfig struct {
 	ConfigFilepath string
-	File           *ini.File
+	// Format is the format of the config file. Empty means ini.
+	Format Format
+	// File is the loaded ini config file.
+	File *ini.File
+	// values holds the decoded sections of a toml or yaml config file.
+	values map[string]any
 }
 
 // NewWriter creates a new writer instance.
@@ -80,6 +93,19 @@ func NewWriter(
 		}
 	}
 
+	if format := FormatOf(configFilepath); format != FormatINI {
+		values, err := loadValues(configFilepath, format)
+		if err != nil {
+			return nil, fmt.Errorf("error loading config file: %s", err)
+		}
+
+		return &WriterConfig{
+			ConfigFilepath: configFilepath,
+			Format:         format,
+			values:         values,
+		}, nil
+	}
+
 	ini, err := ini.LoadSources(ini.LoadOptions{
 		AllowPythonMultilineValues: true,
 		SkipUnrecognizableLines:    true,
@@ -98,7 +124,9 @@ func NewWriter(
 func (w *WriterConfig) Write(ctx context.Context, section string, keyValue map[string]string) error {
 	logger := log.Extract(ctx)
 
-	if w.File == nil || w.ConfigFilepath == "" {
+	structured := w.Format != "" && w.Format != FormatINI
+
+	if (!structured && w.File == nil) || (structured && w.values == nil) || w.ConfigFilepath == "" {
 		return errors.New("got undefined wakatime config file instance")
 	}
 
@@ -107,6 +135,11 @@ func (w *WriterConfig) Write(ctx context.Context, section string, keyValue map[s
 		key = strings.ReplaceAll(key, "\x00", "")
 		value = strings.ReplaceAll(value, "\x00", "")
 
+		if structured {
+			setValue(w.values, section, key, value)
+			continue
+		}
+
 		w.File.Section(section).Key(key).SetValue(value)
 	}
 
@@ -126,6 +159,14 @@ func (w *WriterConfig) Write(ctx context.Context, section string, keyValue map[s
 		}
 	}()
 
+	if structured {
+		if err := saveValues(w.ConfigFilepath, w.Format, w.values); err != nil {
+			return fmt.Errorf("error saving wakatime config: %s", err)
+		}
+
+		return nil
+	}
+
 	if err := w.File.SaveTo(w.ConfigFilepath); err != nil {
 		return fmt.Errorf("error saving wakatime config: %s", err)
 	}
@@ -133,9 +174,64 @@ func (w *WriterConfig) Write(ctx context.Context, section string, keyValue map[s
 	return nil
 }
 
+// loadValues decodes a toml or yaml config file, keeping the value types.
+func loadValues(fp string, format Format) (map[string]any, error) {
+	b, err := os.ReadFile(fp) // nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]any{}
+
+	switch format {
+	case FormatTOML:
+		err = toml.Unmarshal(b, &values)
+	default:
+		err = yaml.Unmarshal(b, &values)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// saveValues encodes the sections of a toml or yaml config file and writes them to disk.
+func saveValues(fp string, format Format, values map[string]any) error {
+	var (
+		b   []byte
+		err error
+	)
+
+	switch format {
+	case FormatTOML:
+		b, err = toml.Marshal(values)
+	default:
+		b, err = yaml.Marshal(values)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fp, b, 0600)
+}
+
+// setValue sets the value of a key in a section of decoded config values.
+func setValue(values map[string]any, section, key, value string) {
+	kv, ok := values[section].(map[string]any)
+	if !ok {
+		kv = map[string]any{}
+		values[section] = kv
+	}
+
+	kv[key] = fromString(value)
+}
+
 // ReadInConfig reads wakatime config file in memory.
 func ReadInConfig(v *viper.Viper, configFilePath string) error {
-	v.SetConfigType("ini")
+	v.SetConfigType(FormatOf(configFilePath).String())
 	v.SetConfigFile(configFilePath)
 
 	if err := v.MergeInConfig(); err != nil {
@@ -162,6 +258,13 @@ func FilePath(ctx context.Context, v *viper.Viper) (string, error) {
 		return "", fmt.Errorf("failed to get user's home directory: %s", err)
 	}
 
+	// the ini config file takes precedence, if more than one exists
+	for _, name := range []string{defaultFile, defaultYAMLFile, defaultYMLFile, defaultTOMLFile} {
+		if fp := filepath.Join(home, name); fileExists(fp) {
+			return fp, nil
+		}
+	}
+
 	return filepath.Join(home, defaultFile), nil
 }
 
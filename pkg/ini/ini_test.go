@@ -53,6 +53,26 @@ func TestReadInConfig_Multiline(t *testing.T) {
 	assert.Equal(t, "\n  .*secret.*\n  fix.*", gitConfig)
 }
 
+func TestReadInConfig_Formats(t *testing.T) {
+	for _, fp := range []string{"testdata/wakatime.toml", "testdata/wakatime.yaml"} {
+		t.Run(fp, func(t *testing.T) {
+			v := setupViper(t)
+
+			err := ini.ReadInConfig(v, fp)
+			require.NoError(t, err)
+
+			assert.Equal(t, "b9485572-74bf-419a-916b-22056ca3a24c", vipertools.GetString(v, "settings.api_key"))
+			assert.Equal(t, "true", vipertools.GetString(v, "settings.debug"))
+			assert.Equal(t, 30, v.GetInt("settings.timeout"))
+			assert.Equal(t, "^/tmp/\nCOMMIT_EDITMSG$", vipertools.GetString(v, "settings.exclude"))
+			assert.Equal(t, []string{"^/tmp/", "COMMIT_EDITMSG$"}, v.GetStringSlice("settings.exclude"))
+			assert.Equal(t, "project-y", vipertools.GetString(v, "projectmap./some/path"))
+			assert.Equal(t, "project-x", vipertools.GetString(v, "project_api_key./some/path"))
+			assert.Equal(t, "project-2", vipertools.GetString(v, "project_api_key./other/tmp/path"))
+		})
+	}
+}
+
 func TestReadInConfig_Multiple(t *testing.T) {
 	v := setupViper(t)
 	v.Set("config", "testdata/wakatime.cfg")
@@ -161,6 +181,51 @@ func TestFilePath(t *testing.T) {
 	}
 }
 
+func TestFilePath_Formats(t *testing.T) {
+	tests := map[string]struct {
+		Files    []string
+		Expected string
+	}{
+		"none": {
+			Expected: ".wakatime.cfg",
+		},
+		"yaml": {
+			Files:    []string{".tracelens.yaml"},
+			Expected: ".tracelens.yaml",
+		},
+		"yml": {
+			Files:    []string{".tracelens.yml"},
+			Expected: ".tracelens.yml",
+		},
+		"toml": {
+			Files:    []string{".tracelens.toml"},
+			Expected: ".tracelens.toml",
+		},
+		"ini takes precedence": {
+			Files:    []string{".tracelens.toml", ".wakatime.cfg"},
+			Expected: ".wakatime.cfg",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+
+			for _, f := range test.Files {
+				err := os.WriteFile(filepath.Join(tmpDir, f), nil, 0600)
+				require.NoError(t, err)
+			}
+
+			t.Setenv("WAKATIME_HOME", tmpDir)
+
+			configFilepath, err := ini.FilePath(context.Background(), setupViper(t))
+			require.NoError(t, err)
+
+			assert.Equal(t, filepath.Join(tmpDir, test.Expected), configFilepath)
+		})
+	}
+}
+
 func TestInternalFilePath(t *testing.T) {
 	home, err := os.UserHomeDir()
 	require.NoError(t, err)
@@ -296,6 +361,52 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+func TestWrite_Formats(t *testing.T) {
+	tests := map[string]struct {
+		Source   string
+		Expected string
+	}{
+		"toml": {
+			Source: "[settings]\nexclude = ['^/tmp/', 'COMMIT_EDITMSG$']\n",
+			Expected: "[internal]\nbackoff_retries = 3\n\n[settings]\ndebug = true\n" +
+				"exclude = ['^/tmp/', 'COMMIT_EDITMSG$']\nhostname = 'example'\n",
+		},
+		"yaml": {
+			Source: "settings:\n  exclude:\n    - ^/tmp/\n    - COMMIT_EDITMSG$\n",
+			Expected: "internal:\n    backoff_retries: 3\nsettings:\n    debug: true\n" +
+				"    exclude:\n        - ^/tmp/\n        - COMMIT_EDITMSG$\n    hostname: example\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			configFilepath := filepath.Join(t.TempDir(), "wakatime."+name)
+
+			err := os.WriteFile(configFilepath, []byte(test.Source), 0600)
+			require.NoError(t, err)
+
+			v := setupViper(t)
+			v.Set("config", configFilepath)
+
+			w, err := ini.NewWriter(context.Background(), v, ini.FilePath)
+			require.NoError(t, err)
+
+			assert.Equal(t, ini.Format(name), w.Format)
+
+			err = w.Write(context.Background(), "settings", map[string]string{"debug": "true", "hostname": "example"})
+			require.NoError(t, err)
+
+			err = w.Write(context.Background(), "internal", map[string]string{"backoff_retries": "3"})
+			require.NoError(t, err)
+
+			actual, err := os.ReadFile(configFilepath)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.Expected, string(actual))
+		})
+	}
+}
+
 func TestWrite_NoMultilineSideEffects(t *testing.T) {
 	tmpFile, err := os.CreateTemp(t.TempDir(), "wakatime")
 	require.NoError(t, err)
@@ -387,6 +498,12 @@ func setupViper(t *testing.T) *viper.Viper {
 	err := codecRegistry.RegisterCodec("ini", iniCodec)
 	require.NoError(t, err)
 
+	err = codecRegistry.RegisterCodec("toml", ini.TOMLCodec{})
+	require.NoError(t, err)
+
+	err = codecRegistry.RegisterCodec("yaml", ini.YAMLCodec{})
+	require.NoError(t, err)
+
 	v := viper.NewWithOptions(viper.WithCodecRegistry(codecRegistry))
 
 	return v
@@ -0,0 +1,213 @@
+package offline
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// keyFileSuffix is appended to the offline db filepath to get the filepath of its key file.
+	keyFileSuffix = ".key"
+	// keySize is the size of the AES-256 key encrypting the offline db in bytes.
+	keySize = 32
+	// dbQuarantineBucket is the bolt db bucket storing queued records, which
+	// cannot be decrypted or parsed.
+	dbQuarantineBucket = "quarantine"
+)
+
+// encryptedPrefix marks encrypted records. Records without it were stored in
+// plaintext by older versions.
+// nolint:gochecknoglobals
+var encryptedPrefix = []byte("enc:v1:")
+
+// KeyFilepath returns the path of the key file encrypting the offline db at filepath.
+func KeyFilepath(filepath string) string {
+	return filepath + keyFileSuffix
+}
+
+// loadCipher loads the key of the offline db at filepath and returns an AES-GCM
+// cipher. If there is no key yet, a random one is generated and saved with 0600
+// permissions, which is reported by created. A key is never generated, while db
+// contains encrypted records, as they could not be decrypted anymore. Must only
+// be called while holding the db file lock, so concurrent processes don't
+// generate different keys.
+func loadCipher(db *bolt.DB, filepath string) (aead cipher.AEAD, created bool, err error) {
+	keyFile := KeyFilepath(filepath)
+
+	data, err := os.ReadFile(keyFile) // nolint:gosec
+	if os.IsNotExist(err) {
+		encrypted, err := hasEncrypted(db)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to check for encrypted records: %s", err)
+		}
+
+		if encrypted {
+			return nil, false, fmt.Errorf(
+				"key file %q not found, but offline db contains encrypted heartbeats."+
+					" Restore the key file or move the offline db away to start with an empty one",
+				keyFile,
+			)
+		}
+
+		key := make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, false, fmt.Errorf("failed to generate key: %s", err)
+		}
+
+		data = []byte(hex.EncodeToString(key))
+
+		if err := os.WriteFile(keyFile, data, 0600); err != nil {
+			return nil, false, fmt.Errorf("failed to write key file: %s", err)
+		}
+
+		created = true
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to read key file: %s", err)
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode key file %q: %s", keyFile, err)
+	}
+
+	if len(key) != keySize {
+		return nil, false, fmt.Errorf("invalid key size in key file %q: %d bytes", keyFile, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create cipher: %s", err)
+	}
+
+	aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create gcm cipher: %s", err)
+	}
+
+	return aead, created, nil
+}
+
+// encrypt encrypts a record with a random nonce. Returns the record unchanged,
+// if aead is nil.
+func encrypt(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	if aead == nil {
+		return plaintext, nil
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %s", err)
+	}
+
+	data := make([]byte, 0, len(encryptedPrefix)+len(nonce)+len(plaintext)+aead.Overhead())
+	data = append(data, encryptedPrefix...)
+	data = append(data, nonce...)
+
+	return aead.Seal(data, nonce, plaintext, nil), nil
+}
+
+// decrypt decrypts a record. Plaintext records are returned unchanged.
+func decrypt(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedPrefix) {
+		return data, nil
+	}
+
+	if aead == nil {
+		return nil, errors.New("missing key to decrypt record")
+	}
+
+	data = data[len(encryptedPrefix):]
+
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted record too short")
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt record: %s", err)
+	}
+
+	return plaintext, nil
+}
+
+// errFound stops iterating over the db, once a record was found.
+var errFound = errors.New("found")
+
+// hasEncrypted returns true, if any bucket of the db contains an encrypted record.
+func hasEncrypted(db *bolt.DB) (bool, error) {
+	return hasRecord(db, func(v []byte) bool {
+		return bytes.HasPrefix(v, encryptedPrefix)
+	})
+}
+
+// hasPlaintext returns true, if any bucket of the db contains a plaintext record.
+func hasPlaintext(db *bolt.DB) (bool, error) {
+	return hasRecord(db, func(v []byte) bool {
+		return v != nil && !bytes.HasPrefix(v, encryptedPrefix)
+	})
+}
+
+// hasRecord returns true, if any bucket of the db contains a record matching match.
+func hasRecord(db *bolt.DB, match func([]byte) bool) (bool, error) {
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+			return b.ForEach(func(_, v []byte) error {
+				if match(v) {
+					return errFound
+				}
+
+				return nil
+			})
+		})
+	})
+	if errors.Is(err, errFound) {
+		return true, nil
+	}
+
+	return false, err
+}
+
+// encryptPlaintext encrypts the plaintext records stored by older versions in
+// all buckets of the db. Older versions might still store plaintext records
+// after the key was generated, so it runs whenever plaintext records are found.
+func encryptPlaintext(db *bolt.DB, aead cipher.AEAD) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			plaintext := map[string][]byte{}
+
+			// the bucket must not be modified while iterating over it
+			err := b.ForEach(func(k, v []byte) error {
+				if v != nil && !bytes.HasPrefix(v, encryptedPrefix) {
+					plaintext[string(k)] = bytes.Clone(v)
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for k, v := range plaintext {
+				data, err := encrypt(aead, v)
+				if err != nil {
+					return err
+				}
+
+				if err := b.Put([]byte(k), data); err != nil {
+					return fmt.Errorf("failed to store encrypted record %q in bucket %q: %s", k, name, err)
+				}
+			}
+
+			return nil
+		})
+	})
+}
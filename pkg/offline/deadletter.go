@@ -0,0 +1,438 @@
+package offline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+)
+
+const (
+	// dbDeadLetterBucket is the bolt db bucket storing heartbeats rejected by the api.
+	dbDeadLetterBucket = "dead_letters"
+	// DeadLettersMax is the maximum number of dead letters kept in the offline
+	// db. The oldest ones are dropped, when it is exceeded. The retention policy
+	// of the offline queue does not apply to dead letters.
+	DeadLettersMax = 1000
+)
+
+// DeadLetter is a heartbeat rejected by the api with a 400 response, stored
+// with the error returned by the api, so it can be fixed up and retried.
+type DeadLetter struct {
+	Error      string              `json:"error"`
+	Heartbeat  heartbeat.Heartbeat `json:"heartbeat"`
+	ID         string              `json:"id"`
+	RejectedAt time.Time           `json:"rejected_at"`
+	Status     int                 `json:"status"`
+}
+
+// deadLetterRecord is the representation of a dead letter in the offline db.
+// It keeps the heartbeat as record, so its routing metadata is not lost.
+type deadLetterRecord struct {
+	Error      string    `json:"error"`
+	Heartbeat  record    `json:"heartbeat"`
+	RejectedAt time.Time `json:"rejected_at"`
+	Status     int       `json:"status"`
+}
+
+// FixUp modifies a rejected heartbeat before retrying it.
+type FixUp func(heartbeat.Heartbeat) heartbeat.Heartbeat
+
+// Truncate returns a fix-up truncating the entity, project, branch, language,
+// cwd, ai tool and dependencies of a heartbeat to at most max characters.
+func Truncate(max int) FixUp {
+	return func(h heartbeat.Heartbeat) heartbeat.Heartbeat {
+		h.AITool = truncate(h.AITool, max)
+		h.Cwd = truncate(h.Cwd, max)
+		h.Entity = truncate(h.Entity, max)
+
+		if h.Branch != nil {
+			h.Branch = heartbeat.PointerTo(truncate(*h.Branch, max))
+		}
+
+		if h.Language != nil {
+			h.Language = heartbeat.PointerTo(truncate(*h.Language, max))
+		}
+
+		if h.Project != nil {
+			h.Project = heartbeat.PointerTo(truncate(*h.Project, max))
+		}
+
+		if len(h.Dependencies) > 0 {
+			deps := make([]string, len(h.Dependencies))
+			for i, d := range h.Dependencies {
+				deps[i] = truncate(d, max)
+			}
+
+			h.Dependencies = deps
+		}
+
+		return h
+	}
+}
+
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+
+	return string([]rune(s)[:max])
+}
+
+// ReadDeadLetters reads all dead letters in the offline db.
+func ReadDeadLetters(ctx context.Context, filepath string) ([]DeadLetter, error) {
+	db, aead, close, err := openDB(ctx, filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start db transaction: %s", err)
+	}
+
+	logger := log.Extract(ctx)
+
+	defer func() {
+		err := tx.Rollback()
+		if err != nil {
+			logger.Errorf("failed to rollback transaction: %s", err)
+		}
+	}()
+
+	queue := newQueue(tx, aead)
+
+	dd, err := queue.ReadDeadLetters()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %s", err)
+	}
+
+	if len(queue.unreadable) > 0 {
+		logger.Warnf(
+			"skipped %d unreadable dead letter(s) with id(s) %s. They may be encrypted with another key than %s and can be purged by id",
+			len(queue.unreadable),
+			strings.Join(queue.unreadable, ", "),
+			KeyFilepath(filepath),
+		)
+	}
+
+	return dd, nil
+}
+
+// RequeueDeadLetters moves the dead letters with the given ids, or all dead
+// letters if no ids are given, back to the offline queue, after applying the
+// fix-ups to their heartbeats. The retention policy is enforced afterwards.
+// Returns the number of requeued heartbeats.
+func RequeueDeadLetters(
+	ctx context.Context,
+	filepath string,
+	retention Retention,
+	ids []string,
+	fixUps ...FixUp,
+) (int, error) {
+	db, aead, close, err := openDB(ctx, filepath)
+	if err != nil {
+		return 0, err
+	}
+
+	defer close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start db transaction: %s", err)
+	}
+
+	queue := newQueue(tx, aead)
+	queue.Retention = retention
+
+	dd, err := queue.PopDeadLetters(ids)
+	if err != nil {
+		_ = tx.Rollback()
+
+		return 0, fmt.Errorf("failed to pop dead letters: %s", err)
+	}
+
+	hh := make([]heartbeat.Heartbeat, 0, len(dd))
+
+	for _, d := range dd {
+		h := d.Heartbeat
+		for _, fixUp := range fixUps {
+			h = fixUp(h)
+		}
+
+		hh = append(hh, h)
+	}
+
+	if err := queue.PushMany(hh); err != nil {
+		_ = tx.Rollback()
+
+		return 0, fmt.Errorf("failed to push heartbeat(s) to queue: %s", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit db transaction: %s", err)
+	}
+
+	if queue.quarantined > 0 {
+		log.Extract(ctx).Warnf(
+			"moved %d unreadable dead letter(s) to bucket %q. They may be encrypted with another key than %s",
+			queue.quarantined,
+			dbQuarantineBucket,
+			KeyFilepath(filepath),
+		)
+	}
+
+	return len(hh), nil
+}
+
+// PurgeDeadLetters deletes the dead letters with the given ids, or all dead
+// letters if no ids are given. Dead letters are deleted by id without reading
+// them, so unreadable ones can be purged as well. Returns the number of deleted
+// dead letters.
+func PurgeDeadLetters(ctx context.Context, filepath string, ids []string) (int, error) {
+	db, aead, close, err := openDB(ctx, filepath)
+	if err != nil {
+		return 0, err
+	}
+
+	defer close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start db transaction: %s", err)
+	}
+
+	queue := newQueue(tx, aead)
+
+	count, err := queue.DeleteDeadLetters(ids)
+	if err != nil {
+		_ = tx.Rollback()
+
+		return 0, fmt.Errorf("failed to delete dead letters: %s", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit db transaction: %s", err)
+	}
+
+	return count, nil
+}
+
+func pushDeadLetters(ctx context.Context, filepath string, dd []DeadLetter) error {
+	db, aead, close, err := openDB(ctx, filepath)
+	if err != nil {
+		return err
+	}
+
+	defer close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return fmt.Errorf("failed to start db transaction: %s", err)
+	}
+
+	queue := newQueue(tx, aead)
+
+	if err := queue.PushDeadLetters(dd); err != nil {
+		_ = tx.Rollback()
+
+		return fmt.Errorf("failed to push dead letters: %s", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit db transaction: %s", err)
+	}
+
+	return nil
+}
+
+// CountDeadLetters returns the number of dead letters in the db.
+func (q *Queue) CountDeadLetters() (int, error) {
+	b, err := q.tx.CreateBucketIfNotExists([]byte(dbDeadLetterBucket))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	return keyCount(b), nil
+}
+
+// PushDeadLetters stores the dead letters in the db. They are keyed by the ID
+// of their heartbeat, so a heartbeat rejected again replaces its dead letter.
+// The oldest dead letters are dropped, if there are more than DeadLettersMax.
+func (q *Queue) PushDeadLetters(dd []DeadLetter) error {
+	b, err := q.tx.CreateBucketIfNotExists([]byte(dbDeadLetterBucket))
+	if err != nil {
+		return fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	for _, d := range dd {
+		data, err := json.Marshal(deadLetterRecord{
+			Error:      d.Error,
+			Heartbeat:  newRecord(d.Heartbeat),
+			RejectedAt: d.RejectedAt,
+			Status:     d.Status,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to json marshal dead letter: %s", err)
+		}
+
+		data, err = encrypt(q.aead, data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt dead letter: %s", err)
+		}
+
+		if err := b.Put([]byte(d.Heartbeat.ID()), data); err != nil {
+			return fmt.Errorf("failed to store dead letter with id %q: %s", d.Heartbeat.ID(), err)
+		}
+	}
+
+	return deleteKeys(b, firstKeys(b, keyCount(b)-DeadLettersMax, q.deadLetterTime))
+}
+
+// ReadDeadLetters reads all dead letters from the db without deleting them.
+// Unreadable dead letters are skipped and their ids kept in q.unreadable.
+func (q *Queue) ReadDeadLetters() ([]DeadLetter, error) {
+	b, err := q.tx.CreateBucketIfNotExists([]byte(dbDeadLetterBucket))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	var dd = make([]DeadLetter, 0)
+
+	c := b.Cursor()
+
+	for key, value := c.First(); key != nil; key, value = c.Next() {
+		d, err := q.parseDeadLetter(key, value)
+		if err != nil {
+			q.unreadable = append(q.unreadable, string(key))
+			continue
+		}
+
+		dd = append(dd, d)
+	}
+
+	return dd, nil
+}
+
+// PopDeadLetters retrieves and deletes the dead letters with the given ids, or
+// all dead letters if no ids are given. Unknown ids are ignored. Unreadable dead
+// letters are moved to the quarantine bucket.
+func (q *Queue) PopDeadLetters(ids []string) ([]DeadLetter, error) {
+	b, err := q.tx.CreateBucketIfNotExists([]byte(dbDeadLetterBucket))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	if len(ids) == 0 {
+		c := b.Cursor()
+
+		for key, _ := c.First(); key != nil; key, _ = c.Next() {
+			ids = append(ids, string(key))
+		}
+	}
+
+	var (
+		dd         []DeadLetter
+		unreadable = map[string][]byte{}
+	)
+
+	for _, id := range ids {
+		value := b.Get([]byte(id))
+		if value == nil {
+			continue
+		}
+
+		d, err := q.parseDeadLetter([]byte(id), value)
+		if err != nil {
+			unreadable[id] = bytes.Clone(value)
+			continue
+		}
+
+		dd = append(dd, d)
+	}
+
+	for _, d := range dd {
+		if err := b.Delete([]byte(d.ID)); err != nil {
+			return nil, fmt.Errorf("failed to delete key %q: %s", d.ID, err)
+		}
+	}
+
+	if err := q.quarantine(b, unreadable); err != nil {
+		return nil, err
+	}
+
+	return dd, nil
+}
+
+// DeleteDeadLetters deletes the dead letters with the given ids, or all dead
+// letters if no ids are given, without reading them. Unknown ids are ignored.
+// Returns the number of deleted dead letters.
+func (q *Queue) DeleteDeadLetters(ids []string) (int, error) {
+	b, err := q.tx.CreateBucketIfNotExists([]byte(dbDeadLetterBucket))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	if len(ids) == 0 {
+		c := b.Cursor()
+
+		for key, _ := c.First(); key != nil; key, _ = c.Next() {
+			ids = append(ids, string(key))
+		}
+	}
+
+	var count int
+
+	for _, id := range ids {
+		if b.Get([]byte(id)) == nil {
+			continue
+		}
+
+		if err := b.Delete([]byte(id)); err != nil {
+			return 0, fmt.Errorf("failed to delete key %q: %s", id, err)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// deadLetterTime returns the heartbeat time of a dead letter.
+func (q *Queue) deadLetterTime(value []byte) (float64, error) {
+	d, err := q.parseDeadLetter(nil, value)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.Heartbeat.Time, nil
+}
+
+func (q *Queue) parseDeadLetter(key, value []byte) (DeadLetter, error) {
+	value, err := decrypt(q.aead, value)
+	if err != nil {
+		return DeadLetter{}, fmt.Errorf("failed to decrypt dead letter with key %q: %s", key, err)
+	}
+
+	var r deadLetterRecord
+
+	if err := json.Unmarshal(value, &r); err != nil {
+		return DeadLetter{}, fmt.Errorf("failed to json unmarshal dead letter with key %q: %s", key, err)
+	}
+
+	return DeadLetter{
+		Error:      r.Error,
+		Heartbeat:  r.Heartbeat.heartbeat(),
+		ID:         string(key),
+		RejectedAt: r.RejectedAt,
+		Status:     r.Status,
+	}, nil
+}
@@ -0,0 +1,401 @@
+package offline_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/api"
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/offline"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestWithQueue_BadRequestResults(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	opt := offline.WithQueue(queueFilepath, offline.Retention{})
+
+	handle := opt(func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		return []heartbeat.Result{
+			{
+				Status:    201,
+				Heartbeat: testHeartbeats()[0],
+			},
+			{
+				Status:    400,
+				Heartbeat: testHeartbeats()[1],
+				Errors:    []string{"entity:", "too long"},
+			},
+		}, nil
+	})
+
+	_, err := handle(context.Background(), testHeartbeats()[:2])
+	require.NoError(t, err)
+
+	count, err := offline.CountHeartbeats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Zero(t, count)
+
+	dd, err := offline.ReadDeadLetters(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	require.Len(t, dd, 1)
+
+	assert.Equal(t, "entity: too long", dd[0].Error)
+	assert.Equal(t, testHeartbeats()[1], dd[0].Heartbeat)
+	assert.Equal(t, testHeartbeats()[1].ID(), dd[0].ID)
+	assert.Equal(t, 400, dd[0].Status)
+	assert.False(t, dd[0].RejectedAt.IsZero())
+}
+
+func TestWithQueue_ErrBadRequest(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	opt := offline.WithQueue(queueFilepath, offline.Retention{})
+
+	var numCalls int
+
+	// the api rejects the whole batch, if one heartbeat is invalid
+	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		numCalls++
+
+		for _, h := range hh {
+			if h.Entity == testHeartbeats()[1].Entity {
+				return nil, api.ErrBadRequest{
+					Body: `{"error":"invalid"}`,
+					Err:  errors.New("bad request"),
+				}
+			}
+		}
+
+		results := make([]heartbeat.Result, 0, len(hh))
+		for _, h := range hh {
+			results = append(results, heartbeat.Result{Status: 201, Heartbeat: h})
+		}
+
+		return results, nil
+	})
+
+	results, err := handle(context.Background(), testHeartbeats()[:2])
+	require.NoError(t, err)
+
+	// the batch is retried one by one
+	assert.Equal(t, 3, numCalls)
+
+	require.Len(t, results, 2)
+	assert.Equal(t, 201, results[0].Status)
+	assert.Equal(t, 400, results[1].Status)
+
+	// rejected heartbeats are not queued again
+	count, err := offline.CountHeartbeats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Zero(t, count)
+
+	dd, err := offline.ReadDeadLetters(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	require.Len(t, dd, 1)
+
+	assert.Equal(t, `{"error":"invalid"}`, dd[0].Error)
+	assert.Equal(t, testHeartbeats()[1].ID(), dd[0].ID)
+	assert.Equal(t, 400, dd[0].Status)
+}
+
+func TestWithQueue_ErrBadRequest_SingleHeartbeat(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	opt := offline.WithQueue(queueFilepath, offline.Retention{})
+
+	handle := opt(func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		return nil, api.ErrBadRequest{
+			Body: `{"error":"invalid"}`,
+			Err:  errors.New("bad request"),
+		}
+	})
+
+	_, err := handle(context.Background(), testHeartbeats()[:1])
+	require.Error(t, err)
+
+	count, err := offline.CountHeartbeats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Zero(t, count)
+
+	dd, err := offline.ReadDeadLetters(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	require.Len(t, dd, 1)
+
+	assert.Equal(t, `{"error":"invalid"}`, dd[0].Error)
+	assert.Equal(t, 400, dd[0].Status)
+}
+
+func TestWithQueue_ErrBadRequest_ErrorWhileRetrying(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	opt := offline.WithQueue(queueFilepath, offline.Retention{})
+
+	var numCalls int
+
+	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		numCalls++
+
+		switch numCalls {
+		case 1:
+			return nil, api.ErrBadRequest{Err: errors.New("bad request")}
+		case 2:
+			return []heartbeat.Result{{Status: 201, Heartbeat: hh[0]}}, nil
+		default:
+			return nil, errors.New("connection refused")
+		}
+	})
+
+	_, err := handle(context.Background(), testHeartbeats()[:3])
+	require.Error(t, err)
+
+	// heartbeats not sent are queued
+	hh, err := offline.ReadHeartbeats(context.Background(), queueFilepath, 10)
+	require.NoError(t, err)
+
+	require.Len(t, hh, 2)
+
+	assert.Equal(t, testHeartbeats()[1].ID(), hh[0].ID())
+	assert.Equal(t, testHeartbeats()[2].ID(), hh[1].ID())
+
+	dd, err := offline.ReadDeadLetters(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Empty(t, dd)
+}
+
+func TestSync_ErrBadRequest(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	_, err := offline.ImportHeartbeats(context.Background(), queueFilepath, offline.Retention{}, testHeartbeats())
+	require.NoError(t, err)
+
+	syncFn := offline.Sync(context.Background(), queueFilepath, 10, offline.Retention{})
+
+	var numCalls int
+
+	err = syncFn(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		numCalls++
+
+		for _, h := range hh {
+			if h.Entity == testHeartbeats()[1].Entity {
+				return nil, api.ErrBadRequest{Err: errors.New("bad request")}
+			}
+		}
+
+		results := make([]heartbeat.Result, 0, len(hh))
+		for _, h := range hh {
+			results = append(results, heartbeat.Result{Status: 201, Heartbeat: h})
+		}
+
+		return results, nil
+	})
+	require.NoError(t, err)
+
+	// the batch is retried one by one
+	assert.Equal(t, 4, numCalls)
+
+	count, err := offline.CountHeartbeats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Zero(t, count)
+
+	dd, err := offline.ReadDeadLetters(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	require.Len(t, dd, 1)
+
+	assert.Equal(t, testHeartbeats()[1].ID(), dd[0].ID)
+}
+
+func TestPushDeadLetters_Max(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	hh := make([]heartbeat.Heartbeat, 0, offline.DeadLettersMax+1)
+
+	for i := 0; i <= offline.DeadLettersMax; i++ {
+		h := testHeartbeats()[0]
+		h.Time += float64(i)
+
+		hh = append(hh, h)
+	}
+
+	pushDeadLetters(t, queueFilepath, hh)
+
+	dd, err := offline.ReadDeadLetters(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	require.Len(t, dd, offline.DeadLettersMax)
+
+	// the oldest dead letter is dropped
+	assert.Equal(t, hh[1].ID(), dd[0].ID)
+}
+
+func TestRequeueDeadLetters(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	pushDeadLetters(t, queueFilepath, testHeartbeats()[:2])
+
+	count, err := offline.RequeueDeadLetters(
+		context.Background(),
+		queueFilepath,
+		offline.Retention{},
+		[]string{testHeartbeats()[0].ID(), "unknown"},
+		offline.Truncate(4),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, count)
+
+	hh, err := offline.ReadHeartbeats(context.Background(), queueFilepath, 10)
+	require.NoError(t, err)
+
+	require.Len(t, hh, 1)
+
+	assert.Equal(t, "/tmp", hh[0].Entity)
+	assert.Equal(t, "waka", *hh[0].Project)
+	assert.Equal(t, "hear", *hh[0].Branch)
+	assert.Equal(t, []string{"dep1", "dep2"}, hh[0].Dependencies)
+
+	dd, err := offline.ReadDeadLetters(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	require.Len(t, dd, 1)
+
+	assert.Equal(t, testHeartbeats()[1].ID(), dd[0].ID)
+}
+
+func TestPurgeDeadLetters(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	pushDeadLetters(t, queueFilepath, testHeartbeats())
+
+	count, err := offline.PurgeDeadLetters(context.Background(), queueFilepath, []string{testHeartbeats()[2].ID()})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, count)
+
+	stats, err := offline.ReadStats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, stats.DeadLetters)
+
+	// no ids purges all dead letters
+	count, err = offline.PurgeDeadLetters(context.Background(), queueFilepath, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, count)
+
+	stats, err = offline.ReadStats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Zero(t, stats.DeadLetters)
+}
+
+func TestReadDeadLetters_Unreadable(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	pushDeadLetters(t, queueFilepath, testHeartbeats()[:1])
+
+	// replace the key, so the first dead letter cannot be decrypted anymore
+	err := os.WriteFile(offline.KeyFilepath(queueFilepath), []byte(strings.Repeat("ab", 32)), 0600)
+	require.NoError(t, err)
+
+	pushDeadLetters(t, queueFilepath, testHeartbeats()[1:2])
+
+	dd, err := offline.ReadDeadLetters(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	require.Len(t, dd, 1)
+
+	assert.Equal(t, testHeartbeats()[1].ID(), dd[0].ID)
+
+	count, err := offline.RequeueDeadLetters(context.Background(), queueFilepath, offline.Retention{}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, count)
+
+	stats, err := offline.ReadStats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Zero(t, stats.DeadLetters)
+
+	db, err := bolt.Open(queueFilepath, 0600, nil)
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 1, tx.Bucket([]byte("quarantine")).Stats().KeyN)
+
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestPurgeDeadLetters_Unreadable(t *testing.T) {
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	pushDeadLetters(t, queueFilepath, testHeartbeats()[:1])
+
+	err := os.WriteFile(offline.KeyFilepath(queueFilepath), []byte(strings.Repeat("ab", 32)), 0600)
+	require.NoError(t, err)
+
+	count, err := offline.PurgeDeadLetters(context.Background(), queueFilepath, []string{testHeartbeats()[0].ID()})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, count)
+
+	stats, err := offline.ReadStats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Zero(t, stats.DeadLetters)
+}
+
+func TestTruncate(t *testing.T) {
+	h := offline.Truncate(3)(heartbeat.Heartbeat{
+		Entity:   "äöüß",
+		Language: heartbeat.PointerTo("Go"),
+	})
+
+	assert.Equal(t, "äöü", h.Entity)
+	assert.Equal(t, "Go", *h.Language)
+	assert.Nil(t, h.Branch)
+}
+
+// pushDeadLetters stores the heartbeats as dead letters, by letting the api
+// reject them.
+func pushDeadLetters(t *testing.T, queueFilepath string, hh []heartbeat.Heartbeat) {
+	t.Helper()
+
+	handle := offline.WithQueue(queueFilepath, offline.Retention{})(
+		func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			var results []heartbeat.Result
+
+			for _, h := range hh {
+				results = append(results, heartbeat.Result{
+					Status:    400,
+					Heartbeat: h,
+					Errors:    []string{"invalid"},
+				})
+			}
+
+			return results, nil
+		})
+
+	_, err := handle(context.Background(), hh)
+	require.NoError(t, err)
+}
@@ -0,0 +1,220 @@
+package offline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+)
+
+// ExportHeartbeats writes all heartbeats in the offline db to w as newline
+// delimited json, one record per line, including the routing metadata needed
+// to sync them later. Heartbeats are not deleted. Unreadable records, e.g.
+// encrypted with a lost key, are skipped. Returns the queue keys of the
+// exported heartbeats and the number of skipped records.
+func ExportHeartbeats(ctx context.Context, filepath string, w io.Writer) ([]string, int, error) {
+	db, aead, close, err := openDB(ctx, filepath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to start db transaction: %s", err)
+	}
+
+	logger := log.Extract(ctx)
+
+	defer func() {
+		err := tx.Rollback()
+		if err != nil {
+			logger.Errorf("failed to rollback transaction: %s", err)
+		}
+	}()
+
+	queue := newQueue(tx, aead)
+
+	keys, skipped, err := queue.Export(w)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to export heartbeats: %s", err)
+	}
+
+	if skipped > 0 {
+		logger.Warnf("skipped %d unreadable heartbeat(s) in offline db", skipped)
+	}
+
+	return keys, skipped, nil
+}
+
+// DeleteHeartbeats deletes the heartbeats with the given queue keys from the
+// offline db.
+func DeleteHeartbeats(ctx context.Context, filepath string, keys []string) error {
+	db, aead, close, err := openDB(ctx, filepath)
+	if err != nil {
+		return err
+	}
+
+	defer close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return fmt.Errorf("failed to start db transaction: %s", err)
+	}
+
+	queue := newQueue(tx, aead)
+
+	if err := queue.DeleteMany(keys); err != nil {
+		_ = tx.Rollback()
+
+		return fmt.Errorf("failed to delete heartbeats: %s", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit db transaction: %s", err)
+	}
+
+	return nil
+}
+
+// ImportHeartbeats stores the given heartbeats in the offline db, skipping
+// heartbeats whose queue key already exists. The retention policy is enforced
+// afterwards. Returns the number of imported heartbeats.
+func ImportHeartbeats(ctx context.Context, filepath string, retention Retention, hh []heartbeat.Heartbeat) (int, error) {
+	db, aead, close, err := openDB(ctx, filepath)
+	if err != nil {
+		return 0, err
+	}
+
+	defer close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start db transaction: %s", err)
+	}
+
+	queue := newQueue(tx, aead)
+	queue.Retention = retention
+
+	imported, err := queue.Import(hh)
+	if err != nil {
+		_ = tx.Rollback()
+
+		return 0, fmt.Errorf("failed to import heartbeats: %s", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit db transaction: %s", err)
+	}
+
+	return imported, nil
+}
+
+// ParseRecord parses a heartbeat with its routing metadata from a record
+// written by ExportHeartbeats. The routing metadata is not validated, so
+// records from untrusted sources must be checked with apikey.ValidateRouting.
+func ParseRecord(data []byte) (heartbeat.Heartbeat, error) {
+	var r record
+
+	if err := json.Unmarshal(data, &r); err != nil {
+		return heartbeat.Heartbeat{}, fmt.Errorf("failed to json unmarshal record: %s", err)
+	}
+
+	return r.heartbeat(), nil
+}
+
+// Export writes all records in the queue to w as newline delimited json and
+// returns their keys. Records, which cannot be decrypted or parsed, are skipped
+// and only counted, so a damaged record does not prevent exporting the others.
+func (q *Queue) Export(w io.Writer) ([]string, int, error) {
+	b, err := q.tx.CreateBucketIfNotExists([]byte(q.Bucket))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	var (
+		keys    []string
+		skipped int
+	)
+
+	c := b.Cursor()
+
+	for key, value := c.First(); key != nil; key, value = c.Next() {
+		value, err := decrypt(q.aead, value)
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		// records stored by older versions might span multiple lines
+		var buf bytes.Buffer
+
+		if err := json.Compact(&buf, value); err != nil {
+			skipped++
+			continue
+		}
+
+		buf.WriteByte('\n')
+
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return nil, 0, fmt.Errorf("failed to write heartbeat with key %q: %s", key, err)
+		}
+
+		keys = append(keys, string(key))
+	}
+
+	return keys, skipped, nil
+}
+
+// DeleteMany deletes the heartbeats with the given keys from the queue.
+func (q *Queue) DeleteMany(keys []string) error {
+	b, err := q.tx.CreateBucketIfNotExists([]byte(q.Bucket))
+	if err != nil {
+		return fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	for _, key := range keys {
+		if err := b.Delete([]byte(key)); err != nil {
+			return fmt.Errorf("failed to delete key %q: %s", key, err)
+		}
+	}
+
+	return nil
+}
+
+// Import stores the heartbeats, whose ID is not yet used as key in the queue.
+// Returns the number of stored heartbeats.
+func (q *Queue) Import(hh []heartbeat.Heartbeat) (int, error) {
+	b, err := q.tx.CreateBucketIfNotExists([]byte(q.Bucket))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	var (
+		imported []heartbeat.Heartbeat
+		seen     = map[string]bool{}
+	)
+
+	for _, h := range hh {
+		key := h.ID()
+
+		if seen[key] || b.Get([]byte(key)) != nil {
+			continue
+		}
+
+		seen[key] = true
+
+		imported = append(imported, h)
+	}
+
+	if err := q.PushMany(imported); err != nil {
+		return 0, err
+	}
+
+	return len(imported), nil
+}
@@ -1,17 +1,23 @@
 package offline
 
 import (
+	"bytes"
 	"context"
+	"crypto/cipher"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/optiflow-os/tracelens-cli/pkg/api"
+	"github.com/optiflow-os/tracelens-cli/pkg/apikey"
 	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
 	"github.com/optiflow-os/tracelens-cli/pkg/ini"
 	"github.com/optiflow-os/tracelens-cli/pkg/log"
@@ -55,8 +61,9 @@ func (Noop) SendHeartbeats(_ context.Context, _ []heartbeat.Heartbeat) ([]heartb
 // of heartbeat sending to the API. Upon inability to send due to missing or
 // failing connection to API, failed sending or errors returned by API, the
 // heartbeats will be temporarily stored in a DB and sending will be retried
-// at next usages of the wakatime cli.
-func WithQueue(filepath string) heartbeat.HandleOption {
+// at next usages of the wakatime cli. The retention policy is enforced, when
+// storing heartbeats.
+func WithQueue(filepath string, retention Retention) heartbeat.HandleOption {
 	return func(next heartbeat.Handle) heartbeat.Handle {
 		return func(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
 			logger := log.Extract(ctx)
@@ -69,10 +76,33 @@ func WithQueue(filepath string) heartbeat.HandleOption {
 			}
 
 			results, err := next(ctx, hh)
+			if err != nil && isBadRequest(err) && len(hh) > 1 {
+				logger.Debugf("sending %d heartbeat(s) one by one after bad request: %s", len(hh), err)
+
+				// rejected heartbeats have bad request results and go to dead letters
+				results, err = sendOneByOne(ctx, next, hh)
+
+				if handleErr := handleResults(ctx, filepath, retention, results, hh); handleErr != nil {
+					return nil, fmt.Errorf("failed to handle results: %s", handleErr)
+				}
+
+				return results, err
+			}
+
+			if err != nil && isBadRequest(err) {
+				logger.Debugf("pushing %d heartbeat(s) to dead letters after bad request: %s", len(hh), err)
+
+				if deadLetterErr := pushDeadLetters(ctx, filepath, newDeadLetters(err, hh)); deadLetterErr != nil {
+					logger.Warnf("failed to push heartbeats to dead letters: %s", deadLetterErr)
+				}
+
+				return nil, err
+			}
+
 			if err != nil {
 				logger.Debugf("pushing %d heartbeat(s) to queue after error: %s", len(hh), err)
 
-				requeueErr := pushHeartbeatsWithRetry(ctx, filepath, hh)
+				requeueErr := pushHeartbeatsWithRetry(ctx, filepath, retention, hh)
 				if requeueErr != nil {
 					return nil, fmt.Errorf(
 						"failed to push heartbeats to queue: %s",
@@ -83,7 +113,7 @@ func WithQueue(filepath string) heartbeat.HandleOption {
 				return nil, err
 			}
 
-			err = handleResults(ctx, filepath, results, hh)
+			err = handleResults(ctx, filepath, retention, results, hh)
 			if err != nil {
 				return nil, fmt.Errorf("failed to handle results: %s", err)
 			}
@@ -118,13 +148,13 @@ func QueueFilepath(ctx context.Context, v *viper.Viper) (string, error) {
 // WithSync initializes and returns a heartbeat handle option, which
 // can be used in a heartbeat processing pipeline to pop heartbeats
 // from offline queue and send the heartbeats to WakaTime API.
-func WithSync(filepath string, syncLimit int) heartbeat.HandleOption {
+func WithSync(filepath string, syncLimit int, retention Retention) heartbeat.HandleOption {
 	return func(next heartbeat.Handle) heartbeat.Handle {
 		return func(ctx context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
 			logger := log.Extract(ctx)
 			logger.Debugf("execute offline sync with file %s", filepath)
 
-			err := Sync(ctx, filepath, syncLimit)(next)
+			err := Sync(ctx, filepath, syncLimit, retention)(next)
 			if err != nil {
 				return nil, fmt.Errorf("failed to sync offline heartbeats: %s", err)
 			}
@@ -135,7 +165,8 @@ func WithSync(filepath string, syncLimit int) heartbeat.HandleOption {
 }
 
 // Sync returns a function to send queued heartbeats to the WakaTime API.
-func Sync(ctx context.Context, filepath string, syncLimit int) func(next heartbeat.Handle) error {
+// Heartbeats failing to send are requeued with the retention policy enforced.
+func Sync(ctx context.Context, filepath string, syncLimit int, retention Retention) func(next heartbeat.Handle) error {
 	return func(next heartbeat.Handle) error {
 		var (
 			alreadySent int
@@ -176,8 +207,32 @@ func Sync(ctx context.Context, filepath string, syncLimit int) func(next heartbe
 			logger.Debugf("send %d heartbeats on sync run %d", len(hh), run)
 
 			results, err := next(ctx, hh)
+			if err != nil && isBadRequest(err) && len(hh) > 1 {
+				logger.Debugf("sending %d heartbeat(s) one by one after bad request: %s", len(hh), err)
+
+				results, err = sendOneByOne(ctx, next, hh)
+
+				if handleErr := handleResults(ctx, filepath, retention, results, hh); handleErr != nil {
+					return fmt.Errorf("failed to handle heartbeats api results: %s", handleErr)
+				}
+
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if err != nil && isBadRequest(err) {
+				if deadLetterErr := pushDeadLetters(ctx, filepath, newDeadLetters(err, hh)); deadLetterErr != nil {
+					logger.Warnf("failed to push heartbeats to dead letters after bad request: %s", deadLetterErr)
+				}
+
+				return err
+			}
+
 			if err != nil {
-				requeueErr := pushHeartbeatsWithRetry(ctx, filepath, hh)
+				requeueErr := pushHeartbeatsWithRetry(ctx, filepath, retention, hh)
 				if requeueErr != nil {
 					logger.Warnf("failed to push heartbeats to queue after api error: %s", requeueErr)
 				}
@@ -185,7 +240,7 @@ func Sync(ctx context.Context, filepath string, syncLimit int) func(next heartbe
 				return err
 			}
 
-			err = handleResults(ctx, filepath, results, hh)
+			err = handleResults(ctx, filepath, retention, results, hh)
 			if err != nil {
 				return fmt.Errorf("failed to handle heartbeats api results: %s", err)
 			}
@@ -195,8 +250,15 @@ func Sync(ctx context.Context, filepath string, syncLimit int) func(next heartbe
 	}
 }
 
-func handleResults(ctx context.Context, filepath string, results []heartbeat.Result, hh []heartbeat.Heartbeat) error {
+func handleResults(
+	ctx context.Context,
+	filepath string,
+	retention Retention,
+	results []heartbeat.Result,
+	hh []heartbeat.Heartbeat,
+) error {
 	var (
+		deadLetters       []DeadLetter
 		err               error
 		withInvalidStatus []heartbeat.Heartbeat
 	)
@@ -222,6 +284,13 @@ func handleResults(ctx context.Context, filepath string, results []heartbeat.Res
 
 			logger.Debugf("heartbeat result status bad request: %s", string(serialized))
 
+			deadLetters = append(deadLetters, DeadLetter{
+				Error:      strings.Join(result.Errors, " "),
+				Heartbeat:  hh[n],
+				RejectedAt: time.Now(),
+				Status:     result.Status,
+			})
+
 			continue
 		}
 
@@ -230,10 +299,18 @@ func handleResults(ctx context.Context, filepath string, results []heartbeat.Res
 		}
 	}
 
+	if len(deadLetters) > 0 {
+		logger.Debugf("pushing %d heartbeat(s) rejected by api to dead letters", len(deadLetters))
+
+		if deadLetterErr := pushDeadLetters(ctx, filepath, deadLetters); deadLetterErr != nil {
+			logger.Warnf("failed to push heartbeats with bad request status to dead letters: %s", deadLetterErr)
+		}
+	}
+
 	if len(withInvalidStatus) > 0 {
 		logger.Debugf("pushing %d heartbeat(s) with invalid result to queue", len(withInvalidStatus))
 
-		err = pushHeartbeatsWithRetry(ctx, filepath, withInvalidStatus)
+		err = pushHeartbeatsWithRetry(ctx, filepath, retention, withInvalidStatus)
 		if err != nil {
 			logger.Warnf("failed to push heartbeats with invalid status to queue: %s", err)
 		}
@@ -246,7 +323,7 @@ func handleResults(ctx context.Context, filepath string, results []heartbeat.Res
 
 		start := len(hh) - leftovers
 
-		err = pushHeartbeatsWithRetry(ctx, filepath, hh[start:])
+		err = pushHeartbeatsWithRetry(ctx, filepath, retention, hh[start:])
 		if err != nil {
 			logger.Warnf("failed to push leftover heartbeats to queue: %s", err)
 		}
@@ -256,7 +333,7 @@ func handleResults(ctx context.Context, filepath string, results []heartbeat.Res
 }
 
 func popHeartbeats(ctx context.Context, filepath string, limit int) ([]heartbeat.Heartbeat, error) {
-	db, close, err := openDB(ctx, filepath)
+	db, aead, close, err := openDB(ctx, filepath)
 	if err != nil {
 		return nil, err
 	}
@@ -268,7 +345,7 @@ func popHeartbeats(ctx context.Context, filepath string, limit int) ([]heartbeat
 		return nil, fmt.Errorf("failed to start db transaction: %s", err)
 	}
 
-	queue := NewQueue(tx)
+	queue := newQueue(tx, aead)
 	logger := log.Extract(ctx)
 
 	queued, err := queue.PopMany(limit)
@@ -285,10 +362,93 @@ func popHeartbeats(ctx context.Context, filepath string, limit int) ([]heartbeat
 		return nil, fmt.Errorf("failed to commit db transaction: %s", err)
 	}
 
+	if queue.quarantined > 0 {
+		logger.Warnf(
+			"moved %d unreadable heartbeat(s) from offline queue to bucket %q. They may be encrypted with another key than %s",
+			queue.quarantined,
+			dbQuarantineBucket,
+			KeyFilepath(filepath),
+		)
+	}
+
 	return queued, nil
 }
 
-func pushHeartbeatsWithRetry(ctx context.Context, filepath string, hh []heartbeat.Heartbeat) error {
+// isBadRequest returns true, if the api rejected the whole batch of heartbeats.
+// The batch is then sent one by one to find the rejected heartbeats.
+func isBadRequest(err error) bool {
+	var errbadrequest api.ErrBadRequest
+
+	return errors.As(err, &errbadrequest)
+}
+
+// sendOneByOne sends the heartbeats of a batch rejected by the api with a bad
+// request error one by one, as the api might have rejected only some of them.
+// Rejected heartbeats get a bad request result. Sending stops at the first
+// other error, leaving the remaining heartbeats without result.
+func sendOneByOne(ctx context.Context, next heartbeat.Handle, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+	results := make([]heartbeat.Result, 0, len(hh))
+
+	for _, h := range hh {
+		rr, err := next(ctx, []heartbeat.Heartbeat{h})
+		if err != nil && isBadRequest(err) {
+			results = append(results, heartbeat.Result{
+				Errors:    []string{badRequestMessage(err)},
+				Heartbeat: h,
+				Status:    http.StatusBadRequest,
+			})
+
+			continue
+		}
+
+		if err != nil {
+			return results, err
+		}
+
+		if len(rr) == 0 {
+			break
+		}
+
+		results = append(results, rr[0])
+	}
+
+	return results, nil
+}
+
+// badRequestMessage returns the response body of a bad request error or else
+// the error message.
+func badRequestMessage(err error) string {
+	var errbadrequest api.ErrBadRequest
+
+	if errors.As(err, &errbadrequest) && errbadrequest.Body != "" {
+		return errbadrequest.Body
+	}
+
+	return err.Error()
+}
+
+// newDeadLetters returns the dead letters of a batch of heartbeats rejected
+// by the api with a bad request error.
+func newDeadLetters(err error, hh []heartbeat.Heartbeat) []DeadLetter {
+	msg := badRequestMessage(err)
+
+	now := time.Now()
+
+	dd := make([]DeadLetter, 0, len(hh))
+
+	for _, h := range hh {
+		dd = append(dd, DeadLetter{
+			Error:      msg,
+			Heartbeat:  h,
+			RejectedAt: now,
+			Status:     http.StatusBadRequest,
+		})
+	}
+
+	return dd
+}
+
+func pushHeartbeatsWithRetry(ctx context.Context, filepath string, retention Retention, hh []heartbeat.Heartbeat) error {
 	var (
 		count int
 		err   error
@@ -311,7 +471,7 @@ func pushHeartbeatsWithRetry(ctx context.Context, filepath string, hh []heartbea
 			)
 		}
 
-		err = pushHeartbeats(ctx, filepath, hh)
+		err = pushHeartbeats(ctx, filepath, retention, hh)
 		if err != nil {
 			count++
 
@@ -328,8 +488,8 @@ func pushHeartbeatsWithRetry(ctx context.Context, filepath string, hh []heartbea
 	return nil
 }
 
-func pushHeartbeats(ctx context.Context, filepath string, hh []heartbeat.Heartbeat) error {
-	db, close, err := openDB(ctx, filepath)
+func pushHeartbeats(ctx context.Context, filepath string, retention Retention, hh []heartbeat.Heartbeat) error {
+	db, aead, close, err := openDB(ctx, filepath)
 	if err != nil {
 		return err
 	}
@@ -341,7 +501,8 @@ func pushHeartbeats(ctx context.Context, filepath string, hh []heartbeat.Heartbe
 		return fmt.Errorf("failed to start db transaction: %s", err)
 	}
 
-	queue := NewQueue(tx)
+	queue := newQueue(tx, aead)
+	queue.Retention = retention
 
 	err = queue.PushMany(hh)
 	if err != nil {
@@ -357,7 +518,7 @@ func pushHeartbeats(ctx context.Context, filepath string, hh []heartbeat.Heartbe
 
 // CountHeartbeats returns the total number of heartbeats in the offline db.
 func CountHeartbeats(ctx context.Context, filepath string) (int, error) {
-	db, close, err := openDB(ctx, filepath)
+	db, aead, close, err := openDB(ctx, filepath)
 	if err != nil {
 		return 0, err
 	}
@@ -378,7 +539,7 @@ func CountHeartbeats(ctx context.Context, filepath string) (int, error) {
 		}
 	}()
 
-	queue := NewQueue(tx)
+	queue := newQueue(tx, aead)
 
 	count, err := queue.Count()
 	if err != nil {
@@ -388,9 +549,42 @@ func CountHeartbeats(ctx context.Context, filepath string) (int, error) {
 	return count, nil
 }
 
+// ReadStats returns statistics about the heartbeats in the offline db.
+func ReadStats(ctx context.Context, filepath string) (Stats, error) {
+	db, aead, close, err := openDB(ctx, filepath)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	defer close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to start db transaction: %s", err)
+	}
+
+	logger := log.Extract(ctx)
+
+	defer func() {
+		err := tx.Rollback()
+		if err != nil {
+			logger.Errorf("failed to rollback transaction: %s", err)
+		}
+	}()
+
+	queue := newQueue(tx, aead)
+
+	stats, err := queue.Stats()
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to read stats: %s", err)
+	}
+
+	return stats, nil
+}
+
 // ReadHeartbeats reads the informed heartbeats in the offline db.
 func ReadHeartbeats(ctx context.Context, filepath string, limit int) ([]heartbeat.Heartbeat, error) {
-	db, close, err := openDB(ctx, filepath)
+	db, aead, close, err := openDB(ctx, filepath)
 	if err != nil {
 		return nil, err
 	}
@@ -402,7 +596,7 @@ func ReadHeartbeats(ctx context.Context, filepath string, limit int) ([]heartbea
 		return nil, fmt.Errorf("failed to start db transaction: %s", err)
 	}
 
-	queue := NewQueue(tx)
+	queue := newQueue(tx, aead)
 	logger := log.Extract(ctx)
 
 	hh, err := queue.ReadMany(limit)
@@ -423,23 +617,39 @@ func ReadHeartbeats(ctx context.Context, filepath string, limit int) ([]heartbea
 }
 
 // openDB opens a connection to the offline db.
-// It returns the pointer to bolt.DB, a function to close the connection and an error.
+// It returns the pointer to bolt.DB, the cipher encrypting its records, a function to close the connection and an error.
 // Although named parameters should be avoided, this func uses them to access inside the deferred function and set an error.
-func openDB(ctx context.Context, filepath string) (db *bolt.DB, _ func(), err error) {
+func openDB(ctx context.Context, filepath string) (db *bolt.DB, aead cipher.AEAD, _ func(), err error) {
+	keptOpenMu.Lock()
+	k, ok := keptOpen[filepath]
+	keptOpenMu.Unlock()
+
+	if ok {
+		return k.acquire(ctx, filepath)
+	}
+
+	return openBoltDB(ctx, filepath)
+}
+
+// openBoltDB opens a new connection to the offline db. The db file is only
+// readable by the user and its records are encrypted with the key from the key
+// file next to it. When the key is generated, plaintext records stored by older
+// versions are encrypted.
+func openBoltDB(ctx context.Context, filepath string) (db *bolt.DB, aead cipher.AEAD, _ func(), err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = ErrOpenDB{Err: fmt.Errorf("panicked: %v", r)}
 		}
 	}()
 
-	db, err = bolt.Open(filepath, 0644, &bolt.Options{Timeout: 30 * time.Second})
+	db, err = bolt.Open(filepath, 0600, &bolt.Options{Timeout: 30 * time.Second})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to open db file: %s", err)
+		return nil, nil, nil, fmt.Errorf("failed to open db file: %s", err)
 	}
 
-	return db, func() {
-		logger := log.Extract(ctx)
+	logger := log.Extract(ctx)
 
+	closeDB := func() {
 		// recover from panic when closing db
 		defer func() {
 			if r := recover(); r != nil {
@@ -450,18 +660,199 @@ func openDB(ctx context.Context, filepath string) (db *bolt.DB, _ func(), err er
 		if err := db.Close(); err != nil {
 			logger.Debugf("failed to close db file: %s", err)
 		}
-	}, err
+	}
+
+	// db files created by older versions are readable by other users
+	if err := os.Chmod(filepath, 0600); err != nil {
+		logger.Warnf("failed to restrict permissions of db file: %s", err)
+	}
+
+	aead, created, err := loadCipher(db, filepath)
+	if err != nil {
+		closeDB()
+
+		return nil, nil, nil, fmt.Errorf("failed to load offline db key: %s", err)
+	}
+
+	if created {
+		logger.Debugf("generated offline db key at %s", KeyFilepath(filepath))
+	}
+
+	// older versions store plaintext records, even after the key was generated
+	plaintext, err := hasPlaintext(db)
+	if err != nil {
+		logger.Warnf("failed to check for plaintext heartbeats in offline db: %s", err)
+	}
+
+	if plaintext {
+		if err := encryptPlaintext(db, aead); err != nil {
+			logger.Warnf("failed to encrypt plaintext heartbeats in offline db: %s", err)
+		}
+	}
+
+	return db, aead, closeDB, nil
+}
+
+// keptOpen contains the offline db connections kept open by KeepOpen, indexed by filepath.
+// nolint:gochecknoglobals
+var (
+	keptOpen   = map[string]*keptOpenDB{}
+	keptOpenMu sync.Mutex
+)
+
+// keptOpenDB is an offline db connection, which is reused across operations.
+type keptOpenDB struct {
+	aead    cipher.AEAD
+	close   func()
+	db      *bolt.DB
+	idle    time.Duration
+	mu      sync.Mutex
+	refs    int
+	stopped bool
+	timer   *time.Timer
+}
+
+// KeepOpen keeps the connection to the offline db at filepath open after
+// operations finished, so long-running processes can reuse it instead of opening
+// the db file over and over again. As bolt db locks the file while it's open, the
+// connection is closed after being unused for the idle duration, to not block
+// other processes. The returned function stops keeping the connection open.
+func KeepOpen(filepath string, idle time.Duration) func() {
+	k := &keptOpenDB{idle: idle}
+
+	keptOpenMu.Lock()
+	keptOpen[filepath] = k
+	keptOpenMu.Unlock()
+
+	return func() {
+		keptOpenMu.Lock()
+		if keptOpen[filepath] == k {
+			delete(keptOpen, filepath)
+		}
+		keptOpenMu.Unlock()
+
+		k.mu.Lock()
+		defer k.mu.Unlock()
+
+		k.stopped = true
+
+		if k.refs == 0 {
+			k.closeDB()
+		}
+	}
+}
+
+func (k *keptOpenDB) acquire(ctx context.Context, filepath string) (*bolt.DB, cipher.AEAD, func(), error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.timer != nil {
+		k.timer.Stop()
+		k.timer = nil
+	}
+
+	if k.db == nil {
+		db, aead, closeDB, err := openBoltDB(ctx, filepath)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		k.db, k.aead, k.close = db, aead, closeDB
+	}
+
+	k.refs++
+
+	return k.db, k.aead, k.release, nil
+}
+
+func (k *keptOpenDB) release() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.refs--
+
+	if k.refs > 0 {
+		return
+	}
+
+	if k.stopped {
+		k.closeDB()
+
+		return
+	}
+
+	k.timer = time.AfterFunc(k.idle, func() {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+
+		if k.refs == 0 {
+			k.closeDB()
+		}
+	})
+}
+
+// closeDB closes the connection. Must be called with k.mu held.
+func (k *keptOpenDB) closeDB() {
+	if k.timer != nil {
+		k.timer.Stop()
+		k.timer = nil
+	}
+
+	if k.db == nil {
+		return
+	}
+
+	k.close()
+
+	k.db, k.aead, k.close = nil, nil, nil
+}
+
+// record is the representation of a heartbeat in the offline db. Next to the
+// heartbeat payload, it keeps the routing metadata not sent to the api, so the
+// heartbeat is synced to the same account and api it was queued for. The api
+// key is stored as fingerprint and resolved against the config on sync.
+type record struct {
+	heartbeat.Heartbeat
+	APIKeyFingerprint string `json:"api_key_fingerprint,omitempty"`
+	APIURL            string `json:"api_url,omitempty"`
+}
+
+func newRecord(h heartbeat.Heartbeat) record {
+	fingerprint := apikey.Fingerprint(h.APIKey)
+	if fingerprint == "" {
+		fingerprint = h.APIKeyFingerprint
+	}
+
+	return record{
+		Heartbeat:         h,
+		APIKeyFingerprint: fingerprint,
+		APIURL:            h.APIURL,
+	}
+}
+
+// heartbeat returns the queued heartbeat with its routing metadata.
+func (r record) heartbeat() heartbeat.Heartbeat {
+	h := r.Heartbeat
+	h.APIKeyFingerprint = r.APIKeyFingerprint
+	h.APIURL = r.APIURL
+
+	return h
 }
 
 // Queue is a db client to temporarily store heartbeats in bolt db, in case heartbeat
 // sending to wakatime api is not possible. Transaction handling is left to the user
 // via the passed in transaction.
 type Queue struct {
-	Bucket string
-	tx     *bolt.Tx
+	Bucket      string
+	Retention   Retention
+	aead        cipher.AEAD
+	quarantined int
+	tx          *bolt.Tx
+	unreadable  []string
 }
 
-// NewQueue creates a new instance of Queue.
+// NewQueue creates a new instance of Queue, which stores records in plaintext.
+// Plaintext and encrypted records can be read alike, if the key is known.
 func NewQueue(tx *bolt.Tx) *Queue {
 	return &Queue{
 		Bucket: dbBucket,
@@ -469,6 +860,14 @@ func NewQueue(tx *bolt.Tx) *Queue {
 	}
 }
 
+// newQueue creates a new instance of Queue, which encrypts records with aead.
+func newQueue(tx *bolt.Tx, aead cipher.AEAD) *Queue {
+	q := NewQueue(tx)
+	q.aead = aead
+
+	return q
+}
+
 // Count returns the total number of heartbeats in the offline db.
 func (q *Queue) Count() (int, error) {
 	b, err := q.tx.CreateBucketIfNotExists([]byte(q.Bucket))
@@ -489,6 +888,7 @@ func (q *Queue) PopMany(limit int) ([]heartbeat.Heartbeat, error) {
 	var (
 		heartbeats []heartbeat.Heartbeat
 		ids        []string
+		unreadable = map[string][]byte{}
 	)
 
 	// load values
@@ -499,14 +899,13 @@ func (q *Queue) PopMany(limit int) ([]heartbeat.Heartbeat, error) {
 			break
 		}
 
-		var h heartbeat.Heartbeat
-
-		err := json.Unmarshal(value, &h)
+		r, err := q.parseRecord(value)
 		if err != nil {
-			return nil, fmt.Errorf("failed to json unmarshal heartbeat data: %s", err)
+			unreadable[string(key)] = bytes.Clone(value)
+			continue
 		}
 
-		heartbeats = append(heartbeats, h)
+		heartbeats = append(heartbeats, r.heartbeat())
 		ids = append(ids, string(key))
 	}
 
@@ -516,10 +915,16 @@ func (q *Queue) PopMany(limit int) ([]heartbeat.Heartbeat, error) {
 		}
 	}
 
+	if err := q.quarantine(b, unreadable); err != nil {
+		return nil, err
+	}
+
 	return heartbeats, nil
 }
 
-// PushMany stores the provided heartbeats in the db.
+// PushMany stores the provided heartbeats with their routing metadata in the db.
+// Heartbeats are keyed by their ID, which is their UUID, so they are popped in
+// time order. Afterwards heartbeats are dropped according to the retention policy.
 func (q *Queue) PushMany(hh []heartbeat.Heartbeat) error {
 	b, err := q.tx.CreateBucketIfNotExists([]byte(q.Bucket))
 	if err != nil {
@@ -527,17 +932,26 @@ func (q *Queue) PushMany(hh []heartbeat.Heartbeat) error {
 	}
 
 	for _, h := range hh {
-		data, err := json.Marshal(h)
+		data, err := json.Marshal(newRecord(h))
 		if err != nil {
 			return fmt.Errorf("failed to json marshal heartbeat: %s", err)
 		}
 
+		data, err = encrypt(q.aead, data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt heartbeat: %s", err)
+		}
+
 		err = b.Put([]byte(h.ID()), data)
 		if err != nil {
 			return fmt.Errorf("failed to store heartbeat with id %q: %s", h.ID(), err)
 		}
 	}
 
+	if err := q.enforceRetention(time.Now()); err != nil {
+		return fmt.Errorf("failed to enforce retention policy: %s", err)
+	}
+
 	return nil
 }
 
@@ -558,15 +972,58 @@ func (q *Queue) ReadMany(limit int) ([]heartbeat.Heartbeat, error) {
 			break
 		}
 
-		var h heartbeat.Heartbeat
-
-		err := json.Unmarshal(value, &h)
+		// unreadable records are skipped, like when popping heartbeats
+		r, err := q.parseRecord(value)
 		if err != nil {
-			return nil, fmt.Errorf("failed to json unmarshal heartbeat data: %s", err)
+			continue
 		}
 
-		heartbeats = append(heartbeats, h)
+		heartbeats = append(heartbeats, r.heartbeat())
 	}
 
 	return heartbeats, nil
 }
+
+// parseRecord decrypts and parses a record of the queue.
+func (q *Queue) parseRecord(value []byte) (record, error) {
+	value, err := decrypt(q.aead, value)
+	if err != nil {
+		return record{}, err
+	}
+
+	var r record
+
+	if err := json.Unmarshal(value, &r); err != nil {
+		return record{}, fmt.Errorf("failed to json unmarshal heartbeat data: %s", err)
+	}
+
+	return r, nil
+}
+
+// quarantine moves unreadable records, e.g. encrypted with a lost key, from the
+// bucket to the quarantine bucket, so they don't block the queue. They are kept
+// unchanged and can be recovered, if the key is restored.
+func (q *Queue) quarantine(b *bolt.Bucket, records map[string][]byte) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	qb, err := q.tx.CreateBucketIfNotExists([]byte(dbQuarantineBucket))
+	if err != nil {
+		return fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	for key, value := range records {
+		if err := qb.Put([]byte(key), value); err != nil {
+			return fmt.Errorf("failed to quarantine key %q: %s", key, err)
+		}
+
+		if err := b.Delete([]byte(key)); err != nil {
+			return fmt.Errorf("failed to delete key %q: %s", key, err)
+		}
+	}
+
+	q.quarantined += len(records)
+
+	return nil
+}
@@ -1,7 +1,11 @@
 package offline_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,9 +13,11 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/optiflow-os/tracelens-cli/pkg/apikey"
 	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
 	"github.com/optiflow-os/tracelens-cli/pkg/ini"
 	"github.com/optiflow-os/tracelens-cli/pkg/offline"
@@ -78,7 +84,7 @@ func TestWithQueue(t *testing.T) {
 	err = db.Close()
 	require.NoError(t, err)
 
-	opt := offline.WithQueue(f.Name())
+	opt := offline.WithQueue(f.Name(), offline.Retention{})
 
 	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
 		assert.Len(t, hh, 2)
@@ -127,7 +133,7 @@ func TestWithQueue(t *testing.T) {
 		for key, value := c.First(); key != nil; key, value = c.Next() {
 			stored = append(stored, heartbeatRecord{
 				ID:        string(key),
-				Heartbeat: string(value),
+				Heartbeat: decryptRecord(t, f.Name(), value),
 			})
 		}
 
@@ -151,7 +157,7 @@ func TestWithQueue_NoHeartbeats(t *testing.T) {
 
 	defer f.Close()
 
-	opt := offline.WithQueue(f.Name())
+	opt := offline.WithQueue(f.Name(), offline.Retention{})
 
 	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
 		assert.Len(t, hh, 0)
@@ -174,7 +180,7 @@ func TestWithQueue_ApiError(t *testing.T) {
 
 	defer f.Close()
 
-	opt := offline.WithQueue(f.Name())
+	opt := offline.WithQueue(f.Name(), offline.Retention{})
 
 	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
 		assert.Equal(t, hh, []heartbeat.Heartbeat{
@@ -204,7 +210,7 @@ func TestWithQueue_ApiError(t *testing.T) {
 		for key, value := c.First(); key != nil; key, value = c.Next() {
 			stored = append(stored, heartbeatRecord{
 				ID:        string(key),
-				Heartbeat: string(value),
+				Heartbeat: decryptRecord(t, f.Name(), value),
 			})
 		}
 
@@ -237,7 +243,7 @@ func TestWithQueue_InvalidResults(t *testing.T) {
 
 	defer f.Close()
 
-	opt := offline.WithQueue(f.Name())
+	opt := offline.WithQueue(f.Name(), offline.Retention{})
 
 	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
 		assert.Equal(t, hh, testHeartbeats())
@@ -290,7 +296,7 @@ func TestWithQueue_InvalidResults(t *testing.T) {
 		for key, value := c.First(); key != nil; key, value = c.Next() {
 			stored = append(stored, heartbeatRecord{
 				ID:        string(key),
-				Heartbeat: string(value),
+				Heartbeat: decryptRecord(t, f.Name(), value),
 			})
 		}
 
@@ -323,7 +329,7 @@ func TestWithQueue_HandleLeftovers(t *testing.T) {
 
 	defer f.Close()
 
-	opt := offline.WithQueue(f.Name())
+	opt := offline.WithQueue(f.Name(), offline.Retention{})
 
 	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
 		assert.Equal(t, hh, testHeartbeats())
@@ -359,7 +365,7 @@ func TestWithQueue_HandleLeftovers(t *testing.T) {
 		for key, value := c.First(); key != nil; key, value = c.Next() {
 			stored = append(stored, heartbeatRecord{
 				ID:        string(key),
-				Heartbeat: string(value),
+				Heartbeat: decryptRecord(t, f.Name(), value),
 			})
 		}
 
@@ -415,7 +421,7 @@ func TestWithSync(t *testing.T) {
 	err = db.Close()
 	require.NoError(t, err)
 
-	opt := offline.WithSync(f.Name(), offline.SyncMaxDefault)
+	opt := offline.WithSync(f.Name(), offline.SyncMaxDefault, offline.Retention{})
 
 	handle := opt(func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
 		return []heartbeat.Result{
@@ -449,7 +455,7 @@ func TestWithSync(t *testing.T) {
 		for key, value := c.First(); key != nil; key, value = c.Next() {
 			stored = append(stored, heartbeatRecord{
 				ID:        string(key),
-				Heartbeat: string(value),
+				Heartbeat: decryptRecord(t, f.Name(), value),
 			})
 		}
 
@@ -486,7 +492,7 @@ func TestSync_MultipleRequests(t *testing.T) {
 	err = db.Close()
 	require.NoError(t, err)
 
-	syncFn := offline.Sync(context.Background(), f.Name(), 1000)
+	syncFn := offline.Sync(context.Background(), f.Name(), 1000, offline.Retention{})
 
 	var numCalls int
 
@@ -539,7 +545,7 @@ func TestSync_MultipleRequests(t *testing.T) {
 		for key, value := c.First(); key != nil; key, value = c.Next() {
 			stored = append(stored, heartbeatRecord{
 				ID:        string(key),
-				Heartbeat: string(value),
+				Heartbeat: decryptRecord(t, f.Name(), value),
 			})
 		}
 
@@ -585,7 +591,7 @@ func TestSync_APIError(t *testing.T) {
 	err = db.Close()
 	require.NoError(t, err)
 
-	syncFn := offline.Sync(context.Background(), f.Name(), 10)
+	syncFn := offline.Sync(context.Background(), f.Name(), 10, offline.Retention{})
 
 	var numCalls int
 
@@ -614,7 +620,7 @@ func TestSync_APIError(t *testing.T) {
 		for key, value := c.First(); key != nil; key, value = c.Next() {
 			stored = append(stored, heartbeatRecord{
 				ID:        string(key),
-				Heartbeat: string(value),
+				Heartbeat: decryptRecord(t, f.Name(), value),
 			})
 		}
 
@@ -673,7 +679,7 @@ func TestSync_InvalidResults(t *testing.T) {
 	err = db.Close()
 	require.NoError(t, err)
 
-	syncFn := offline.Sync(context.Background(), f.Name(), 1000)
+	syncFn := offline.Sync(context.Background(), f.Name(), 1000, offline.Retention{})
 
 	var numCalls int
 
@@ -736,7 +742,7 @@ func TestSync_InvalidResults(t *testing.T) {
 		for key, value := c.First(); key != nil; key, value = c.Next() {
 			stored = append(stored, heartbeatRecord{
 				ID:        string(key),
-				Heartbeat: string(value),
+				Heartbeat: decryptRecord(t, f.Name(), value),
 			})
 		}
 
@@ -782,7 +788,7 @@ func TestSync_SyncLimit(t *testing.T) {
 	err = db.Close()
 	require.NoError(t, err)
 
-	syncFn := offline.Sync(context.Background(), f.Name(), 1)
+	syncFn := offline.Sync(context.Background(), f.Name(), 1, offline.Retention{})
 
 	var numCalls int
 
@@ -813,7 +819,7 @@ func TestSync_SyncLimit(t *testing.T) {
 		for key, value := c.First(); key != nil; key, value = c.Next() {
 			stored = append(stored, heartbeatRecord{
 				ID:        string(key),
-				Heartbeat: string(value),
+				Heartbeat: decryptRecord(t, f.Name(), value),
 			})
 		}
 
@@ -862,7 +868,7 @@ func TestSync_SyncUnlimited(t *testing.T) {
 	err = db.Close()
 	require.NoError(t, err)
 
-	syncFn := offline.Sync(context.Background(), f.Name(), 0)
+	syncFn := offline.Sync(context.Background(), f.Name(), 0, offline.Retention{})
 
 	var numCalls int
 
@@ -897,7 +903,7 @@ func TestSync_SyncUnlimited(t *testing.T) {
 		for key, value := c.First(); key != nil; key, value = c.Next() {
 			stored = append(stored, heartbeatRecord{
 				ID:        string(key),
-				Heartbeat: string(value),
+				Heartbeat: decryptRecord(t, f.Name(), value),
 			})
 		}
 
@@ -960,6 +966,59 @@ func TestCountHeartbeats_Empty(t *testing.T) {
 	assert.Equal(t, count, 0)
 }
 
+func TestKeepOpen(t *testing.T) {
+	// setup
+	f, err := os.CreateTemp(t.TempDir(), "")
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	stop := offline.KeepOpen(f.Name(), time.Minute)
+
+	count, err := offline.CountHeartbeats(context.Background(), f.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, count, 0)
+
+	// connection is kept open and therefore the db file locked
+	_, err = bolt.Open(f.Name(), 0600, &bolt.Options{Timeout: 10 * time.Millisecond})
+	require.Error(t, err)
+
+	count, err = offline.CountHeartbeats(context.Background(), f.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, count, 0)
+
+	stop()
+
+	db, err := bolt.Open(f.Name(), 0600, &bolt.Options{Timeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	err = db.Close()
+	require.NoError(t, err)
+}
+
+func TestKeepOpen_Idle(t *testing.T) {
+	// setup
+	f, err := os.CreateTemp(t.TempDir(), "")
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	stop := offline.KeepOpen(f.Name(), 10*time.Millisecond)
+	defer stop()
+
+	_, err = offline.CountHeartbeats(context.Background(), f.Name())
+	require.NoError(t, err)
+
+	// connection is closed after being idle
+	db, err := bolt.Open(f.Name(), 0600, &bolt.Options{Timeout: time.Second})
+	require.NoError(t, err)
+
+	err = db.Close()
+	require.NoError(t, err)
+}
+
 func TestReadHeartbeats(t *testing.T) {
 	// setup
 	f, err := os.CreateTemp(t.TempDir(), "")
@@ -1045,6 +1104,243 @@ func TestReadHeartbeats_Empty(t *testing.T) {
 	assert.Len(t, hh, 0)
 }
 
+func TestWithQueue_Encrypted(t *testing.T) {
+	// setup
+	f, err := os.CreateTemp(t.TempDir(), "")
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	opt := offline.WithQueue(f.Name(), offline.Retention{})
+
+	handle := opt(func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		return []heartbeat.Result{}, errors.New("error")
+	})
+
+	// run
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{testHeartbeats()[0]})
+	require.Error(t, err)
+
+	// check
+	info, err := os.Stat(f.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	info, err = os.Stat(offline.KeyFilepath(f.Name()))
+	require.NoError(t, err)
+
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	require.NoError(t, err)
+
+	var stored []byte
+
+	err = db.View(func(tx *bolt.Tx) error {
+		_, value := tx.Bucket([]byte("heartbeats")).Cursor().First()
+		stored = bytes.Clone(value)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = db.Close()
+	require.NoError(t, err)
+
+	dataGo, err := os.ReadFile("testdata/heartbeat_go.json")
+	require.NoError(t, err)
+
+	assert.True(t, bytes.HasPrefix(stored, []byte("enc:v1:")))
+	assert.NotContains(t, string(stored), "/tmp/main.go")
+	assert.JSONEq(t, string(dataGo), decryptRecord(t, f.Name(), stored))
+}
+
+func TestReadHeartbeats_EncryptsPlaintext(t *testing.T) {
+	// setup
+	f, err := os.CreateTemp(t.TempDir(), "")
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	db, err := bolt.Open(f.Name(), 0600, nil)
+	require.NoError(t, err)
+
+	dataGo, err := os.ReadFile("testdata/heartbeat_go.json")
+	require.NoError(t, err)
+
+	insertHeartbeatRecord(t, db, "heartbeats", heartbeatRecord{
+		ID:        "1592868367.219124-file-coding-wakatime-cli-heartbeat-/tmp/main.go-true",
+		Heartbeat: string(dataGo),
+	})
+
+	err = db.Close()
+	require.NoError(t, err)
+
+	// run
+	hh, err := offline.ReadHeartbeats(context.Background(), f.Name(), offline.PrintMaxDefault)
+	require.NoError(t, err)
+
+	// check
+	require.Len(t, hh, 1)
+	assert.Equal(t, "/tmp/main.go", hh[0].Entity)
+
+	db, err = bolt.Open(f.Name(), 0600, nil)
+	require.NoError(t, err)
+
+	var stored []byte
+
+	err = db.View(func(tx *bolt.Tx) error {
+		stored = bytes.Clone(tx.Bucket([]byte("heartbeats")).Get(
+			[]byte("1592868367.219124-file-coding-wakatime-cli-heartbeat-/tmp/main.go-true"),
+		))
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = db.Close()
+	require.NoError(t, err)
+
+	assert.True(t, bytes.HasPrefix(stored, []byte("enc:v1:")))
+	assert.JSONEq(t, string(dataGo), decryptRecord(t, f.Name(), stored))
+}
+
+func TestReadHeartbeats_EncryptsPlaintext_ExistingKey(t *testing.T) {
+	// setup
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	// generate the key
+	_, err := offline.ReadHeartbeats(context.Background(), queueFilepath, offline.PrintMaxDefault)
+	require.NoError(t, err)
+
+	require.FileExists(t, offline.KeyFilepath(queueFilepath))
+
+	// an older version stores a plaintext record after the key was generated
+	db, err := bolt.Open(queueFilepath, 0600, nil)
+	require.NoError(t, err)
+
+	dataGo, err := os.ReadFile("testdata/heartbeat_go.json")
+	require.NoError(t, err)
+
+	insertHeartbeatRecord(t, db, "heartbeats", heartbeatRecord{
+		ID:        "1592868367.219124-file-coding-wakatime-cli-heartbeat-/tmp/main.go-true",
+		Heartbeat: string(dataGo),
+	})
+
+	err = db.Close()
+	require.NoError(t, err)
+
+	// run
+	hh, err := offline.ReadHeartbeats(context.Background(), queueFilepath, offline.PrintMaxDefault)
+	require.NoError(t, err)
+
+	// check
+	require.Len(t, hh, 1)
+
+	db, err = bolt.Open(queueFilepath, 0600, nil)
+	require.NoError(t, err)
+
+	var stored []byte
+
+	err = db.View(func(tx *bolt.Tx) error {
+		stored = bytes.Clone(tx.Bucket([]byte("heartbeats")).Get(
+			[]byte("1592868367.219124-file-coding-wakatime-cli-heartbeat-/tmp/main.go-true"),
+		))
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = db.Close()
+	require.NoError(t, err)
+
+	assert.True(t, bytes.HasPrefix(stored, []byte("enc:v1:")))
+	assert.JSONEq(t, string(dataGo), decryptRecord(t, queueFilepath, stored))
+}
+
+func TestReadHeartbeats_MissingKey(t *testing.T) {
+	// setup
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	handle := offline.WithQueue(queueFilepath, offline.Retention{})(
+		func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			return []heartbeat.Result{}, errors.New("error")
+		})
+
+	_, err := handle(context.Background(), []heartbeat.Heartbeat{testHeartbeats()[0]})
+	require.Error(t, err)
+
+	err = os.Remove(offline.KeyFilepath(queueFilepath))
+	require.NoError(t, err)
+
+	// run
+	_, err = offline.ReadHeartbeats(context.Background(), queueFilepath, offline.PrintMaxDefault)
+
+	// check
+	require.ErrorContains(t, err, "offline db contains encrypted heartbeats")
+
+	assert.NoFileExists(t, offline.KeyFilepath(queueFilepath))
+}
+
+func TestSync_ReplacedKey(t *testing.T) {
+	// setup
+	queueFilepath := filepath.Join(t.TempDir(), "offline_heartbeats.bdb")
+
+	handle := offline.WithQueue(queueFilepath, offline.Retention{})(
+		func(_ context.Context, _ []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+			return []heartbeat.Result{}, errors.New("error")
+		})
+
+	_, err := handle(context.Background(), []heartbeat.Heartbeat{testHeartbeats()[0]})
+	require.Error(t, err)
+
+	err = os.WriteFile(offline.KeyFilepath(queueFilepath), []byte(strings.Repeat("ab", 32)), 0600)
+	require.NoError(t, err)
+
+	_, err = handle(context.Background(), []heartbeat.Heartbeat{testHeartbeats()[1]})
+	require.Error(t, err)
+
+	syncFn := offline.Sync(context.Background(), queueFilepath, 1000, offline.Retention{})
+
+	var numCalls int
+
+	// run
+	err = syncFn(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		numCalls++
+
+		assert.Equal(t, []heartbeat.Heartbeat{testHeartbeats()[1]}, hh)
+
+		return []heartbeat.Result{
+			{
+				Status:    http.StatusCreated,
+				Heartbeat: testHeartbeats()[1],
+			},
+		}, nil
+	})
+	require.NoError(t, err)
+
+	// check
+	assert.Equal(t, 1, numCalls)
+
+	count, err := offline.CountHeartbeats(context.Background(), queueFilepath)
+	require.NoError(t, err)
+
+	assert.Zero(t, count)
+
+	db, err := bolt.Open(queueFilepath, 0600, nil)
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 1, tx.Bucket([]byte("quarantine")).Stats().KeyN)
+
+		return nil
+	})
+	require.NoError(t, err)
+}
+
 func TestQueue_Count(t *testing.T) {
 	// setup
 	db, cleanup := initDB(t)
@@ -1252,6 +1548,286 @@ func TestQueue_PushMany(t *testing.T) {
 	assert.JSONEq(t, string(dataJs), stored[2].Heartbeat)
 }
 
+func TestQueue_PushMany_UUID(t *testing.T) {
+	// setup
+	db, cleanup := initDB(t)
+	defer cleanup()
+
+	newer := heartbeat.Heartbeat{Entity: "/tmp/main.py", Time: 1592868386.079084, UUID: heartbeat.NewUUID(1592868386.079084)}
+	older := heartbeat.Heartbeat{Entity: "/tmp/main.go", Time: 1592868367.219124, UUID: heartbeat.NewUUID(1592868367.219124)}
+
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+
+	// run
+	q := offline.NewQueue(tx)
+	q.Bucket = "test_bucket"
+	err = q.PushMany([]heartbeat.Heartbeat{newer, older})
+	require.NoError(t, err)
+
+	hh, err := q.PopMany(2)
+	require.NoError(t, err)
+
+	err = tx.Commit()
+	require.NoError(t, err)
+
+	// check uuids are persisted and heartbeats popped in time order
+	assert.Equal(t, []heartbeat.Heartbeat{older, newer}, hh)
+}
+
+func TestQueue_PushMany_MaxHeartbeats(t *testing.T) {
+	// setup
+	db, cleanup := initDB(t)
+	defer cleanup()
+
+	now := float64(time.Now().Unix())
+
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+
+	// run
+	q := offline.NewQueue(tx)
+	q.Bucket = "test_bucket"
+	q.Retention = offline.Retention{MaxHeartbeats: 2}
+
+	err = q.PushMany([]heartbeat.Heartbeat{
+		{Entity: "/tmp/main.go", Time: now - 30},
+		{Entity: "/tmp/main.py", Time: now - 20},
+		{Entity: "/tmp/main.js", Time: now - 10},
+	})
+	require.NoError(t, err)
+
+	stats, err := q.Stats()
+	require.NoError(t, err)
+
+	hh, err := q.PopMany(10)
+	require.NoError(t, err)
+
+	err = tx.Commit()
+	require.NoError(t, err)
+
+	// check oldest heartbeat was dropped
+	require.Len(t, hh, 2)
+	assert.Equal(t, "/tmp/main.py", hh[0].Entity)
+	assert.Equal(t, "/tmp/main.js", hh[1].Entity)
+
+	assert.Equal(t, offline.Stats{
+		Count:   2,
+		Dropped: 1,
+		Newest:  now - 10,
+		Oldest:  now - 20,
+	}, stats)
+}
+
+func TestQueue_PushMany_MaxAge(t *testing.T) {
+	// setup
+	db, cleanup := initDB(t)
+	defer cleanup()
+
+	now := float64(time.Now().Unix())
+
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+
+	// run
+	q := offline.NewQueue(tx)
+	q.Bucket = "test_bucket"
+	q.Retention = offline.Retention{MaxAge: 24 * time.Hour}
+
+	err = q.PushMany([]heartbeat.Heartbeat{
+		{Entity: "/tmp/main.go", Time: now - 2*24*3600},
+		{Entity: "/tmp/main.py", Time: now - 3600},
+	})
+	require.NoError(t, err)
+
+	dropped, err := q.Dropped()
+	require.NoError(t, err)
+
+	hh, err := q.PopMany(10)
+	require.NoError(t, err)
+
+	err = tx.Commit()
+	require.NoError(t, err)
+
+	// check expired heartbeat was dropped
+	require.Len(t, hh, 1)
+	assert.Equal(t, "/tmp/main.py", hh[0].Entity)
+	assert.Equal(t, 1, dropped)
+}
+
+func TestQueue_PushMany_MixedKeys(t *testing.T) {
+	now := float64(time.Now().Unix())
+
+	// keys in bucket order: arbitrary id, uuids, legacy id without uuid
+	hh := []heartbeat.Heartbeat{
+		{Entity: "/tmp/legacy.go", Time: now - 30},
+		{Entity: "/tmp/arbitrary.go", Time: now - 10, UUID: "00000000-custom"},
+		{Entity: "/tmp/older.go", Time: now - 40, UUID: heartbeat.NewUUID(now - 40)},
+		{Entity: "/tmp/newer.go", Time: now - 20, UUID: heartbeat.NewUUID(now - 20)},
+	}
+
+	tests := map[string]offline.Retention{
+		"max heartbeats": {MaxHeartbeats: 2},
+		"max age":        {MaxAge: 25 * time.Second},
+	}
+
+	for name, retention := range tests {
+		t.Run(name, func(t *testing.T) {
+			// setup
+			db, cleanup := initDB(t)
+			defer cleanup()
+
+			tx, err := db.Begin(true)
+			require.NoError(t, err)
+
+			// run
+			q := offline.NewQueue(tx)
+			q.Bucket = "test_bucket"
+			q.Retention = retention
+
+			err = q.PushMany(hh)
+			require.NoError(t, err)
+
+			dropped, err := q.Dropped()
+			require.NoError(t, err)
+
+			queued, err := q.PopMany(10)
+			require.NoError(t, err)
+
+			err = tx.Commit()
+			require.NoError(t, err)
+
+			// check the oldest heartbeats were dropped, regardless of their key format
+			var entities []string
+			for _, h := range queued {
+				entities = append(entities, h.Entity)
+			}
+
+			assert.ElementsMatch(t, []string{"/tmp/arbitrary.go", "/tmp/newer.go"}, entities)
+			assert.Equal(t, 2, dropped)
+		})
+	}
+}
+
+func TestQueue_Stats_MixedKeys(t *testing.T) {
+	// setup
+	db, cleanup := initDB(t)
+	defer cleanup()
+
+	now := float64(time.Now().Unix())
+
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+
+	q := offline.NewQueue(tx)
+	q.Bucket = "test_bucket"
+
+	err = q.PushMany([]heartbeat.Heartbeat{
+		{Entity: "/tmp/legacy.go", Time: now - 30},
+		{Entity: "/tmp/arbitrary.go", Time: now - 10, UUID: "00000000-custom"},
+		{Entity: "/tmp/older.go", Time: now - 40.123456, UUID: heartbeat.NewUUID(now - 40.123456)},
+	})
+	require.NoError(t, err)
+
+	// run
+	stats, err := q.Stats()
+	require.NoError(t, err)
+
+	err = tx.Commit()
+	require.NoError(t, err)
+
+	// check
+	assert.Equal(t, offline.Stats{
+		Count:  3,
+		Newest: now - 10,
+		Oldest: now - 40.123456,
+	}, stats)
+}
+
+func TestQueue_PushMany_Coalesce(t *testing.T) {
+	// setup
+	db, cleanup := initDB(t)
+	defer cleanup()
+
+	now := float64(time.Now().Unix())
+
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+
+	// run
+	q := offline.NewQueue(tx)
+	q.Bucket = "test_bucket"
+	q.Retention = offline.Retention{
+		DropStrategy:  offline.DropCoalesce,
+		MaxHeartbeats: 4,
+	}
+
+	err = q.PushMany([]heartbeat.Heartbeat{
+		{Entity: "/tmp/main.go", Time: now - 300},
+		{Entity: "/tmp/main.py", Time: now - 290},
+		{Entity: "/tmp/main.go", Time: now - 280},
+		{Entity: "/tmp/main.go", Time: now - 270, IsWrite: heartbeat.PointerTo(true)},
+		{Entity: "/tmp/main.go", Time: now - 60},
+	})
+	require.NoError(t, err)
+
+	hh, err := q.PopMany(10)
+	require.NoError(t, err)
+
+	err = tx.Commit()
+	require.NoError(t, err)
+
+	// check only the coalesced heartbeat was dropped, instead of the oldest one
+	require.Len(t, hh, 4)
+	assert.Equal(t, now-300, hh[0].Time)
+	assert.Equal(t, now-290, hh[1].Time)
+	assert.Equal(t, now-270, hh[2].Time)
+	assert.Equal(t, now-60, hh[3].Time)
+}
+
+func TestQueue_PushMany_Routing(t *testing.T) {
+	// setup
+	db, cleanup := initDB(t)
+	defer cleanup()
+
+	h := heartbeat.Heartbeat{
+		APIKey: "00000000-0000-4000-8000-000000000001",
+		APIURL: "https://example.org/api/v1",
+		Entity: "HIDDEN.go",
+		Time:   1592868367.219124,
+		UUID:   heartbeat.NewUUID(1592868367.219124),
+	}
+
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+
+	// run
+	q := offline.NewQueue(tx)
+	q.Bucket = "test_bucket"
+	err = q.PushMany([]heartbeat.Heartbeat{h})
+	require.NoError(t, err)
+
+	stored := tx.Bucket([]byte("test_bucket")).Get([]byte(h.UUID))
+
+	hh, err := q.PopMany(1)
+	require.NoError(t, err)
+
+	err = tx.Commit()
+	require.NoError(t, err)
+
+	// check api key is not stored in plaintext, but resolvable by its fingerprint
+	assert.NotContains(t, string(stored), h.APIKey)
+	assert.Equal(t, []heartbeat.Heartbeat{
+		{
+			APIKeyFingerprint: apikey.Fingerprint("00000000-0000-4000-8000-000000000001"),
+			APIURL:            "https://example.org/api/v1",
+			Entity:            "HIDDEN.go",
+			Time:              1592868367.219124,
+			UUID:              h.UUID,
+		},
+	}, hh)
+}
+
 func TestQueue_ReadMany(t *testing.T) {
 	// setup
 	f, err := os.CreateTemp(t.TempDir(), "")
@@ -1434,6 +2010,37 @@ func testHeartbeats() []heartbeat.Heartbeat {
 	}
 }
 
+// decryptRecord decrypts a record stored in the offline db at filepath with the
+// key from its key file. Plaintext records are returned unchanged.
+func decryptRecord(t *testing.T, filepath string, value []byte) string {
+	t.Helper()
+
+	prefix := []byte("enc:v1:")
+
+	if !bytes.HasPrefix(value, prefix) {
+		return string(value)
+	}
+
+	data, err := os.ReadFile(offline.KeyFilepath(filepath))
+	require.NoError(t, err)
+
+	key, err := hex.DecodeString(string(data))
+	require.NoError(t, err)
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	value = value[len(prefix):]
+
+	plaintext, err := aead.Open(nil, value[:aead.NonceSize()], value[aead.NonceSize():], nil)
+	require.NoError(t, err)
+
+	return string(plaintext)
+}
+
 type heartbeatRecord struct {
 	ID        string
 	Heartbeat string
@@ -0,0 +1,477 @@
+package offline
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// coalesceWindow is the interval in which heartbeats of the same entity are
+	// coalesced into a single one by the coalesce drop strategy.
+	coalesceWindow = RateLimitDefaultSeconds * time.Second
+	// dbMetaBucket is the bolt db bucket storing metadata of the other buckets.
+	dbMetaBucket = "meta"
+	// droppedKeySuffix is appended to a bucket name to get the metadata key of
+	// the number of heartbeats dropped from it.
+	droppedKeySuffix = ":dropped"
+)
+
+// DropStrategy defines which heartbeats are dropped, when the offline queue
+// exceeds its maximum number of heartbeats.
+type DropStrategy int
+
+const (
+	// DropOldest drops the oldest heartbeats. This is the default value.
+	DropOldest DropStrategy = iota
+	// DropCoalesce first coalesces heartbeats of the same entity sent in short
+	// succession, before dropping the oldest heartbeats.
+	DropCoalesce
+)
+
+const (
+	dropOldestString   = "oldest"
+	dropCoalesceString = "coalesce"
+)
+
+// ParseDropStrategy parses a drop strategy from a string.
+func ParseDropStrategy(s string) (DropStrategy, error) {
+	switch s {
+	case dropOldestString:
+		return DropOldest, nil
+	case dropCoalesceString:
+		return DropCoalesce, nil
+	default:
+		return DropOldest, fmt.Errorf("invalid drop strategy %q", s)
+	}
+}
+
+// String returns the string representation of a drop strategy.
+func (s DropStrategy) String() string {
+	switch s {
+	case DropOldest:
+		return dropOldestString
+	case DropCoalesce:
+		return dropCoalesceString
+	default:
+		return ""
+	}
+}
+
+// Retention is the retention policy of the offline queue. Zero values disable
+// the respective limit.
+type Retention struct {
+	DropStrategy  DropStrategy
+	MaxAge        time.Duration
+	MaxHeartbeats int
+}
+
+// String implements fmt.Stringer interface.
+func (r Retention) String() string {
+	return fmt.Sprintf(
+		"drop strategy: %s, max age: %s, max heartbeats: %d",
+		r.DropStrategy,
+		r.MaxAge,
+		r.MaxHeartbeats,
+	)
+}
+
+// Stats contains statistics about the heartbeats in the offline queue. Oldest
+// and Newest are the times of the oldest and newest heartbeat and zero for an
+// empty queue.
+type Stats struct {
+	Count       int
+	DeadLetters int
+	Dropped     int
+	Newest      float64
+	Oldest      float64
+}
+
+// entry is a heartbeat loaded from the offline queue with its key.
+type entry struct {
+	Heartbeat heartbeat.Heartbeat
+	Key       []byte
+}
+
+// Dropped returns the number of heartbeats dropped from the queue by its
+// retention policy.
+func (q *Queue) Dropped() (int, error) {
+	b, err := q.tx.CreateBucketIfNotExists([]byte(dbMetaBucket))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	value := b.Get([]byte(q.Bucket + droppedKeySuffix))
+	if value == nil {
+		return 0, nil
+	}
+
+	value, err = decrypt(q.aead, value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decrypt number of dropped heartbeats: %s", err)
+	}
+
+	dropped, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse number of dropped heartbeats: %s", err)
+	}
+
+	return dropped, nil
+}
+
+// Stats returns statistics about the heartbeats in the queue. The oldest and
+// newest heartbeats are found by their keys, so only these two records are
+// decrypted, apart from records with keys not starting with the heartbeat time.
+func (q *Queue) Stats() (Stats, error) {
+	b, err := q.tx.CreateBucketIfNotExists([]byte(q.Bucket))
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	dropped, err := q.Dropped()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	deadLetters, err := q.CountDeadLetters()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{
+		Count:       keyCount(b),
+		DeadLetters: deadLetters,
+		Dropped:     dropped,
+	}
+
+	keys := sortedKeys(b, q.recordTime)
+	if len(keys) > 0 {
+		stats.Oldest = q.exactTime(b, keys[0])
+		stats.Newest = q.exactTime(b, keys[len(keys)-1])
+	}
+
+	return stats, nil
+}
+
+// exactTime returns the heartbeat time of the record stored under the key. The
+// time taken from a uuid key is only precise to the millisecond, so the record
+// is read, falling back to the key time if it cannot be decoded.
+func (q *Queue) exactTime(b *bolt.Bucket, k timedKey) float64 {
+	t, err := q.recordTime(b.Get(k.Key))
+	if err != nil {
+		return k.Time
+	}
+
+	return t
+}
+
+// enforceRetention drops heartbeats from the queue, which are older than the
+// maximum age or exceed the maximum number of heartbeats. Heartbeats are keyed by
+// their uuid, which starts with the heartbeat time, so the oldest ones are found
+// without decrypting the whole queue.
+func (q *Queue) enforceRetention(now time.Time) error {
+	r := q.Retention
+
+	if r.MaxAge <= 0 && r.MaxHeartbeats <= 0 {
+		return nil
+	}
+
+	b, err := q.tx.CreateBucketIfNotExists([]byte(q.Bucket))
+	if err != nil {
+		return fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	var drop [][]byte
+
+	if r.MaxAge > 0 {
+		drop = q.expired(b, now.Add(-r.MaxAge))
+		if err := deleteKeys(b, drop); err != nil {
+			return err
+		}
+	}
+
+	// counting keys is cheap, so only load heartbeats if there is something to drop
+	if r.MaxHeartbeats > 0 && keyCount(b) > r.MaxHeartbeats && r.DropStrategy == DropCoalesce {
+		entries, err := q.entries()
+		if err != nil {
+			return err
+		}
+
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Heartbeat.Time < entries[j].Heartbeat.Time
+		})
+
+		_, coalesced := coalesce(entries)
+
+		keys := make([][]byte, 0, len(coalesced))
+		for _, e := range coalesced {
+			keys = append(keys, e.Key)
+		}
+
+		if err := deleteKeys(b, keys); err != nil {
+			return err
+		}
+
+		drop = append(drop, keys...)
+	}
+
+	if r.MaxHeartbeats > 0 {
+		oldest := firstKeys(b, keyCount(b)-r.MaxHeartbeats, q.recordTime)
+		if err := deleteKeys(b, oldest); err != nil {
+			return err
+		}
+
+		drop = append(drop, oldest...)
+	}
+
+	if len(drop) == 0 {
+		return nil
+	}
+
+	return q.addDropped(len(drop))
+}
+
+// expired returns the keys of the heartbeats older than cutoff. It walks the
+// queue in time order and stops at the first heartbeat newer than cutoff.
+func (q *Queue) expired(b *bolt.Bucket, cutoff time.Time) [][]byte {
+	var (
+		keys  [][]byte
+		limit = float64(cutoff.UnixNano()) / 1e9
+	)
+
+	for _, k := range sortedKeys(b, q.recordTime) {
+		if k.Time >= limit {
+			break
+		}
+
+		keys = append(keys, k.Key)
+	}
+
+	return keys
+}
+
+// firstKeys returns the keys of up to n of the oldest heartbeats in the bucket.
+func firstKeys(b *bolt.Bucket, n int, readTime func([]byte) (float64, error)) [][]byte {
+	var keys [][]byte
+
+	for _, k := range sortedKeys(b, readTime) {
+		if len(keys) >= n {
+			break
+		}
+
+		keys = append(keys, k.Key)
+	}
+
+	return keys
+}
+
+// timedKey is a key of a bucket with the time of the heartbeat stored under it.
+type timedKey struct {
+	Key  []byte
+	Time float64
+}
+
+// sortedKeys returns the keys of the bucket sorted by the time of their
+// heartbeat. Keys are uuids, which start with the heartbeat time, but buckets
+// written by older versions also contain ids of heartbeats without uuid, which
+// start with the heartbeat time as well, or arbitrary ids passed by plugins.
+// For these, the time is read from the record via readTime. Records, whose time
+// cannot be read, are skipped and never dropped.
+func sortedKeys(b *bolt.Bucket, readTime func([]byte) (float64, error)) []timedKey {
+	var (
+		keys   []timedKey
+		sorted = true
+	)
+
+	c := b.Cursor()
+
+	for key, value := c.First(); key != nil; key, value = c.Next() {
+		t, ok := keyTime(key)
+		if !ok {
+			var err error
+
+			t, err = readTime(value)
+			if err != nil {
+				continue
+			}
+		}
+
+		if len(keys) > 0 && t < keys[len(keys)-1].Time {
+			sorted = false
+		}
+
+		keys = append(keys, timedKey{Key: bytes.Clone(key), Time: t})
+	}
+
+	if !sorted {
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keys[i].Time < keys[j].Time
+		})
+	}
+
+	return keys
+}
+
+// keyTime returns the heartbeat time, which a key starts with. Keys are either
+// version 7 uuids or ids of heartbeats without uuid, which start with the
+// heartbeat time in seconds, followed by a dash.
+func keyTime(key []byte) (float64, bool) {
+	if t, ok := heartbeat.UUIDTime(string(key)); ok {
+		return t, true
+	}
+
+	prefix, _, ok := bytes.Cut(key, []byte("-"))
+	if !ok {
+		return 0, false
+	}
+
+	t, err := strconv.ParseFloat(string(prefix), 64)
+	if err != nil || t <= 0 {
+		return 0, false
+	}
+
+	return t, true
+}
+
+// recordTime returns the heartbeat time of a queued record.
+func (q *Queue) recordTime(value []byte) (float64, error) {
+	r, err := q.parseRecord(value)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Time, nil
+}
+
+// deleteKeys deletes the keys from the bucket.
+func deleteKeys(b *bolt.Bucket, keys [][]byte) error {
+	for _, key := range keys {
+		if err := b.Delete(key); err != nil {
+			return fmt.Errorf("failed to delete key %q: %s", key, err)
+		}
+	}
+
+	return nil
+}
+
+// entries loads all heartbeats from the queue without deleting them. Records,
+// which cannot be decoded, are skipped and never dropped.
+func (q *Queue) entries() ([]entry, error) {
+	b, err := q.tx.CreateBucketIfNotExists([]byte(q.Bucket))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	var entries []entry
+
+	c := b.Cursor()
+
+	for key, value := c.First(); key != nil; key, value = c.Next() {
+		r, err := q.parseRecord(value)
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, entry{
+			Heartbeat: r.heartbeat(),
+			Key:       bytes.Clone(key),
+		})
+	}
+
+	return entries, nil
+}
+
+// keyCount counts the keys in the bucket. Unlike the bucket stats, it includes
+// keys put in the current transaction.
+func keyCount(b *bolt.Bucket) int {
+	var count int
+
+	c := b.Cursor()
+
+	for key, _ := c.First(); key != nil; key, _ = c.Next() {
+		count++
+	}
+
+	return count
+}
+
+func (q *Queue) addDropped(n int) error {
+	dropped, err := q.Dropped()
+	if err != nil {
+		return err
+	}
+
+	b, err := q.tx.CreateBucketIfNotExists([]byte(dbMetaBucket))
+	if err != nil {
+		return fmt.Errorf("failed to create/load bucket: %s", err)
+	}
+
+	data, err := encrypt(q.aead, []byte(strconv.Itoa(dropped+n)))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt number of dropped heartbeats: %s", err)
+	}
+
+	if err := b.Put([]byte(q.Bucket+droppedKeySuffix), data); err != nil {
+		return fmt.Errorf("failed to store number of dropped heartbeats: %s", err)
+	}
+
+	return nil
+}
+
+// coalesce drops heartbeats, which were sent within the coalesce window after
+// a kept heartbeat to the same entity and account. Write heartbeats are always
+// kept. Entries must be sorted by time. Returns the kept and dropped entries.
+func coalesce(entries []entry) ([]entry, []entry) {
+	var (
+		kept    = make([]entry, 0, len(entries))
+		dropped []entry
+		last    = map[string]float64{}
+	)
+
+	for _, e := range entries {
+		h := e.Heartbeat
+		group := coalesceGroup(h)
+
+		t, ok := last[group]
+		if ok && h.Time-t < coalesceWindow.Seconds() && (h.IsWrite == nil || !*h.IsWrite) {
+			dropped = append(dropped, e)
+
+			continue
+		}
+
+		last[group] = h.Time
+		kept = append(kept, e)
+	}
+
+	return kept, dropped
+}
+
+// coalesceGroup returns the key of the group of heartbeats, which can be
+// coalesced with each other.
+func coalesceGroup(h heartbeat.Heartbeat) string {
+	var branch, project string
+
+	if h.Branch != nil {
+		branch = *h.Branch
+	}
+
+	if h.Project != nil {
+		project = *h.Project
+	}
+
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%s",
+		h.Entity,
+		h.EntityType,
+		h.Category,
+		project,
+		branch,
+		h.APIKeyFingerprint,
+		h.APIURL,
+	)
+}
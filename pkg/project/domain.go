@@ -0,0 +1,58 @@
+package project
+
+import (
+	"context"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/log"
+	"github.com/optiflow-os/tracelens-cli/pkg/regex"
+)
+
+// DomainRule contains the project name and category for domain and url
+// entities matching a regular expression.
+type DomainRule struct {
+	// Category is the category assigned to matching heartbeats. Nil keeps the category.
+	Category *heartbeat.Category
+	// Project is the project name. It may reference capture groups like {0}.
+	// Empty keeps the detected project.
+	Project string
+	// Regex is the regular expression for a specific domain or url.
+	Regex regex.Regex
+}
+
+// MatchDomainRule returns the first rule matching the domain or url entity
+// and the project name with capture groups replaced. Rules go under the
+// [domain_rules] config section.
+//
+// For example:
+//
+//	[domain_rules]
+//	github.com/org/(\w+)/pull = project: {0}; category: code reviewing
+//	meet.google.com = category: meeting
+//
+// Will result in url 'https://github.com/org/api/pull/42' to have project
+// name 'api' and category 'code reviewing'.
+func MatchDomainRule(ctx context.Context, entity string, rules []DomainRule) (DomainRule, string, bool) {
+	logger := log.Extract(ctx)
+
+	for _, rule := range rules {
+		matches := rule.Regex.FindStringSubmatch(ctx, entity)
+		if len(matches) == 0 {
+			continue
+		}
+
+		if rule.Project == "" {
+			return rule, "", true
+		}
+
+		project, err := formatMatches(rule.Project, matches)
+		if err != nil {
+			logger.Errorf("error formatting %q: %s", rule.Project, err)
+			continue
+		}
+
+		return rule, project, true
+	}
+
+	return DomainRule{}, "", false
+}
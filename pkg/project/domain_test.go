@@ -0,0 +1,68 @@
+package project_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
+	"github.com/optiflow-os/tracelens-cli/pkg/project"
+	"github.com/optiflow-os/tracelens-cli/pkg/regex"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchDomainRule(t *testing.T) {
+	codeReviewing, meeting := heartbeat.CodeReviewingCategory, heartbeat.MeetingCategory
+
+	rules := []project.DomainRule{
+		{
+			Category: &codeReviewing,
+			Project:  "{0}",
+			Regex:    regex.NewRegexpWrap(regexp.MustCompile(`github\.com/org/(\w+)/pull`)),
+		},
+		{
+			Category: &meeting,
+			Regex:    regex.NewRegexpWrap(regexp.MustCompile(`meet\.google\.com`)),
+		},
+	}
+
+	tests := map[string]struct {
+		Entity          string
+		ExpectedProject string
+		ExpectedRule    project.DomainRule
+	}{
+		"url with capture group": {
+			Entity:          "https://github.com/org/billing/pull/42",
+			ExpectedProject: "billing",
+			ExpectedRule:    rules[0],
+		},
+		"domain without project": {
+			Entity:       "meet.google.com",
+			ExpectedRule: rules[1],
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rule, projectName, ok := project.MatchDomainRule(context.Background(), test.Entity, rules)
+			require.True(t, ok)
+
+			assert.Equal(t, test.ExpectedRule, rule)
+			assert.Equal(t, test.ExpectedProject, projectName)
+		})
+	}
+}
+
+func TestMatchDomainRule_NoMatch(t *testing.T) {
+	rules := []project.DomainRule{
+		{
+			Project: "{0}",
+			Regex:   regex.NewRegexpWrap(regexp.MustCompile(`github\.com/org/(\w+)/pull`)),
+		},
+	}
+
+	_, _, ok := project.MatchDomainRule(context.Background(), "https://github.com/org/billing/issues/1", rules)
+	assert.False(t, ok)
+}
@@ -30,6 +30,7 @@ func WithFiltering(config FilterConfig) heartbeat.HandleOption {
 				err := Filter(h, config)
 				if err != nil {
 					logger.Debugln(err.Error())
+					heartbeat.ReportSkipped(ctx, h, err.Error())
 
 					if h.LocalFileNeedsCleanup {
 						err = os.Remove(h.LocalFile)
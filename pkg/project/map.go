@@ -47,12 +47,7 @@ func matchPattern(ctx context.Context, fp string, patterns []MapPattern) (string
 		if pattern.Regex.MatchString(ctx, fp) {
 			matches := pattern.Regex.FindStringSubmatch(ctx, fp)
 			if len(matches) > 0 {
-				params := make([]any, len(matches[1:]))
-				for i, v := range matches[1:] {
-					params[i] = v
-				}
-
-				result, err := pyfmt.Fmt(pattern.Name, params...)
+				result, err := formatMatches(pattern.Name, matches)
 				if err != nil {
 					logger.Errorf("error formatting %q: %s", pattern.Name, err)
 					continue
@@ -66,6 +61,17 @@ func matchPattern(ctx context.Context, fp string, patterns []MapPattern) (string
 	return "", false
 }
 
+// formatMatches replaces the {0}, {1}, ... placeholders of the template with
+// the capture groups of the regex matches.
+func formatMatches(template string, matches []string) (string, error) {
+	params := make([]any, len(matches[1:]))
+	for i, v := range matches[1:] {
+		params[i] = v
+	}
+
+	return pyfmt.Fmt(template, params...)
+}
+
 // ID returns its id.
 func (Map) ID() DetectorID {
 	return MapDetector
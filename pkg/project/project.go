@@ -52,6 +52,8 @@ const (
 	SubversionDetector
 	// TfvcDetector is the detector ID for tfvc detector.
 	TfvcDetector
+	// DomainDetector is the detector ID for domain rule detector.
+	DomainDetector
 )
 
 const (
@@ -61,6 +63,7 @@ const (
 	mercurialDetectorString  = "mercurial-detector"
 	subversionDetectorString = "svn-detector"
 	tfvcDetectorString       = "tfvc-detector"
+	domainDetectorString     = "domain-rule-detector"
 )
 
 // String implements fmt.Stringer interface.
@@ -78,6 +81,8 @@ func (d DetectorID) String() string {
 		return subversionDetectorString
 	case TfvcDetector:
 		return tfvcDetectorString
+	case DomainDetector:
+		return domainDetectorString
 	default:
 		return ""
 	}
@@ -105,6 +110,11 @@ type (
 
 	// Config contains project detection configurations.
 	Config struct {
+		// DomainRules contains the project name and category per domain or url.
+		DomainRules []DomainRule
+		// DryRun obfuscates project names without writing a .wakatime-project
+		// file, so the next heartbeat gets another obfuscated name.
+		DryRun bool
 		// HideProjectNames determines if the project name should be obfuscated by matching its path.
 		HideProjectNames []regex.Regex
 		// Patterns contains the overridden project name per path.
@@ -135,8 +145,9 @@ type (
 
 // WithDetection finds the current project and branch.
 // First looks for a .wakatime-project file or project map. Second, uses the
-// --project arg. Third, try to auto-detect using a revision control repository.
-// Last, uses the --alternate-project arg.
+// --project arg. Then, domain and url entities use the [domain_rules] section.
+// Third, try to auto-detect using a revision control repository. Last, uses
+// the --alternate-project arg.
 func WithDetection(config Config) heartbeat.HandleOption {
 	return func(next heartbeat.Handle) heartbeat.Handle {
 		return func(ctx context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
@@ -145,11 +156,17 @@ func WithDetection(config Config) heartbeat.HandleOption {
 			for n, h := range hh {
 				logger.Debugf("execute project detection for: %s", h.Entity)
 
+				var (
+					result   Result
+					detector DetectorID
+				)
+
 				// first, use .wakatime-project or [projectmap] section with entity path.
 				// Then, detect with project folder. This tries to use the same project name
 				// across all IDEs instead of sometimes using alternate project when file is unsaved
-				result, detector := Detect(ctx, config.MapPatterns,
+				result, detector = Detect(ctx, config.MapPatterns,
 					DetecterArg{Filepath: h.Entity, ShouldRun: h.EntityType == heartbeat.FileType},
+					DetecterArg{Filepath: commandDir(h.Cwd), ShouldRun: h.EntityType == heartbeat.CommandType},
 					DetecterArg{Filepath: h.ProjectPathOverride, ShouldRun: true},
 				)
 
@@ -159,6 +176,20 @@ func WithDetection(config Config) heartbeat.HandleOption {
 					result.Folder = h.ProjectPathOverride
 				}
 
+				// then, domain and url entities use the [domain_rules] section
+				if h.EntityType == heartbeat.DomainType || h.EntityType == heartbeat.URLType {
+					if rule, project, ok := MatchDomainRule(ctx, h.Entity, config.DomainRules); ok {
+						if result.Project == "" && project != "" {
+							result.Project = project
+							detector = DomainDetector
+						}
+
+						if rule.Category != nil && !h.CategoryExplicit {
+							hh[n].Category = *rule.Category
+						}
+					}
+				}
+
 				// third, autodetect with revision control with entity path.
 				// Then, autodetect with project folder. This tries to use the same project name
 				// across all IDEs instead of sometimes using alternate project when file is unsaved
@@ -169,6 +200,7 @@ func WithDetection(config Config) heartbeat.HandleOption {
 						config.Submodule.MapPatterns,
 						config.ProjectFromGitRemote,
 						DetecterArg{Filepath: h.Entity, ShouldRun: h.EntityType == heartbeat.FileType},
+						DetecterArg{Filepath: commandDir(h.Cwd), ShouldRun: h.EntityType == heartbeat.CommandType},
 						DetecterArg{Filepath: h.ProjectPathOverride, ShouldRun: true},
 					)
 
@@ -196,6 +228,11 @@ func WithDetection(config Config) heartbeat.HandleOption {
 					result.Folder = filepath.Dir(h.Entity)
 				}
 
+				// commands use their working directory instead
+				if h.EntityType == heartbeat.CommandType && result.Folder == "" {
+					result.Folder = h.Cwd
+				}
+
 				if runtime.GOOS == "windows" && result.Folder != "" {
 					result.Folder = windows.FormatFilePath(result.Folder)
 				}
@@ -207,7 +244,7 @@ func WithDetection(config Config) heartbeat.HandleOption {
 					Patterns:            config.HideProjectNames,
 					ProjectPathOverride: h.ProjectPathOverride,
 				}) && result.Project != "" && detector != FileDetector {
-					result.Project = obfuscateProjectName(ctx, result.Folder)
+					result.Project = obfuscateProjectName(ctx, result.Folder, config.DryRun)
 				}
 
 				result.Folder = FormatProjectFolder(ctx, result.Folder)
@@ -230,6 +267,16 @@ func WithDetection(config Config) heartbeat.HandleOption {
 	}
 }
 
+// commandDir returns the working directory of a command entity with a trailing
+// separator, so detectors search from the directory itself instead of its parent.
+func commandDir(cwd string) string {
+	if cwd == "" || strings.HasSuffix(cwd, string(filepath.Separator)) {
+		return cwd
+	}
+
+	return cwd + string(filepath.Separator)
+}
+
 // Detect finds the current project and branch from config plugins.
 func Detect(ctx context.Context, patterns []MapPattern, args ...DetecterArg) (Result, DetectorID) {
 	logger := log.Extract(ctx)
@@ -321,7 +368,7 @@ func DetectWithRevControl(
 	return Result{}
 }
 
-func obfuscateProjectName(ctx context.Context, folder string) string {
+func obfuscateProjectName(ctx context.Context, folder string, dryRun bool) string {
 	// when folder unknown, use Unknown Project (https://github.com/optiflow-os/tracelens-cli/issues/1164)
 	if folder == "" {
 		return ""
@@ -335,6 +382,10 @@ func obfuscateProjectName(ctx context.Context, folder string) string {
 	logger := log.Extract(ctx)
 	project := generateProjectName()
 
+	if dryRun {
+		return project
+	}
+
 	err := Write(folder, project)
 	if err != nil {
 		logger.Warnf("failed to write: %s", err)
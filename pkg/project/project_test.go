@@ -509,6 +509,190 @@ func TestWithDetection_ObfuscateProject(t *testing.T) {
 	assert.FileExists(t, filepath.Join(fp, "wakatime-cli/.wakatime-project"))
 }
 
+func TestWithDetection_ObfuscateProject_DryRun(t *testing.T) {
+	fp := setupTestGitBasic(t)
+
+	entity := filepath.Join(fp, "wakatime-cli/src/pkg/file.go")
+
+	opt := project.WithDetection(project.Config{
+		DryRun:           true,
+		HideProjectNames: []regex.Regex{regex.MustCompile(".*")},
+	})
+
+	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		assert.NotEmpty(t, hh[0].Project)
+		assert.NotEqual(t, "wakatime-cli", *hh[0].Project)
+
+		return nil, nil
+	})
+
+	_, err := handle(context.Background(), []heartbeat.Heartbeat{
+		{
+			EntityType: heartbeat.FileType,
+			Entity:     entity,
+		},
+	})
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, filepath.Join(fp, "wakatime-cli/.wakatime-project"))
+}
+
+func TestWithDetection_Command(t *testing.T) {
+	fp := setupTestGitBasic(t)
+
+	ctx := context.Background()
+
+	cwd := filepath.Join(fp, "wakatime-cli")
+	projectPath := project.FormatProjectFolder(ctx, cwd)
+
+	opt := project.WithDetection(project.Config{})
+
+	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		assert.Equal(t, []heartbeat.Heartbeat{
+			{
+				Branch:      heartbeat.PointerTo("master"),
+				Cwd:         cwd,
+				Entity:      "go test ./...",
+				EntityType:  heartbeat.CommandType,
+				Project:     heartbeat.PointerTo("wakatime-cli"),
+				ProjectPath: projectPath,
+			},
+		}, hh)
+
+		return nil, nil
+	})
+
+	_, err := handle(ctx, []heartbeat.Heartbeat{
+		{
+			Cwd:        cwd,
+			Entity:     "go test ./...",
+			EntityType: heartbeat.CommandType,
+		},
+	})
+	require.NoError(t, err)
+}
+
+func TestWithDetection_ProjectFolderIsRepoRoot(t *testing.T) {
+	fp := setupTestGitBasic(t)
+
+	ctx := context.Background()
+
+	// shell hooks pass their working directory with a trailing separator
+	projectFolder := filepath.Join(fp, "wakatime-cli") + string(filepath.Separator)
+
+	opt := project.WithDetection(project.Config{})
+
+	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		assert.Equal(t, heartbeat.PointerTo("wakatime-cli"), hh[0].Project)
+		assert.Equal(t, heartbeat.PointerTo("master"), hh[0].Branch)
+
+		return nil, nil
+	})
+
+	_, err := handle(ctx, []heartbeat.Heartbeat{
+		{
+			Entity:              "make",
+			EntityType:          heartbeat.AppType,
+			ProjectPathOverride: projectFolder,
+		},
+	})
+	require.NoError(t, err)
+}
+
+func TestWithDetection_DomainRules(t *testing.T) {
+	codeReviewing, meeting := heartbeat.CodeReviewingCategory, heartbeat.MeetingCategory
+
+	opt := project.WithDetection(project.Config{
+		DomainRules: []project.DomainRule{
+			{
+				Category: &codeReviewing,
+				Project:  "{0}",
+				Regex:    regex.MustCompile(`(?i)github\.com/org/(\w+)/pull`),
+			},
+			{
+				Category: &meeting,
+				Regex:    regex.MustCompile(`(?i)meet\.google\.com`),
+			},
+		},
+	})
+
+	handle := opt(func(_ context.Context, hh []heartbeat.Heartbeat) ([]heartbeat.Result, error) {
+		assert.Equal(t, []heartbeat.Heartbeat{
+			{
+				Branch:     heartbeat.PointerTo(""),
+				Category:   heartbeat.CodeReviewingCategory,
+				Entity:     "https://github.com/org/billing/pull/42",
+				EntityType: heartbeat.URLType,
+				Project:    heartbeat.PointerTo("billing"),
+			},
+			{
+				Branch:           heartbeat.PointerTo(""),
+				Category:         heartbeat.BrowsingCategory,
+				CategoryExplicit: true,
+				Entity:           "https://github.com/org/billing/pull/42",
+				EntityType:       heartbeat.URLType,
+				Project:          heartbeat.PointerTo("browser"),
+				ProjectOverride:  "browser",
+			},
+			{
+				Branch:          heartbeat.PointerTo(""),
+				Category:        heartbeat.MeetingCategory,
+				Entity:          "meet.google.com",
+				EntityType:      heartbeat.DomainType,
+				Project:         heartbeat.PointerTo("browser"),
+				ProjectOverride: "browser",
+			},
+			{
+				Branch:           heartbeat.PointerTo(""),
+				Category:         heartbeat.DebuggingCategory,
+				CategoryExplicit: true,
+				Entity:           "meet.google.com",
+				EntityType:       heartbeat.DomainType,
+				Project:          heartbeat.PointerTo(""),
+			},
+			{
+				Branch:     heartbeat.PointerTo(""),
+				Entity:     "github.com",
+				EntityType: heartbeat.DomainType,
+				Project:    heartbeat.PointerTo(""),
+			},
+		}, hh)
+
+		return nil, nil
+	})
+
+	_, err := handle(context.Background(), []heartbeat.Heartbeat{
+		{
+			Entity:     "https://github.com/org/billing/pull/42",
+			EntityType: heartbeat.URLType,
+		},
+		// explicit project and category take precedence over domain rules
+		{
+			Category:         heartbeat.BrowsingCategory,
+			CategoryExplicit: true,
+			Entity:           "https://github.com/org/billing/pull/42",
+			EntityType:       heartbeat.URLType,
+			ProjectOverride:  "browser",
+		},
+		{
+			Entity:          "meet.google.com",
+			EntityType:      heartbeat.DomainType,
+			ProjectOverride: "browser",
+		},
+		{
+			Category:         heartbeat.DebuggingCategory,
+			CategoryExplicit: true,
+			Entity:           "meet.google.com",
+			EntityType:       heartbeat.DomainType,
+		},
+		{
+			Entity:     "github.com",
+			EntityType: heartbeat.DomainType,
+		},
+	})
+	require.NoError(t, err)
+}
+
 func TestDetect_FileDetected(t *testing.T) {
 	tmpDir, err := realpath.Realpath(t.TempDir())
 	require.NoError(t, err)
@@ -720,6 +904,7 @@ func detectorIDTests() map[string]project.DetectorID {
 		"mercurial-detector":    project.MercurialDetector,
 		"svn-detector":          project.SubversionDetector,
 		"tfvc-detector":         project.TfvcDetector,
+		"domain-rule-detector":  project.DomainDetector,
 	}
 }
 
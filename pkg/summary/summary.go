@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/optiflow-os/tracelens-cli/pkg/heartbeat"
 	"github.com/optiflow-os/tracelens-cli/pkg/output"
 )
 
@@ -195,7 +196,13 @@ func RenderToday(summary *Summary, hideCategories bool, out output.Output) (stri
 }
 
 func getText(summary *Summary, hideCategories bool) string {
-	if len(summary.Data.Categories) < 2 || hideCategories {
+	if hideCategories {
+		return summary.Data.GrandTotal.Text
+	}
+
+	// a single category is only shown, when it's ai coding, so ai pair-programming
+	// time can be told apart from coding time
+	if len(summary.Data.Categories) < 2 && !hasAICodingCategory(summary.Data.Categories) {
 		return summary.Data.GrandTotal.Text
 	}
 
@@ -206,3 +213,13 @@ func getText(summary *Summary, hideCategories bool) string {
 
 	return strings.Join(outputs, ", ")
 }
+
+func hasAICodingCategory(categories []Category) bool {
+	for _, category := range categories {
+		if strings.EqualFold(category.Name, heartbeat.AICodingCategory.String()) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -51,6 +51,17 @@ func TestRenderToday_OneCategory(t *testing.T) {
 	assert.Equal(t, "2 hrs 17 mins", rendered)
 }
 
+func TestRenderToday_OneCategoryAICoding(t *testing.T) {
+	s := testSummary()
+	s.Data.Categories = s.Data.Categories[:1]
+	s.Data.Categories[0].Name = "AI Coding"
+
+	rendered, err := summary.RenderToday(s, false, output.TextOutput)
+	require.NoError(t, err)
+
+	assert.Equal(t, "2 hrs 17 mins AI Coding", rendered)
+}
+
 func TestRenderToday_MultipleCategoriesHidden(t *testing.T) {
 	rendered, err := summary.RenderToday(testSummary(), true, output.TextOutput)
 	require.NoError(t, err)